@@ -1124,6 +1124,9 @@ func TestUnpackRevert(t *testing.T) {
 		{"", "", errors.New("invalid data for unpacking")},
 		{"08c379a1", "", errors.New("invalid data for unpacking")},
 		{"08c379a00000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000d72657665727420726561736f6e00000000000000000000000000000000000000", "revert reason", nil},
+		{"4e487b710000000000000000000000000000000000000000000000000000000000000000", "generic panic", nil},
+		{"4e487b710000000000000000000000000000000000000000000000000000000000000011", "arithmetic underflow or overflow", nil},
+		{"4e487b71000000000000000000000000000000000000000000000000000000000000ff00", "unknown panic code: 0xff00", nil},
 	}
 	for index, c := range cases {
 		t.Run(fmt.Sprintf("case %d", index), func(t *testing.T) {
@@ -1143,3 +1146,67 @@ func TestUnpackRevert(t *testing.T) {
 		})
 	}
 }
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+
+	const jsondata = `[
+		{"type":"error","name":"InsufficientBalance","inputs":[{"name":"available","type":"uint256"},{"name":"required","type":"uint256"}]},
+		{"type":"error","name":"Unauthorized","inputs":[{"name":"","type":"address"}]},
+		{"type":"function","name":"withdraw","inputs":[{"name":"amount","type":"uint256"}],"outputs":[]}
+	]`
+	abi, err := JSON(strings.NewReader(jsondata))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(abi.Errors) != 2 {
+		t.Fatalf("error count mismatch: have %d, want 2", len(abi.Errors))
+	}
+	balanceErr := abi.Errors["InsufficientBalance"]
+	if have, want := balanceErr.Sig, "InsufficientBalance(uint256,uint256)"; have != want {
+		t.Errorf("signature mismatch: have %q, want %q", have, want)
+	}
+	if have, want := balanceErr.String(), "error InsufficientBalance(uint256 available, uint256 required)"; have != want {
+		t.Errorf("string mismatch: have %q, want %q", have, want)
+	}
+	if have, want := abi.Errors["Unauthorized"].Inputs[0].Name, "arg0"; have != want {
+		t.Errorf("unnamed argument mismatch: have %q, want %q", have, want)
+	}
+	// Encode a revert with the error and ensure it can be looked up and decoded
+	args, _ := balanceErr.Inputs.Pack(big.NewInt(1), big.NewInt(2))
+	data := append(crypto.Keccak256([]byte(balanceErr.Sig))[:4], args...)
+
+	var id [4]byte
+	copy(id[:], data)
+	found, err := abi.ErrorByID(id)
+	if err != nil {
+		t.Fatalf("failed to look up error: %v", err)
+	}
+	if found.Name != "InsufficientBalance" {
+		t.Fatalf("error mismatch: have %s, want InsufficientBalance", found.Name)
+	}
+	values, err := found.Unpack(data)
+	if err != nil {
+		t.Fatalf("failed to unpack error: %v", err)
+	}
+	if !reflect.DeepEqual(values, []interface{}{big.NewInt(1), big.NewInt(2)}) {
+		t.Errorf("arguments mismatch: have %v", values)
+	}
+	var decoded struct {
+		Available *big.Int
+		Required  *big.Int
+	}
+	if err := found.UnpackIntoInterface(&decoded, data); err != nil {
+		t.Fatalf("failed to unpack error into struct: %v", err)
+	}
+	if decoded.Available.Int64() != 1 || decoded.Required.Int64() != 2 {
+		t.Errorf("struct mismatch: have %+v", decoded)
+	}
+	unauthorizedErr := abi.Errors["Unauthorized"]
+	if _, err := unauthorizedErr.Unpack(data); err == nil {
+		t.Error("expected error unpacking with a different selector")
+	}
+	if _, err := abi.ErrorByID([4]byte{1, 2, 3, 4}); err == nil {
+		t.Error("expected error looking up unknown selector")
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 
 	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/eip712"
 	"github.com/ethereum/go-ethereum/accounts/external"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
@@ -59,6 +60,14 @@ func NewKeyStoreTransactor(keystore *keystore.KeyStore, account accounts.Account
 			}
 			return tx.WithSignature(signer, signature)
 		},
+		TypedDataSigner: func(address common.Address, data *eip712.TypedData) ([]byte, error) {
+			if address != account.Address {
+				return nil, errors.New("not authorized to sign this account")
+			}
+			return signTypedData(data, func(hash []byte) ([]byte, error) {
+				return keystore.SignHash(account, hash)
+			})
+		},
 	}, nil
 }
 
@@ -78,7 +87,30 @@ func NewKeyedTransactor(key *ecdsa.PrivateKey) *TransactOpts {
 			}
 			return tx.WithSignature(signer, signature)
 		},
+		TypedDataSigner: func(address common.Address, data *eip712.TypedData) ([]byte, error) {
+			if address != keyAddr {
+				return nil, errors.New("not authorized to sign this account")
+			}
+			return signTypedData(data, func(hash []byte) ([]byte, error) {
+				return crypto.Sign(hash, key)
+			})
+		},
+	}
+}
+
+// signTypedData hashes EIP-712 typed data and signs it with the given function,
+// converting the V of the signature to 27 or 28 as expected by ecrecover.
+func signTypedData(data *eip712.TypedData, sign func(hash []byte) ([]byte, error)) ([]byte, error) {
+	hash, _, err := data.SigningHash()
+	if err != nil {
+		return nil, err
+	}
+	signature, err := sign(hash)
+	if err != nil {
+		return nil, err
 	}
+	signature[crypto.RecoveryIDOffset] += 27
+	return signature, nil
 }
 
 // NewClefTransactor is a utility method to easily create a transaction signer
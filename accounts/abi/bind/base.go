@@ -21,10 +21,13 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"reflect"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/eip712"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/event"
@@ -34,6 +37,11 @@ import (
 // sign the transaction before submission.
 type SignerFn func(types.Signer, common.Address, *types.Transaction) (*types.Transaction, error)
 
+// TypedDataSignerFn is a signer function callback to sign EIP-712 typed data,
+// like permits or meta-transactions, producing a signature with a V of 27 or 28
+// as expected by ecrecover.
+type TypedDataSignerFn func(common.Address, *eip712.TypedData) ([]byte, error)
+
 // CallOpts is the collection of options to fine tune a contract call request.
 type CallOpts struct {
 	Pending     bool            // Whether to operate on the pending state or the last known one
@@ -49,6 +57,8 @@ type TransactOpts struct {
 	Nonce  *big.Int       // Nonce to use for the transaction execution (nil = use pending state)
 	Signer SignerFn       // Method to use for signing the transaction (mandatory)
 
+	TypedDataSigner TypedDataSignerFn // Method to use for signing typed data (optional)
+
 	Value    *big.Int // Funds to transfer along the transaction (nil = 0 = no funds)
 	GasPrice *big.Int // Gas price to use for the transaction execution (nil = gas price oracle)
 	GasLimit uint64   // Gas limit to set for the transaction execution (0 = estimate)
@@ -56,6 +66,15 @@ type TransactOpts struct {
 	Context context.Context // Network context to support cancellation and timeouts (nil = no timeout)
 }
 
+// SignTypedData signs EIP-712 typed data on behalf of the account the options
+// transact from, e.g. a permit to be submitted by someone else.
+func (opts *TransactOpts) SignTypedData(data *eip712.TypedData) ([]byte, error) {
+	if opts.TypedDataSigner == nil {
+		return nil, errors.New("no signer to sign the typed data with")
+	}
+	return opts.TypedDataSigner(opts.From, data)
+}
+
 // FilterOpts is the collection of options to fine tune filtering for events
 // within a bound contract.
 type FilterOpts struct {
@@ -72,6 +91,42 @@ type WatchOpts struct {
 	Context context.Context // Network context to support cancellation and timeouts (nil = no timeout)
 }
 
+// RevertError is returned by calls and gas estimations of a bound contract that
+// were reverted by the EVM. Besides the raw revert data, it carries the decoded
+// revert reason of require and assert failures, or the name and arguments of the
+// custom error the contract reverted with. Custom errors registered with the
+// contract are also made available as typed Go errors via errors.As.
+type RevertError struct {
+	Data   []byte        // Raw data the contract reverted with
+	Reason string        // Revert reason of an Error(string) or Panic(uint256) revert
+	Name   string        // Name of the custom error the contract reverted with
+	Args   []interface{} // Arguments of the custom error the contract reverted with
+
+	typed error // Registered Go error type populated with the arguments
+	err   error // Original error returned by the backend
+}
+
+// Error implements error, describing the decoded revert if possible.
+func (e *RevertError) Error() string {
+	switch {
+	case e.typed != nil:
+		return fmt.Sprintf("execution reverted: %v", e.typed)
+	case e.Name != "":
+		return fmt.Sprintf("execution reverted: %s%v", e.Name, e.Args)
+	default:
+		return e.err.Error()
+	}
+}
+
+// Unwrap returns the typed custom error if the contract reverted with one that
+// has been registered, or the original error returned by the backend otherwise.
+func (e *RevertError) Unwrap() error {
+	if e.typed != nil {
+		return e.typed
+	}
+	return e.err
+}
+
 // BoundContract is the base wrapper object that reflects a contract on the
 // Ethereum network. It contains a collection of methods that are used by the
 // higher level contract bindings to operate.
@@ -81,6 +136,8 @@ type BoundContract struct {
 	caller     ContractCaller     // Read interface to interact with the blockchain
 	transactor ContractTransactor // Write interface to interact with the blockchain
 	filterer   ContractFilterer   // Event filtering to interact with the blockchain
+
+	errors map[string]reflect.Type // Go types of the registered custom errors, by name
 }
 
 // NewBoundContract creates a low level contract interface through which calls
@@ -95,6 +152,69 @@ func NewBoundContract(address common.Address, abi abi.ABI, caller ContractCaller
 	}
 }
 
+// RegisterError associates a custom error of the contract ABI with a Go error
+// type, which reverts with the error are decoded into. The given value must be
+// a pointer to a struct whose fields match the arguments of the error by name,
+// like the ones generated by abigen.
+func (c *BoundContract) RegisterError(name string, typ error) {
+	rtyp := reflect.TypeOf(typ)
+	if rtyp == nil || rtyp.Kind() != reflect.Ptr || rtyp.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("bind: error type %T is not a struct pointer", typ))
+	}
+	if c.errors == nil {
+		c.errors = make(map[string]reflect.Type)
+	}
+	c.errors[name] = rtyp.Elem()
+}
+
+// unpackRevert decodes the revert data carried by an error returned from the
+// backend into a RevertError. Any other error is returned unchanged.
+func (c *BoundContract) unpackRevert(err error) error {
+	var dataErr interface {
+		ErrorCode() int
+		ErrorData() interface{}
+	}
+	if !errors.As(err, &dataErr) || dataErr.ErrorCode() != 3 {
+		return err
+	}
+	hex, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return err
+	}
+	data, decErr := hexutil.Decode(hex)
+	if decErr != nil {
+		return err
+	}
+	revert := &RevertError{Data: data, err: err}
+	if reason, unpackErr := abi.UnpackRevert(data); unpackErr == nil {
+		revert.Reason = reason
+		return revert
+	}
+	if len(data) < 4 {
+		return revert
+	}
+	var id [4]byte
+	copy(id[:], data)
+
+	custom, lookupErr := c.abi.ErrorByID(id)
+	if lookupErr != nil {
+		return revert
+	}
+	args, unpackErr := custom.Unpack(data)
+	if unpackErr != nil {
+		return revert
+	}
+	revert.Name, revert.Args = custom.Name, args
+
+	if typ, ok := c.errors[custom.Name]; ok {
+		typed := reflect.New(typ)
+		if custom.UnpackIntoInterface(typed.Interface(), data) == nil {
+			revert.typed = typed.Interface().(error)
+		}
+	}
+	return revert
+}
+
 // DeployContract deploys a contract onto the Ethereum blockchain and binds the
 // deployment address with a Go wrapper.
 func DeployContract(opts *TransactOpts, abi abi.ABI, bytecode []byte, backend ContractBackend, params ...interface{}) (common.Address, *types.Transaction, *BoundContract, error) {
@@ -142,7 +262,10 @@ func (c *BoundContract) Call(opts *CallOpts, results *[]interface{}, method stri
 			return ErrNoPendingState
 		}
 		output, err = pb.PendingCallContract(ctx, msg)
-		if err == nil && len(output) == 0 {
+		if err != nil {
+			return c.unpackRevert(err)
+		}
+		if len(output) == 0 {
 			// Make sure we have a contract to operate on, and bail out otherwise.
 			if code, err = pb.PendingCodeAt(ctx, c.address); err != nil {
 				return err
@@ -152,7 +275,10 @@ func (c *BoundContract) Call(opts *CallOpts, results *[]interface{}, method stri
 		}
 	} else {
 		output, err = c.caller.CallContract(ctx, msg, opts.BlockNumber)
-		if err == nil && len(output) == 0 {
+		if err != nil {
+			return c.unpackRevert(err)
+		}
+		if len(output) == 0 {
 			// Make sure we have a contract to operate on, and bail out otherwise.
 			if code, err = c.caller.CodeAt(ctx, c.address, opts.BlockNumber); err != nil {
 				return err
@@ -240,7 +366,7 @@ func (c *BoundContract) transact(opts *TransactOpts, contract *common.Address, i
 		msg := ethereum.CallMsg{From: opts.From, To: contract, GasPrice: gasPrice, Value: value, Data: input}
 		gasLimit, err = c.transactor.EstimateGas(ensureContext(opts.Context), msg)
 		if err != nil {
-			return nil, fmt.Errorf("failed to estimate gas needed: %v", err)
+			return nil, fmt.Errorf("failed to estimate gas needed: %w", c.unpackRevert(err))
 		}
 	}
 	// Create the transaction, sign it and schedule it for execution
@@ -18,6 +18,8 @@ package bind_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math/big"
 	"reflect"
 	"strings"
@@ -255,3 +257,89 @@ func newMockLog(topics []common.Hash, txHash common.Hash) types.Log {
 		Removed:     false,
 	}
 }
+
+// revertError mimics the error returned by the backends for reverted calls.
+type revertError struct {
+	data string
+}
+
+func (e *revertError) Error() string          { return "execution reverted" }
+func (e *revertError) ErrorCode() int         { return 3 }
+func (e *revertError) ErrorData() interface{} { return e.data }
+
+// revertCaller is a contract caller whose calls all revert with the given data.
+type revertCaller struct {
+	mockCaller
+	data []byte
+}
+
+func (rc *revertCaller) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return nil, &revertError{data: hexutil.Encode(rc.data)}
+}
+
+// insufficientBalance is a Go type for a custom error as generated by abigen.
+type insufficientBalance struct {
+	Available *big.Int
+	Required  *big.Int
+}
+
+func (e *insufficientBalance) Error() string {
+	return fmt.Sprintf("InsufficientBalance(%v, %v)", e.Available, e.Required)
+}
+
+func TestCallRevertErrors(t *testing.T) {
+	abiString := `[
+		{"type":"function","name":"withdraw","inputs":[],"outputs":[]},
+		{"type":"error","name":"InsufficientBalance","inputs":[{"name":"available","type":"uint256"},{"name":"required","type":"uint256"}]},
+		{"type":"error","name":"Unauthorized","inputs":[{"name":"","type":"address"}]}
+	]`
+	parsedAbi, err := abi.JSON(strings.NewReader(abiString))
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(data []byte) *bind.RevertError {
+		bc := bind.NewBoundContract(common.Address{}, parsedAbi, &revertCaller{data: data}, nil, nil)
+		bc.RegisterError("InsufficientBalance", new(insufficientBalance))
+
+		err := bc.Call(nil, nil, "withdraw")
+		var revert *bind.RevertError
+		if !errors.As(err, &revert) {
+			t.Fatalf("expected revert error, got %v", err)
+		}
+		return revert
+	}
+	// Revert reasons and panics are decoded into the reason
+	reason := call(common.FromHex("0x08c379a00000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000d72657665727420726561736f6e00000000000000000000000000000000000000"))
+	if reason.Reason != "revert reason" {
+		t.Errorf("revert reason mismatch: have %q, want %q", reason.Reason, "revert reason")
+	}
+	panicked := call(common.FromHex("0x4e487b710000000000000000000000000000000000000000000000000000000000000001"))
+	if panicked.Reason != "assert(false)" {
+		t.Errorf("panic reason mismatch: have %q, want %q", panicked.Reason, "assert(false)")
+	}
+	// Registered custom errors are decoded into their Go types
+	balanceErr := parsedAbi.Errors["InsufficientBalance"]
+	args, _ := balanceErr.Inputs.Pack(big.NewInt(1), big.NewInt(2))
+	revert := call(append(common.CopyBytes(balanceErr.ID[:4]), args...))
+
+	var typed *insufficientBalance
+	if !errors.As(revert, &typed) {
+		t.Fatalf("expected typed error, got %v", revert)
+	}
+	if typed.Available.Int64() != 1 || typed.Required.Int64() != 2 {
+		t.Errorf("typed error mismatch: have %+v", typed)
+	}
+	if have, want := revert.Error(), "execution reverted: InsufficientBalance(1, 2)"; have != want {
+		t.Errorf("error message mismatch: have %q, want %q", have, want)
+	}
+	// Unregistered custom errors are still decoded by name and arguments
+	unauthorizedErr := parsedAbi.Errors["Unauthorized"]
+	args, _ = unauthorizedErr.Inputs.Pack(common.HexToAddress("0x01"))
+	revert = call(append(common.CopyBytes(unauthorizedErr.ID[:4]), args...))
+	if revert.Name != "Unauthorized" || !reflect.DeepEqual(revert.Args, []interface{}{common.HexToAddress("0x01")}) {
+		t.Errorf("custom error mismatch: have %s%v", revert.Name, revert.Args)
+	}
+	if errors.As(revert, &typed) {
+		t.Errorf("unexpected typed error for unregistered custom error")
+	}
+}
@@ -77,6 +77,7 @@ func Bind(types []string, abis []string, bytecodes []string, fsigs []map[string]
 			calls     = make(map[string]*tmplMethod)
 			transacts = make(map[string]*tmplMethod)
 			events    = make(map[string]*tmplEvent)
+			errs      = make(map[string]*tmplError)
 			fallback  *tmplMethod
 			receive   *tmplMethod
 
@@ -158,6 +159,32 @@ func Bind(types []string, abis []string, bytecodes []string, fsigs []map[string]
 			// Append the event to the accumulator list
 			events[original.Name] = &tmplEvent{Original: original, Normalized: normalized}
 		}
+		for _, original := range evmABI.Errors {
+			// Normalize the error for capital cases and non-anonymous arguments
+			normalized := original
+
+			// Ensure there is no duplicated identifier, errors share the type
+			// namespace with the events of the contract
+			normalizedName := methodNormalizer[lang](alias(aliases, original.Name))
+			if eventIdentifiers[normalizedName] {
+				return "", fmt.Errorf("duplicated identifier \"%s\"(normalized \"%s\"), use --alias for renaming", original.Name, normalizedName)
+			}
+			eventIdentifiers[normalizedName] = true
+			normalized.Name = normalizedName
+
+			normalized.Inputs = make([]abi.Argument, len(original.Inputs))
+			copy(normalized.Inputs, original.Inputs)
+			for j, input := range normalized.Inputs {
+				if input.Name == "" {
+					normalized.Inputs[j].Name = fmt.Sprintf("arg%d", j)
+				}
+				if hasStruct(input.Type) {
+					bindStructType[lang](input.Type, structs)
+				}
+			}
+			// Append the error to the accumulator list
+			errs[original.Name] = &tmplError{Original: original, Normalized: normalized}
+		}
 		// Add two special fallback functions if they exist
 		if evmABI.HasFallback() {
 			fallback = &tmplMethod{Original: evmABI.Fallback}
@@ -180,6 +207,7 @@ func Bind(types []string, abis []string, bytecodes []string, fsigs []map[string]
 			Fallback:    fallback,
 			Receive:     receive,
 			Events:      events,
+			Errors:      errs,
 			Libraries:   make(map[string]string),
 		}
 		// Function 4-byte signatures are stored in the same sequence
@@ -428,15 +456,16 @@ func bindStructTypeGo(kind abi.Type, structs map[string]*tmplStruct) string {
 		var fields []*tmplField
 		for i, elem := range kind.TupleElems {
 			field := bindStructTypeGo(*elem, structs)
-			fields = append(fields, &tmplField{Type: field, Name: capitalise(kind.TupleRawNames[i]), SolKind: *elem})
+			fields = append(fields, &tmplField{Type: field, Name: capitalise(kind.TupleRawNames[i]), SolKind: *elem, Tag: typedDataTag(kind.TupleRawNames[i], *elem)})
 		}
 		name := kind.TupleRawName
 		if name == "" {
 			name = fmt.Sprintf("Struct%d", len(structs))
 		}
 		structs[id] = &tmplStruct{
-			Name:   name,
-			Fields: fields,
+			Name:     name,
+			TypeName: kind.TupleStructName,
+			Fields:   fields,
 		}
 		return name
 	case abi.ArrayTy:
@@ -448,6 +477,19 @@ func bindStructTypeGo(kind abi.Type, structs map[string]*tmplStruct) string {
 	}
 }
 
+// typedDataTag returns the Go struct tag mapping a struct field to its EIP-712
+// member. The type of nested structs is left to be derived from the Go type.
+func typedDataTag(name string, kind abi.Type) string {
+	elem := kind
+	for elem.T == abi.SliceTy || elem.T == abi.ArrayTy {
+		elem = *elem.Elem
+	}
+	if elem.T == abi.TupleTy {
+		return fmt.Sprintf("`eip712:\"%s\"`", name)
+	}
+	return fmt.Sprintf("`eip712:\"%s,%s\"`", name, kind.String())
+}
+
 // bindStructTypeJava converts a Solidity tuple type to a Java one and records the mapping
 // in the given map.
 // Notably, this function will resolve and record nested struct recursively.
@@ -975,6 +975,67 @@ var bindTests = []struct {
 				t.Fatalf("unsubscribed simple event arrived: %v", event)
 			case <-time.After(250 * time.Millisecond):
 			}
+			// Follow the simple events of one sender, including past ones
+			updates := make(chan *EventerSimpleEventUpdate)
+			opts := &bind.FollowOpts{Start: 1, Confirmations: 2, PollInterval: 10 * time.Millisecond}
+			fsub, err := eventer.FollowSimpleEvent(opts, updates, []common.Address{{3}}, nil, nil)
+			if err != nil {
+				t.Fatalf("failed to follow simple events: %v", err)
+			}
+			defer fsub.Unsubscribe()
+
+			expect := func(kind bind.LogEventKind, value uint64) {
+				select {
+				case update := <-updates:
+					if update.Kind != kind || update.Event.Value.Uint64() != value || update.Event.Addr != (common.Address{3}) {
+						t.Fatalf("followed event mismatch: have %v %v, want %v %d", update.Kind, update.Event, kind, value)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("followed %v event %d didn't arrive", kind, value)
+				}
+			}
+			expect(bind.LogAdded, 33)
+			expect(bind.LogConfirmed, 33)
+
+			// Raise a new event, which is only confirmed after two more blocks
+			if _, err := eventer.RaiseSimpleEvent(auth, common.Address{3}, [32]byte{3}, false, big.NewInt(333)); err != nil {
+				t.Fatalf("failed to raise followed simple event: %v", err)
+			}
+			sim.Commit()
+			expect(bind.LogAdded, 333)
+
+			sim.Commit()
+			select {
+			case update := <-updates:
+				t.Fatalf("followed event confirmed too early: %v", update.Event)
+			case <-time.After(100 * time.Millisecond):
+			}
+			sim.Commit()
+			expect(bind.LogConfirmed, 333)
+			fsub.Unsubscribe()
+
+			// Stop following while an update is pending, and ensure it's redelivered
+			opts.Store = new(bind.MemoryCheckpointStore)
+			if fsub, err = eventer.FollowSimpleEvent(opts, updates, []common.Address{{3}}, nil, nil); err != nil {
+				t.Fatalf("failed to follow simple events: %v", err)
+			}
+			expect(bind.LogAdded, 33)
+			expect(bind.LogConfirmed, 33)
+			expect(bind.LogAdded, 333)
+			expect(bind.LogConfirmed, 333)
+
+			if _, err := eventer.RaiseSimpleEvent(auth, common.Address{3}, [32]byte{3}, false, big.NewInt(3333)); err != nil {
+				t.Fatalf("failed to raise followed simple event: %v", err)
+			}
+			sim.Commit()
+			time.Sleep(100 * time.Millisecond)
+			fsub.Unsubscribe()
+
+			if fsub, err = eventer.FollowSimpleEvent(opts, updates, []common.Address{{3}}, nil, nil); err != nil {
+				t.Fatalf("failed to resume following simple events: %v", err)
+			}
+			defer fsub.Unsubscribe()
+			expect(bind.LogAdded, 3333)
 		`,
 		nil,
 		nil,
@@ -1685,6 +1746,137 @@ var bindTests = []struct {
 		nil,
 		nil,
 	},
+	// Test that custom errors are generated and decoded from reverts
+	{
+		`CustomErrors`,
+		`
+		pragma solidity ^0.8.4;
+
+		contract CustomErrors {
+			error InsufficientBalance(uint256 available, uint256 required);
+
+			function balance() public view returns (uint256) {
+				revert InsufficientBalance(1, 2);
+			}
+		}
+		`,
+		[]string{"6050600c60003960506000f36044600c60003960446000fdcf47918100000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002"},
+		[]string{`[{"inputs":[{"internalType":"uint256","name":"available","type":"uint256"},{"internalType":"uint256","name":"required","type":"uint256"}],"name":"InsufficientBalance","type":"error"},{"inputs":[],"name":"balance","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"stateMutability":"view","type":"function"}]`},
+		`
+			"errors"
+			"math/big"
+
+			"github.com/ethereum/go-ethereum/accounts/abi/bind"
+			"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+			"github.com/ethereum/go-ethereum/core"
+			"github.com/ethereum/go-ethereum/crypto"
+		`,
+		`
+			key, _ := crypto.GenerateKey()
+			addr := crypto.PubkeyToAddress(key.PublicKey)
+
+			sim := backends.NewSimulatedBackend(core.GenesisAlloc{addr: {Balance: big.NewInt(1000000000)}}, 10000000)
+			defer sim.Close()
+
+			_, _, c, err := DeployCustomErrors(bind.NewKeyedTransactor(key), sim)
+			if err != nil {
+				t.Fatalf("Failed to deploy contract: %v", err)
+			}
+			sim.Commit()
+
+			_, err = c.Balance(nil)
+
+			var typed *CustomErrorsInsufficientBalance
+			if !errors.As(err, &typed) {
+				t.Fatalf("Expected typed custom error, got %v", err)
+			}
+			if typed.Available.Uint64() != 1 || typed.Required.Uint64() != 2 {
+				t.Fatalf("Custom error arguments mismatch: have %v", typed)
+			}
+			var revert *bind.RevertError
+			if !errors.As(err, &revert) || revert.Name != "InsufficientBalance" {
+				t.Fatalf("Expected revert error, got %v", err)
+			}
+			if have, want := err.Error(), "execution reverted: InsufficientBalance(1, 2)"; have != want {
+				t.Fatalf("Error message mismatch: have %q, want %q", have, want)
+			}
+		`,
+		nil,
+		nil,
+		nil,
+		nil,
+	},
+	// Test that structs can be turned into EIP-712 typed data and signed
+	{
+		`TypedData`,
+		`
+		pragma solidity ^0.8.0;
+		pragma abicoder v2;
+
+		contract TypedData {
+			struct Permit {
+				address owner;
+				address spender;
+				uint96 value;
+				bytes32[] tags;
+			}
+			function permit(Permit memory p, bytes memory signature) public {}
+		}
+		`,
+		[]string{""},
+		[]string{`[{"inputs":[{"components":[{"internalType":"address","name":"owner","type":"address"},{"internalType":"address","name":"spender","type":"address"},{"internalType":"uint96","name":"value","type":"uint96"},{"internalType":"bytes32[]","name":"tags","type":"bytes32[]"}],"internalType":"struct TypedData.Permit","name":"p","type":"tuple"},{"internalType":"bytes","name":"signature","type":"bytes"}],"name":"permit","outputs":[],"stateMutability":"nonpayable","type":"function"}]`},
+		`
+			"math/big"
+
+			"github.com/ethereum/go-ethereum/accounts/abi/bind"
+			"github.com/ethereum/go-ethereum/accounts/abi/eip712"
+			"github.com/ethereum/go-ethereum/common"
+			"github.com/ethereum/go-ethereum/common/math"
+			"github.com/ethereum/go-ethereum/crypto"
+		`,
+		`
+			key, _ := crypto.GenerateKey()
+			opts := bind.NewKeyedTransactor(key)
+
+			permit := &TypedDataPermit{
+				Owner:   opts.From,
+				Spender: common.HexToAddress("0x01"),
+				Value:   big.NewInt(1000),
+				Tags:    [][32]byte{{1}, {2}},
+			}
+			domain := eip712.TypedDataDomain{Name: "Token", Version: "1", ChainId: math.NewHexOrDecimal256(1337)}
+			data, err := permit.ToTypedData(domain)
+			if err != nil {
+				t.Fatalf("Failed to convert struct to typed data: %v", err)
+			}
+			if data.PrimaryType != "Permit" {
+				t.Fatalf("Primary type mismatch: have %s, want Permit", data.PrimaryType)
+			}
+			if have, want := string(data.EncodeType("Permit")), "Permit(address owner,address spender,uint96 value,bytes32[] tags)"; have != want {
+				t.Fatalf("Type encoding mismatch: have %s, want %s", have, want)
+			}
+			signature, err := opts.SignTypedData(data)
+			if err != nil {
+				t.Fatalf("Failed to sign typed data: %v", err)
+			}
+			if signature[64] != 27 && signature[64] != 28 {
+				t.Fatalf("Invalid signature V: %d", signature[64])
+			}
+			hash, _, _ := data.SigningHash()
+			signature[64] -= 27
+			pubkey, err := crypto.SigToPub(hash, signature)
+			if err != nil {
+				t.Fatalf("Failed to recover signer: %v", err)
+			}
+			if signer := crypto.PubkeyToAddress(*pubkey); signer != opts.From {
+				t.Fatalf("Signer mismatch: have %x, want %x", signer, opts.From)
+			}
+		`,
+		nil,
+		nil,
+		nil,
+		nil,
+	},
 }
 
 // Tests that packages generated by the binder can be successfully compiled and
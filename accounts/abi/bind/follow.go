@@ -0,0 +1,591 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// defaultFollowPollInterval is the interval of checking for new blocks if
+	// none is specified and new head notifications are unavailable or dropped.
+	defaultFollowPollInterval = 5 * time.Second
+
+	// defaultFollowBatchSize is the maximum number of blocks to filter for logs
+	// in one go if none is specified.
+	defaultFollowBatchSize = 1000
+)
+
+// ErrNoHeaderReader is returned by FollowLogs if the backend of the contract
+// can't retrieve block headers, which are needed to track the canonical chain.
+var ErrNoHeaderReader = errors.New("backend does not support header retrieval")
+
+// errChainChanged is returned if the chain was reorganised while filtering a
+// range of blocks, so the retrieved logs can't be trusted.
+var errChainChanged = errors.New("chain reorganised during log filtering")
+
+// LogEventKind is the type of a notification of a followed log.
+type LogEventKind int
+
+const (
+	// LogAdded is sent when a log is first seen in the canonical chain.
+	LogAdded LogEventKind = iota
+
+	// LogConfirmed is sent when the block of an added log is buried under the
+	// requested number of confirmations.
+	LogConfirmed
+
+	// LogReverted is sent when the block of an added but unconfirmed log is
+	// removed from the canonical chain by a reorganisation.
+	LogReverted
+)
+
+// String implements fmt.Stringer.
+func (k LogEventKind) String() string {
+	switch k {
+	case LogAdded:
+		return "added"
+	case LogConfirmed:
+		return "confirmed"
+	case LogReverted:
+		return "reverted"
+	default:
+		return fmt.Sprintf("LogEventKind(%d)", int(k))
+	}
+}
+
+// LogEvent is a notification of a followed log. Every log is first added, and
+// then either confirmed or reverted. Reverted logs have their Removed flag set.
+type LogEvent struct {
+	Kind LogEventKind
+	Log  types.Log
+}
+
+// FollowedBlock is a block whose logs were added but not confirmed yet, tracked
+// to notice if it's reorganised out of the canonical chain.
+type FollowedBlock struct {
+	Number uint64      `json:"number"`
+	Hash   common.Hash `json:"hash"`
+	Parent common.Hash `json:"parentHash"`
+	Logs   []types.Log `json:"logs"`
+}
+
+// Checkpoint is the progress of a log follower: the first block whose logs
+// haven't been confirmed yet, along with the unconfirmed blocks from there on
+// whose logs were already added.
+type Checkpoint struct {
+	Number uint64          `json:"number"`
+	Blocks []FollowedBlock `json:"blocks"`
+}
+
+// copy returns a copy of the checkpoint which doesn't share the block list.
+func (c *Checkpoint) copy() *Checkpoint {
+	return &Checkpoint{Number: c.Number, Blocks: append([]FollowedBlock{}, c.Blocks...)}
+}
+
+// CheckpointStore persists the progress of a log follower, so that it can resume
+// after a restart without missing logs or reorganisations.
+type CheckpointStore interface {
+	// Load returns the saved checkpoint, or nil if there's none yet.
+	Load() (*Checkpoint, error)
+
+	// Save replaces the checkpoint after all notifications covered by it have
+	// been received.
+	Save(checkpoint *Checkpoint) error
+}
+
+// MemoryCheckpointStore is a CheckpointStore keeping the checkpoint in memory,
+// which allows resuming a follower within the same process.
+type MemoryCheckpointStore struct {
+	checkpoint *Checkpoint
+	lock       sync.Mutex
+}
+
+// Load implements CheckpointStore, returning the last saved checkpoint.
+func (s *MemoryCheckpointStore) Load() (*Checkpoint, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.checkpoint == nil {
+		return nil, nil
+	}
+	return s.checkpoint.copy(), nil
+}
+
+// Save implements CheckpointStore, replacing the checkpoint.
+func (s *MemoryCheckpointStore) Save(checkpoint *Checkpoint) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.checkpoint = checkpoint.copy()
+	return nil
+}
+
+// DatabaseCheckpointStore is a CheckpointStore persisting the checkpoint in a
+// key-value database under the given key.
+type DatabaseCheckpointStore struct {
+	db  ethdb.KeyValueStore
+	key []byte
+}
+
+// NewDatabaseCheckpointStore creates a checkpoint store saving into the given
+// database. Each follower needs a distinct key.
+func NewDatabaseCheckpointStore(db ethdb.KeyValueStore, key []byte) *DatabaseCheckpointStore {
+	return &DatabaseCheckpointStore{db: db, key: common.CopyBytes(key)}
+}
+
+// Load implements CheckpointStore, reading the checkpoint from the database.
+func (s *DatabaseCheckpointStore) Load() (*Checkpoint, error) {
+	has, err := s.db.Has(s.key)
+	if err != nil || !has {
+		return nil, err
+	}
+	blob, err := s.db.Get(s.key)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := new(Checkpoint)
+	if err := json.Unmarshal(blob, checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint: %v", err)
+	}
+	return checkpoint, nil
+}
+
+// Save implements CheckpointStore, writing the checkpoint into the database.
+func (s *DatabaseCheckpointStore) Save(checkpoint *Checkpoint) error {
+	blob, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(s.key, blob)
+}
+
+// FollowOpts is the collection of options to fine tune following contract
+// events in a reorg aware and resumable way.
+type FollowOpts struct {
+	Start         uint64          // Block to start following from if there's no saved checkpoint
+	Confirmations uint64          // Number of blocks on top of a log's block needed to confirm it
+	Store         CheckpointStore // Store to resume from and save the progress to (nil = don't persist)
+
+	PollInterval time.Duration // Interval of checking for new blocks (0 = 5 seconds)
+	BatchSize    uint64        // Maximum number of blocks to filter in one go (0 = 1000)
+
+	Context context.Context // Network context to support cancellation and timeouts (nil = no timeout)
+}
+
+// headSubscriber is implemented by backends that can notify about new chain
+// heads, in which case followers don't need to wait for the poll interval.
+type headSubscriber interface {
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+}
+
+// FollowLogs follows the logs of the given event, filtering for new blocks as
+// the chain progresses. Contrary to WatchLogs, it doesn't rely on a single long
+// lived subscription: ranges missed while the connection is down are filtered
+// afterwards, logs are confirmed after the requested number of blocks, and the
+// logs of blocks reorganised out before that are explicitly reverted.
+//
+// Notifications are sent on an unbuffered channel, and the checkpoint is saved
+// once the notifications covered by it have been received. Notifications received
+// but not yet processed when stopping are thus not sent again; use FollowLogsFunc
+// to save the checkpoint only after they have been processed.
+func (c *BoundContract) FollowLogs(opts *FollowOpts, name string, query ...[]interface{}) (chan LogEvent, event.Subscription, error) {
+	logs := make(chan LogEvent)
+	sub, err := c.FollowLogsFunc(opts, name, func(ctx context.Context, event LogEvent) error {
+		select {
+		case logs <- event:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, query...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return logs, sub, nil
+}
+
+// FollowLogsFunc follows the logs of the given event like FollowLogs, passing
+// the notifications to the handler one by one instead of sending them on a
+// channel. The handler must return once the given context is cancelled, and an
+// error returned by it terminates the subscription.
+//
+// New head notifications are used to speed up following if the backend supports
+// them, falling back to polling otherwise. Failing backend requests are retried,
+// only failing to save the checkpoint terminates the subscription.
+//
+// The checkpoint is saved once the handler returned for all notifications covered
+// by it. It includes the unconfirmed blocks whose logs were added, so that after
+// a restart the logs of the ones reorganised out meanwhile are reverted. All
+// notifications handled after the last save are sent again after a restart, so
+// logs are delivered at least once. With zero confirmations, logs are confirmed
+// right away and reorganisations are not tracked.
+func (c *BoundContract) FollowLogsFunc(opts *FollowOpts, name string, handler func(ctx context.Context, event LogEvent) error, query ...[]interface{}) (event.Subscription, error) {
+	// Don't crash on a lazy user
+	if opts == nil {
+		opts = new(FollowOpts)
+	}
+	headers, ok := c.filterer.(ContractHeaderReader)
+	if !ok {
+		return nil, ErrNoHeaderReader
+	}
+	// Append the event selector to the query parameters and construct the topic set
+	query = append([][]interface{}{{c.abi.Events[name].ID}}, query...)
+
+	topics, err := abi.MakeTopics(query...)
+	if err != nil {
+		return nil, err
+	}
+	f := &logFollower{
+		filterer: c.filterer,
+		headers:  headers,
+		address:  c.address,
+		topics:   topics,
+		handler:  handler,
+		confirms: opts.Confirmations,
+		store:    opts.Store,
+		interval: opts.PollInterval,
+		maxBatch: opts.BatchSize,
+		next:     opts.Start,
+	}
+	if f.interval == 0 {
+		f.interval = defaultFollowPollInterval
+	}
+	if f.maxBatch == 0 {
+		f.maxBatch = defaultFollowBatchSize
+	}
+	f.batch = f.maxBatch
+
+	if f.store != nil {
+		checkpoint, err := f.store.Load()
+		if err != nil {
+			return nil, err
+		}
+		if checkpoint != nil {
+			f.next = checkpoint.Number
+			if n := len(checkpoint.Blocks); n > 0 {
+				f.blocks = checkpoint.Blocks
+				f.next = checkpoint.Blocks[n-1].Number + 1
+			}
+		}
+	}
+	ctx := ensureContext(opts.Context)
+
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		go func() {
+			select {
+			case <-quit:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		err := f.loop(ctx)
+		select {
+		case <-quit:
+			return nil
+		default:
+			return err
+		}
+	}), nil
+}
+
+// logFollower tracks the canonical chain for the logs of an event.
+type logFollower struct {
+	filterer ContractFilterer
+	headers  ContractHeaderReader
+	address  common.Address
+	topics   [][]common.Hash
+	handler  func(context.Context, LogEvent) error
+	confirms uint64
+	store    CheckpointStore
+	interval time.Duration
+	maxBatch uint64
+
+	batch  uint64          // Number of blocks to filter next, shrunk on failures
+	next   uint64          // First block which hasn't been filtered yet
+	blocks []FollowedBlock // Filtered but unconfirmed blocks, ascending up to next
+}
+
+// loop follows the chain until the context is cancelled, or saving the checkpoint
+// or handling a notification fails.
+func (f *logFollower) loop(ctx context.Context) error {
+	var (
+		heads  = make(chan *types.Header, 1)
+		sub    ethereum.Subscription
+		subErr <-chan error
+		timer  = time.NewTimer(0)
+	)
+	defer timer.Stop()
+	defer func() {
+		if sub != nil {
+			sub.Unsubscribe()
+		}
+	}()
+	for {
+		select {
+		case <-timer.C:
+		case <-heads:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case err := <-subErr:
+			log.Debug("Log follower lost new head subscription", "err", err)
+			sub, subErr = nil, nil
+			continue
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		// Resubscribe to new heads if it was lost, filtering anything missed meanwhile
+		if sub == nil {
+			if subscriber, ok := f.filterer.(headSubscriber); ok {
+				if s, err := subscriber.SubscribeNewHead(ctx, heads); err == nil {
+					sub, subErr = s, s.Err()
+				}
+			}
+		}
+		if err := f.poll(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			var fatal *fatalError
+			if errors.As(err, &fatal) {
+				return fatal.err
+			}
+			log.Debug("Log follower failed to process new blocks", "next", f.next, "err", err)
+		}
+		timer.Reset(f.interval)
+	}
+}
+
+// fatalError wraps a failure terminating the follower instead of being retried,
+// i.e. of saving the checkpoint or of handling a notification.
+type fatalError struct{ err error }
+
+func (e *fatalError) Error() string { return e.err.Error() }
+
+// poll reverts any reorganised blocks, filters the blocks up to the current head
+// and confirms the blocks buried deep enough.
+func (f *logFollower) poll(ctx context.Context) error {
+	if err := f.unwind(ctx); err != nil {
+		return err
+	}
+	head, err := f.headers.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+	number := head.Number.Uint64()
+	for f.next <= number {
+		to := f.next + f.batch - 1
+		if to > number || to < f.next {
+			to = number
+		}
+		if err := f.filter(ctx, f.next, to, number); err != nil {
+			if f.batch > 1 {
+				f.batch /= 2
+			}
+			return err
+		}
+		if f.batch < f.maxBatch {
+			f.batch *= 2
+			if f.batch > f.maxBatch {
+				f.batch = f.maxBatch
+			}
+		}
+	}
+	return f.confirm(ctx, number)
+}
+
+// unwind reverts the followed blocks which are no longer canonical, newest first,
+// so that they get filtered again.
+func (f *logFollower) unwind(ctx context.Context) error {
+	var reverted bool
+	for len(f.blocks) > 0 {
+		last := f.blocks[len(f.blocks)-1]
+		header, err := f.header(ctx, last.Number)
+		if err != nil {
+			return err
+		}
+		if header != nil && header.Hash() == last.Hash {
+			break
+		}
+		for i := len(last.Logs) - 1; i >= 0; i-- {
+			log := last.Logs[i]
+			log.Removed = true
+			if err := f.deliver(ctx, LogEvent{Kind: LogReverted, Log: log}); err != nil {
+				return err
+			}
+		}
+		f.blocks = f.blocks[:len(f.blocks)-1]
+		f.next = last.Number
+		reverted = true
+	}
+	if !reverted {
+		return nil
+	}
+	return f.save()
+}
+
+// filter retrieves the logs of the given block range, adding them and confirming
+// the ones buried deep enough below the head.
+func (f *logFollower) filter(ctx context.Context, from, to, head uint64) error {
+	logs, err := f.filterer.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: []common.Address{f.address},
+		Topics:    f.topics,
+	})
+	if err != nil {
+		return err
+	}
+	// Retrieve the unconfirmed blocks of the range, to notice reorganisations later
+	var blocks []FollowedBlock
+	if f.confirms > 0 {
+		first := from
+		if head >= f.confirms && head-f.confirms+1 > first {
+			first = head - f.confirms + 1
+		}
+		for number := first; number <= to; number++ {
+			header, err := f.header(ctx, number)
+			if err != nil {
+				return err
+			}
+			if header == nil {
+				return errChainChanged
+			}
+			blocks = append(blocks, FollowedBlock{Number: number, Hash: header.Hash(), Parent: header.ParentHash})
+		}
+		// Ensure the blocks and logs belong to the same chain as the followed blocks
+		for i, block := range blocks {
+			var parent common.Hash
+			switch {
+			case i > 0:
+				parent = blocks[i-1].Hash
+			case len(f.blocks) > 0 && f.blocks[len(f.blocks)-1].Number+1 == block.Number:
+				parent = f.blocks[len(f.blocks)-1].Hash
+			default:
+				continue
+			}
+			if block.Parent != parent {
+				return errChainChanged
+			}
+		}
+		for _, log := range logs {
+			if len(blocks) == 0 || log.BlockNumber < blocks[0].Number {
+				continue
+			}
+			block := &blocks[log.BlockNumber-blocks[0].Number]
+			if log.BlockHash != block.Hash {
+				return errChainChanged
+			}
+			block.Logs = append(block.Logs, log)
+		}
+	}
+	for _, log := range logs {
+		if err := f.deliver(ctx, LogEvent{Kind: LogAdded, Log: log}); err != nil {
+			return err
+		}
+		if len(blocks) == 0 || log.BlockNumber < blocks[0].Number {
+			if err := f.deliver(ctx, LogEvent{Kind: LogConfirmed, Log: log}); err != nil {
+				return err
+			}
+		}
+	}
+	f.blocks = append(f.blocks, blocks...)
+	f.next = to + 1
+
+	return f.save()
+}
+
+// confirm notifies about the logs of the followed blocks that are buried deep
+// enough below the head, and stops tracking them.
+func (f *logFollower) confirm(ctx context.Context, head uint64) error {
+	confirmed := 0
+	for _, block := range f.blocks {
+		if block.Number+f.confirms > head {
+			break
+		}
+		for _, log := range block.Logs {
+			if err := f.deliver(ctx, LogEvent{Kind: LogConfirmed, Log: log}); err != nil {
+				return err
+			}
+		}
+		confirmed++
+	}
+	if confirmed == 0 {
+		return nil
+	}
+	f.blocks = f.blocks[confirmed:]
+	return f.save()
+}
+
+// save persists the progress of the follower, i.e. the first unconfirmed block
+// along with the followed blocks from there on.
+func (f *logFollower) save() error {
+	if f.store == nil {
+		return nil
+	}
+	checkpoint := &Checkpoint{Number: f.next, Blocks: f.blocks}
+	if len(f.blocks) > 0 {
+		checkpoint.Number = f.blocks[0].Number
+	}
+	if err := f.store.Save(checkpoint); err != nil {
+		return &fatalError{err}
+	}
+	return nil
+}
+
+// header retrieves a canonical header by number, returning nil if the chain is
+// shorter.
+func (f *logFollower) header(ctx context.Context, number uint64) (*types.Header, error) {
+	header, err := f.headers.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+	if errors.Is(err, ethereum.NotFound) {
+		return nil, nil
+	}
+	return header, err
+}
+
+// deliver passes a notification to the handler. Failures other than the context
+// being cancelled are fatal, as the notification can't be skipped.
+func (f *logFollower) deliver(ctx context.Context, event LogEvent) error {
+	if err := f.handler(ctx, event); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &fatalError{err}
+	}
+	return nil
+}
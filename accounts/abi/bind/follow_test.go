@@ -0,0 +1,333 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const pingABI = `[{"anonymous":false,"inputs":[{"indexed":false,"name":"value","type":"uint256"}],"name":"Ping","type":"event"}]`
+
+// mockChain is a contract backend serving logs from a chain that can be rewound
+// and extended, to simulate reorganisations.
+type mockChain struct {
+	event   common.Hash
+	headers []*types.Header
+	logs    map[common.Hash][]types.Log
+	fails   int // Number of upcoming log filterings to fail
+	lock    sync.Mutex
+}
+
+func newMockChain(event common.Hash) *mockChain {
+	return &mockChain{
+		event:   event,
+		headers: []*types.Header{{Number: big.NewInt(0)}},
+		logs:    make(map[common.Hash][]types.Log),
+	}
+}
+
+// push extends the chain with a block of the given fork, optionally with a log.
+func (c *mockChain) push(fork byte, ping bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	parent := c.headers[len(c.headers)-1]
+	header := &types.Header{
+		Number:     big.NewInt(int64(len(c.headers))),
+		ParentHash: parent.Hash(),
+		Extra:      []byte{fork},
+	}
+	c.headers = append(c.headers, header)
+	if ping {
+		c.logs[header.Hash()] = []types.Log{{
+			Topics:      []common.Hash{c.event},
+			Data:        common.LeftPadBytes(header.Number.Bytes(), 32),
+			BlockNumber: header.Number.Uint64(),
+			BlockHash:   header.Hash(),
+		}}
+	}
+}
+
+// rewind drops all blocks above the given one.
+func (c *mockChain) rewind(number int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.headers = c.headers[:number+1]
+}
+
+func (c *mockChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if number == nil {
+		return c.headers[len(c.headers)-1], nil
+	}
+	if number.Uint64() >= uint64(len(c.headers)) {
+		return nil, ethereum.NotFound
+	}
+	return c.headers[number.Uint64()], nil
+}
+
+func (c *mockChain) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.fails > 0 {
+		c.fails--
+		return nil, errors.New("connection lost")
+	}
+	var logs []types.Log
+	for n := query.FromBlock.Uint64(); n <= query.ToBlock.Uint64() && n < uint64(len(c.headers)); n++ {
+		logs = append(logs, c.logs[c.headers[n].Hash()]...)
+	}
+	return logs, nil
+}
+
+func (c *mockChain) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return nil, errors.New("not supported")
+}
+
+// expectLogEvent waits for the next followed log notification and checks it.
+func expectLogEvent(t *testing.T, logs chan bind.LogEvent, kind bind.LogEventKind, number uint64) {
+	t.Helper()
+
+	select {
+	case ev := <-logs:
+		if ev.Kind != kind || ev.Log.BlockNumber != number {
+			t.Fatalf("notification mismatch: have %v log of block %d, want %v log of block %d", ev.Kind, ev.Log.BlockNumber, kind, number)
+		}
+		if ev.Log.Removed != (kind == bind.LogReverted) {
+			t.Fatalf("removed flag mismatch for %v log: have %v", kind, ev.Log.Removed)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting for %v log of block %d", kind, number)
+	}
+}
+
+// expectNoLogEvent checks that no more notifications arrive for a while.
+func expectNoLogEvent(t *testing.T, logs chan bind.LogEvent) {
+	t.Helper()
+
+	select {
+	case ev := <-logs:
+		t.Fatalf("unexpected %v log of block %d", ev.Kind, ev.Log.BlockNumber)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// Tests that followed logs are confirmed after the requested number of blocks,
+// that reorganised logs are reverted and that following resumes from the saved
+// checkpoint.
+func TestFollowLogs(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(pingABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := newMockChain(parsed.Events["Ping"].ID)
+	chain.push(0, true)
+	chain.push(0, false)
+	chain.push(0, true)
+
+	var (
+		contract = bind.NewBoundContract(common.Address{}, parsed, nil, nil, chain)
+		store    = bind.NewDatabaseCheckpointStore(rawdb.NewMemoryDatabase(), []byte("ping"))
+		opts     = &bind.FollowOpts{Confirmations: 2, Store: store, PollInterval: 10 * time.Millisecond}
+	)
+	logs, sub, err := contract.FollowLogs(opts, "Ping")
+	if err != nil {
+		t.Fatalf("failed to follow logs: %v", err)
+	}
+	expectLogEvent(t, logs, bind.LogAdded, 1)
+	expectLogEvent(t, logs, bind.LogConfirmed, 1)
+	expectLogEvent(t, logs, bind.LogAdded, 3)
+	expectNoLogEvent(t, logs)
+
+	// Replace the last block with a fork moving the log, and confirm it
+	chain.rewind(2)
+	chain.push(1, false)
+	chain.push(1, true)
+	expectLogEvent(t, logs, bind.LogReverted, 3)
+	expectLogEvent(t, logs, bind.LogAdded, 4)
+	expectNoLogEvent(t, logs)
+
+	chain.push(1, false)
+	chain.push(1, false)
+	expectLogEvent(t, logs, bind.LogConfirmed, 4)
+	expectNoLogEvent(t, logs)
+	sub.Unsubscribe()
+
+	checkpoint, err := store.Load()
+	if err != nil || checkpoint == nil {
+		t.Fatalf("failed to load checkpoint: %v", err)
+	}
+	if checkpoint.Number != 5 || len(checkpoint.Blocks) != 2 {
+		t.Fatalf("checkpoint mismatch: have %d with %d blocks, want 5 with 2 blocks", checkpoint.Number, len(checkpoint.Blocks))
+	}
+	// Resume following, ensuring confirmed logs aren't delivered again
+	logs, sub, err = contract.FollowLogs(opts, "Ping")
+	if err != nil {
+		t.Fatalf("failed to resume following logs: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	chain.push(1, true)
+	expectLogEvent(t, logs, bind.LogAdded, 7)
+	expectNoLogEvent(t, logs)
+}
+
+// Tests that the logs of unconfirmed blocks reorganised out while the follower
+// was stopped are reverted after resuming.
+func TestFollowLogsResumeReorg(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(pingABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := newMockChain(parsed.Events["Ping"].ID)
+	chain.push(0, false)
+	chain.push(0, true)
+	chain.push(0, true)
+
+	var (
+		contract = bind.NewBoundContract(common.Address{}, parsed, nil, nil, chain)
+		store    = bind.NewDatabaseCheckpointStore(rawdb.NewMemoryDatabase(), []byte("ping"))
+		opts     = &bind.FollowOpts{Confirmations: 3, Store: store, PollInterval: 10 * time.Millisecond}
+	)
+	logs, sub, err := contract.FollowLogs(opts, "Ping")
+	if err != nil {
+		t.Fatalf("failed to follow logs: %v", err)
+	}
+	expectLogEvent(t, logs, bind.LogAdded, 2)
+	expectLogEvent(t, logs, bind.LogAdded, 3)
+	expectNoLogEvent(t, logs)
+	sub.Unsubscribe()
+
+	checkpoint, err := store.Load()
+	if err != nil || checkpoint == nil {
+		t.Fatalf("failed to load checkpoint: %v", err)
+	}
+	if checkpoint.Number != 1 || len(checkpoint.Blocks) != 3 {
+		t.Fatalf("checkpoint mismatch: have %d with %d blocks, want 1 with 3 blocks", checkpoint.Number, len(checkpoint.Blocks))
+	}
+	// Replace the logs while stopped, moving one and dropping the other
+	chain.rewind(1)
+	chain.push(1, false)
+	chain.push(1, true)
+	chain.push(1, false)
+
+	logs, sub, err = contract.FollowLogs(opts, "Ping")
+	if err != nil {
+		t.Fatalf("failed to resume following logs: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	expectLogEvent(t, logs, bind.LogReverted, 3)
+	expectLogEvent(t, logs, bind.LogReverted, 2)
+	expectLogEvent(t, logs, bind.LogAdded, 3)
+	expectNoLogEvent(t, logs)
+
+	chain.push(1, false)
+	chain.push(1, false)
+	expectLogEvent(t, logs, bind.LogConfirmed, 3)
+	expectNoLogEvent(t, logs)
+}
+
+// Tests that log filtering failures are retried without missing any logs.
+func TestFollowLogsRetry(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(pingABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := newMockChain(parsed.Events["Ping"].ID)
+	for i := 0; i < 5; i++ {
+		chain.push(0, true)
+	}
+	chain.fails = 3
+
+	contract := bind.NewBoundContract(common.Address{}, parsed, nil, nil, chain)
+	logs, sub, err := contract.FollowLogs(&bind.FollowOpts{Start: 1, PollInterval: 10 * time.Millisecond, BatchSize: 2}, "Ping")
+	if err != nil {
+		t.Fatalf("failed to follow logs: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	for number := uint64(1); number <= 5; number++ {
+		expectLogEvent(t, logs, bind.LogAdded, number)
+		expectLogEvent(t, logs, bind.LogConfirmed, number)
+	}
+	expectNoLogEvent(t, logs)
+}
+
+// Tests that a failing notification handler terminates the follower, without the
+// failed notification being skipped when resuming.
+func TestFollowLogsFuncFailure(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(pingABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := newMockChain(parsed.Events["Ping"].ID)
+	chain.push(0, true)
+	chain.push(0, true)
+
+	var (
+		contract = bind.NewBoundContract(common.Address{}, parsed, nil, nil, chain)
+		opts     = &bind.FollowOpts{Start: 1, Store: new(bind.MemoryCheckpointStore), PollInterval: 10 * time.Millisecond}
+		failure  = errors.New("handler failure")
+	)
+	sub, err := contract.FollowLogsFunc(opts, "Ping", func(ctx context.Context, ev bind.LogEvent) error {
+		if ev.Log.BlockNumber == 2 {
+			return failure
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to follow logs: %v", err)
+	}
+	select {
+	case err := <-sub.Err():
+		if err != failure {
+			t.Fatalf("subscription error mismatch: have %v, want %v", err, failure)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("follower not terminated by failing handler")
+	}
+	// Resume following, the logs of the failed batch must be delivered again
+	logs, sub, err := contract.FollowLogs(opts, "Ping")
+	if err != nil {
+		t.Fatalf("failed to resume following logs: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	expectLogEvent(t, logs, bind.LogAdded, 1)
+	expectLogEvent(t, logs, bind.LogConfirmed, 1)
+	expectLogEvent(t, logs, bind.LogAdded, 2)
+	expectLogEvent(t, logs, bind.LogConfirmed, 2)
+	expectNoLogEvent(t, logs)
+}
@@ -38,6 +38,7 @@ type tmplContract struct {
 	Fallback    *tmplMethod            // Additional special fallback function
 	Receive     *tmplMethod            // Additional special receive function
 	Events      map[string]*tmplEvent  // Contract events accessors
+	Errors      map[string]*tmplError  // Contract custom errors raised on reverts
 	Libraries   map[string]string      // Same as tmplData, but filtered to only keep what the contract needs
 	Library     bool                   // Indicator whether the contract is a library
 }
@@ -57,19 +58,28 @@ type tmplEvent struct {
 	Normalized abi.Event // Normalized version of the parsed fields
 }
 
+// tmplError is a wrapper around an abi.Error that contains a few preprocessed
+// and cached data fields.
+type tmplError struct {
+	Original   abi.Error // Original error as parsed by the abi package
+	Normalized abi.Error // Normalized version of the parsed fields
+}
+
 // tmplField is a wrapper around a struct field with binding language
 // struct type definition and relative filed name.
 type tmplField struct {
 	Type    string   // Field type representation depends on target binding language
 	Name    string   // Field name converted from the raw user-defined field name
 	SolKind abi.Type // Raw abi type information
+	Tag     string   // Struct tag of the field, for Go bindings only
 }
 
 // tmplStruct is a wrapper around an abi.tuple and contains an auto-generated
 // struct name.
 type tmplStruct struct {
-	Name   string       // Auto-generated struct name(before solidity v0.5.11) or raw name.
-	Fields []*tmplField // Struct fields definition depends on the binding language.
+	Name     string       // Auto-generated struct name(before solidity v0.5.11) or raw name.
+	TypeName string       // Struct name without the defining contract, empty if unknown.
+	Fields   []*tmplField // Struct fields definition depends on the binding language.
 }
 
 // tmplSource is language to template mapping containing all the supported
@@ -88,12 +98,15 @@ const tmplSourceGo = `
 package {{.Package}}
 
 import (
+	"context"
+	"fmt"
 	"math/big"
 	"strings"
 
 	ethereum "github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/eip712"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/event"
@@ -101,10 +114,13 @@ import (
 
 // Reference imports to suppress errors if they are not otherwise used.
 var (
+	_ = context.Background
+	_ = fmt.Sprintf
 	_ = big.NewInt
 	_ = strings.NewReader
 	_ = ethereum.NotFound
 	_ = bind.Bind
+	_ = eip712.FromStruct
 	_ = common.Big1
 	_ = types.BloomLookup
 	_ = event.NewSubscription
@@ -115,7 +131,20 @@ var (
 	// {{.Name}} is an auto generated low-level Go binding around an user-defined struct.
 	type {{.Name}} struct {
 	{{range $field := .Fields}}
-	{{$field.Name}} {{$field.Type}}{{end}}
+	{{$field.Name}} {{$field.Type}} {{$field.Tag}}{{end}}
+	}
+
+	{{if .TypeName}}
+	// EIP712TypeName returns the name of the Solidity struct, which the EIP-712
+	// struct type is named after.
+	func ({{.Name}}) EIP712TypeName() string {
+		return "{{.TypeName}}"
+	}
+	{{end}}
+	// ToTypedData returns the EIP-712 typed data of the struct within the given
+	// domain, to be hashed or signed, e.g. with bind.TransactOpts.SignTypedData.
+	func (s *{{.Name}}) ToTypedData(domain eip712.TypedDataDomain) (*eip712.TypedData, error) {
+		return eip712.FromStruct(domain, s)
 	}
 {{end}}
 
@@ -149,6 +178,9 @@ var (
 		  if err != nil {
 		    return common.Address{}, nil, nil, err
 		  }
+		  {{range .Errors}}
+			contract.RegisterError("{{.Original.Name}}", new({{$contract.Type}}{{.Normalized.Name}}))
+		  {{end}}
 		  return address, tx, &{{.Type}}{ {{.Type}}Caller: {{.Type}}Caller{contract: contract}, {{.Type}}Transactor: {{.Type}}Transactor{contract: contract}, {{.Type}}Filterer: {{.Type}}Filterer{contract: contract} }, nil
 		}
 	{{end}}
@@ -254,7 +286,11 @@ var (
 	  if err != nil {
 	    return nil, err
 	  }
-	  return bind.NewBoundContract(address, parsed, caller, transactor, filterer), nil
+	  contract := bind.NewBoundContract(address, parsed, caller, transactor, filterer)
+	  {{range .Errors}}
+		contract.RegisterError("{{.Original.Name}}", new({{$contract.Type}}{{.Normalized.Name}}))
+	  {{end}}
+	  return contract, nil
 	}
 
 	// Call invokes the (constant) contract method with params as input values and
@@ -474,6 +510,13 @@ var (
 			Raw types.Log // Blockchain specific contextual infos
 		}
 
+		// {{$contract.Type}}{{.Normalized.Name}}Update is a notification of a followed {{.Normalized.Name}} event,
+		// which is first added and then either confirmed or reverted.
+		type {{$contract.Type}}{{.Normalized.Name}}Update struct {
+			Kind  bind.LogEventKind
+			Event *{{$contract.Type}}{{.Normalized.Name}}
+		}
+
 		// Filter{{.Normalized.Name}} is a free log retrieval operation binding the contract event 0x{{printf "%x" .Original.ID}}.
 		//
 		// Solidity: {{.Original.String}}
@@ -533,6 +576,33 @@ var (
 			}), nil
 		}
 
+		// Follow{{.Normalized.Name}} is a reorg aware, resumable log following operation binding the contract event 0x{{printf "%x" .Original.ID}}.
+		//
+		// Solidity: {{.Original.String}}
+		func (_{{$contract.Type}} *{{$contract.Type}}Filterer) Follow{{.Normalized.Name}}(opts *bind.FollowOpts, sink chan<- *{{$contract.Type}}{{.Normalized.Name}}Update{{range .Normalized.Inputs}}{{if .Indexed}}, {{.Name}} []{{bindtype .Type $structs}}{{end}}{{end}}) (event.Subscription, error) {
+			{{range .Normalized.Inputs}}
+			{{if .Indexed}}var {{.Name}}Rule []interface{}
+			for _, {{.Name}}Item := range {{.Name}} {
+				{{.Name}}Rule = append({{.Name}}Rule, {{.Name}}Item)
+			}{{end}}{{end}}
+
+			return _{{$contract.Type}}.contract.FollowLogsFunc(opts, "{{.Original.Name}}", func(ctx context.Context, update bind.LogEvent) error {
+				// New notification arrived, parse the event and forward to the user
+				event := new({{$contract.Type}}{{.Normalized.Name}})
+				if err := _{{$contract.Type}}.contract.UnpackLog(event, "{{.Original.Name}}", update.Log); err != nil {
+					return err
+				}
+				event.Raw = update.Log
+
+				select {
+				case sink <- &{{$contract.Type}}{{.Normalized.Name}}Update{Kind: update.Kind, Event: event}:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}{{range .Normalized.Inputs}}{{if .Indexed}}, {{.Name}}Rule{{end}}{{end}})
+		}
+
 		// Parse{{.Normalized.Name}} is a log parse operation binding the contract event 0x{{printf "%x" .Original.ID}}.
 		//
 		// Solidity: {{.Original.String}}
@@ -545,6 +615,20 @@ var (
 		}
 
  	{{end}}
+
+	{{range .Errors}}
+		// {{$contract.Type}}{{.Normalized.Name}} represents a {{.Normalized.Name}} error raised by the {{$contract.Type}} contract.
+		type {{$contract.Type}}{{.Normalized.Name}} struct { {{range .Normalized.Inputs}}
+			{{capitalise .Name}} {{bindtype .Type $structs}}; {{end}}
+		}
+
+		// Error implements the error interface, 0x{{printf "%x" (slice .Original.ID.Bytes 0 4)}}.
+		//
+		// Solidity: {{.Original.String}}
+		func (e *{{$contract.Type}}{{.Normalized.Name}}) Error() string {
+			return fmt.Sprintf("{{.Original.Name}}({{range $i, $_ := .Normalized.Inputs}}{{if $i}}, {{end}}%v{{end}})"{{range .Normalized.Inputs}}, e.{{capitalise .Name}}{{end}})
+		}
+	{{end}}
 {{end}}
 `
 
@@ -0,0 +1,364 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eip712
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+)
+
+var (
+	addressT   = reflect.TypeOf(common.Address{})
+	bigT       = reflect.TypeOf(new(big.Int))
+	typeNamerT = reflect.TypeOf((*TypeNamer)(nil)).Elem()
+)
+
+// TypeNamer is implemented by Go structs whose struct type is named differently
+// than the Go type, e.g. the bindings of Solidity structs defined in contracts,
+// which are prefixed with the contract name. The method is called on the zero
+// value of the struct.
+type TypeNamer interface {
+	EIP712TypeName() string
+}
+
+// member is a member of a struct type, along with the Go struct field holding
+// its value.
+type member struct {
+	Type
+	field  int      // Index of the Go struct field holding the value
+	fields []member // Members of the struct type of the value or its elements
+}
+
+// builder derives the struct types of typed data, collecting their definitions.
+type builder struct {
+	types   Types
+	structs map[reflect.Type][]member // Members of the Go struct types seen so far
+}
+
+// newBuilder creates a builder for typed data of the given domain.
+func newBuilder(domain TypedDataDomain) *builder {
+	return &builder{
+		types:   Types{"EIP712Domain": domain.Types()},
+		structs: make(map[reflect.Type][]member),
+	}
+}
+
+// define records the members of a struct type, ensuring they don't conflict
+// with a previous definition of the same name.
+func (b *builder) define(name string, members []member) error {
+	fields := make([]Type, len(members))
+	for i, m := range members {
+		fields[i] = m.Type
+	}
+	if prev, ok := b.types[name]; ok && !reflect.DeepEqual(prev, fields) {
+		return fmt.Errorf("conflicting definitions of struct type %s", name)
+	}
+	b.types[name] = fields
+	return nil
+}
+
+// FromStruct builds the typed data of a Go struct within the given domain. The
+// struct is the primary type, named after the Go type unless it implements
+// TypeNamer, with the exported fields as its members, named after the fields
+// with their first letter lowercased. The member types are derived from the Go
+// types:
+//
+//	common.Address        address
+//	bool, string          bool, string
+//	[]byte, [N]byte       bytes, bytesN
+//	uintN, intN           uintN, intN
+//	*big.Int              uint256
+//	structs               struct type named like the primary type
+//	slices                arrays of the element type
+//
+// Other fixed-size arrays are rejected, as only dynamic arrays can be encoded.
+// A field tag of the form `eip712:"name,type"` overrides the member name and
+// type, e.g. for *big.Int fields of other sizes, and `eip712:"-"` skips it.
+func FromStruct(domain TypedDataDomain, v interface{}) (*TypedData, error) {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("eip712: %T is not a struct", v)
+	}
+	b := newBuilder(domain)
+	members, err := b.goStruct(val.Type())
+	if err != nil {
+		return nil, err
+	}
+	message, err := encodeStruct(val, members)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedData{
+		Types:       b.types,
+		PrimaryType: structName(val.Type()),
+		Domain:      domain,
+		Message:     message,
+	}, nil
+}
+
+// goStruct derives the members of a Go struct type and defines its struct type.
+func (b *builder) goStruct(typ reflect.Type) ([]member, error) {
+	if members, ok := b.structs[typ]; ok {
+		if members == nil {
+			return nil, fmt.Errorf("eip712: recursive struct type %v", typ)
+		}
+		return members, nil
+	}
+	if typ.Name() == "" {
+		return nil, fmt.Errorf("eip712: anonymous struct type %v", typ)
+	}
+	b.structs[typ] = nil
+
+	members := []member{}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported field
+		}
+		name, kind := decapitalise(field.Name), ""
+		if tag, ok := field.Tag.Lookup("eip712"); ok {
+			if tag == "-" {
+				continue
+			}
+			parts := strings.SplitN(tag, ",", 2)
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			if len(parts) == 2 {
+				kind = parts[1]
+			}
+		}
+		derived, fields, err := b.goType(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("eip712: field %s of %v: %v", field.Name, typ, err)
+		}
+		if kind == "" {
+			kind = derived
+		}
+		members = append(members, member{Type: Type{Name: name, Type: kind}, field: i, fields: fields})
+	}
+	if err := b.define(structName(typ), members); err != nil {
+		return nil, err
+	}
+	b.structs[typ] = members
+	return members, nil
+}
+
+// goType derives the member type of a Go type, along with the members of the
+// struct type of the value or its elements.
+func (b *builder) goType(typ reflect.Type) (string, []member, error) {
+	switch typ {
+	case addressT:
+		return "address", nil, nil
+	case bigT:
+		return "uint256", nil, nil
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return "bool", nil, nil
+	case reflect.String:
+		return "string", nil, nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		return fmt.Sprintf("uint%d", typ.Bits()), nil, nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		return fmt.Sprintf("int%d", typ.Bits()), nil, nil
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			if typ.Kind() == reflect.Slice {
+				return "bytes", nil, nil
+			}
+			return fmt.Sprintf("bytes%d", typ.Len()), nil, nil
+		}
+		if typ.Kind() == reflect.Array {
+			return "", nil, fmt.Errorf("unsupported fixed-size array %v", typ)
+		}
+		elem, fields, err := b.goType(typ.Elem())
+		if err != nil {
+			return "", nil, err
+		}
+		return elem + "[]", fields, nil
+	case reflect.Struct:
+		fields, err := b.goStruct(typ)
+		return structName(typ), fields, err
+	case reflect.Ptr:
+		if typ.Elem().Kind() == reflect.Struct {
+			return b.goType(typ.Elem())
+		}
+	}
+	return "", nil, fmt.Errorf("unsupported type %v", typ)
+}
+
+// structName returns the struct type name of a Go struct type.
+func structName(typ reflect.Type) string {
+	if reflect.PtrTo(typ).Implements(typeNamerT) {
+		return reflect.New(typ).Interface().(TypeNamer).EIP712TypeName()
+	}
+	return typ.Name()
+}
+
+// FromABI builds the typed data of a value of an ABI tuple type within the given
+// domain, e.g. of a struct argument of a contract method. The tuple and nested
+// tuples must be named after their Solidity structs, as recorded by the compiler
+// in the JSON ABI, and are named without their defining contract. The value is a
+// Go struct as used by the abi package, whose fields hold the elements of the
+// tuple in order. Fixed-size arrays other than bytesN are rejected.
+func FromABI(domain TypedDataDomain, typ abi.Type, v interface{}) (*TypedData, error) {
+	if typ.T != abi.TupleTy {
+		return nil, fmt.Errorf("eip712: %v is not a tuple type", typ)
+	}
+	b := newBuilder(domain)
+	members, err := b.abiTuple(typ)
+	if err != nil {
+		return nil, err
+	}
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct || val.NumField() != len(members) {
+		return nil, fmt.Errorf("eip712: %T doesn't match tuple type %v", v, typ)
+	}
+	message, err := encodeStruct(val, members)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedData{
+		Types:       b.types,
+		PrimaryType: typ.TupleStructName,
+		Domain:      domain,
+		Message:     message,
+	}, nil
+}
+
+// abiTuple derives the members of an ABI tuple type and defines its struct type.
+func (b *builder) abiTuple(typ abi.Type) ([]member, error) {
+	if typ.TupleStructName == "" {
+		return nil, fmt.Errorf("eip712: unnamed tuple type %v", typ)
+	}
+	members := make([]member, len(typ.TupleElems))
+	for i, elem := range typ.TupleElems {
+		kind, fields, err := b.abiType(*elem)
+		if err != nil {
+			return nil, err
+		}
+		members[i] = member{Type: Type{Name: typ.TupleRawNames[i], Type: kind}, field: i, fields: fields}
+	}
+	if err := b.define(typ.TupleStructName, members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// abiType derives the member type of an ABI type, along with the members of the
+// struct type of the value or its elements.
+func (b *builder) abiType(typ abi.Type) (string, []member, error) {
+	switch typ.T {
+	case abi.TupleTy:
+		fields, err := b.abiTuple(typ)
+		return typ.TupleStructName, fields, err
+	case abi.SliceTy:
+		elem, fields, err := b.abiType(*typ.Elem)
+		if err != nil {
+			return "", nil, err
+		}
+		return elem + "[]", fields, nil
+	case abi.ArrayTy, abi.FunctionTy, abi.HashTy, abi.FixedPointTy:
+		return "", nil, fmt.Errorf("eip712: unsupported type %v", typ)
+	default:
+		return typ.String(), nil, nil
+	}
+}
+
+// encodeStruct converts a Go struct into a typed data message.
+func encodeStruct(val reflect.Value, members []member) (TypedDataMessage, error) {
+	message := make(TypedDataMessage, len(members))
+	for _, m := range members {
+		value, err := encodeValue(val.Field(m.field), m.fields)
+		if err != nil {
+			return nil, fmt.Errorf("eip712: member %s: %v", m.Name, err)
+		}
+		message[m.Name] = value
+	}
+	return message, nil
+}
+
+// encodeValue converts a Go value into its typed data message representation.
+func encodeValue(val reflect.Value, fields []member) (interface{}, error) {
+	if val.Type() == bigT {
+		if val.IsNil() {
+			return nil, errors.New("nil integer")
+		}
+		return (*math.HexOrDecimal256)(val.Interface().(*big.Int)), nil
+	}
+	if val.Type() == addressT {
+		return val.Interface().(common.Address).Hex(), nil
+	}
+	switch val.Kind() {
+	case reflect.Ptr:
+		if val.IsNil() {
+			return nil, errors.New("nil value")
+		}
+		return encodeValue(val.Elem(), fields)
+	case reflect.Bool:
+		return val.Bool(), nil
+	case reflect.String:
+		return val.String(), nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		return (*math.HexOrDecimal256)(new(big.Int).SetUint64(val.Uint())), nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		return (*math.HexOrDecimal256)(big.NewInt(val.Int())), nil
+	case reflect.Slice, reflect.Array:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			blob := make([]byte, val.Len())
+			reflect.Copy(reflect.ValueOf(blob), val)
+			return blob, nil
+		}
+		items := make([]interface{}, val.Len())
+		for i := range items {
+			item, err := encodeValue(val.Index(i), fields)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	case reflect.Struct:
+		return encodeStruct(val, fields)
+	}
+	return nil, fmt.Errorf("unsupported type %v", val.Type())
+}
+
+// decapitalise lowercases the first letter of a Go field name.
+func decapitalise(name string) string {
+	if name == "" {
+		return name
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
@@ -0,0 +1,238 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eip712
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+)
+
+// Person and Mail are the structs of the example of the EIP-712 specification.
+type Person struct {
+	Name   string
+	Wallet common.Address
+}
+
+type Mail struct {
+	From     Person
+	To       Person
+	Contents string
+}
+
+var (
+	mailDomain = TypedDataDomain{
+		Name:              "Ether Mail",
+		Version:           "1",
+		ChainId:           math.NewHexOrDecimal256(1),
+		VerifyingContract: "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC",
+	}
+	mail = Mail{
+		From:     Person{Name: "Cow", Wallet: common.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826")},
+		To:       Person{Name: "Bob", Wallet: common.HexToAddress("0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB")},
+		Contents: "Hello, Bob!",
+	}
+)
+
+// checkMail verifies the hashes of the typed data of the example mail against
+// the ones of the EIP-712 specification.
+func checkMail(t *testing.T, data *TypedData) {
+	t.Helper()
+
+	if have, want := string(data.EncodeType("Mail")), "Mail(Person from,Person to,string contents)Person(string name,address wallet)"; have != want {
+		t.Errorf("type encoding mismatch: have %s, want %s", have, want)
+	}
+	separator, err := data.DomainSeparator()
+	if err != nil {
+		t.Fatalf("failed to hash domain: %v", err)
+	}
+	if have, want := separator.String(), "0xf2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f"; have != want {
+		t.Errorf("domain separator mismatch: have %s, want %s", have, want)
+	}
+	hash, rawData, err := data.SigningHash()
+	if err != nil {
+		t.Fatalf("failed to hash typed data: %v", err)
+	}
+	if have, want := hash.String(), "0xbe609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2"; have != want {
+		t.Errorf("signing hash mismatch: have %s, want %s", have, want)
+	}
+	if len(rawData) != 66 || rawData[0] != 0x19 || rawData[1] != 0x01 {
+		t.Errorf("invalid signing preimage: %x", rawData)
+	}
+}
+
+func TestFromStruct(t *testing.T) {
+	data, err := FromStruct(mailDomain, &mail)
+	if err != nil {
+		t.Fatalf("failed to build typed data: %v", err)
+	}
+	if data.PrimaryType != "Mail" {
+		t.Errorf("primary type mismatch: have %s, want Mail", data.PrimaryType)
+	}
+	checkMail(t, data)
+}
+
+// mailerPerson and mailerMail mimic the bindings of structs defined within a
+// contract, which are named after the Solidity structs explicitly.
+type mailerPerson struct {
+	Name   string
+	Wallet common.Address
+}
+
+func (mailerPerson) EIP712TypeName() string { return "Person" }
+
+type mailerMail struct {
+	From     mailerPerson
+	To       mailerPerson
+	Contents string
+}
+
+func (*mailerMail) EIP712TypeName() string { return "Mail" }
+
+func TestFromStructTypeNamer(t *testing.T) {
+	data, err := FromStruct(mailDomain, mailerMail{
+		From:     mailerPerson(mail.From),
+		To:       mailerPerson(mail.To),
+		Contents: mail.Contents,
+	})
+	if err != nil {
+		t.Fatalf("failed to build typed data: %v", err)
+	}
+	if data.PrimaryType != "Mail" {
+		t.Errorf("primary type mismatch: have %s, want Mail", data.PrimaryType)
+	}
+	checkMail(t, data)
+}
+
+func TestFromABI(t *testing.T) {
+	parsed, err := abi.ParseHumanReadable([]string{
+		"struct Person { string name; address wallet; }",
+		"struct Mail { Person from; Person to; string contents; }",
+		"function send(Mail mail)",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := FromABI(mailDomain, parsed.Methods["send"].Inputs[0].Type, mail)
+	if err != nil {
+		t.Fatalf("failed to build typed data: %v", err)
+	}
+	checkMail(t, data)
+
+	// Structs defined within contracts are named without the contract
+	parsed, err = abi.JSON(strings.NewReader(`[{"inputs":[{"components":[
+		{"components":[{"internalType":"string","name":"name","type":"string"},{"internalType":"address","name":"wallet","type":"address"}],"internalType":"struct Mailer.Person","name":"from","type":"tuple"},
+		{"components":[{"internalType":"string","name":"name","type":"string"},{"internalType":"address","name":"wallet","type":"address"}],"internalType":"struct Mailer.Person","name":"to","type":"tuple"},
+		{"internalType":"string","name":"contents","type":"string"}
+	],"internalType":"struct Mailer.Mail","name":"mail","type":"tuple"}],"name":"send","outputs":[],"stateMutability":"nonpayable","type":"function"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err = FromABI(mailDomain, parsed.Methods["send"].Inputs[0].Type, mail); err != nil {
+		t.Fatalf("failed to build typed data: %v", err)
+	}
+	if data.PrimaryType != "Mail" {
+		t.Errorf("primary type mismatch: have %s, want Mail", data.PrimaryType)
+	}
+	checkMail(t, data)
+
+	// Tuples without struct names can't be turned into typed data
+	parsed, _ = abi.ParseHumanReadable([]string{"function send((string name, address wallet) to)"})
+	if _, err := FromABI(mailDomain, parsed.Methods["send"].Inputs[0].Type, mail.To); err == nil {
+		t.Error("expected error for unnamed tuple")
+	}
+	// Neither can tuples with fixed-size arrays
+	parsed, _ = abi.ParseHumanReadable([]string{
+		"struct Payment { uint64[2] amounts; }",
+		"function pay(Payment payment)",
+	})
+	payment := struct{ Amounts [2]uint64 }{[2]uint64{1, 2}}
+	if _, err := FromABI(mailDomain, parsed.Methods["pay"].Inputs[0].Type, payment); err == nil {
+		t.Error("expected error for fixed-size array")
+	}
+}
+
+// Permit is a permit of EIP-2612, using tags for the members.
+type Permit struct {
+	Owner    common.Address
+	Spender  common.Address
+	Value    *big.Int
+	Nonce    *big.Int
+	Deadline *big.Int `eip712:"deadline,uint64"`
+	Note     string   `eip712:"-"`
+}
+
+func TestFromStructTags(t *testing.T) {
+	permit := &Permit{
+		Owner:    common.HexToAddress("0x01"),
+		Spender:  common.HexToAddress("0x02"),
+		Value:    big.NewInt(1000),
+		Nonce:    big.NewInt(0),
+		Deadline: big.NewInt(1 << 40),
+		Note:     "ignored",
+	}
+	data, err := FromStruct(TypedDataDomain{Name: "Token", ChainId: math.NewHexOrDecimal256(1)}, permit)
+	if err != nil {
+		t.Fatalf("failed to build typed data: %v", err)
+	}
+	if have, want := string(data.EncodeType("Permit")), "Permit(address owner,address spender,uint256 value,uint256 nonce,uint64 deadline)"; have != want {
+		t.Errorf("type encoding mismatch: have %s, want %s", have, want)
+	}
+	if _, ok := data.Message["note"]; ok {
+		t.Error("skipped field included in message")
+	}
+	if _, _, err := data.SigningHash(); err != nil {
+		t.Fatalf("failed to hash typed data: %v", err)
+	}
+	// Values exceeding the tagged type must be rejected
+	permit.Deadline = new(big.Int).Lsh(common.Big1, 64)
+	if data, err = FromStruct(TypedDataDomain{Name: "Token"}, permit); err != nil {
+		t.Fatalf("failed to build typed data: %v", err)
+	}
+	if _, _, err := data.SigningHash(); err == nil || !strings.Contains(err.Error(), "uint64") {
+		t.Errorf("expected overflow error, got %v", err)
+	}
+}
+
+func TestFromStructErrors(t *testing.T) {
+	type recursive struct {
+		Inner []recursive
+	}
+	type callback struct {
+		Fn func()
+	}
+	type fixed struct {
+		Amounts [2]uint64
+	}
+	tests := []interface{}{
+		42,
+		struct{ Name string }{"anonymous"},
+		recursive{},
+		Permit{},
+		callback{},
+		fixed{},
+	}
+	for i, v := range tests {
+		if _, err := FromStruct(mailDomain, v); err == nil {
+			t.Errorf("test %d: expected error for %T", i, v)
+		}
+	}
+}
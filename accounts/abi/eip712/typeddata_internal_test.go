@@ -14,7 +14,7 @@
 // You should have received a copy of the GNU Lesser General Public License
 // along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
 
-package core
+package eip712
 
 import (
 	"bytes"
@@ -143,3 +143,16 @@ func TestParseInteger(t *testing.T) {
 		}
 	}
 }
+
+func TestPrimitiveTypeValidity(t *testing.T) {
+	for _, typ := range []string{"address", "bool[]", "string", "bytes", "bytes1", "bytes32[]", "int", "uint[]", "uint8", "uint96", "int256[]"} {
+		if !isPrimitiveTypeValid(typ) {
+			t.Errorf("type %q rejected", typ)
+		}
+	}
+	for _, typ := range []string{"", "address[2]", "bytes0", "bytes33", "bytes01", "uint0", "uint7", "uint264", "int+8", "uint08", "float"} {
+		if isPrimitiveTypeValid(typ) {
+			t.Errorf("type %q accepted", typ)
+		}
+	}
+}
@@ -17,15 +17,100 @@
 package abi
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 var (
 	errBadBool = errors.New("abi: improperly encoded boolean value")
 )
 
+// Error is a custom error defined by a contract, raised by reverting with the
+// error's selector and its abi-encoded arguments, just like a function call.
+type Error struct {
+	Name   string
+	Inputs Arguments
+	str    string
+	// Sig contains the string signature according to the ABI spec.
+	// e.g.	 error foo(uint32 a, int b) = "foo(uint32,int256)"
+	// Please note that "int" is substitute for its canonical representation "int256"
+	Sig string
+	// ID returns the canonical representation of the error's signature used by the
+	// abi definition to identify error names and types.
+	ID common.Hash
+}
+
+// NewError creates a new Error.
+// It sanitizes the input arguments to remove unnamed arguments.
+// It also precomputes the id, signature and string representation
+// of the error.
+func NewError(name string, inputs Arguments) Error {
+	names := make([]string, len(inputs))
+	types := make([]string, len(inputs))
+	for i, input := range inputs {
+		if input.Name == "" {
+			inputs[i] = Argument{
+				Name:    fmt.Sprintf("arg%d", i),
+				Indexed: input.Indexed,
+				Type:    input.Type,
+			}
+		} else {
+			inputs[i] = input
+		}
+		// string representation
+		names[i] = fmt.Sprintf("%v %v", input.Type, inputs[i].Name)
+		// sig representation
+		types[i] = input.Type.String()
+	}
+
+	str := fmt.Sprintf("error %v(%v)", name, strings.Join(names, ", "))
+	sig := fmt.Sprintf("%v(%v)", name, strings.Join(types, ","))
+	id := common.BytesToHash(crypto.Keccak256([]byte(sig)))
+
+	return Error{
+		Name:   name,
+		Inputs: inputs,
+		str:    str,
+		Sig:    sig,
+		ID:     id,
+	}
+}
+
+func (e Error) String() string {
+	return e.str
+}
+
+// Unpack decodes the arguments of the error from the revert data.
+func (e *Error) Unpack(data []byte) ([]interface{}, error) {
+	if len(data) < 4 {
+		return nil, errors.New("abi: invalid data for unpacking")
+	}
+	if !bytes.Equal(data[:4], e.ID[:4]) {
+		return nil, fmt.Errorf("abi: revert data is not a %s error", e.Name)
+	}
+	return e.Inputs.Unpack(data[4:])
+}
+
+// UnpackIntoInterface decodes the arguments of the error from the revert data
+// into the fields of the given struct, matched by name. Unlike with method
+// outputs, a single argument is also copied into the matching field.
+func (e *Error) UnpackIntoInterface(v interface{}, data []byte) error {
+	if val := reflect.ValueOf(v); val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("abi: Unpack(non-struct-pointer %T)", v)
+	}
+	values, err := e.Unpack(data)
+	if err != nil {
+		return err
+	}
+	return e.Inputs.copyTuple(v, values)
+}
+
 // formatSliceString formats the reflection kind with the given slice size
 // and returns a formatted string representation.
 func formatSliceString(kind reflect.Kind, sliceSize int) string {
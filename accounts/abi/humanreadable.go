@@ -0,0 +1,488 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package abi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// humanArgument is the JSON ABI representation of an argument parsed from a
+// human-readable declaration.
+type humanArgument struct {
+	Name         string          `json:"name"`
+	Type         string          `json:"type"`
+	InternalType string          `json:"internalType,omitempty"`
+	Components   []humanArgument `json:"components,omitempty"`
+	Indexed      bool            `json:"indexed,omitempty"`
+}
+
+// humanField is the JSON ABI representation of a function, constructor, event
+// or error parsed from a human-readable declaration.
+type humanField struct {
+	Type            string           `json:"type"`
+	Name            string           `json:"name,omitempty"`
+	Inputs          []humanArgument  `json:"inputs"`
+	Outputs         *[]humanArgument `json:"outputs,omitempty"` // Set for functions only, even if empty
+	StateMutability string           `json:"stateMutability,omitempty"`
+	Anonymous       bool             `json:"anonymous,omitempty"`
+}
+
+// humanStruct is a struct declaration of a human-readable ABI, resolved into
+// its members on first use.
+type humanStruct struct {
+	tokens    []string        // Tokens of the struct members between the braces
+	members   []humanArgument // Members of the struct, once resolved
+	resolving bool            // Whether the struct is being resolved, to detect recursion
+	resolved  bool            // Whether the struct members have been resolved
+}
+
+// ParseHumanReadable parses a contract ABI from a list of human-readable,
+// Solidity style declarations, for example:
+//
+//	function transfer(address to, uint256 amount) returns (bool)
+//	event Transfer(address indexed from, address indexed to, uint256 value)
+//	error InsufficientBalance(uint256 available, uint256 required)
+//	struct Point { uint256 x; uint256 y; }
+//	function move((uint256 x, uint256 y) from, Point to) view
+//
+// Besides those, constructor, fallback and receive declarations are accepted,
+// as are bare function signatures like transfer(address,uint256). Tuples can be
+// written as tuple(...), (...) or by referencing a declared struct by name.
+func ParseHumanReadable(declarations []string) (ABI, error) {
+	blob, err := HumanReadableToJSON(declarations)
+	if err != nil {
+		return ABI{}, err
+	}
+	return JSON(bytes.NewReader(blob))
+}
+
+// HumanReadableToJSON converts a list of human-readable declarations into the
+// JSON ABI format, for tools that only operate on JSON ABIs. The accepted syntax
+// is the one of ParseHumanReadable.
+func HumanReadableToJSON(declarations []string) ([]byte, error) {
+	var (
+		structs = make(map[string]*humanStruct)
+		decls   []int
+		tokens  = make([][]string, len(declarations))
+	)
+	// Gather the struct declarations first, as they can be referenced anywhere
+	for i, declaration := range declarations {
+		var err error
+		if tokens[i], err = tokenizeHumanReadable(declaration); err != nil {
+			return nil, fmt.Errorf("abi: invalid declaration %q: %v", declaration, err)
+		}
+		if len(tokens[i]) == 0 {
+			continue
+		}
+		if tokens[i][0] != "struct" {
+			decls = append(decls, i)
+			continue
+		}
+		p := &humanParser{tokens: tokens[i], pos: 1}
+		name, err := p.identifier()
+		if err == nil {
+			err = p.expect("{")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("abi: invalid declaration %q: %v", declaration, err)
+		}
+		start := p.pos
+		for p.pos < len(p.tokens) && p.tokens[p.pos] != "}" {
+			p.pos++
+		}
+		members := p.tokens[start:p.pos]
+		if err := p.expect("}"); err != nil {
+			return nil, fmt.Errorf("abi: invalid declaration %q: %v", declaration, err)
+		}
+		p.accept(";")
+		if err := p.end(); err != nil {
+			return nil, fmt.Errorf("abi: invalid declaration %q: %v", declaration, err)
+		}
+		if _, ok := structs[name]; ok {
+			return nil, fmt.Errorf("abi: duplicate struct %s", name)
+		}
+		structs[name] = &humanStruct{tokens: members}
+	}
+	// Parse all the other declarations into their JSON representation
+	fields := make([]humanField, 0, len(decls))
+	for _, i := range decls {
+		p := &humanParser{tokens: tokens[i], structs: structs}
+		field, err := p.declaration()
+		if err != nil {
+			return nil, fmt.Errorf("abi: invalid declaration %q: %v", declarations[i], err)
+		}
+		fields = append(fields, field)
+	}
+	return json.Marshal(fields)
+}
+
+// tokenizeHumanReadable splits a human-readable declaration into identifiers,
+// numbers and punctuation.
+func tokenizeHumanReadable(declaration string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(declaration); {
+		c := declaration[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.IndexByte("()[]{},;", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		case isHumanIdentChar(c):
+			j := i
+			for j < len(declaration) && isHumanIdentChar(declaration[j]) {
+				j++
+			}
+			tokens = append(tokens, declaration[i:j])
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+// isHumanIdentChar returns whether the character can be part of an identifier,
+// a type or an array size. Dots are permitted for library qualified structs.
+func isHumanIdentChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '$' || c == '.'
+}
+
+// humanParser is a recursive descent parser of a single tokenized declaration.
+type humanParser struct {
+	tokens  []string
+	pos     int
+	structs map[string]*humanStruct
+}
+
+// peek returns the next token without consuming it, or an empty string at the
+// end of the declaration.
+func (p *humanParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// accept consumes the next token if it matches the given one.
+func (p *humanParser) accept(token string) bool {
+	if p.peek() == token {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expect consumes the next token, failing if it doesn't match the given one.
+func (p *humanParser) expect(token string) error {
+	if !p.accept(token) {
+		return fmt.Errorf("expected %q, got %s", token, p.describe())
+	}
+	return nil
+}
+
+// end ensures all the tokens of the declaration have been consumed.
+func (p *humanParser) end() error {
+	if p.pos < len(p.tokens) {
+		return fmt.Errorf("unexpected %s", p.describe())
+	}
+	return nil
+}
+
+// describe returns a description of the next token for error messages.
+func (p *humanParser) describe() string {
+	if p.pos < len(p.tokens) {
+		return fmt.Sprintf("%q", p.tokens[p.pos])
+	}
+	return "end of declaration"
+}
+
+// isIdentifier returns whether the next token is an identifier.
+func (p *humanParser) isIdentifier() bool {
+	token := p.peek()
+	return token != "" && isHumanIdentChar(token[0]) && (token[0] < '0' || token[0] > '9')
+}
+
+// identifier consumes the next token, failing if it isn't an identifier.
+func (p *humanParser) identifier() (string, error) {
+	if !p.isIdentifier() {
+		return "", fmt.Errorf("expected identifier, got %s", p.describe())
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+// declaration parses a function, constructor, fallback, receive, event or error
+// declaration.
+func (p *humanParser) declaration() (humanField, error) {
+	var (
+		field = humanField{Inputs: []humanArgument{}}
+		err   error
+	)
+	switch kind := p.peek(); kind {
+	case "function", "event", "error":
+		p.pos++
+		field.Type = kind
+		if field.Name, err = p.identifier(); err != nil {
+			return field, err
+		}
+	case "constructor", "fallback", "receive":
+		p.pos++
+		field.Type = kind
+	default:
+		// Bare function signature, e.g. transfer(address,uint256)
+		field.Type = "function"
+		if field.Name, err = p.identifier(); err != nil {
+			return field, err
+		}
+	}
+	if field.Inputs, err = p.parameters(field.Type == "event"); err != nil {
+		return field, err
+	}
+	switch field.Type {
+	case "event":
+		field.Anonymous = p.accept("anonymous")
+
+	case "error":
+
+	default:
+		field.StateMutability = "nonpayable"
+		if field.Type == "receive" {
+			field.StateMutability = "payable"
+		}
+		if field.Type == "function" {
+			field.Outputs = &[]humanArgument{}
+		}
+		for p.pos < len(p.tokens) && p.peek() != ";" {
+			switch modifier := p.peek(); modifier {
+			case "external", "public", "internal", "private", "virtual", "override":
+				p.pos++
+			case "view", "pure", "payable", "nonpayable":
+				p.pos++
+				field.StateMutability = modifier
+			case "constant":
+				p.pos++
+				field.StateMutability = "view"
+			case "returns":
+				p.pos++
+				if field.Type != "function" {
+					return field, fmt.Errorf("%s cannot return values", field.Type)
+				}
+				outputs, err := p.parameters(false)
+				if err != nil {
+					return field, err
+				}
+				field.Outputs = &outputs
+			default:
+				return field, fmt.Errorf("unexpected %s", p.describe())
+			}
+		}
+	}
+	p.accept(";")
+	return field, p.end()
+}
+
+// parameters parses a parenthesized, comma separated list of parameters.
+func (p *humanParser) parameters(indexable bool) ([]humanArgument, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	params := []humanArgument{}
+	if p.accept(")") {
+		return params, nil
+	}
+	for {
+		param, err := p.parameter(indexable)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, param)
+		if p.accept(")") {
+			return params, nil
+		}
+		if !p.accept(",") {
+			return nil, fmt.Errorf("expected \",\" or \")\", got %s", p.describe())
+		}
+	}
+}
+
+// parameter parses a single parameter: its type, the optional indexed flag and
+// data location, followed by the optional name.
+func (p *humanParser) parameter(indexable bool) (humanArgument, error) {
+	param, err := p.typ()
+	if err != nil {
+		return param, err
+	}
+	for {
+		switch p.peek() {
+		case "indexed":
+			if !indexable {
+				return param, errors.New("only event parameters can be indexed")
+			}
+			p.pos++
+			param.Indexed = true
+			continue
+		case "memory", "calldata", "storage":
+			p.pos++
+			continue
+		}
+		break
+	}
+	if p.isIdentifier() {
+		param.Name = p.tokens[p.pos]
+		p.pos++
+	}
+	return param, nil
+}
+
+// typ parses an elementary type, a tuple or a struct reference, along with any
+// array dimensions.
+func (p *humanParser) typ() (humanArgument, error) {
+	var param humanArgument
+
+	switch {
+	case p.peek() == "(" || (p.peek() == "tuple" && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1] == "("):
+		p.accept("tuple")
+		components, err := p.parameters(false)
+		if err != nil {
+			return param, err
+		}
+		param.Type, param.Components = "tuple", components
+
+	default:
+		name, err := p.identifier()
+		if err != nil {
+			return param, err
+		}
+		if _, ok := p.structs[name]; ok {
+			components, err := p.resolveStruct(name)
+			if err != nil {
+				return param, err
+			}
+			param.Type, param.InternalType, param.Components = "tuple", "struct "+name, components
+			break
+		}
+		switch name {
+		case "uint":
+			name = "uint256"
+		case "int":
+			name = "int256"
+		case "byte":
+			name = "bytes1"
+		}
+		if name == "tuple" || strings.Contains(name, ".") {
+			return param, fmt.Errorf("unknown type %q", name)
+		}
+		if _, err := NewType(name, "", nil); err != nil {
+			return param, fmt.Errorf("unknown type %q", name)
+		}
+		param.Type = name
+	}
+	// Parse any array dimensions of the type
+	for p.accept("[") {
+		suffix := "[]"
+		if size := p.peek(); size != "" && size[0] >= '0' && size[0] <= '9' {
+			p.pos++
+			suffix = "[" + size + "]"
+		}
+		if err := p.expect("]"); err != nil {
+			return param, err
+		}
+		param.Type += suffix
+		if param.InternalType != "" {
+			param.InternalType += suffix
+		}
+	}
+	return param, nil
+}
+
+// resolveStruct parses the members of a declared struct.
+func (p *humanParser) resolveStruct(name string) ([]humanArgument, error) {
+	s := p.structs[name]
+	if s.resolved {
+		return s.members, nil
+	}
+	if s.resolving {
+		return nil, fmt.Errorf("recursive struct %s", name)
+	}
+	s.resolving = true
+	defer func() { s.resolving = false }()
+
+	members := []humanArgument{}
+	sp := &humanParser{tokens: s.tokens, structs: p.structs}
+	for sp.pos < len(sp.tokens) {
+		member, err := sp.typ()
+		if err != nil {
+			return nil, fmt.Errorf("struct %s: %v", name, err)
+		}
+		if member.Name, err = sp.identifier(); err != nil {
+			return nil, fmt.Errorf("struct %s: %v", name, err)
+		}
+		if err := sp.expect(";"); err != nil {
+			return nil, fmt.Errorf("struct %s: %v", name, err)
+		}
+		members = append(members, member)
+	}
+	s.members, s.resolved = members, true
+	return members, nil
+}
+
+// SplitHumanReadable splits a human-readable ABI document into declarations.
+// The document is either a JSON array of declaration strings, or a text with a
+// declaration per line, where blank lines and // comments are ignored and
+// declarations with unbalanced brackets continue on the following lines.
+//
+// The returned flag reports whether the document was human-readable at all, or
+// rather a JSON ABI to be parsed by JSON.
+func SplitHumanReadable(document []byte) ([]string, bool) {
+	trimmed := bytes.TrimSpace(document)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		var declarations []string
+		if err := json.Unmarshal(trimmed, &declarations); err != nil {
+			return nil, false
+		}
+		return declarations, true
+	}
+	var (
+		declarations []string
+		pending      string
+	)
+	for _, line := range strings.Split(string(trimmed), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if pending != "" {
+			line = pending + " " + line
+		}
+		if strings.Count(line, "(") > strings.Count(line, ")") || strings.Count(line, "{") > strings.Count(line, "}") {
+			pending = line
+			continue
+		}
+		declarations, pending = append(declarations, line), ""
+	}
+	if pending != "" {
+		declarations = append(declarations, pending)
+	}
+	return declarations, true
+}
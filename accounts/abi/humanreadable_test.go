@@ -0,0 +1,160 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package abi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Tests that human-readable declarations result in the same ABI as the JSON
+// definition produced by the compiler.
+func TestHumanReadableRoundTrip(t *testing.T) {
+	const jsondata = `[
+		{"type":"constructor","inputs":[{"name":"supply","type":"uint256"}],"stateMutability":"nonpayable"},
+		{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable"},
+		{"type":"function","name":"balanceOf","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}],"stateMutability":"view"},
+		{"type":"function","name":"deposit","inputs":[],"outputs":[],"stateMutability":"payable"},
+		{"type":"function","name":"move","inputs":[{"name":"from","type":"tuple","components":[{"name":"x","type":"uint256"},{"name":"y","type":"uint256"}]},{"name":"to","type":"tuple[]","internalType":"struct Point[]","components":[{"name":"x","type":"uint256"},{"name":"y","type":"uint256"}]}],"outputs":[],"stateMutability":"pure"},
+		{"type":"event","name":"Transfer","inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}],"anonymous":false},
+		{"type":"error","name":"InsufficientBalance","inputs":[{"name":"available","type":"uint256"},{"name":"required","type":"uint256"}]},
+		{"type":"fallback","stateMutability":"nonpayable"},
+		{"type":"receive","stateMutability":"payable"}
+	]`
+	want, err := JSON(strings.NewReader(jsondata))
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := ParseHumanReadable([]string{
+		"constructor(uint supply)",
+		"function transfer(address to, uint256 amount) external returns (bool)",
+		"function balanceOf(address owner) view returns (uint256)",
+		"function deposit() payable",
+		"struct Point { uint256 x; uint256 y; }",
+		"function move(tuple(uint256 x, uint256 y) from, Point[] memory to) pure",
+		"event Transfer(address indexed from, address indexed to, uint256 value)",
+		"error InsufficientBalance(uint256 available, uint256 required);",
+		"fallback() external",
+		"receive() external payable",
+	})
+	if err != nil {
+		t.Fatalf("failed to parse human-readable ABI: %v", err)
+	}
+	for name, method := range want.Methods {
+		if have.Methods[name].ID == nil || string(have.Methods[name].ID) != string(method.ID) {
+			t.Errorf("method %s: id mismatch: have %x, want %x", name, have.Methods[name].ID, method.ID)
+		}
+		if have.Methods[name].String() != method.String() {
+			t.Errorf("method %s: mismatch: have %q, want %q", name, have.Methods[name].String(), method.String())
+		}
+	}
+	if len(have.Methods) != len(want.Methods) {
+		t.Errorf("method count mismatch: have %d, want %d", len(have.Methods), len(want.Methods))
+	}
+	for name, event := range want.Events {
+		if have.Events[name].ID != event.ID || have.Events[name].String() != event.String() {
+			t.Errorf("event %s: mismatch: have %q, want %q", name, have.Events[name].String(), event.String())
+		}
+	}
+	for name, err := range want.Errors {
+		if have.Errors[name].ID != err.ID || have.Errors[name].String() != err.String() {
+			t.Errorf("error %s: mismatch: have %q, want %q", name, have.Errors[name].String(), err.String())
+		}
+	}
+	if have.Constructor.String() != want.Constructor.String() {
+		t.Errorf("constructor mismatch: have %q, want %q", have.Constructor.String(), want.Constructor.String())
+	}
+	if have.Fallback.String() != want.Fallback.String() || have.Receive.String() != want.Receive.String() {
+		t.Errorf("fallback or receive mismatch: have %q, %q", have.Fallback.String(), have.Receive.String())
+	}
+	if name := have.Methods["move"].Inputs[1].Type.Elem.TupleRawName; name != "Point" {
+		t.Errorf("struct name mismatch: have %q, want %q", name, "Point")
+	}
+}
+
+func TestHumanReadableBareSignature(t *testing.T) {
+	abi, err := ParseHumanReadable([]string{"transfer(address,uint256)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := abi.Methods["transfer"].Sig, "transfer(address,uint256)"; have != want {
+		t.Errorf("signature mismatch: have %q, want %q", have, want)
+	}
+}
+
+func TestHumanReadableErrors(t *testing.T) {
+	tests := []struct {
+		declaration string
+		err         string
+	}{
+		{"function transfer(address to, uint256 amount", `expected "," or ")", got end of declaration`},
+		{"function transfer(addres to)", `unknown type "addres"`},
+		{"function transfer(address indexed to)", "only event parameters can be indexed"},
+		{"function transfer(address to) returns bool", `expected "(", got "bool"`},
+		{"constructor() returns (bool)", "constructor cannot return values"},
+		{"event Transfer(address from) view", `unexpected "view"`},
+		{"function get(Loop l)", "recursive struct Loop"},
+		{"function foo() # bar", `unexpected character '#'`},
+	}
+	for _, tt := range tests {
+		_, err := ParseHumanReadable([]string{"struct Loop { Loop inner; }", tt.declaration})
+		if err == nil {
+			t.Errorf("%q: expected error", tt.declaration)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: error mismatch: have %q, want %q", tt.declaration, err, tt.err)
+		}
+	}
+}
+
+func TestSplitHumanReadable(t *testing.T) {
+	tests := []struct {
+		document     string
+		declarations []string
+		human        bool
+	}{
+		{
+			document:     `["function foo()", "event Bar(uint256 baz)"]`,
+			declarations: []string{"function foo()", "event Bar(uint256 baz)"},
+			human:        true,
+		},
+		{
+			document: "// Token interface\nfunction foo() // does nothing\n\nstruct Point {\n\tuint256 x;\n\tuint256 y;\n}\nevent Bar(\n\tuint256 baz\n)\n",
+			declarations: []string{
+				"function foo()",
+				"struct Point { uint256 x; uint256 y; }",
+				"event Bar( uint256 baz )",
+			},
+			human: true,
+		},
+		{
+			document: `[{"type":"function","name":"foo","inputs":[],"outputs":[]}]`,
+			human:    false,
+		},
+	}
+	for i, tt := range tests {
+		declarations, human := SplitHumanReadable([]byte(tt.document))
+		if human != tt.human {
+			t.Errorf("test %d: format mismatch: have %v, want %v", i, human, tt.human)
+		}
+		if !reflect.DeepEqual(declarations, tt.declarations) {
+			t.Errorf("test %d: declarations mismatch: have %q, want %q", i, declarations, tt.declarations)
+		}
+	}
+}
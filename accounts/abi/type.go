@@ -53,10 +53,11 @@ type Type struct {
 	stringKind string // holds the unparsed string for deriving signatures
 
 	// Tuple relative fields
-	TupleRawName  string       // Raw struct name defined in source code, may be empty.
-	TupleElems    []*Type      // Type information of all tuple fields
-	TupleRawNames []string     // Raw field name of all tuple fields
-	TupleType     reflect.Type // Underlying struct of the tuple
+	TupleRawName    string       // Raw struct name defined in source code, may be empty.
+	TupleStructName string       // Struct name without the defining contract, may be empty.
+	TupleElems      []*Type      // Type information of all tuple fields
+	TupleRawNames   []string     // Raw field name of all tuple fields
+	TupleType       reflect.Type // Underlying struct of the tuple
 }
 
 var (
@@ -201,7 +202,11 @@ func NewType(t string, internalType string, components []ArgumentMarshaling) (ty
 		if internalType != "" && strings.HasPrefix(internalType, structPrefix) {
 			// Foo.Bar type definition is not allowed in golang,
 			// convert the format to FooBar
-			typ.TupleRawName = strings.Replace(internalType[len(structPrefix):], ".", "", -1)
+			name := internalType[len(structPrefix):]
+			typ.TupleRawName = strings.Replace(name, ".", "", -1)
+
+			// The plain struct name is the last segment, e.g. Bar of Foo.Bar
+			typ.TupleStructName = name[strings.LastIndex(name, ".")+1:]
 		}
 
 	case "function":
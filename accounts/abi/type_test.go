@@ -315,10 +315,11 @@ func TestInternalType(t *testing.T) {
 		TupleType: reflect.TypeOf(struct {
 			A int64 `json:"a"`
 		}{}),
-		stringKind:    "(int64)",
-		TupleRawName:  "ab[]",
-		TupleElems:    []*Type{{T: IntTy, Size: 64, stringKind: "int64"}},
-		TupleRawNames: []string{"a"},
+		stringKind:      "(int64)",
+		TupleRawName:    "ab[]",
+		TupleStructName: "b[]",
+		TupleElems:      []*Type{{T: IntTy, Size: 64, stringKind: "int64"}},
+		TupleRawNames:   []string{"a"},
 	}
 
 	blob := "tuple"
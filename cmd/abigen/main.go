@@ -45,7 +45,7 @@ var (
 	// Flags needed by abigen
 	abiFlag = cli.StringFlag{
 		Name:  "abi",
-		Usage: "Path to the Ethereum contract ABI json to bind, - for STDIN",
+		Usage: "Path to the Ethereum contract ABI json or human-readable ABI to bind, - for STDIN",
 	}
 	binFlag = cli.StringFlag{
 		Name:  "bin",
@@ -150,19 +150,25 @@ func abigen(c *cli.Context) error {
 	if c.GlobalString(abiFlag.Name) != "" {
 		// Load up the ABI, optional bytecode and type name from the parameters
 		var (
-			abi []byte
-			err error
+			data []byte
+			err  error
 		)
 		input := c.GlobalString(abiFlag.Name)
 		if input == "-" {
-			abi, err = ioutil.ReadAll(os.Stdin)
+			data, err = ioutil.ReadAll(os.Stdin)
 		} else {
-			abi, err = ioutil.ReadFile(input)
+			data, err = ioutil.ReadFile(input)
 		}
 		if err != nil {
 			utils.Fatalf("Failed to read input ABI: %v", err)
 		}
-		abis = append(abis, string(abi))
+		// Convert human-readable ABIs into JSON, which the bindings embed
+		if declarations, ok := abi.SplitHumanReadable(data); ok {
+			if data, err = abi.HumanReadableToJSON(declarations); err != nil {
+				utils.Fatalf("Failed to parse human-readable ABI: %v", err)
+			}
+		}
+		abis = append(abis, string(data))
 
 		var bin []byte
 		if binFile := c.GlobalString(binFlag.Name); binFile != "" {
@@ -49,6 +49,7 @@ var (
 		ArgsUsage: "<genesisPath>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.StateSchemeFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
@@ -56,7 +57,10 @@ The init command initializes a new genesis block and definition for the network.
 This is a destructive action and changes the network in which you will be
 participating.
 
-It expects the genesis file as argument.`,
+It expects the genesis file as argument. The --state.scheme flag selects how the
+state trie nodes are stored: "hash" keeps every trie node keyed by its hash, while
+"path" keeps only the latest state keyed by trie path, overwriting stale nodes in
+place. The scheme can't be changed once the database is initialized.`,
 	}
 	dumpGenesisCommand = cli.Command{
 		Action:    utils.MigrateFlags(dumpGenesis),
@@ -239,6 +243,10 @@ func initGenesis(ctx *cli.Context) error {
 	if err := json.NewDecoder(file).Decode(genesis); err != nil {
 		utils.Fatalf("invalid genesis file: %v", err)
 	}
+	scheme := ctx.String(utils.StateSchemeFlag.Name)
+	if scheme != rawdb.HashScheme && scheme != rawdb.PathScheme {
+		utils.Fatalf("--%s must be either '%s' or '%s'", utils.StateSchemeFlag.Name, rawdb.HashScheme, rawdb.PathScheme)
+	}
 	// Open and initialise both full and light databases
 	stack, _ := makeConfigNode(ctx)
 	defer stack.Close()
@@ -248,6 +256,16 @@ func initGenesis(ctx *cli.Context) error {
 		if err != nil {
 			utils.Fatalf("Failed to open database: %v", err)
 		}
+		// Light clients don't store the state, only configure the full database
+		if name == "chaindata" {
+			if stored := rawdb.ReadCanonicalHash(chaindb, 0); stored != (common.Hash{}) {
+				if have := rawdb.ReadStateScheme(chaindb); ctx.IsSet(utils.StateSchemeFlag.Name) && have != scheme {
+					utils.Fatalf("Database already initialized with the %s state scheme, requested %s", have, scheme)
+				}
+			} else {
+				rawdb.WriteStateScheme(chaindb, scheme)
+			}
+		}
 		_, hash, err := core.SetupGenesisBlock(chaindb, genesis)
 		if err != nil {
 			utils.Fatalf("Failed to write genesis block: %v", err)
@@ -603,7 +621,7 @@ func inspect(ctx *cli.Context) error {
 	_, chainDb := utils.MakeChain(ctx, node, true)
 	defer chainDb.Close()
 
-	return rawdb.InspectDatabase(chainDb)
+	return rawdb.InspectDatabase(chainDb, nil, nil)
 }
 
 // hashish returns true for strings that look like hashes.
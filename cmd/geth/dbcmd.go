@@ -0,0 +1,435 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/trie"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	// dbFlags are the flags needed by all the database subcommands to locate
+	// the chain database of a stopped node.
+	dbFlags = []cli.Flag{
+		utils.DataDirFlag,
+		utils.AncientFlag,
+		utils.CacheFlag,
+		utils.RopstenFlag,
+		utils.RinkebyFlag,
+		utils.GoerliFlag,
+		utils.YoloV1Flag,
+		utils.LegacyTestnetFlag,
+		utils.SyncModeFlag,
+	}
+
+	dbCommand = cli.Command{
+		Name:      "db",
+		Usage:     "Low level database operations",
+		ArgsUsage: "",
+		Category:  "DATABASE COMMANDS",
+		Subcommands: []cli.Command{
+			dbInspectCmd,
+			dbStatCmd,
+			dbCompactCmd,
+			dbGetCmd,
+			dbPutCmd,
+			dbDeleteCmd,
+			dbDumpTrieCmd,
+			dbDumpFreezerIndex,
+			dbVerifyFreezerCmd,
+		},
+	}
+	dbInspectCmd = cli.Command{
+		Action:      utils.MigrateFlags(inspectDB),
+		Name:        "inspect",
+		ArgsUsage:   "<prefix> <start>",
+		Flags:       dbFlags,
+		Usage:       "Inspect the storage size for each type of data in the database",
+		Description: `This commands iterates the entire database. If the optional 'prefix' and 'start' arguments are provided, then the iteration is limited to the given subset of data.`,
+	}
+	dbStatCmd = cli.Command{
+		Action: utils.MigrateFlags(dbStats),
+		Name:   "stats",
+		Usage:  "Print leveldb statistics",
+		Flags:  dbFlags,
+	}
+	dbCompactCmd = cli.Command{
+		Action: utils.MigrateFlags(dbCompact),
+		Name:   "compact",
+		Usage:  "Compact leveldb database. WARNING: May take a very long time",
+		Flags:  dbFlags,
+		Description: `This command performs a database compaction.
+WARNING: This operation may take a very long time to finish, and may cause database
+corruption if it is aborted during execution!`,
+	}
+	dbGetCmd = cli.Command{
+		Action:      utils.MigrateFlags(dbGet),
+		Name:        "get",
+		Usage:       "Show the value of a database key",
+		ArgsUsage:   "<hex-encoded key>",
+		Flags:       dbFlags,
+		Description: "This command looks up the specified database key from the database.",
+	}
+	dbPutCmd = cli.Command{
+		Action:    utils.MigrateFlags(dbPut),
+		Name:      "put",
+		Usage:     "Set the value of a database key (WARNING: may corrupt your database)",
+		ArgsUsage: "<hex-encoded key> <hex-encoded value>",
+		Flags:     dbFlags,
+		Description: `This command sets a given database key to the given value.
+WARNING: This is a low-level operation which may cause database corruption!`,
+	}
+	dbDeleteCmd = cli.Command{
+		Action:    utils.MigrateFlags(dbDelete),
+		Name:      "delete",
+		Usage:     "Delete a database key (WARNING: may corrupt your database)",
+		ArgsUsage: "<hex-encoded key>",
+		Flags:     dbFlags,
+		Description: `This command deletes the specified database key from the database.
+WARNING: This is a low-level operation which may cause database corruption!`,
+	}
+	dbDumpTrieCmd = cli.Command{
+		Action:    utils.MigrateFlags(dbDumpTrie),
+		Name:      "dumptrie",
+		Usage:     "Show the storage key/values of a given trie",
+		ArgsUsage: "<hex-encoded trie root> (<hex-encoded owner>)",
+		Flags:     dbFlags,
+		Description: `This command iterates the trie with the given root and prints all the
+leaf keys and values in it. In the path state scheme, storage tries can only be
+located with the hash of the owning account given as the second argument.`,
+	}
+	dbDumpFreezerIndex = cli.Command{
+		Action:    utils.MigrateFlags(freezerInspect),
+		Name:      "freezer-index",
+		Usage:     "Dump out the index of a given freezer table",
+		ArgsUsage: "<table> <start>-<end>",
+		Flags:     dbFlags,
+		Description: `This command displays information about the freezer index of the given
+table ("headers", "hashes", "bodies", "receipts" or "diffs"). The range of the
+entries to display may also be a single number.`,
+	}
+	dbVerifyFreezerCmd = cli.Command{
+		Action:    utils.MigrateFlags(freezerVerify),
+		Name:      "verify-freezer",
+		Usage:     "Check the integrity of the ancient store",
+		ArgsUsage: "",
+		Flags: append(dbFlags, cli.BoolFlag{
+			Name:  "truncate",
+			Usage: "Truncate the ancient store to the last intact item if corrupted",
+		}),
+		Description: `This command walks all the tables of the ancient store, checking that they
+contain the same number of items, that every item can be read and decoded, and
+that the transaction and receipt roots, hashes and total difficulties match the
+headers. The first corrupted item is reported.
+
+With --truncate, the ancient store is cut back to the last intact item and the
+chain head is rewound to it, so a subsequent sync resumes from there.`,
+	}
+)
+
+func inspectDB(ctx *cli.Context) error {
+	var (
+		prefix []byte
+		start  []byte
+	)
+	if ctx.NArg() > 2 {
+		return fmt.Errorf("max 2 arguments: %v", ctx.Command.ArgsUsage)
+	}
+	if ctx.NArg() >= 1 {
+		d, err := hexutil.Decode(ctx.Args().Get(0))
+		if err != nil {
+			return fmt.Errorf("failed to hex-decode 'prefix': %v", err)
+		}
+		prefix = d
+	}
+	if ctx.NArg() >= 2 {
+		d, err := hexutil.Decode(ctx.Args().Get(1))
+		if err != nil {
+			return fmt.Errorf("failed to hex-decode 'start': %v", err)
+		}
+		start = d
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	return rawdb.InspectDatabase(db, prefix, start)
+}
+
+func dbStats(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	showLeveldbStats(db)
+	return nil
+}
+
+func showLeveldbStats(db ethdb.Stater) {
+	if stats, err := db.Stat("leveldb.stats"); err != nil {
+		log.Warn("Failed to read database stats", "error", err)
+	} else {
+		fmt.Println(stats)
+	}
+	if ioStats, err := db.Stat("leveldb.iostats"); err != nil {
+		log.Warn("Failed to read database iostats", "error", err)
+	} else {
+		fmt.Println(ioStats)
+	}
+}
+
+func dbCompact(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	log.Info("Stats before compaction")
+	showLeveldbStats(db)
+
+	log.Info("Triggering compaction")
+	start := time.Now()
+	if err := db.Compact(nil, nil); err != nil {
+		log.Info("Compact err", "error", err)
+		return err
+	}
+	log.Info("Compaction finished", "elapsed", common.PrettyDuration(time.Since(start)))
+
+	log.Info("Stats after compaction")
+	showLeveldbStats(db)
+	return nil
+}
+
+// dbGet shows the value of a given database key
+func dbGet(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	key, err := hexutil.Decode(ctx.Args().Get(0))
+	if err != nil {
+		log.Info("Could not decode the key", "error", err)
+		return err
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	data, err := db.Get(key)
+	if err != nil {
+		log.Info("Get operation failed", "error", err)
+		return err
+	}
+	fmt.Printf("key %#x: %#x\n", key, data)
+	return nil
+}
+
+// dbDelete deletes a key from the database
+func dbDelete(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	key, err := hexutil.Decode(ctx.Args().Get(0))
+	if err != nil {
+		log.Info("Could not decode the key", "error", err)
+		return err
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	data, err := db.Get(key)
+	if err == nil {
+		fmt.Printf("Previous value: %#x\n", data)
+	}
+	if err = db.Delete(key); err != nil {
+		log.Info("Delete operation returned an error", "error", err)
+		return err
+	}
+	return nil
+}
+
+// dbPut overwrite a value in the database
+func dbPut(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	var (
+		key   []byte
+		value []byte
+		data  []byte
+		err   error
+	)
+	key, err = hexutil.Decode(ctx.Args().Get(0))
+	if err != nil {
+		log.Info("Could not decode the key", "error", err)
+		return err
+	}
+	value, err = hexutil.Decode(ctx.Args().Get(1))
+	if err != nil {
+		log.Info("Could not decode the value", "error", err)
+		return err
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	data, err = db.Get(key)
+	if err == nil {
+		fmt.Printf("Previous value: %#x\n", data)
+	}
+	return db.Put(key, value)
+}
+
+// dbDumpTrie shows the key-value slots of a given trie
+func dbDumpTrie(ctx *cli.Context) error {
+	if ctx.NArg() < 1 || ctx.NArg() > 2 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	root, err := parseRoot(ctx.Args().Get(0))
+	if err != nil {
+		log.Info("Could not decode the root", "error", err)
+		return err
+	}
+	var owner common.Hash
+	if ctx.NArg() == 2 {
+		if owner, err = parseRoot(ctx.Args().Get(1)); err != nil {
+			log.Info("Could not decode the owner", "error", err)
+			return err
+		}
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	t, err := trie.NewWithOwner(owner, root, trie.NewDatabase(db))
+	if err != nil {
+		return err
+	}
+	var count int64
+	it := trie.NewIterator(t.NodeIterator(nil))
+	for it.Next() {
+		fmt.Printf("  %d. key %#x: %#x\n", count, it.Key, it.Value)
+		count++
+	}
+	return it.Err
+}
+
+// freezerInspect dumps the index entries of a freezer table
+func freezerInspect(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	table := ctx.Args().Get(0)
+	start, end, err := parseRange(ctx.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	ancient := resolveAncient(ctx, stack)
+	log.Info("Opening freezer", "location", ancient, "table", table)
+	return rawdb.InspectFreezerTable(ancient, table, start, end)
+}
+
+// freezerVerify checks the consistency of the ancient store, optionally cutting
+// it back to the last intact item.
+func freezerVerify(ctx *cli.Context) error {
+	if ctx.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", ctx.Args())
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	ancient := resolveAncient(ctx, stack)
+	log.Info("Verifying freezer", "location", ancient)
+
+	items, err := rawdb.VerifyFreezer(ancient, trie.NewStackTrie(nil))
+	if err == nil {
+		log.Info("Freezer is intact", "items", items)
+		return nil
+	}
+	if _, ok := err.(*rawdb.FreezerCorruption); !ok || !ctx.Bool("truncate") {
+		return err
+	}
+	log.Error("Freezer is corrupted", "intact", items, "err", err)
+
+	db, err := stack.OpenDatabase("chaindata", 16, 16, "")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return rawdb.TruncateFreezer(db, ancient, items)
+}
+
+// resolveAncient returns the location of the ancient store, either configured
+// explicitly or within the chain database.
+func resolveAncient(ctx *cli.Context, stack *node.Node) string {
+	ancient := ctx.GlobalString(utils.AncientFlag.Name)
+	switch {
+	case ancient == "":
+		ancient = filepath.Join(stack.ResolvePath("chaindata"), "ancient")
+	case !filepath.IsAbs(ancient):
+		ancient = stack.ResolvePath(ancient)
+	}
+	return ancient
+}
+
+// parseRange parses an inclusive "<start>-<end>" range of item numbers, or a
+// single item number.
+func parseRange(input string) (int64, int64, error) {
+	parts := strings.SplitN(input, "-", 2)
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("invalid range start %q", parts[0])
+	}
+	if len(parts) == 1 {
+		return start, start, nil
+	}
+	end, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || end < start {
+		return 0, 0, fmt.Errorf("invalid range end %q", parts[1])
+	}
+	return start, end, nil
+}
@@ -673,7 +673,7 @@ func (api *RetestethAPI) AccountRange(ctx context.Context,
 		signer := types.MakeSigner(api.blockchain.Config(), block.Number())
 		for idx, tx := range block.Transactions() {
 			// Assemble the transaction call message and return if the requested offset
-			msg, _ := tx.AsMessage(signer)
+			msg, _ := tx.AsMessage(signer, block.BaseFee())
 			context := core.NewEVMContext(msg, block.Header(), api.blockchain, nil)
 			// Not yet the searched for transaction, execute on top of the current state
 			vmenv := vm.NewEVM(context, statedb, api.blockchain.Config(), vm.Config{})
@@ -783,7 +783,7 @@ func (api *RetestethAPI) StorageRangeAt(ctx context.Context,
 		signer := types.MakeSigner(api.blockchain.Config(), block.Number())
 		for idx, tx := range block.Transactions() {
 			// Assemble the transaction call message and return if the requested offset
-			msg, _ := tx.AsMessage(signer)
+			msg, _ := tx.AsMessage(signer, block.BaseFee())
 			context := core.NewEVMContext(msg, block.Header(), api.blockchain, nil)
 			// Not yet the searched for transaction, execute on top of the current state
 			vmenv := vm.NewEVM(context, statedb, api.blockchain.Config(), vm.Config{})
@@ -0,0 +1,450 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256(nil)
+)
+
+var (
+	snapshotCommand = cli.Command{
+		Name:        "snapshot",
+		Usage:       "A set of commands based on the snapshot",
+		Category:    "MISCELLANEOUS COMMANDS",
+		Description: "",
+		Subcommands: []cli.Command{
+			{
+				Name:      "prune-state",
+				Usage:     "Prune stale ethereum state data based on the snapshot",
+				ArgsUsage: "<root>",
+				Action:    utils.MigrateFlags(pruneState),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+					utils.YoloV1Flag,
+					utils.LegacyTestnetFlag,
+					utils.CacheTrieJournalFlag,
+					utils.BloomFilterSizeFlag,
+				},
+				Description: `
+geth snapshot prune-state <state-root>
+will prune historical state data with the help of the state snapshot.
+All trie nodes and contract codes that do not belong to the specified
+version state will be deleted from the database. After pruning, only
+two version states are available: genesis and the specific one.
+
+The default pruning target is the bottom-most snapshot diff layer which has
+its state available, falling back to the snapshot disk layer.
+
+WARNING: It's necessary to delete the trie clean cache after the pruning.
+If you specify another directory for the trie clean cache via "--cache.trie.journal"
+during the use of Geth, please also specify it here for correct deletion. Otherwise
+the trie clean cache with default directory will be deleted.
+
+The pruning is crash-safe: if it is interrupted after any state was deleted,
+it is resumed the next time this command or Geth itself is started.
+`,
+			},
+			{
+				Name:      "verify-state",
+				Usage:     "Recalculate state hash based on the snapshot for verification",
+				ArgsUsage: "<root>",
+				Action:    utils.MigrateFlags(verifyState),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+					utils.YoloV1Flag,
+					utils.LegacyTestnetFlag,
+				},
+				Description: `
+geth snapshot verify-state <state-root>
+will traverse the whole accounts and storages set based on the specified
+snapshot and recalculate the root hash of state for verification.
+In other words, this command does the snapshot to trie conversion.
+If no root is given, the state of the current head block is verified.
+`,
+			},
+			{
+				Name:      "inspect-account",
+				Usage:     "Dump the snapshot entry and storage of an account",
+				ArgsUsage: "<address | hash>",
+				Action:    utils.MigrateFlags(inspectAccount),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+					utils.YoloV1Flag,
+					utils.LegacyTestnetFlag,
+				},
+				Description: `
+geth snapshot inspect-account <address | hash>
+will print the snapshot entry of the given account (either by address or by
+the hash of the address) in the state of the current head block, along with
+all the storage slots belonging to it.
+`,
+			},
+			{
+				Name:      "traverse-state",
+				Usage:     "Traverse the state with given root hash for verification",
+				ArgsUsage: "<root>",
+				Action:    utils.MigrateFlags(traverseState),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+					utils.YoloV1Flag,
+					utils.LegacyTestnetFlag,
+				},
+				Description: `
+geth snapshot traverse-state <state-root>
+will traverse the whole state from the given state root and will abort if any
+referenced trie node or contract code is missing. This can be used for state
+integrity verification. If no root is given, the state of the current head
+block is traversed.
+
+It's also usable without snapshot enabled.
+`,
+			},
+		},
+	}
+)
+
+func pruneState(ctx *cli.Context) error {
+	stack, config := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	pruner, err := pruner.NewPruner(chaindb, stack.ResolvePath(""), stack.ResolvePath(config.Eth.TrieCleanCacheJournal), ctx.GlobalUint64(utils.BloomFilterSizeFlag.Name))
+	if err != nil {
+		log.Error("Failed to open snapshot tree", "error", err)
+		return err
+	}
+	if ctx.NArg() > 1 {
+		log.Error("Too many arguments given")
+		return errors.New("too many arguments")
+	}
+	var targetRoot common.Hash
+	if ctx.NArg() == 1 {
+		targetRoot, err = parseRoot(ctx.Args()[0])
+		if err != nil {
+			log.Error("Failed to resolve state root", "error", err)
+			return err
+		}
+	}
+	// Pruning deletes trie nodes the dirty journal might rely on, drop it
+	if config.Eth.TrieDirtyCacheJournal != "" {
+		os.Remove(stack.ResolvePath(config.Eth.TrieDirtyCacheJournal))
+	}
+	if err = pruner.Prune(targetRoot); err != nil {
+		log.Error("Failed to prune state", "error", err)
+		return err
+	}
+	return nil
+}
+
+func verifyState(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	headBlock := rawdb.ReadHeadBlock(chaindb)
+	if headBlock == nil {
+		log.Error("Failed to load head block")
+		return errors.New("no head block")
+	}
+	snaptree := snapshot.New(chaindb, trie.NewDatabase(chaindb), 256, headBlock.Root(), false)
+	if ctx.NArg() > 1 {
+		log.Error("Too many arguments given")
+		return errors.New("too many arguments")
+	}
+	var (
+		root = headBlock.Root()
+		err  error
+	)
+	if ctx.NArg() == 1 {
+		root, err = parseRoot(ctx.Args()[0])
+		if err != nil {
+			log.Error("Failed to resolve state root", "error", err)
+			return err
+		}
+	}
+	if err := snapshot.VerifyState(snaptree, root); err != nil {
+		log.Error("Failed to verify state", "root", root, "error", err)
+		return err
+	}
+	log.Info("Verified the state", "root", root)
+	return nil
+}
+
+func inspectAccount(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		log.Error("Account address or hash is required")
+		return errors.New("invalid arguments")
+	}
+	var accountHash common.Hash
+	switch arg := ctx.Args()[0]; {
+	case common.IsHexAddress(arg):
+		accountHash = crypto.Keccak256Hash(common.HexToAddress(arg).Bytes())
+	default:
+		hash, err := parseRoot(arg)
+		if err != nil {
+			log.Error("Failed to resolve account", "error", err)
+			return err
+		}
+		accountHash = hash
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	headBlock := rawdb.ReadHeadBlock(chaindb)
+	if headBlock == nil {
+		log.Error("Failed to load head block")
+		return errors.New("no head block")
+	}
+	root := headBlock.Root()
+	snaptree := snapshot.New(chaindb, trie.NewDatabase(chaindb), 256, root, false)
+	snap := snaptree.Snapshot(root)
+	if snap == nil {
+		log.Error("Head state snapshot is not available", "root", root)
+		return errors.New("missing snapshot")
+	}
+	account, err := snap.Account(accountHash)
+	if err != nil {
+		log.Error("Failed to retrieve account", "hash", accountHash, "error", err)
+		return err
+	}
+	if account == nil {
+		fmt.Printf("Account %x not found in state %x\n", accountHash, root)
+		return nil
+	}
+	storageRoot, codeHash := emptyRoot, emptyCode
+	if len(account.Root) > 0 {
+		storageRoot = common.BytesToHash(account.Root)
+	}
+	if len(account.CodeHash) > 0 {
+		codeHash = account.CodeHash
+	}
+	fmt.Printf("Account:  %x\n", accountHash)
+	fmt.Printf("State:    %x (block #%d)\n", root, headBlock.NumberU64())
+	fmt.Printf("Nonce:    %d\n", account.Nonce)
+	fmt.Printf("Balance:  %v\n", account.Balance)
+	fmt.Printf("Root:     %x\n", storageRoot)
+	fmt.Printf("CodeHash: %x\n", codeHash)
+
+	it, err := snaptree.StorageIterator(root, accountHash, common.Hash{})
+	if err != nil {
+		log.Error("Failed to open storage iterator", "error", err)
+		return err
+	}
+	defer it.Release()
+
+	var slots int
+	for it.Next() {
+		_, content, _, err := rlp.Split(it.Slot())
+		if err != nil {
+			log.Error("Invalid storage slot", "slot", it.Hash(), "error", err)
+			return err
+		}
+		if slots == 0 {
+			fmt.Println("Storage:")
+		}
+		fmt.Printf("  %x: %x\n", it.Hash(), content)
+		slots++
+	}
+	if err := it.Error(); err != nil {
+		log.Error("Failed to iterate storage", "error", err)
+		return err
+	}
+	fmt.Printf("Slots:    %d\n", slots)
+	return nil
+}
+
+// traverseState is a helper function used for pruning verification.
+// Basically it just iterates the trie, ensure all nodes and associated
+// contract codes are present.
+func traverseState(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	headBlock := rawdb.ReadHeadBlock(chaindb)
+	if headBlock == nil {
+		log.Error("Failed to load head block")
+		return errors.New("no head block")
+	}
+	if ctx.NArg() > 1 {
+		log.Error("Too many arguments given")
+		return errors.New("too many arguments")
+	}
+	var (
+		root common.Hash
+		err  error
+	)
+	if ctx.NArg() == 1 {
+		root, err = parseRoot(ctx.Args()[0])
+		if err != nil {
+			log.Error("Failed to resolve state root", "error", err)
+			return err
+		}
+		log.Info("Start traversing the state", "root", root)
+	} else {
+		root = headBlock.Root()
+		log.Info("Start traversing the state", "root", root, "number", headBlock.NumberU64())
+	}
+	triedb := trie.NewDatabase(chaindb)
+	t, err := trie.NewSecure(root, triedb)
+	if err != nil {
+		log.Error("Failed to open trie", "root", root, "error", err)
+		return err
+	}
+	var (
+		nodes      int
+		accounts   int
+		slots      int
+		codes      int
+		lastReport time.Time
+		start      = time.Now()
+	)
+	// checkNode ensures the given trie node is present in the database. The
+	// embedded nodes don't have a hash and are skipped.
+	checkNode := func(hash common.Hash) error {
+		if hash == (common.Hash{}) {
+			return nil
+		}
+		nodes++
+
+		// In the path scheme, nodes are verified against their hash when the
+		// iterator resolves them, there's nothing keyed by hash to look up
+		if triedb.Scheme() == rawdb.PathScheme {
+			return nil
+		}
+		if blob := rawdb.ReadTrieNode(chaindb, hash); len(blob) == 0 {
+			return fmt.Errorf("missing trie node %x", hash)
+		}
+		return nil
+	}
+	accIter := t.NodeIterator(nil)
+	for accIter.Next(true) {
+		if err := checkNode(accIter.Hash()); err != nil {
+			log.Error("Failed to traverse state", "root", root, "error", err)
+			return err
+		}
+		// If it's a leaf node, yes we are touching an account,
+		// dig into the storage trie further.
+		if accIter.Leaf() {
+			accounts++
+			var acc state.Account
+			if err := rlp.DecodeBytes(accIter.LeafBlob(), &acc); err != nil {
+				log.Error("Invalid account encountered during traversal", "error", err)
+				return err
+			}
+			if acc.Root != emptyRoot {
+				storageTrie, err := trie.NewSecureWithOwner(common.BytesToHash(accIter.LeafKey()), acc.Root, triedb)
+				if err != nil {
+					log.Error("Failed to open storage trie", "root", acc.Root, "error", err)
+					return err
+				}
+				storageIter := storageTrie.NodeIterator(nil)
+				for storageIter.Next(true) {
+					if err := checkNode(storageIter.Hash()); err != nil {
+						log.Error("Failed to traverse storage", "account", common.BytesToHash(accIter.LeafKey()), "error", err)
+						return err
+					}
+					if storageIter.Leaf() {
+						slots++
+					}
+				}
+				if storageIter.Error() != nil {
+					log.Error("Failed to traverse storage trie", "root", acc.Root, "error", storageIter.Error())
+					return storageIter.Error()
+				}
+			}
+			if !bytes.Equal(acc.CodeHash, emptyCode) {
+				codes++
+				if code := rawdb.ReadCode(chaindb, common.BytesToHash(acc.CodeHash)); len(code) == 0 {
+					log.Error("Code is missing", "hash", common.BytesToHash(acc.CodeHash))
+					return errors.New("missing code")
+				}
+			}
+		}
+		if time.Since(lastReport) > time.Second*8 {
+			log.Info("Traversing state", "nodes", nodes, "accounts", accounts, "slots", slots, "codes", codes, "elapsed", common.PrettyDuration(time.Since(start)))
+			lastReport = time.Now()
+		}
+	}
+	if accIter.Error() != nil {
+		log.Error("Failed to traverse state trie", "root", root, "error", accIter.Error())
+		return accIter.Error()
+	}
+	log.Info("State is complete", "nodes", nodes, "accounts", accounts, "slots", slots, "codes", codes, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+func parseRoot(input string) (common.Hash, error) {
+	var h common.Hash
+	if err := h.UnmarshalText([]byte(input)); err != nil {
+		return h, err
+	}
+	return h, nil
+}
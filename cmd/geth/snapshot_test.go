@@ -0,0 +1,117 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// snapshotGenesis is a genesis with a plain account and a contract account with
+// code and storage, so that all parts of the state are exercised.
+const snapshotGenesis = `{
+	"alloc"      : {
+		"0x1000000000000000000000000000000000000001": {"balance": "1000"},
+		"0x2000000000000000000000000000000000000002": {
+			"balance": "0",
+			"code"   : "0x6001600055",
+			"storage": {"0x0000000000000000000000000000000000000000000000000000000000000001": "0x0000000000000000000000000000000000000000000000000000000000000002"}
+		}
+	},
+	"coinbase"   : "0x0000000000000000000000000000000000000000",
+	"difficulty" : "0x20000",
+	"extraData"  : "",
+	"gasLimit"   : "0x2fefd8",
+	"nonce"      : "0x0000000000000042",
+	"mixhash"    : "0x0000000000000000000000000000000000000000000000000000000000000000",
+	"parentHash" : "0x0000000000000000000000000000000000000000000000000000000000000000",
+	"timestamp"  : "0x00",
+	"config"     : {}
+}`
+
+// initSnapshotDatadir creates a data directory initialized with snapshotGenesis.
+func initSnapshotDatadir(t *testing.T) string {
+	datadir := tmpdir(t)
+	json := filepath.Join(datadir, "genesis.json")
+	if err := ioutil.WriteFile(json, []byte(snapshotGenesis), 0600); err != nil {
+		os.RemoveAll(datadir)
+		t.Fatalf("failed to write genesis file: %v", err)
+	}
+	runGeth(t, "--nousb", "--datadir", datadir, "init", json).WaitExit()
+	return datadir
+}
+
+// runSnapshotCmd runs a snapshot subcommand, checking whether it succeeded and
+// that its log output contains the given message.
+func runSnapshotCmd(t *testing.T, datadir string, success bool, message string, args ...string) {
+	t.Helper()
+
+	geth := runGeth(t, append([]string{"--nousb", "--datadir", datadir, "snapshot"}, args...)...)
+	geth.WaitExit()
+
+	if status := geth.ExitStatus(); (status == 0) != success {
+		t.Fatalf("%v: exit status mismatch: have %d, want success %v\n%s", args, status, success, geth.StderrText())
+	}
+	if stderr := geth.StderrText(); !strings.Contains(stderr, message) {
+		t.Fatalf("%v: missing %q in output:\n%s", args, message, stderr)
+	}
+}
+
+// Tests that the state of a freshly initialized chain can be verified and
+// traversed by the snapshot subcommands.
+func TestSnapshotVerifyState(t *testing.T) {
+	datadir := initSnapshotDatadir(t)
+	defer os.RemoveAll(datadir)
+
+	runSnapshotCmd(t, datadir, true, "Verified the state", "verify-state")
+	runSnapshotCmd(t, datadir, true, "State is complete", "traverse-state")
+
+	// Unknown roots and malformed arguments must be rejected
+	unknown := "0x0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"
+	runSnapshotCmd(t, datadir, false, "Failed to verify state", "verify-state", unknown)
+	runSnapshotCmd(t, datadir, false, "Failed to open trie", "traverse-state", unknown)
+	runSnapshotCmd(t, datadir, false, "Too many arguments given", "verify-state", unknown, unknown)
+}
+
+// Tests that the snapshot entries of accounts can be inspected.
+func TestSnapshotInspectAccount(t *testing.T) {
+	datadir := initSnapshotDatadir(t)
+	defer os.RemoveAll(datadir)
+
+	geth := runGeth(t, "--nousb", "--datadir", datadir, "snapshot", "inspect-account", "0x2000000000000000000000000000000000000002")
+	geth.ExpectRegexp(`(?s)Nonce:    0\nBalance:  0\n.*Storage:\n  [0-9a-f]{64}: 02\nSlots:    1\n`)
+	geth.ExpectExit()
+
+	geth = runGeth(t, "--nousb", "--datadir", datadir, "snapshot", "inspect-account", "0x1000000000000000000000000000000000000001")
+	geth.ExpectRegexp(`(?s)Balance:  1000\n.*Slots:    0\n`)
+	geth.ExpectExit()
+
+	geth = runGeth(t, "--nousb", "--datadir", datadir, "snapshot", "inspect-account", "0x3000000000000000000000000000000000000003")
+	geth.ExpectRegexp(`Account [0-9a-f]{64} not found in state [0-9a-f]{64}\n`)
+	geth.ExpectExit()
+}
+
+// Tests that pruning is refused while there aren't enough snapshot layers yet.
+func TestSnapshotPruneStateTooEarly(t *testing.T) {
+	datadir := initSnapshotDatadir(t)
+	defer os.RemoveAll(datadir)
+
+	runSnapshotCmd(t, datadir, false, "snapshot not old enough yet", "prune-state")
+}
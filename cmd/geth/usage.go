@@ -48,6 +48,9 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.ExitWhenSyncedFlag,
 			utils.GCModeFlag,
 			utils.TxLookupLimitFlag,
+			utils.StateHistoryFlag,
+			utils.TraceIndexFlag,
+			utils.AccountHistoryIndexFlag,
 			utils.EthStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightKDFFlag,
@@ -112,6 +115,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.CacheTrieJournalFlag,
 			utils.CacheTrieRejournalFlag,
 			utils.CacheGCFlag,
+			utils.CacheGCJournalFlag,
 			utils.CacheSnapshotFlag,
 			utils.CacheNoPrefetchFlag,
 		},
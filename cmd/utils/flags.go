@@ -187,7 +187,7 @@ var (
 	defaultSyncMode = eth.DefaultConfig.SyncMode
 	SyncModeFlag    = TextMarshalerFlag{
 		Name:  "syncmode",
-		Usage: `Blockchain sync mode ("fast", "full", or "light")`,
+		Usage: `Blockchain sync mode ("fast", "full", "snap" or "light")`,
 		Value: &defaultSyncMode,
 	}
 	GCModeFlag = cli.StringFlag{
@@ -204,6 +204,24 @@ var (
 		Usage: "Number of recent blocks to maintain transactions index by-hash for (default = index all blocks)",
 		Value: 0,
 	}
+	StateSchemeFlag = cli.StringFlag{
+		Name:  "state.scheme",
+		Usage: `Scheme to use for storing the state trie nodes ("hash" or "path")`,
+		Value: rawdb.HashScheme,
+	}
+	StateHistoryFlag = cli.Uint64Flag{
+		Name:  "state.history",
+		Usage: "Number of recent blocks the state can be rewound to in the path state scheme",
+		Value: eth.DefaultConfig.StateHistory,
+	}
+	TraceIndexFlag = cli.BoolFlag{
+		Name:  "trace.index",
+		Usage: "Index the call traces of the chain for fast trace filtering (requires --gcmode=archive)",
+	}
+	AccountHistoryIndexFlag = cli.BoolFlag{
+		Name:  "history.accounts",
+		Usage: "Index the blocks changing the balance, nonce, code or storage of each account (requires --gcmode=archive)",
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -374,6 +392,11 @@ var (
 		Usage: "Percentage of cache memory allowance to use for trie pruning (default = 25% full mode, 0% archive mode)",
 		Value: 25,
 	}
+	CacheGCJournalFlag = cli.StringFlag{
+		Name:  "cache.gc.journal",
+		Usage: "Disk journal for dirty trie nodes to survive crashes (empty = disabled)",
+		Value: eth.DefaultConfig.TrieDirtyCacheJournal,
+	}
 	CacheSnapshotFlag = cli.IntFlag{
 		Name:  "cache.snapshot",
 		Usage: "Percentage of cache memory allowance to use for snapshot caching (default = 10% full mode, 20% archive mode)",
@@ -383,6 +406,11 @@ var (
 		Name:  "cache.noprefetch",
 		Usage: "Disable heuristic state prefetch during block import (less CPU and disk IO, more time waiting for data)",
 	}
+	BloomFilterSizeFlag = cli.Uint64Flag{
+		Name:  "bloomfilter.size",
+		Usage: "Megabytes of memory allocated to bloom-filter for pruning",
+		Value: 2048,
+	}
 	// Miner settings
 	MiningEnabledFlag = cli.BoolFlag{
 		Name:  "mine",
@@ -1529,6 +1557,15 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
 	}
+	if ctx.GlobalIsSet(StateHistoryFlag.Name) {
+		cfg.StateHistory = ctx.GlobalUint64(StateHistoryFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceIndexFlag.Name) {
+		cfg.CallTraceIndex = ctx.GlobalBool(TraceIndexFlag.Name)
+	}
+	if ctx.GlobalIsSet(AccountHistoryIndexFlag.Name) {
+		cfg.AccountHistoryIndex = ctx.GlobalBool(AccountHistoryIndexFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
 		cfg.TrieCleanCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheTrieFlag.Name) / 100
 	}
@@ -1541,6 +1578,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cfg.TrieDirtyCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
 	}
+	if ctx.GlobalIsSet(CacheGCJournalFlag.Name) {
+		cfg.TrieDirtyCacheJournal = ctx.GlobalString(CacheGCJournalFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheSnapshotFlag.Name) {
 		cfg.SnapshotCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheSnapshotFlag.Name) / 100
 	}
@@ -127,7 +127,9 @@ type CacheConfig struct {
 	TrieCleanNoPrefetch bool          // Whether to disable heuristic state prefetching for followup blocks
 	TrieDirtyLimit      int           // Memory limit (MB) at which to start flushing dirty trie nodes to disk
 	TrieDirtyDisabled   bool          // Whether to disable trie write caching and GC altogether (archive node)
+	TrieDirtyJournal    string        // Disk journal for recovering dirty trie nodes after a crash
 	TrieTimeLimit       time.Duration // Time limit after which to flush the current in-memory trie to disk
+	StateHistory        uint64        // Number of recent states revertible via reverse diffs in the path scheme (0 = default)
 	SnapshotLimit       int           // Memory allowance (MB) to use for caching snapshot entries in memory
 
 	SnapshotWait bool // Wait for snapshot construction on startup. TODO(karalabe): This is a dirty hack for testing, nuke it
@@ -249,6 +251,24 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	bc.prefetcher = newStatePrefetcher(chainConfig, bc, engine)
 	bc.processor = NewStateProcessor(chainConfig, bc, engine)
 
+	// The path scheme only keeps a single state on disk, which is incompatible
+	// with archive mode
+	pathScheme := bc.stateCache.TrieDB().Scheme() == rawdb.PathScheme
+	if pathScheme {
+		if cacheConfig.TrieDirtyDisabled {
+			return nil, errors.New("archive mode is unsupported in the path state scheme")
+		}
+		if cacheConfig.StateHistory > 0 {
+			bc.stateCache.TrieDB().SetStateHistory(cacheConfig.StateHistory)
+		}
+	}
+	// Recover any dirty trie nodes lost in an unclean shutdown before checking
+	// the head state, otherwise the chain would be needlessly rewound.
+	if cacheConfig.TrieDirtyJournal != "" && !cacheConfig.TrieDirtyDisabled && !pathScheme {
+		if _, err := bc.stateCache.TrieDB().OpenJournal(cacheConfig.TrieDirtyJournal); err != nil {
+			log.Error("Failed to open dirty trie journal", "path", cacheConfig.TrieDirtyJournal, "err", err)
+		}
+	}
 	var err error
 	bc.hc, err = NewHeaderChain(db, chainConfig, engine, bc.insertStopped)
 	if err != nil {
@@ -337,6 +357,10 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 			}
 		}
 	}
+	// Schedule any tries recovered from the dirty journal for garbage collection
+	if !bc.cacheConfig.TrieDirtyDisabled && !pathScheme {
+		bc.loadDirtyRoots()
+	}
 	// Load any existing snapshot, regenerating it if loading failed
 	if bc.cacheConfig.SnapshotLimit > 0 {
 		bc.snaps = snapshot.New(bc.db, bc.stateCache.TrieDB(), bc.cacheConfig.SnapshotLimit, bc.CurrentBlock().Root(), !bc.cacheConfig.SnapshotWait)
@@ -363,6 +387,38 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	return bc, nil
 }
 
+// loadDirtyRoots schedules the tries recovered from the dirty trie journal for
+// garbage collection, just as if the recent blocks were imported in this session.
+// Recovered tries not belonging to the recent canonical chain are dereferenced.
+func (bc *BlockChain) loadDirtyRoots() {
+	triedb := bc.stateCache.TrieDB()
+
+	roots := triedb.Roots()
+	if len(roots) == 0 {
+		return
+	}
+	head := bc.CurrentBlock().NumberU64()
+	for number := head; number+TriesInMemory > head; number-- {
+		header := bc.GetHeaderByNumber(number)
+		if header == nil {
+			break
+		}
+		if roots[header.Root] > 0 {
+			roots[header.Root]--
+			bc.triegc.Push(header.Root, -int64(number))
+		}
+		if number == 0 {
+			break
+		}
+	}
+	for root, refs := range roots {
+		for ; refs > 0; refs-- {
+			triedb.Dereference(root)
+		}
+	}
+	log.Info("Loaded recovered tries from dirty journal", "tries", bc.triegc.Size())
+}
+
 // GetVMConfig returns the block chain VM config.
 func (bc *BlockChain) GetVMConfig() *vm.Config {
 	return &bc.vmConfig
@@ -462,7 +518,7 @@ func (bc *BlockChain) SetHead(head uint64) error {
 			} else {
 				// Block exists, keep rewinding until we find one with state
 				for {
-					if _, err := state.New(newHeadBlock.Root(), bc.stateCache, bc.snaps); err != nil {
+					if _, err := state.New(newHeadBlock.Root(), bc.stateCache, bc.snaps); err != nil && !bc.recoverState(newHeadBlock.Root()) {
 						log.Trace("Block state missing, rewinding further", "number", newHeadBlock.NumberU64(), "hash", newHeadBlock.Hash())
 						if pivot == nil || newHeadBlock.NumberU64() > *pivot {
 							newHeadBlock = bc.GetBlock(newHeadBlock.ParentHash(), newHeadBlock.NumberU64()-1)
@@ -799,6 +855,21 @@ func (bc *BlockChain) HasFastBlock(hash common.Hash, number uint64) bool {
 	return rawdb.HasReceipts(bc.db, hash, number)
 }
 
+// recoverState attempts to revert the persisted state to the one with the given
+// root via the reverse diffs of the path scheme, reporting whether the state is
+// available afterwards. All the newer states kept in memory are discarded.
+func (bc *BlockChain) recoverState(root common.Hash) bool {
+	triedb := bc.stateCache.TrieDB()
+	if !triedb.Recoverable(root) {
+		return false
+	}
+	if err := triedb.Recover(root); err != nil {
+		log.Error("Failed to recover state", "root", root, "err", err)
+		return false
+	}
+	return true
+}
+
 // HasState checks if state trie is fully present in the database or not.
 func (bc *BlockChain) HasState(hash common.Hash) bool {
 	_, err := bc.stateCache.OpenTrie(hash)
@@ -947,7 +1018,17 @@ func (bc *BlockChain) Stop() {
 	//  - HEAD:     So we don't need to reprocess any blocks in the general case
 	//  - HEAD-1:   So we don't do large reorgs if our HEAD becomes an uncle
 	//  - HEAD-127: So we have a hard limit on the number of blocks reexecuted
-	if !bc.cacheConfig.TrieDirtyDisabled {
+	//
+	// In the path scheme only a single state can be persisted, the older ones
+	// remain reachable through the reverse diffs.
+	if triedb := bc.stateCache.TrieDB(); triedb.Scheme() == rawdb.PathScheme {
+		recent := bc.CurrentBlock()
+
+		log.Info("Writing cached state to disk", "block", recent.Number(), "hash", recent.Hash(), "root", recent.Root())
+		if err := triedb.Commit(recent.Root(), true, nil); err != nil {
+			log.Error("Failed to commit recent state trie", "err", err)
+		}
+	} else if !bc.cacheConfig.TrieDirtyDisabled {
 		triedb := bc.stateCache.TrieDB()
 
 		for _, offset := range []uint64{0, 1, TriesInMemory - 1} {
@@ -972,6 +1053,10 @@ func (bc *BlockChain) Stop() {
 		if size, _ := triedb.Size(); size != 0 {
 			log.Error("Dangling trie nodes after full cleanup")
 		}
+		// All the needed state is on disk, the dirty journal is obsolete
+		if err := triedb.CloseJournal(true); err != nil {
+			log.Error("Failed to discard dirty trie journal", "err", err)
+		}
 	}
 	// Ensure all live cached entries be saved into disk, so that we can skip
 	// cache warmup when node restarts.
@@ -1468,7 +1553,7 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 		if err := triedb.Commit(root, false, nil); err != nil {
 			return NonStatTy, err
 		}
-	} else {
+	} else if triedb.Scheme() == rawdb.HashScheme {
 		// Full but not archive node, do proper garbage collection
 		triedb.Reference(root, common.Hash{}) // metadata reference to keep trie alive
 		bc.triegc.Push(root, -int64(block.NumberU64()))
@@ -1514,6 +1599,8 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 				triedb.Dereference(root.(common.Hash))
 			}
 		}
+		// Persist the dirty cache changes so a crash doesn't lose the new state
+		triedb.SyncJournal()
 	}
 	// If the total difficulty is higher than our known, add it to the canonical chain
 	// Second clause in the if statement reduces the vulnerability to selfish mining.
@@ -1544,6 +1631,14 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 	} else {
 		status = SideStatTy
 	}
+	// In the path scheme, persist the state layers beyond the retention limit.
+	// Only do it along the canonical chain, otherwise a long sidechain might get
+	// its state flushed on top of the canonical one.
+	if status == CanonStatTy && triedb.Scheme() == rawdb.PathScheme {
+		if err := triedb.Flatten(root, TriesInMemory); err != nil {
+			return NonStatTy, err
+		}
+	}
 	// Set new head.
 	if status == CanonStatTy {
 		bc.writeHeadBlock(block)
@@ -1993,7 +2088,7 @@ func (bc *BlockChain) insertSideChain(block *types.Block, it *insertIterator) (i
 		numbers []uint64
 	)
 	parent := it.previous()
-	for parent != nil && !bc.HasState(parent.Root) {
+	for parent != nil && !bc.HasState(parent.Root) && !bc.recoverState(parent.Root) {
 		hashes = append(hashes, parent.Hash())
 		numbers = append(numbers, parent.Number.Uint64())
 
@@ -24,7 +24,9 @@ import (
 	"io/ioutil"
 	"math/big"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
@@ -1651,3 +1653,132 @@ func testRepair(t *testing.T, tt *rewindTest) {
 		t.Errorf("Frozen block count mismatch: have %d, want %d", frozen, tt.expFrozen)
 	}
 }
+
+// Tests that a chain crashing with all its state still in memory recovers the
+// state from the dirty trie journal on restart, instead of rewinding.
+func TestDirtyJournalRepair(t *testing.T) {
+	// Create a temporary persistent database
+	datadir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temporary datadir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+
+	db, err := rawdb.NewLevelDBDatabaseWithFreezer(datadir, 0, 0, datadir, "")
+	if err != nil {
+		t.Fatalf("Failed to create persistent database: %v", err)
+	}
+	defer db.Close() // Might double close, should be fine
+
+	// Initialize a fresh chain with the dirty journal enabled and crash it
+	var (
+		genesis = new(Genesis).MustCommit(db)
+		engine  = ethash.NewFullFaker()
+		config  = &CacheConfig{
+			TrieCleanLimit:   256,
+			TrieDirtyLimit:   256,
+			TrieDirtyJournal: filepath.Join(datadir, "triedirty"),
+			TrieTimeLimit:    5 * time.Minute,
+			SnapshotWait:     true,
+		}
+	)
+	chain, err := NewBlockChain(db, config, params.AllEthashProtocolChanges, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create chain: %v", err)
+	}
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, rawdb.NewMemoryDatabase(), 2*TriesInMemory, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.Address{0x02})
+	})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("Failed to import canonical chain: %v", err)
+	}
+	db.Close()
+
+	// Start a new blockchain back up and ensure nothing was rewound
+	db, err = rawdb.NewLevelDBDatabaseWithFreezer(datadir, 0, 0, datadir, "")
+	if err != nil {
+		t.Fatalf("Failed to reopen persistent database: %v", err)
+	}
+	defer db.Close()
+
+	chain, err = NewBlockChain(db, config, params.AllEthashProtocolChanges, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to recreate chain: %v", err)
+	}
+	if head := chain.CurrentBlock(); head.NumberU64() != uint64(len(blocks)) {
+		t.Fatalf("Head block mismatch: have %d, want %d", head.NumberU64(), len(blocks))
+	}
+	if size := chain.triegc.Size(); size != TriesInMemory {
+		t.Fatalf("Recovered trie count mismatch: have %d, want %d", size, TriesInMemory)
+	}
+	// A clean shutdown persists the needed state, so the journal is discarded
+	chain.Stop()
+	if _, err := os.Stat(config.TrieDirtyJournal); !os.IsNotExist(err) {
+		t.Fatalf("Dirty journal not discarded on clean shutdown: %v", err)
+	}
+}
+
+// Tests that a chain using the path state scheme keeps only the latest state on
+// disk, yet can still be rewound via the reverse diffs and restarted cleanly.
+func TestPathSchemeSetHead(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	rawdb.WriteStateScheme(db, rawdb.PathScheme)
+
+	var (
+		genesis = new(Genesis).MustCommit(db)
+		engine  = ethash.NewFullFaker()
+		config  = &CacheConfig{
+			TrieCleanLimit: 256,
+			TrieDirtyLimit: 256,
+			TrieTimeLimit:  5 * time.Minute,
+			SnapshotWait:   true,
+		}
+	)
+	if _, err := NewBlockChain(db, &CacheConfig{TrieDirtyDisabled: true}, params.AllEthashProtocolChanges, engine, vm.Config{}, nil, nil); err == nil {
+		t.Fatalf("Archive chain created in the path scheme")
+	}
+	chain, err := NewBlockChain(db, config, params.AllEthashProtocolChanges, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create chain: %v", err)
+	}
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, rawdb.NewMemoryDatabase(), 2*TriesInMemory, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.Address{0x02})
+	})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("Failed to import canonical chain: %v", err)
+	}
+	// Only the most recent states should be available, the rest is overwritten
+	for i, block := range blocks {
+		if have, want := chain.HasState(block.Root()), i >= TriesInMemory-1; have != want {
+			t.Fatalf("Block #%d state availability mismatch: have %v, want %v", block.NumberU64(), have, want)
+		}
+	}
+	// Rewind below the persisted state and ensure it's recovered
+	if err := chain.SetHead(TriesInMemory / 2); err != nil {
+		t.Fatalf("Failed to rewind chain: %v", err)
+	}
+	if head := chain.CurrentBlock(); head.NumberU64() != TriesInMemory/2 {
+		t.Fatalf("Head block mismatch after rewind: have %d, want %d", head.NumberU64(), TriesInMemory/2)
+	}
+	if !chain.HasState(chain.CurrentBlock().Root()) {
+		t.Fatalf("Head state missing after rewind")
+	}
+	// Reimport the rewound blocks and ensure the state survives a restart
+	if _, err := chain.InsertChain(blocks[TriesInMemory/2:]); err != nil {
+		t.Fatalf("Failed to reimport canonical chain: %v", err)
+	}
+	chain.Stop()
+
+	chain, err = NewBlockChain(db, config, params.AllEthashProtocolChanges, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to recreate chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if head := chain.CurrentBlock(); head.NumberU64() != uint64(len(blocks)) {
+		t.Fatalf("Head block mismatch after restart: have %d, want %d", head.NumberU64(), len(blocks))
+	}
+	if !chain.HasState(chain.CurrentBlock().Root()) {
+		t.Fatalf("Head state missing after restart")
+	}
+}
@@ -1424,6 +1424,87 @@ func TestEIP161AccountRemoval(t *testing.T) {
 	}
 }
 
+// Tests the EIP-1559 fork transition: the gas limit doubles at the fork block,
+// the base fee is tracked in the headers and only the priority fee is credited
+// to the miner while the base fee is burned.
+func TestEIP1559Transition(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		engine = ethash.NewFaker()
+
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		funds   = new(big.Int).Mul(common.Big1, big.NewInt(params.Ether))
+		miner   = common.Address{0xaa}
+		theAddr = common.Address{1}
+
+		config = *params.AllEthashProtocolChanges
+		gspec  = &Genesis{
+			Config:   &config,
+			GasLimit: 10000000,
+			Alloc:    GenesisAlloc{address: {Balance: funds}},
+		}
+	)
+	config.BerlinBlock = common.Big0
+	config.LondonBlock = common.Big1
+	genesis := gspec.MustCommit(db)
+	signer := types.LatestSigner(gspec.Config)
+
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 2, func(i int, b *BlockGen) {
+		b.SetCoinbase(miner)
+		tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+			ChainID:   gspec.Config.ChainID,
+			Nonce:     uint64(i),
+			To:        &theAddr,
+			Gas:       params.TxGas,
+			GasFeeCap: new(big.Int).Mul(b.BaseFee(), common.Big2),
+			GasTipCap: big.NewInt(2),
+			Value:     common.Big0,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.AddTx(tx)
+	})
+	diskdb := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(diskdb)
+
+	chain, err := NewBlockChain(diskdb, nil, gspec.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	if genesis.BaseFee() != nil {
+		t.Fatalf("pre-London genesis has base fee %v", genesis.BaseFee())
+	}
+	fork := chain.GetBlockByNumber(1)
+	if have, want := fork.GasLimit(), genesis.GasLimit()*params.ElasticityMultiplier; have != want {
+		t.Errorf("fork block gas limit mismatch: have %d, want %d", have, want)
+	}
+	if have, want := fork.BaseFee(), new(big.Int).SetUint64(params.InitialBaseFee); have.Cmp(want) != 0 {
+		t.Errorf("fork block base fee mismatch: have %v, want %v", have, want)
+	}
+	// Only the tip is paid to the miner, the base fee is burned
+	block := chain.GetBlockByNumber(2)
+	state, _ := chain.State()
+
+	gasUsed := new(big.Int).SetUint64(block.GasUsed())
+	reward := new(big.Int).Mul(ethash.ConstantinopleBlockReward, common.Big2)
+	tips := new(big.Int).Mul(big.NewInt(2), new(big.Int).SetUint64(fork.GasUsed()+block.GasUsed()))
+	if have, want := state.GetBalance(miner), new(big.Int).Add(reward, tips); have.Cmp(want) != 0 {
+		t.Errorf("miner balance mismatch: have %v, want %v", have, want)
+	}
+	spent := new(big.Int).Mul(gasUsed, new(big.Int).Add(block.BaseFee(), big.NewInt(2)))
+	spent.Add(spent, new(big.Int).Mul(new(big.Int).SetUint64(fork.GasUsed()), new(big.Int).Add(fork.BaseFee(), big.NewInt(2))))
+	if have, want := state.GetBalance(address), new(big.Int).Sub(funds, spent); have.Cmp(want) != 0 {
+		t.Errorf("sender balance mismatch: have %v, want %v", have, want)
+	}
+}
+
 // This is a regression test (i.e. as weird as it is, don't delete it ever), which
 // tests that under weird reorg conditions the blockchain and its internal header-
 // chain return the same latest block/header.
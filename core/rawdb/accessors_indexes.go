@@ -18,6 +18,7 @@ package rawdb
 
 import (
 	"bytes"
+	"encoding/binary"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -175,3 +176,167 @@ func DeleteBloombits(db ethdb.Database, bit uint, from uint64, to uint64) {
 		log.Crit("Failed to delete bloom bits", "err", it.Error())
 	}
 }
+
+// ReadCallTraces retrieves the flattened call traces of the block with the given
+// number, along with the hash of the block they were collected from.
+func ReadCallTraces(db ethdb.KeyValueReader, number uint64) (common.Hash, []byte) {
+	data, _ := db.Get(callTracesKey(number))
+	if len(data) < common.HashLength {
+		return common.Hash{}, nil
+	}
+	return common.BytesToHash(data[:common.HashLength]), data[common.HashLength:]
+}
+
+// WriteCallTraces stores the flattened call traces of the block with the given
+// number and hash.
+func WriteCallTraces(db ethdb.KeyValueWriter, number uint64, hash common.Hash, traces []byte) {
+	if err := db.Put(callTracesKey(number), append(hash.Bytes(), traces...)); err != nil {
+		log.Crit("Failed to store call traces", "err", err)
+	}
+}
+
+// DeleteCallTraces removes the flattened call traces of the block with the given
+// number.
+func DeleteCallTraces(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Delete(callTracesKey(number)); err != nil {
+		log.Crit("Failed to delete call traces", "err", err)
+	}
+}
+
+// ReadCallTraceIndex retrieves the numbers of the blocks within the given range
+// (inclusive) which contain call traces involving the given address.
+func ReadCallTraceIndex(db ethdb.Iteratee, address common.Address, from uint64, to uint64) []uint64 {
+	prefix := append(append([]byte{}, callTraceIndexPrefix...), address.Bytes()...)
+
+	it := db.NewIterator(prefix, encodeBlockNumber(from))
+	defer it.Release()
+
+	var numbers []uint64
+	for it.Next() {
+		if len(it.Key()) != len(prefix)+8 {
+			continue
+		}
+		number := binary.BigEndian.Uint64(it.Key()[len(prefix):])
+		if number > to {
+			break
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers
+}
+
+// WriteCallTraceIndex marks the block with the given number as containing call
+// traces involving the given address.
+func WriteCallTraceIndex(db ethdb.KeyValueWriter, address common.Address, number uint64) {
+	if err := db.Put(callTraceIndexKey(address, number), nil); err != nil {
+		log.Crit("Failed to store call trace index", "err", err)
+	}
+}
+
+// DeleteCallTraceIndex removes the call trace index entry of the given address
+// and block number.
+func DeleteCallTraceIndex(db ethdb.KeyValueWriter, address common.Address, number uint64) {
+	if err := db.Delete(callTraceIndexKey(address, number)); err != nil {
+		log.Crit("Failed to delete call trace index", "err", err)
+	}
+}
+
+// Account history change flags, denoting which fields of an account were changed
+// within a block.
+const (
+	AccountBalanceChanged uint8 = 1 << iota
+	AccountNonceChanged
+	AccountCodeChanged
+	AccountStorageChanged
+)
+
+// AccountHistoryEntry is the change of an account within a block, along with the
+// balance and nonce of the account at the end of the block.
+type AccountHistoryEntry struct {
+	Number  uint64 `rlp:"-"` // Number of the block, stored in the database key
+	Flags   uint8
+	Balance *big.Int
+	Nonce   uint64
+}
+
+// ReadAccountChanges retrieves the addresses of the accounts changed within the
+// block with the given number, along with the hash of the block.
+func ReadAccountChanges(db ethdb.KeyValueReader, number uint64) (common.Hash, []common.Address) {
+	data, _ := db.Get(accountChangesKey(number))
+	if len(data) < common.HashLength {
+		return common.Hash{}, nil
+	}
+	var addresses []common.Address
+	if err := rlp.DecodeBytes(data[common.HashLength:], &addresses); err != nil {
+		log.Error("Invalid account changes RLP", "number", number, "err", err)
+		return common.Hash{}, nil
+	}
+	return common.BytesToHash(data[:common.HashLength]), addresses
+}
+
+// WriteAccountChanges stores the addresses of the accounts changed within the
+// block with the given number and hash.
+func WriteAccountChanges(db ethdb.KeyValueWriter, number uint64, hash common.Hash, addresses []common.Address) {
+	data, err := rlp.EncodeToBytes(addresses)
+	if err != nil {
+		log.Crit("Failed to RLP encode account changes", "err", err)
+	}
+	if err := db.Put(accountChangesKey(number), append(hash.Bytes(), data...)); err != nil {
+		log.Crit("Failed to store account changes", "err", err)
+	}
+}
+
+// DeleteAccountChanges removes the changed accounts of the block with the given
+// number.
+func DeleteAccountChanges(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Delete(accountChangesKey(number)); err != nil {
+		log.Crit("Failed to delete account changes", "err", err)
+	}
+}
+
+// ReadAccountHistory retrieves the changes of an account within the given block
+// range (inclusive) in ascending block order, returning at most limit entries.
+func ReadAccountHistory(db ethdb.Iteratee, address common.Address, from uint64, to uint64, limit int) []*AccountHistoryEntry {
+	prefix := append(append([]byte{}, accountHistoryPrefix...), address.Bytes()...)
+
+	it := db.NewIterator(prefix, encodeBlockNumber(from))
+	defer it.Release()
+
+	var entries []*AccountHistoryEntry
+	for len(entries) < limit && it.Next() {
+		if len(it.Key()) != len(prefix)+8 {
+			continue
+		}
+		number := binary.BigEndian.Uint64(it.Key()[len(prefix):])
+		if number > to {
+			break
+		}
+		entry := &AccountHistoryEntry{Number: number}
+		if err := rlp.DecodeBytes(it.Value(), entry); err != nil {
+			log.Error("Invalid account history entry RLP", "address", address, "number", number, "err", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// WriteAccountHistory stores the change of an account within the block with the
+// given number.
+func WriteAccountHistory(db ethdb.KeyValueWriter, address common.Address, entry *AccountHistoryEntry) {
+	data, err := rlp.EncodeToBytes(entry)
+	if err != nil {
+		log.Crit("Failed to RLP encode account history entry", "err", err)
+	}
+	if err := db.Put(accountHistoryKey(address, entry.Number), data); err != nil {
+		log.Crit("Failed to store account history entry", "err", err)
+	}
+}
+
+// DeleteAccountHistory removes the change of an account within the block with
+// the given number.
+func DeleteAccountHistory(db ethdb.KeyValueWriter, address common.Address, number uint64) {
+	if err := db.Delete(accountHistoryKey(address, number)); err != nil {
+		log.Crit("Failed to delete account history entry", "err", err)
+	}
+}
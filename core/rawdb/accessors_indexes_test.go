@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"hash"
 	"math/big"
+	"reflect"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -177,3 +178,92 @@ func TestDeleteBloomBits(t *testing.T) {
 	check(1, 1, params.MainnetGenesisHash, true)
 	check(1, 1, params.RinkebyGenesisHash, true)
 }
+
+func TestCallTraceStorage(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	// Check that call traces are stored along with the block hash
+	if hash, traces := ReadCallTraces(db, 1); hash != (common.Hash{}) || traces != nil {
+		t.Fatalf("non existent call traces returned: %x %s", hash, traces)
+	}
+	WriteCallTraces(db, 1, params.MainnetGenesisHash, []byte("[]"))
+	if hash, traces := ReadCallTraces(db, 1); hash != params.MainnetGenesisHash || string(traces) != "[]" {
+		t.Fatalf("call traces mismatch: have %x %s, want %x []", hash, traces, params.MainnetGenesisHash)
+	}
+	DeleteCallTraces(db, 1)
+	if hash, traces := ReadCallTraces(db, 1); hash != (common.Hash{}) || traces != nil {
+		t.Fatalf("deleted call traces returned: %x %s", hash, traces)
+	}
+	// Check that the index only reports the blocks of the address within range
+	var (
+		addr1 = common.Address{0x01}
+		addr2 = common.Address{0x02}
+	)
+	for _, number := range []uint64{1, 5, 256, 300} {
+		WriteCallTraceIndex(db, addr1, number)
+	}
+	WriteCallTraceIndex(db, addr2, 2)
+
+	check := func(addr common.Address, from, to uint64, want []uint64) {
+		t.Helper()
+		if have := ReadCallTraceIndex(db, addr, from, to); !reflect.DeepEqual(have, want) {
+			t.Errorf("call trace index mismatch for %x [%d, %d]: have %v, want %v", addr, from, to, have, want)
+		}
+	}
+	check(addr1, 0, 1000, []uint64{1, 5, 256, 300})
+	check(addr1, 2, 256, []uint64{5, 256})
+	check(addr1, 301, 1000, nil)
+	check(addr2, 0, 1000, []uint64{2})
+
+	DeleteCallTraceIndex(db, addr1, 5)
+	check(addr1, 0, 1000, []uint64{1, 256, 300})
+}
+
+func TestAccountHistoryStorage(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	// Check that the changed accounts are stored along with the block hash
+	addrs := []common.Address{{0x01}, {0x02}}
+	WriteAccountChanges(db, 1, params.MainnetGenesisHash, addrs)
+	if hash, have := ReadAccountChanges(db, 1); hash != params.MainnetGenesisHash || !reflect.DeepEqual(have, addrs) {
+		t.Fatalf("account changes mismatch: have %x %v, want %x %v", hash, have, params.MainnetGenesisHash, addrs)
+	}
+	DeleteAccountChanges(db, 1)
+	if hash, have := ReadAccountChanges(db, 1); hash != (common.Hash{}) || have != nil {
+		t.Fatalf("deleted account changes returned: %x %v", hash, have)
+	}
+	// Check that the history is returned in order, within range and limit
+	var entries []*AccountHistoryEntry
+	for i, number := range []uint64{1, 5, 256, 300} {
+		entry := &AccountHistoryEntry{
+			Number:  number,
+			Flags:   AccountBalanceChanged | AccountNonceChanged,
+			Balance: big.NewInt(int64(100 * i)),
+			Nonce:   uint64(i),
+		}
+		WriteAccountHistory(db, addrs[0], entry)
+		entries = append(entries, entry)
+	}
+	WriteAccountHistory(db, addrs[1], &AccountHistoryEntry{Number: 2, Flags: AccountCodeChanged, Balance: new(big.Int)})
+
+	check := func(addr common.Address, from, to uint64, limit int, want []*AccountHistoryEntry) {
+		t.Helper()
+		have := ReadAccountHistory(db, addr, from, to, limit)
+		if len(have) != len(want) {
+			t.Fatalf("account history length mismatch for %x [%d, %d]: have %d, want %d", addr, from, to, len(have), len(want))
+		}
+		for i := range have {
+			if have[i].Number != want[i].Number || have[i].Flags != want[i].Flags || have[i].Balance.Cmp(want[i].Balance) != 0 || have[i].Nonce != want[i].Nonce {
+				t.Errorf("account history entry %d mismatch: have %+v, want %+v", i, have[i], want[i])
+			}
+		}
+	}
+	check(addrs[0], 0, 1000, 100, entries)
+	check(addrs[0], 2, 256, 100, entries[1:3])
+	check(addrs[0], 0, 1000, 2, entries[:2])
+	check(addrs[0], 301, 1000, 100, nil)
+
+	DeleteAccountHistory(db, addrs[0], 5)
+	check(addrs[0], 0, 1000, 100, []*AccountHistoryEntry{entries[0], entries[2], entries[3]})
+	check(addrs[1], 0, 1000, 100, []*AccountHistoryEntry{{Number: 2, Flags: AccountCodeChanged, Balance: new(big.Int)}})
+}
@@ -118,3 +118,51 @@ func DeleteSnapshotJournal(db ethdb.KeyValueWriter) {
 		log.Crit("Failed to remove snapshot journal", "err", err)
 	}
 }
+
+// ReadSnapshotPruneMarker retrieves the state root an interrupted offline state
+// pruning was targeting, or an empty hash if no pruning is in progress.
+func ReadSnapshotPruneMarker(db ethdb.KeyValueReader) common.Hash {
+	data, _ := db.Get(snapshotPruneMarkerKey)
+	if len(data) != common.HashLength {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteSnapshotPruneMarker stores the state root an offline state pruning is
+// targeting. The marker must be written before any state is deleted, so that
+// an interrupted pruning can be resumed.
+func WriteSnapshotPruneMarker(db ethdb.KeyValueWriter, root common.Hash) {
+	if err := db.Put(snapshotPruneMarkerKey, root[:]); err != nil {
+		log.Crit("Failed to store snapshot prune marker", "err", err)
+	}
+}
+
+// DeleteSnapshotPruneMarker deletes the offline state pruning marker, signalling
+// that the pruning has finished.
+func DeleteSnapshotPruneMarker(db ethdb.KeyValueWriter) {
+	if err := db.Delete(snapshotPruneMarkerKey); err != nil {
+		log.Crit("Failed to remove snapshot prune marker", "err", err)
+	}
+}
+
+// ReadSnapshotSyncStatus retrieves the serialized sync status saved at shutdown.
+func ReadSnapshotSyncStatus(db ethdb.KeyValueReader) []byte {
+	data, _ := db.Get(snapshotSyncStatusKey)
+	return data
+}
+
+// WriteSnapshotSyncStatus stores the serialized sync status to save at shutdown.
+func WriteSnapshotSyncStatus(db ethdb.KeyValueWriter, status []byte) {
+	if err := db.Put(snapshotSyncStatusKey, status); err != nil {
+		log.Crit("Failed to store snapshot sync status", "err", err)
+	}
+}
+
+// DeleteSnapshotSyncStatus deletes the serialized sync status saved at the last
+// shutdown.
+func DeleteSnapshotSyncStatus(db ethdb.KeyValueWriter) {
+	if err := db.Delete(snapshotSyncStatusKey); err != nil {
+		log.Crit("Failed to remove snapshot sync status", "err", err)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// The list of schemes the state trie nodes can be stored with.
+const (
+	// HashScheme stores trie nodes keyed by their hash. Nodes are shared between
+	// states, so stale ones can't be deleted without a full traversal.
+	HashScheme = "hash"
+
+	// PathScheme stores trie nodes keyed by their owner and path, overwriting
+	// them in place as the state progresses. Only the latest persisted state is
+	// available on disk, older ones can be recovered via reverse diffs.
+	PathScheme = "path"
+)
+
+// ReadStateScheme retrieves the scheme used to store the state trie nodes. If
+// none was recorded, the database uses the legacy hash scheme.
+func ReadStateScheme(db ethdb.KeyValueReader) string {
+	data, _ := db.Get(stateSchemeKey)
+	if len(data) == 0 {
+		return HashScheme
+	}
+	return string(data)
+}
+
+// WriteStateScheme stores the scheme used to store the state trie nodes.
+func WriteStateScheme(db ethdb.KeyValueWriter, scheme string) {
+	if err := db.Put(stateSchemeKey, []byte(scheme)); err != nil {
+		log.Crit("Failed to store state scheme", "err", err)
+	}
+}
+
+// ReadAccountTrieNode retrieves the account trie node stored at the given path.
+func ReadAccountTrieNode(db ethdb.KeyValueReader, path []byte) []byte {
+	data, _ := db.Get(accountTrieNodeKey(path))
+	return data
+}
+
+// WriteAccountTrieNode stores the account trie node at the given path.
+func WriteAccountTrieNode(db ethdb.KeyValueWriter, path []byte, node []byte) {
+	if err := db.Put(accountTrieNodeKey(path), node); err != nil {
+		log.Crit("Failed to store account trie node", "err", err)
+	}
+}
+
+// DeleteAccountTrieNode deletes the account trie node stored at the given path.
+func DeleteAccountTrieNode(db ethdb.KeyValueWriter, path []byte) {
+	if err := db.Delete(accountTrieNodeKey(path)); err != nil {
+		log.Crit("Failed to delete account trie node", "err", err)
+	}
+}
+
+// ReadStorageTrieNode retrieves the storage trie node of an account stored at
+// the given path.
+func ReadStorageTrieNode(db ethdb.KeyValueReader, accountHash common.Hash, path []byte) []byte {
+	data, _ := db.Get(storageTrieNodeKey(accountHash, path))
+	return data
+}
+
+// WriteStorageTrieNode stores the storage trie node of an account at the given
+// path.
+func WriteStorageTrieNode(db ethdb.KeyValueWriter, accountHash common.Hash, path []byte, node []byte) {
+	if err := db.Put(storageTrieNodeKey(accountHash, path), node); err != nil {
+		log.Crit("Failed to store storage trie node", "err", err)
+	}
+}
+
+// DeleteStorageTrieNode deletes the storage trie node of an account stored at
+// the given path.
+func DeleteStorageTrieNode(db ethdb.KeyValueWriter, accountHash common.Hash, path []byte) {
+	if err := db.Delete(storageTrieNodeKey(accountHash, path)); err != nil {
+		log.Crit("Failed to delete storage trie node", "err", err)
+	}
+}
+
+// IterateStorageTrieNodes returns an iterator for walking all the path-based
+// storage trie nodes of a specific account.
+func IterateStorageTrieNodes(db ethdb.Iteratee, accountHash common.Hash) ethdb.Iterator {
+	return db.NewIterator(storageTrieNodeKey(accountHash, nil), nil)
+}
+
+// ReadPersistentStateID retrieves the id of the latest persisted state in the
+// path scheme.
+func ReadPersistentStateID(db ethdb.KeyValueReader) uint64 {
+	data, _ := db.Get(persistentStateIDKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WritePersistentStateID stores the id of the latest persisted state in the
+// path scheme.
+func WritePersistentStateID(db ethdb.KeyValueWriter, id uint64) {
+	if err := db.Put(persistentStateIDKey, encodeBlockNumber(id)); err != nil {
+		log.Crit("Failed to store persistent state id", "err", err)
+	}
+}
+
+// ReadStateID retrieves the id of the persisted state with the given root.
+func ReadStateID(db ethdb.KeyValueReader, root common.Hash) *uint64 {
+	data, _ := db.Get(stateIDKey(root))
+	if len(data) != 8 {
+		return nil
+	}
+	id := binary.BigEndian.Uint64(data)
+	return &id
+}
+
+// WriteStateID stores the id of the persisted state with the given root.
+func WriteStateID(db ethdb.KeyValueWriter, root common.Hash, id uint64) {
+	if err := db.Put(stateIDKey(root), encodeBlockNumber(id)); err != nil {
+		log.Crit("Failed to store state id", "err", err)
+	}
+}
+
+// DeleteStateID deletes the id of the persisted state with the given root.
+func DeleteStateID(db ethdb.KeyValueWriter, root common.Hash) {
+	if err := db.Delete(stateIDKey(root)); err != nil {
+		log.Crit("Failed to delete state id", "err", err)
+	}
+}
+
+// ReadReverseDiff retrieves the reverse diff reverting the persisted state with
+// the given id to its parent.
+func ReadReverseDiff(db ethdb.KeyValueReader, id uint64) []byte {
+	data, _ := db.Get(reverseDiffKey(id))
+	return data
+}
+
+// WriteReverseDiff stores the reverse diff reverting the persisted state with
+// the given id to its parent.
+func WriteReverseDiff(db ethdb.KeyValueWriter, id uint64, diff []byte) {
+	if err := db.Put(reverseDiffKey(id), diff); err != nil {
+		log.Crit("Failed to store reverse diff", "err", err)
+	}
+}
+
+// DeleteReverseDiff deletes the reverse diff of the persisted state with the
+// given id.
+func DeleteReverseDiff(db ethdb.KeyValueWriter, id uint64) {
+	if err := db.Delete(reverseDiffKey(id)); err != nil {
+		log.Crit("Failed to delete reverse diff", "err", err)
+	}
+}
@@ -270,8 +270,8 @@ func (s *stat) Count() string {
 
 // InspectDatabase traverses the entire database and checks the size
 // of all different categories of data.
-func InspectDatabase(db ethdb.Database) error {
-	it := db.NewIterator(nil, nil)
+func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
+	it := db.NewIterator(keyPrefix, keyStart)
 	defer it.Release()
 
 	var (
@@ -287,12 +287,18 @@ func InspectDatabase(db ethdb.Database) error {
 		numHashPairings stat
 		hashNumPairings stat
 		tries           stat
+		pathTries       stat
+		reverseDiffs    stat
 		codes           stat
 		txLookups       stat
 		accountSnaps    stat
 		storageSnaps    stat
 		preimages       stat
 		bloomBits       stat
+		callTraces      stat
+		callTraceIndex  stat
+		accountChanges  stat
+		accountHistory  stat
 		cliqueSnaps     stat
 
 		// Ancient store statistics
@@ -335,6 +341,14 @@ func InspectDatabase(db ethdb.Database) error {
 			hashNumPairings.Add(size)
 		case len(key) == common.HashLength:
 			tries.Add(size)
+		case bytes.HasPrefix(key, TrieNodeAccountPrefix) && len(key) <= len(TrieNodeAccountPrefix)+2*common.HashLength:
+			pathTries.Add(size)
+		case bytes.HasPrefix(key, TrieNodeStoragePrefix) && len(key) >= len(TrieNodeStoragePrefix)+common.HashLength && len(key) <= len(TrieNodeStoragePrefix)+3*common.HashLength:
+			pathTries.Add(size)
+		case bytes.HasPrefix(key, reverseDiffPrefix) && len(key) == len(reverseDiffPrefix)+8:
+			reverseDiffs.Add(size)
+		case bytes.HasPrefix(key, stateIDPrefix) && len(key) == len(stateIDPrefix)+common.HashLength:
+			reverseDiffs.Add(size)
 		case bytes.HasPrefix(key, codePrefix) && len(key) == len(codePrefix)+common.HashLength:
 			codes.Add(size)
 		case bytes.HasPrefix(key, txLookupPrefix) && len(key) == (len(txLookupPrefix)+common.HashLength):
@@ -347,6 +361,14 @@ func InspectDatabase(db ethdb.Database) error {
 			preimages.Add(size)
 		case bytes.HasPrefix(key, bloomBitsPrefix) && len(key) == (len(bloomBitsPrefix)+10+common.HashLength):
 			bloomBits.Add(size)
+		case bytes.HasPrefix(key, callTracesPrefix) && len(key) == (len(callTracesPrefix)+8):
+			callTraces.Add(size)
+		case bytes.HasPrefix(key, callTraceIndexPrefix) && len(key) == (len(callTraceIndexPrefix)+common.AddressLength+8):
+			callTraceIndex.Add(size)
+		case bytes.HasPrefix(key, accountChangesPrefix) && len(key) == (len(accountChangesPrefix)+8):
+			accountChanges.Add(size)
+		case bytes.HasPrefix(key, accountHistoryPrefix) && len(key) == (len(accountHistoryPrefix)+common.AddressLength+8):
+			accountHistory.Add(size)
 		case bytes.HasPrefix(key, []byte("clique-")) && len(key) == 7+common.HashLength:
 			cliqueSnaps.Add(size)
 		case bytes.HasPrefix(key, []byte("cht-")) && len(key) == 4+common.HashLength:
@@ -355,7 +377,7 @@ func InspectDatabase(db ethdb.Database) error {
 			bloomTrieNodes.Add(size)
 		default:
 			var accounted bool
-			for _, meta := range [][]byte{databaseVerisionKey, headHeaderKey, headBlockKey, headFastBlockKey, fastTrieProgressKey} {
+			for _, meta := range [][]byte{databaseVerisionKey, headHeaderKey, headBlockKey, headFastBlockKey, fastTrieProgressKey, stateSchemeKey, persistentStateIDKey} {
 				if bytes.Equal(key, meta) {
 					metadata.Add(size)
 					accounted = true
@@ -395,8 +417,14 @@ func InspectDatabase(db ethdb.Database) error {
 		{"Key-Value store", "Block hash->number", hashNumPairings.Size(), hashNumPairings.Count()},
 		{"Key-Value store", "Transaction index", txLookups.Size(), txLookups.Count()},
 		{"Key-Value store", "Bloombit index", bloomBits.Size(), bloomBits.Count()},
+		{"Key-Value store", "Call traces", callTraces.Size(), callTraces.Count()},
+		{"Key-Value store", "Call trace index", callTraceIndex.Size(), callTraceIndex.Count()},
+		{"Key-Value store", "Account changes", accountChanges.Size(), accountChanges.Count()},
+		{"Key-Value store", "Account history", accountHistory.Size(), accountHistory.Count()},
 		{"Key-Value store", "Contract codes", codes.Size(), codes.Count()},
 		{"Key-Value store", "Trie nodes", tries.Size(), tries.Count()},
+		{"Key-Value store", "Path trie nodes", pathTries.Size(), pathTries.Count()},
+		{"Key-Value store", "State reverse diffs", reverseDiffs.Size(), reverseDiffs.Count()},
 		{"Key-Value store", "Trie preimages", preimages.Size(), preimages.Count()},
 		{"Key-Value store", "Account snapshot", accountSnaps.Size(), accountSnaps.Count()},
 		{"Key-Value store", "Storage snapshot", storageSnaps.Size(), storageSnaps.Count()},
@@ -22,6 +22,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -470,3 +471,25 @@ func (f *freezer) repair() error {
 	atomic.StoreUint64(&f.frozen, min)
 	return nil
 }
+
+// InspectFreezerTable dumps the index entries of a single freezer table within
+// the [start, end] range to stdout. The freezer must not be in use.
+func InspectFreezerTable(ancient string, table string, start, end int64) error {
+	noSnappy, ok := freezerNoSnappy[table]
+	if !ok {
+		var known []string
+		for name := range freezerNoSnappy {
+			known = append(known, name)
+		}
+		sort.Strings(known)
+		return fmt.Errorf("%w: %q, known tables: %v", errUnknownTable, table, known)
+	}
+	t, err := newTable(ancient, table, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, noSnappy)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	t.dumpIndex(os.Stdout, start, end)
+	return nil
+}
@@ -633,23 +633,25 @@ func (t *freezerTable) Sync() error {
 
 // printIndex is a debug print utility function for testing
 func (t *freezerTable) printIndex() {
+	t.dumpIndex(os.Stdout, 0, 100)
+}
+
+// dumpIndex writes the raw index entries in the [start, stop] range to the given
+// writer. The first entry holds the number of the first data file and the number
+// of items deleted from the tail instead of an offset.
+func (t *freezerTable) dumpIndex(w io.Writer, start, stop int64) {
 	buf := make([]byte, indexEntrySize)
 
-	fmt.Printf("|-----------------|\n")
-	fmt.Printf("| fileno | offset |\n")
-	fmt.Printf("|--------+--------|\n")
+	fmt.Fprintf(w, "| number | fileno | offset |\n")
+	fmt.Fprintf(w, "|--------|--------|--------|\n")
 
-	for i := uint64(0); ; i++ {
+	for i := uint64(start); i <= uint64(stop); i++ {
 		if _, err := t.index.ReadAt(buf, int64(i*indexEntrySize)); err != nil {
 			break
 		}
 		var entry indexEntry
 		entry.unmarshalBinary(buf)
-		fmt.Printf("|  %03d   |  %03d   | \n", entry.filenum, entry.offset)
-		if i > 100 {
-			fmt.Printf(" ... \n")
-			break
-		}
+		fmt.Fprintf(w, "| %06d | %06d | %06d |\n", i, entry.filenum, entry.offset)
 	}
-	fmt.Printf("|-----------------|\n")
+	fmt.Fprintf(w, "|--------------------------|\n")
 }
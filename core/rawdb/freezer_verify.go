@@ -0,0 +1,411 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/golang/snappy"
+	"github.com/prometheus/tsdb/fileutil"
+)
+
+// freezerTableOrder is the order in which the tables of an ancient item are
+// verified, so that the cheap and fundamental ones are checked first.
+var freezerTableOrder = []string{freezerHeaderTable, freezerHashTable, freezerBodiesTable, freezerReceiptTable, freezerDifficultyTable}
+
+// FreezerCorruption describes the first inconsistent item found in the ancient
+// store by VerifyFreezer.
+type FreezerCorruption struct {
+	Table string // Table containing the bad data, empty if it spans all tables
+	Item  uint64 // Number of the first bad item
+	Err   error  // Reason the item was deemed corrupted
+}
+
+// Error implements error, reporting the location of the corruption.
+func (e *FreezerCorruption) Error() string {
+	if e.Table == "" {
+		return fmt.Sprintf("ancient item %d: %v", e.Item, e.Err)
+	}
+	return fmt.Sprintf("ancient table %s, item %d: %v", e.Table, e.Item, e.Err)
+}
+
+// verifyTable is a read-only view over the index and data files of a single
+// freezer table. Contrary to freezerTable, it never repairs the files and checks
+// every index entry it touches instead of assuming it's sane.
+type verifyTable struct {
+	name     string
+	path     string
+	noSnappy bool
+
+	index  *os.File
+	files  map[uint32]*os.File // Opened data files
+	sizes  map[uint32]int64    // Sizes of the opened data files
+	offset uint64              // Number of items deleted from the tail
+	items  uint64              // Number of items in the table, including the deleted ones
+}
+
+// openVerifyTable opens the index of a freezer table for verification.
+func openVerifyTable(path string, name string, noSnappy bool) (*verifyTable, error) {
+	idxName := fmt.Sprintf("%s.cidx", name)
+	if noSnappy {
+		idxName = fmt.Sprintf("%s.ridx", name)
+	}
+	t := &verifyTable{
+		name:     name,
+		path:     path,
+		noSnappy: noSnappy,
+		files:    make(map[uint32]*os.File),
+		sizes:    make(map[uint32]int64),
+	}
+	// Tables are only created when the freezer is first opened, treat missing
+	// ones as empty
+	index, err := os.Open(filepath.Join(path, idxName))
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.index = index
+
+	stat, err := index.Stat()
+	if err != nil {
+		t.close()
+		return nil, err
+	}
+	// A partially written trailing index entry is dropped on startup anyway, so
+	// only count the complete ones
+	if entries := stat.Size() / indexEntrySize; entries > 0 {
+		first, err := t.entry(0)
+		if err != nil {
+			t.close()
+			return nil, err
+		}
+		t.offset = uint64(first.offset)
+		t.items = t.offset + uint64(entries) - 1
+	}
+	return t, nil
+}
+
+// close releases all the files opened by the table.
+func (t *verifyTable) close() {
+	if t.index != nil {
+		t.index.Close()
+	}
+	for _, f := range t.files {
+		f.Close()
+	}
+}
+
+// entry reads the index entry at the given position.
+func (t *verifyTable) entry(pos uint64) (indexEntry, error) {
+	var (
+		entry  indexEntry
+		buffer = make([]byte, indexEntrySize)
+	)
+	if _, err := t.index.ReadAt(buffer, int64(pos*indexEntrySize)); err != nil {
+		return entry, err
+	}
+	entry.unmarshalBinary(buffer)
+	return entry, nil
+}
+
+// dataFile opens the data file with the given number, returning it along with
+// its size.
+func (t *verifyTable) dataFile(num uint32) (*os.File, int64, error) {
+	if f, ok := t.files[num]; ok {
+		return f, t.sizes[num], nil
+	}
+	name := fmt.Sprintf("%s.%04d.cdat", t.name, num)
+	if t.noSnappy {
+		name = fmt.Sprintf("%s.%04d.rdat", t.name, num)
+	}
+	f, err := os.Open(filepath.Join(t.path, name))
+	if err != nil {
+		return nil, 0, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	t.files[num], t.sizes[num] = f, stat.Size()
+	return f, stat.Size(), nil
+}
+
+// retrieve reads and decompresses an item, validating its index entries against
+// each other and against the data file they point into.
+func (t *verifyTable) retrieve(item uint64) ([]byte, error) {
+	if item < t.offset {
+		return nil, errors.New("item deleted from the tail")
+	}
+	if item >= t.items {
+		return nil, errOutOfBounds
+	}
+	pos := item - t.offset
+
+	start, err := t.entry(pos)
+	if err != nil {
+		return nil, err
+	}
+	end, err := t.entry(pos + 1)
+	if err != nil {
+		return nil, err
+	}
+	// The first entry only carries the tail metadata, any other one holds the
+	// end offset of the previous item
+	var from uint32
+	switch {
+	case pos == 0 || start.filenum+1 == end.filenum:
+		from = 0
+	case start.filenum == end.filenum:
+		if end.offset < start.offset {
+			return nil, fmt.Errorf("index offsets out of order: %d > %d", start.offset, end.offset)
+		}
+		from = start.offset
+	default:
+		return nil, fmt.Errorf("index file numbers out of order: %d -> %d", start.filenum, end.filenum)
+	}
+	f, size, err := t.dataFile(end.filenum)
+	if err != nil {
+		return nil, err
+	}
+	if int64(end.offset) > size {
+		return nil, fmt.Errorf("data file %d truncated: have %d bytes, need %d", end.filenum, size, end.offset)
+	}
+	blob := make([]byte, end.offset-from)
+	if _, err := f.ReadAt(blob, int64(from)); err != nil {
+		return nil, err
+	}
+	if t.noSnappy {
+		return blob, nil
+	}
+	return snappy.Decode(nil, blob)
+}
+
+// VerifyFreezer walks every table of the ancient store at the given path and
+// checks that each item is readable, that the tables agree on the number of
+// items, and that the blocks are consistent: headers chain together, hashes
+// match the headers, transaction and receipt roots match the bodies and the
+// receipts, and total difficulties add up.
+//
+// The number of leading items found intact is returned, along with the first
+// corruption found as a *FreezerCorruption. The hasher is used to derive the
+// transaction and receipt roots.
+//
+// The freezer must not be in use by a running node. The files are not modified.
+func VerifyFreezer(ancient string, hasher types.Hasher) (uint64, error) {
+	lock, _, err := fileutil.Flock(filepath.Join(ancient, "FLOCK"))
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Release()
+
+	tables := make(map[string]*verifyTable)
+	defer func() {
+		for _, t := range tables {
+			t.close()
+		}
+	}()
+	var (
+		first  uint64
+		limit  uint64
+		counts = make(map[string]uint64)
+	)
+	for i, name := range freezerTableOrder {
+		t, err := openVerifyTable(ancient, name, freezerNoSnappy[name])
+		if err != nil {
+			return 0, &FreezerCorruption{Table: name, Err: err}
+		}
+		tables[name], counts[name] = t, t.items
+
+		if t.offset > first {
+			first = t.offset
+		}
+		if i == 0 || t.items < limit {
+			limit = t.items
+		}
+	}
+	var (
+		prevHash common.Hash
+		prevTd   *big.Int
+		start    = time.Now()
+		logged   = time.Now()
+	)
+	for number := first; number < limit; number++ {
+		blobs := make(map[string][]byte)
+		for _, name := range freezerTableOrder {
+			blob, err := tables[name].retrieve(number)
+			if err != nil {
+				return number, &FreezerCorruption{Table: name, Item: number, Err: err}
+			}
+			blobs[name] = blob
+		}
+		hash, td, err := verifyAncientItem(number, blobs, prevHash, prevTd, hasher)
+		if err != nil {
+			return number, err
+		}
+		prevHash, prevTd = hash, td
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Verifying ancient store", "number", number, "limit", limit, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	for _, name := range freezerTableOrder {
+		if counts[name] != limit {
+			return limit, &FreezerCorruption{Item: limit, Err: fmt.Errorf("table item counts mismatch: %v", counts)}
+		}
+	}
+	log.Info("Verified ancient store", "items", limit, "elapsed", common.PrettyDuration(time.Since(start)))
+	return limit, nil
+}
+
+// verifyAncientItem decodes all the parts of a frozen block and checks them for
+// consistency with each other and with the parent block. The hash and total
+// difficulty of the block are returned for checking the next one.
+func verifyAncientItem(number uint64, blobs map[string][]byte, parent common.Hash, parentTd *big.Int, hasher types.Hasher) (common.Hash, *big.Int, error) {
+	corrupt := func(table string, format string, args ...interface{}) (common.Hash, *big.Int, error) {
+		return common.Hash{}, nil, &FreezerCorruption{Table: table, Item: number, Err: fmt.Errorf(format, args...)}
+	}
+	// Verify the header and its position in the chain
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(blobs[freezerHeaderTable], header); err != nil {
+		return corrupt(freezerHeaderTable, "invalid header: %v", err)
+	}
+	if header.Number == nil || !header.Number.IsUint64() || header.Number.Uint64() != number {
+		return corrupt(freezerHeaderTable, "header number mismatch: have %v, want %d", header.Number, number)
+	}
+	if parentTd != nil && header.ParentHash != parent {
+		return corrupt(freezerHeaderTable, "parent hash mismatch: have %x, want %x", header.ParentHash, parent)
+	}
+	hash := header.Hash()
+	if have := blobs[freezerHashTable]; len(have) != common.HashLength || common.BytesToHash(have) != hash {
+		return corrupt(freezerHashTable, "hash mismatch: have %x, want %x", have, hash)
+	}
+	// Verify the body against the header
+	body := new(types.Body)
+	if err := rlp.DecodeBytes(blobs[freezerBodiesTable], body); err != nil {
+		return corrupt(freezerBodiesTable, "invalid body: %v", err)
+	}
+	if root := deriveListRoot(types.Transactions(body.Transactions), hasher); root != header.TxHash {
+		return corrupt(freezerBodiesTable, "transaction root mismatch: have %x, want %x", root, header.TxHash)
+	}
+	if uncles := types.CalcUncleHash(body.Uncles); uncles != header.UncleHash {
+		return corrupt(freezerBodiesTable, "uncle hash mismatch: have %x, want %x", uncles, header.UncleHash)
+	}
+	// Verify the receipts against the header
+	var stored []*types.ReceiptForStorage
+	if err := rlp.DecodeBytes(blobs[freezerReceiptTable], &stored); err != nil {
+		return corrupt(freezerReceiptTable, "invalid receipts: %v", err)
+	}
+	if len(stored) != len(body.Transactions) {
+		return corrupt(freezerReceiptTable, "receipt count mismatch: have %d, want %d", len(stored), len(body.Transactions))
+	}
+	receipts := make(types.Receipts, len(stored))
+	for i, receipt := range stored {
+		receipts[i] = (*types.Receipt)(receipt)
+		receipts[i].Type = body.Transactions[i].Type()
+		receipts[i].Bloom = types.CreateBloom(types.Receipts{receipts[i]})
+	}
+	if root := deriveListRoot(receipts, hasher); root != header.ReceiptHash {
+		return corrupt(freezerReceiptTable, "receipt root mismatch: have %x, want %x", root, header.ReceiptHash)
+	}
+	// Verify the total difficulty against the parent's
+	td := new(big.Int)
+	if err := rlp.DecodeBytes(blobs[freezerDifficultyTable], td); err != nil {
+		return corrupt(freezerDifficultyTable, "invalid total difficulty: %v", err)
+	}
+	if parentTd != nil {
+		if want := new(big.Int).Add(parentTd, header.Difficulty); td.Cmp(want) != 0 {
+			return corrupt(freezerDifficultyTable, "total difficulty mismatch: have %v, want %v", td, want)
+		}
+	}
+	return hash, td, nil
+}
+
+// deriveListRoot computes the root hash of a transaction or receipt list the same
+// way blocks are assembled, with empty lists mapping to the empty root.
+func deriveListRoot(list types.DerivableList, hasher types.Hasher) common.Hash {
+	if list.Len() == 0 {
+		return types.EmptyRootHash
+	}
+	return types.DeriveSha(list, hasher)
+}
+
+// TruncateFreezer drops all the items from the ancient store at the given path
+// beyond the first items, and rewinds the head markers of the key-value store to
+// the last item kept, so that a subsequent sync refills the chain from there.
+//
+// It's meant to be used with the number of intact items reported by
+// VerifyFreezer, on the database of a stopped node.
+func TruncateFreezer(db ethdb.KeyValueStore, ancient string, items uint64) error {
+	if items == 0 {
+		return errors.New("cannot truncate the genesis block")
+	}
+	f, err := newFreezer(ancient, "")
+	if err != nil {
+		return err
+	}
+	// The freezer is never started here, so release its files manually instead
+	// of waiting on the background loop to quit
+	defer func() {
+		for _, table := range f.tables {
+			table.Close()
+		}
+		f.instanceLock.Release()
+	}()
+	frozen, err := f.Ancients()
+	if err != nil {
+		return err
+	}
+	if items > frozen {
+		return fmt.Errorf("truncation target beyond ancient items: %d > %d", items, frozen)
+	}
+	blob, err := f.Ancient(freezerHashTable, items-1)
+	if err != nil {
+		return err
+	}
+	head := common.BytesToHash(blob)
+
+	// Rewind the markers before dropping the data, so an interruption in between
+	// leaves a consistent, if shorter, chain behind
+	if number := ReadHeaderNumber(db, ReadHeadHeaderHash(db)); number == nil || *number >= items {
+		WriteHeadHeaderHash(db, head)
+	}
+	if number := ReadHeaderNumber(db, ReadHeadFastBlockHash(db)); number == nil || *number >= items {
+		WriteHeadFastBlockHash(db, head)
+	}
+	if number := ReadHeaderNumber(db, ReadHeadBlockHash(db)); number == nil || *number >= items {
+		WriteHeadBlockHash(db, head)
+	}
+	if err := f.TruncateAncients(items); err != nil {
+		return err
+	}
+	log.Info("Truncated ancient store", "items", items, "dropped", frozen-items, "head", head)
+	return nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// newVerifyTestFreezer creates a freezer filled with a chain of blocks, each
+// containing a few transactions and their receipts.
+func newVerifyTestFreezer(t *testing.T, blocks int) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "freezer-verify")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	db, err := NewDatabaseWithFreezer(NewMemoryDatabase(), dir, "")
+	if err != nil {
+		t.Fatalf("failed to create database with ancient backend: %v", err)
+	}
+	var (
+		parent common.Hash
+		td     = new(big.Int)
+	)
+	for i := 0; i < blocks; i++ {
+		var (
+			txs      []*types.Transaction
+			receipts []*types.Receipt
+		)
+		for j := 0; j < i%4; j++ {
+			txs = append(txs, types.NewTransaction(uint64(j), common.Address{byte(i)}, big.NewInt(int64(j)), 21000, big.NewInt(1), nil))
+
+			receipt := types.NewReceipt(nil, false, uint64(21000*(j+1)))
+			receipt.Logs = []*types.Log{{Address: common.Address{byte(j)}, Topics: []common.Hash{{byte(i)}}}}
+			receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+			receipts = append(receipts, receipt)
+		}
+		header := &types.Header{
+			ParentHash: parent,
+			Number:     big.NewInt(int64(i)),
+			Difficulty: big.NewInt(int64(i + 1)),
+			Extra:      []byte("test block"),
+		}
+		block := types.NewBlock(header, txs, nil, receipts, newHasher())
+		td.Add(td, block.Difficulty())
+
+		WriteAncientBlock(db, block, receipts, td)
+		parent = block.Hash()
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("failed to close database: %v", err)
+	}
+	return dir
+}
+
+// Tests that an intact freezer passes verification.
+func TestVerifyFreezer(t *testing.T) {
+	dir := newVerifyTestFreezer(t, 32)
+	defer os.RemoveAll(dir)
+
+	items, err := VerifyFreezer(dir, newHasher())
+	if err != nil {
+		t.Fatalf("failed to verify freezer: %v", err)
+	}
+	if items != 32 {
+		t.Fatalf("verified item count mismatch: have %d, want %d", items, 32)
+	}
+}
+
+// Tests that a data file truncated in the middle of a table is detected, that
+// the first item affected is reported, and that the freezer can be cut back to
+// the intact items.
+func TestVerifyFreezerTruncatedData(t *testing.T) {
+	dir := newVerifyTestFreezer(t, 32)
+	defer os.RemoveAll(dir)
+
+	// Cut the bodies data file in the middle of item 20
+	index, err := ioutil.ReadFile(filepath.Join(dir, "bodies.cidx"))
+	if err != nil {
+		t.Fatalf("failed to read index: %v", err)
+	}
+	end := binary.BigEndian.Uint32(index[21*indexEntrySize+2:])
+	if err := os.Truncate(filepath.Join(dir, "bodies.0000.cdat"), int64(end-1)); err != nil {
+		t.Fatalf("failed to truncate data file: %v", err)
+	}
+	items, err := VerifyFreezer(dir, newHasher())
+	if items != 20 {
+		t.Fatalf("verified item count mismatch: have %d, want %d", items, 20)
+	}
+	corruption, ok := err.(*FreezerCorruption)
+	if !ok {
+		t.Fatalf("error type mismatch: have %T (%v), want *FreezerCorruption", err, err)
+	}
+	if corruption.Table != freezerBodiesTable || corruption.Item != 20 {
+		t.Fatalf("corruption location mismatch: have %s/%d, want %s/%d", corruption.Table, corruption.Item, freezerBodiesTable, 20)
+	}
+	// Truncate the freezer to the intact items and ensure the head is rewound
+	db := NewMemoryDatabase()
+	head := common.Hash{0xff}
+	WriteHeaderNumber(db, head, 31)
+	WriteHeadHeaderHash(db, head)
+
+	if err := TruncateFreezer(db, dir, items); err != nil {
+		t.Fatalf("failed to truncate freezer: %v", err)
+	}
+	if items, err := VerifyFreezer(dir, newHasher()); err != nil || items != 20 {
+		t.Fatalf("truncated freezer verification mismatch: have %d/%v, want %d/nil", items, err, 20)
+	}
+	hashes, err := ioutil.ReadFile(filepath.Join(dir, "hashes.0000.rdat"))
+	if err != nil {
+		t.Fatalf("failed to read hashes: %v", err)
+	}
+	if have, want := ReadHeadHeaderHash(db), common.BytesToHash(hashes[19*common.HashLength:20*common.HashLength]); have != want {
+		t.Fatalf("head header mismatch: have %x, want %x", have, want)
+	}
+}
+
+// Tests that data which is readable but inconsistent with the header is detected.
+func TestVerifyFreezerMismatchedData(t *testing.T) {
+	dir := newVerifyTestFreezer(t, 32)
+	defer os.RemoveAll(dir)
+
+	// Overwrite the total difficulty of item 10 with a different, valid value
+	index, err := ioutil.ReadFile(filepath.Join(dir, "diffs.ridx"))
+	if err != nil {
+		t.Fatalf("failed to read index: %v", err)
+	}
+	start := binary.BigEndian.Uint32(index[10*indexEntrySize+2:])
+	file, err := os.OpenFile(filepath.Join(dir, "diffs.0000.rdat"), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("failed to open data file: %v", err)
+	}
+	if _, err := file.WriteAt([]byte{0x01}, int64(start)); err != nil {
+		t.Fatalf("failed to overwrite total difficulty: %v", err)
+	}
+	file.Close()
+
+	items, err := VerifyFreezer(dir, newHasher())
+	if items != 10 {
+		t.Fatalf("verified item count mismatch: have %d, want %d", items, 10)
+	}
+	if corruption, ok := err.(*FreezerCorruption); !ok || corruption.Table != freezerDifficultyTable || corruption.Item != 10 {
+		t.Fatalf("corruption mismatch: have %v, want table %s, item %d", err, freezerDifficultyTable, 10)
+	}
+}
@@ -51,6 +51,20 @@ var (
 	// snapshotJournalKey tracks the in-memory diff layers across restarts.
 	snapshotJournalKey = []byte("SnapshotJournal")
 
+	// snapshotPruneMarkerKey tracks the target root of an in-progress offline
+	// state pruning, to allow resuming it after a crash.
+	snapshotPruneMarkerKey = []byte("SnapshotPruneMarker")
+
+	// snapshotSyncStatusKey tracks the snapshot sync status across restarts.
+	snapshotSyncStatusKey = []byte("SnapshotSyncStatus")
+
+	// stateSchemeKey tracks the scheme used to store the state trie nodes.
+	stateSchemeKey = []byte("TrieScheme")
+
+	// persistentStateIDKey tracks the id of the latest persisted state in the
+	// path-based scheme.
+	persistentStateIDKey = []byte("LastStateID")
+
 	// txIndexTailKey tracks the oldest block whose transactions have been indexed.
 	txIndexTailKey = []byte("TransactionIndexTail")
 
@@ -71,12 +85,22 @@ var (
 	SnapshotAccountPrefix = []byte("a") // SnapshotAccountPrefix + account hash -> account trie value
 	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
 	codePrefix            = []byte("c") // codePrefix + code hash -> account code
+	TrieNodeAccountPrefix = []byte("A") // TrieNodeAccountPrefix + hex path -> account trie node (path scheme)
+	TrieNodeStoragePrefix = []byte("O") // TrieNodeStoragePrefix + account hash + hex path -> storage trie node (path scheme)
+	stateIDPrefix         = []byte("L") // stateIDPrefix + state root -> state id (uint64 big endian)
+	reverseDiffPrefix     = []byte("D") // reverseDiffPrefix + state id (uint64 big endian) -> reverse diff
+	callTracesPrefix      = []byte("x") // callTracesPrefix + num (uint64 big endian) -> block hash + flattened call traces
+	callTraceIndexPrefix  = []byte("X") // callTraceIndexPrefix + address + num (uint64 big endian) -> nil
+	accountChangesPrefix  = []byte("y") // accountChangesPrefix + num (uint64 big endian) -> block hash + changed addresses
+	accountHistoryPrefix  = []byte("Y") // accountHistoryPrefix + address + num (uint64 big endian) -> account history entry
 
 	preimagePrefix = []byte("secure-key-")      // preimagePrefix + hash -> preimage
 	configPrefix   = []byte("ethereum-config-") // config prefix for the db
 
 	// Chain index prefixes (use `i` + single byte to avoid mixing data types).
 	BloomBitsIndexPrefix = []byte("iB") // BloomBitsIndexPrefix is the data table of a chain indexer to track its progress
+	CallTraceIndexPrefix = []byte("iT") // CallTraceIndexPrefix is the data table of the call trace indexer to track its progress
+	AccountHistoryPrefix = []byte("iA") // AccountHistoryPrefix is the data table of the account history indexer to track its progress
 
 	preimageCounter    = metrics.NewRegisteredCounter("db/preimage/total", nil)
 	preimageHitCounter = metrics.NewRegisteredCounter("db/preimage/hits", nil)
@@ -189,6 +213,26 @@ func bloomBitsKey(bit uint, section uint64, hash common.Hash) []byte {
 	return key
 }
 
+// callTracesKey = callTracesPrefix + num (uint64 big endian)
+func callTracesKey(number uint64) []byte {
+	return append(callTracesPrefix, encodeBlockNumber(number)...)
+}
+
+// callTraceIndexKey = callTraceIndexPrefix + address + num (uint64 big endian)
+func callTraceIndexKey(address common.Address, number uint64) []byte {
+	return append(append(callTraceIndexPrefix, address.Bytes()...), encodeBlockNumber(number)...)
+}
+
+// accountChangesKey = accountChangesPrefix + num (uint64 big endian)
+func accountChangesKey(number uint64) []byte {
+	return append(accountChangesPrefix, encodeBlockNumber(number)...)
+}
+
+// accountHistoryKey = accountHistoryPrefix + address + num (uint64 big endian)
+func accountHistoryKey(address common.Address, number uint64) []byte {
+	return append(append(accountHistoryPrefix, address.Bytes()...), encodeBlockNumber(number)...)
+}
+
 // preimageKey = preimagePrefix + hash
 func preimageKey(hash common.Hash) []byte {
 	return append(preimagePrefix, hash.Bytes()...)
@@ -208,6 +252,26 @@ func IsCodeKey(key []byte) (bool, []byte) {
 	return false, nil
 }
 
+// accountTrieNodeKey = TrieNodeAccountPrefix + path
+func accountTrieNodeKey(path []byte) []byte {
+	return append(TrieNodeAccountPrefix, path...)
+}
+
+// storageTrieNodeKey = TrieNodeStoragePrefix + accountHash + path
+func storageTrieNodeKey(accountHash common.Hash, path []byte) []byte {
+	return append(append(TrieNodeStoragePrefix, accountHash.Bytes()...), path...)
+}
+
+// stateIDKey = stateIDPrefix + root
+func stateIDKey(root common.Hash) []byte {
+	return append(stateIDPrefix, root.Bytes()...)
+}
+
+// reverseDiffKey = reverseDiffPrefix + id (uint64 big endian)
+func reverseDiffKey(id uint64) []byte {
+	return append(reverseDiffPrefix, encodeBlockNumber(id)...)
+}
+
 // configKey = configPrefix + hash
 func configKey(hash common.Hash) []byte {
 	return append(configPrefix, hash.Bytes()...)
@@ -134,7 +134,7 @@ func (db *cachingDB) OpenTrie(root common.Hash) (Trie, error) {
 
 // OpenStorageTrie opens the storage trie of an account.
 func (db *cachingDB) OpenStorageTrie(addrHash, root common.Hash) (Trie, error) {
-	return trie.NewSecure(root, db.db)
+	return trie.NewSecureWithOwner(addrHash, root, db.db)
 }
 
 // CopyTrie returns an independent copy of the given trie.
@@ -0,0 +1,183 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// AccountState is the content of an account at a point in time. Only the storage
+// slots relevant to a diff are included.
+type AccountState struct {
+	Balance *big.Int
+	Nonce   uint64
+	Code    []byte
+	Storage map[common.Hash]common.Hash
+}
+
+// AccountDiff is the change of an account, with the values of all the fields
+// before and after the change. Pre is nil for accounts which didn't exist yet,
+// Post is nil for accounts which self-destructed.
+type AccountDiff struct {
+	Pre  *AccountState
+	Post *AccountState
+}
+
+// diffOrigin tracks the original values of an account while walking the journal.
+type diffOrigin struct {
+	born  bool         // Whether the account didn't exist originally
+	reset *stateObject // Original account overwritten by a contract creation
+
+	balance *big.Int
+	nonce   *uint64
+	code    []byte
+	hasCode bool
+	storage map[common.Hash]common.Hash
+}
+
+// Diff returns the changes made to the accounts since the state was last
+// finalised, i.e. the effects of the transaction being currently applied. The
+// original values are recovered from the journal of changes.
+func (s *StateDB) Diff() map[common.Address]*AccountDiff {
+	origins := make(map[common.Address]*diffOrigin)
+
+	origin := func(addr common.Address) (*diffOrigin, bool) {
+		if o, ok := origins[addr]; ok {
+			return o, false
+		}
+		o := &diffOrigin{storage: make(map[common.Hash]common.Hash)}
+		origins[addr] = o
+		return o, true
+	}
+	for _, entry := range s.journal.entries {
+		switch change := entry.(type) {
+		case createObjectChange:
+			if o, fresh := origin(*change.account); fresh {
+				o.born = true
+			}
+		case resetObjectChange:
+			o, fresh := origin(change.prev.address)
+			if fresh && change.prev.deleted {
+				o.born = true
+				break
+			}
+			// The account is overwritten by a contract creation, any original
+			// values not yet seen are the ones of the old account
+			if !o.born && o.reset == nil {
+				o.reset = change.prev
+				if o.balance == nil {
+					o.balance = new(big.Int).Set(change.prev.Balance())
+				}
+				if o.nonce == nil {
+					nonce := change.prev.Nonce()
+					o.nonce = &nonce
+				}
+				if !o.hasCode {
+					o.code, o.hasCode = change.prev.Code(s.db), true
+				}
+			}
+		case balanceChange:
+			if o, _ := origin(*change.account); o.balance == nil {
+				o.balance = new(big.Int).Set(change.prev)
+			}
+		case suicideChange:
+			if o, _ := origin(*change.account); o.balance == nil {
+				o.balance = new(big.Int).Set(change.prevbalance)
+			}
+		case nonceChange:
+			if o, _ := origin(*change.account); o.nonce == nil {
+				nonce := change.prev
+				o.nonce = &nonce
+			}
+		case codeChange:
+			if o, _ := origin(*change.account); !o.hasCode {
+				o.code, o.hasCode = change.prevcode, true
+			}
+		case storageChange:
+			o, _ := origin(*change.account)
+			if _, ok := o.storage[change.key]; !ok {
+				// Slots of overwritten accounts start out empty, but originally
+				// held the values of the old account
+				if o.reset != nil {
+					o.storage[change.key] = o.reset.GetState(s.db, change.key)
+				} else {
+					o.storage[change.key] = change.prevalue
+				}
+			}
+		}
+	}
+	diffs := make(map[common.Address]*AccountDiff, len(origins))
+	for addr, o := range origins {
+		obj := s.stateObjects[addr]
+		if obj == nil {
+			continue
+		}
+		diff := new(AccountDiff)
+		if !obj.suicided && !obj.deleted {
+			diff.Post = &AccountState{
+				Balance: new(big.Int).Set(obj.Balance()),
+				Nonce:   obj.Nonce(),
+				Code:    obj.Code(s.db),
+				Storage: make(map[common.Hash]common.Hash, len(o.storage)),
+			}
+			for key := range o.storage {
+				diff.Post.Storage[key] = obj.GetState(s.db, key)
+			}
+		}
+		if !o.born {
+			// Fields not changed by the journal are still at their original values
+			diff.Pre = &AccountState{
+				Balance: o.balance,
+				Code:    o.code,
+				Storage: o.storage,
+			}
+			if diff.Pre.Balance == nil {
+				diff.Pre.Balance = new(big.Int).Set(obj.Balance())
+			}
+			if o.nonce != nil {
+				diff.Pre.Nonce = *o.nonce
+			} else {
+				diff.Pre.Nonce = obj.Nonce()
+			}
+			if !o.hasCode {
+				diff.Pre.Code = obj.Code(s.db)
+			}
+		}
+		// Accounts created empty, or created and destroyed again, don't exist
+		// before nor after the change
+		if diff.Pre == nil && (diff.Post == nil || diff.Post.empty()) {
+			continue
+		}
+		diffs[addr] = diff
+	}
+	return diffs
+}
+
+// empty returns whether the account is indistinguishable from a non-existent one.
+func (a *AccountState) empty() bool {
+	if a.Nonce != 0 || a.Balance.Sign() != 0 || len(a.Code) != 0 {
+		return false
+	}
+	for _, value := range a.Storage {
+		if value != (common.Hash{}) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+)
+
+// Tests that the diff of the changes made since the last finalisation recovers
+// the original values of all the modified accounts.
+func TestStateDiff(t *testing.T) {
+	var (
+		modified  = common.Address{0x01}
+		destroyed = common.Address{0x02}
+		created   = common.Address{0x03}
+		touched   = common.Address{0x04}
+		reset     = common.Address{0x05}
+		untouched = common.Address{0x06}
+
+		key1 = common.Hash{0x01}
+		key2 = common.Hash{0x02}
+	)
+	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
+
+	state.SetBalance(modified, big.NewInt(100))
+	state.SetNonce(modified, 1)
+	state.SetCode(modified, []byte{0x60})
+	state.SetState(modified, key1, common.Hash{0x11})
+	state.SetBalance(destroyed, big.NewInt(200))
+	state.SetState(destroyed, key1, common.Hash{0x22})
+	state.SetBalance(reset, big.NewInt(300))
+	state.SetNonce(reset, 3)
+	state.SetBalance(untouched, big.NewInt(400))
+	state.Finalise(true)
+
+	if diff := state.Diff(); len(diff) != 0 {
+		t.Fatalf("diff after finalisation: %v", diff)
+	}
+	// Apply a set of changes, some of them reverted later
+	state.AddBalance(modified, big.NewInt(50))
+	state.SetNonce(modified, 2)
+	state.SetState(modified, key1, common.Hash{0x12})
+	state.SetState(modified, key2, common.Hash{0x13})
+	state.Suicide(destroyed)
+	state.AddBalance(created, big.NewInt(10))
+	state.AddBalance(touched, new(big.Int))
+	state.CreateAccount(reset)
+	state.SetCode(reset, []byte{0x61})
+	state.SetNonce(reset, 1)
+
+	snap := state.Snapshot()
+	state.SetBalance(untouched, big.NewInt(1))
+	state.RevertToSnapshot(snap)
+
+	want := map[common.Address]*AccountDiff{
+		modified: {
+			Pre: &AccountState{
+				Balance: big.NewInt(100),
+				Nonce:   1,
+				Code:    []byte{0x60},
+				Storage: map[common.Hash]common.Hash{key1: {0x11}, key2: {}},
+			},
+			Post: &AccountState{
+				Balance: big.NewInt(150),
+				Nonce:   2,
+				Code:    []byte{0x60},
+				Storage: map[common.Hash]common.Hash{key1: {0x12}, key2: {0x13}},
+			},
+		},
+		destroyed: {
+			Pre: &AccountState{
+				Balance: big.NewInt(200),
+				Storage: map[common.Hash]common.Hash{},
+			},
+		},
+		created: {
+			Post: &AccountState{
+				Balance: big.NewInt(10),
+				Storage: map[common.Hash]common.Hash{},
+			},
+		},
+		reset: {
+			Pre: &AccountState{
+				Balance: big.NewInt(300),
+				Nonce:   3,
+				Storage: map[common.Hash]common.Hash{},
+			},
+			Post: &AccountState{
+				Balance: big.NewInt(300),
+				Nonce:   1,
+				Code:    []byte{0x61},
+				Storage: map[common.Hash]common.Hash{},
+			},
+		},
+	}
+	have := state.Diff()
+	if len(have) != len(want) {
+		t.Errorf("diff size mismatch: have %d, want %d", len(have), len(want))
+	}
+	for addr, diff := range want {
+		if !reflect.DeepEqual(normalizeDiff(have[addr]), normalizeDiff(diff)) {
+			t.Errorf("account %x: diff mismatch:\nhave pre %+v post %+v\nwant pre %+v post %+v", addr, have[addr].Pre, have[addr].Post, diff.Pre, diff.Post)
+		}
+	}
+}
+
+// normalizeDiff replaces empty code with nil, to compare diffs regardless of how
+// the code was retrieved.
+func normalizeDiff(diff *AccountDiff) *AccountDiff {
+	if diff == nil {
+		return nil
+	}
+	for _, acc := range []*AccountState{diff.Pre, diff.Post} {
+		if acc != nil && len(acc.Code) == 0 {
+			acc.Code = nil
+		}
+	}
+	return diff
+}
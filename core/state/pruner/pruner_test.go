@@ -0,0 +1,241 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// makeTestChain creates an archive chain of the given length with snapshots
+// enabled, where every block modifies the state. The database is returned
+// after the chain has been stopped and the snapshot journalled.
+func makeTestChain(t *testing.T, blocks int) (ethdb.Database, []*types.Block) {
+	var (
+		key, _  = crypto.GenerateKey()
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		db      = rawdb.NewMemoryDatabase()
+		gspec   = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  core.GenesisAlloc{address: {Balance: big.NewInt(1000000000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		gendb   = rawdb.NewMemoryDatabase()
+		signer  = types.LatestSigner(gspec.Config)
+	)
+	gspec.MustCommit(gendb)
+	chain, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, blocks, func(i int, b *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(address), common.Address{byte(i)}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		b.AddTx(tx)
+	})
+	cacheConfig := &core.CacheConfig{
+		TrieCleanLimit:    256,
+		TrieDirtyDisabled: true, // Archive mode, every state is persisted
+		SnapshotLimit:     256,
+		SnapshotWait:      true,
+	}
+	blockchain, err := core.NewBlockChain(db, cacheConfig, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	blockchain.Stop()
+	return db, append([]*types.Block{genesis}, chain...)
+}
+
+// newTestPruner creates a pruner with a small bloom filter to keep the memory
+// usage of the tests reasonable.
+func newTestPruner(t *testing.T, db ethdb.Database, datadir string) *Pruner {
+	head := rawdb.ReadHeadBlock(db)
+	bloom, err := newStateBloomWithSize(1)
+	if err != nil {
+		t.Fatalf("failed to create state bloom: %v", err)
+	}
+	return &Pruner{
+		db:            db,
+		stateBloom:    bloom,
+		datadir:       datadir,
+		trieCachePath: filepath.Join(datadir, "triecache"),
+		headHeader:    head.Header(),
+		snaptree:      snapshot.New(db, trie.NewDatabase(db), 256, head.Root(), false),
+	}
+}
+
+// checkState verifies that the entire state belonging to the given root can
+// be iterated over from the database.
+func checkState(db ethdb.Database, root common.Hash) error {
+	statedb, err := state.New(root, state.NewDatabase(db), nil)
+	if err != nil {
+		return err
+	}
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+	}
+	return it.Error
+}
+
+func TestPruneState(t *testing.T) {
+	datadir, err := ioutil.TempDir("", "pruner-")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+
+	db, blocks := makeTestChain(t, 140)
+	head := blocks[len(blocks)-1]
+	target := blocks[len(blocks)-127]
+
+	if err := newTestPruner(t, db, datadir).Prune(common.Hash{}); err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	// The target and genesis state must be intact, everything else gone
+	if err := checkState(db, target.Root()); err != nil {
+		t.Fatalf("target state corrupted: %v", err)
+	}
+	if err := checkState(db, blocks[0].Root()); err != nil {
+		t.Fatalf("genesis state corrupted: %v", err)
+	}
+	for _, block := range []*types.Block{blocks[1], blocks[len(blocks)-128], head} {
+		if blob := rawdb.ReadTrieNode(db, block.Root()); len(blob) != 0 {
+			t.Errorf("state root of block #%d not pruned", block.NumberU64())
+		}
+	}
+	// The pruning must have been marked as finished
+	if marker := rawdb.ReadSnapshotPruneMarker(db); marker != (common.Hash{}) {
+		t.Errorf("prune marker not cleaned up: %x", marker)
+	}
+	if common.FileExist(bloomFilterName(datadir)) {
+		t.Errorf("state bloom not cleaned up")
+	}
+	if root := rawdb.ReadSnapshotRoot(db); root != target.Root() {
+		t.Errorf("snapshot root mismatch: have %x, want %x", root, target.Root())
+	}
+}
+
+func TestRecoverPruning(t *testing.T) {
+	datadir, err := ioutil.TempDir("", "pruner-")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+
+	db, blocks := makeTestChain(t, 140)
+	target := blocks[len(blocks)-127]
+
+	// Simulate a pruning which was interrupted right after the bloom filter
+	// was persisted, before any state was deleted
+	p := newTestPruner(t, db, datadir)
+	if err := snapshot.GenerateTrie(p.snaptree, target.Root(), db, p.stateBloom); err != nil {
+		t.Fatalf("failed to generate state: %v", err)
+	}
+	if err := extractGenesis(db, p.stateBloom); err != nil {
+		t.Fatalf("failed to extract genesis: %v", err)
+	}
+	name := bloomFilterName(datadir)
+	if err := p.stateBloom.Commit(name, name+stateBloomFileTempSuffix); err != nil {
+		t.Fatalf("failed to commit state bloom: %v", err)
+	}
+	rawdb.WriteSnapshotPruneMarker(db, target.Root())
+
+	// Recovering without the marker being cleaned up should finish the job
+	if err := RecoverPruning(datadir, db, filepath.Join(datadir, "triecache")); err != nil {
+		t.Fatalf("failed to recover pruning: %v", err)
+	}
+	if err := checkState(db, target.Root()); err != nil {
+		t.Fatalf("target state corrupted: %v", err)
+	}
+	if blob := rawdb.ReadTrieNode(db, blocks[1].Root()); len(blob) != 0 {
+		t.Errorf("stale state root not pruned")
+	}
+	if marker := rawdb.ReadSnapshotPruneMarker(db); marker != (common.Hash{}) {
+		t.Errorf("prune marker not cleaned up: %x", marker)
+	}
+	// A second recovery must be a noop
+	if err := RecoverPruning(datadir, db, filepath.Join(datadir, "triecache")); err != nil {
+		t.Fatalf("failed to run noop recovery: %v", err)
+	}
+}
+
+func TestRecoverPruningAfterSnapshotCap(t *testing.T) {
+	datadir, err := ioutil.TempDir("", "pruner-")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+
+	db, blocks := makeTestChain(t, 140)
+	target := blocks[len(blocks)-127]
+
+	if err := newTestPruner(t, db, datadir).Prune(common.Hash{}); err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	// Simulate an interruption after the snapshot was capped to the target and
+	// journaled, but before the marker and the bloom filter were dropped
+	bloom, err := newStateBloomWithSize(1)
+	if err != nil {
+		t.Fatalf("failed to create state bloom: %v", err)
+	}
+	snaptree := snapshot.New(db, trie.NewDatabase(db), 256, target.Root(), false)
+	if err := snapshot.GenerateTrie(snaptree, target.Root(), db, bloom); err != nil {
+		t.Fatalf("failed to generate state: %v", err)
+	}
+	if err := extractGenesis(db, bloom); err != nil {
+		t.Fatalf("failed to extract genesis: %v", err)
+	}
+	name := bloomFilterName(datadir)
+	if err := bloom.Commit(name, name+stateBloomFileTempSuffix); err != nil {
+		t.Fatalf("failed to commit state bloom: %v", err)
+	}
+	rawdb.WriteSnapshotPruneMarker(db, target.Root())
+
+	if err := RecoverPruning(datadir, db, filepath.Join(datadir, "triecache")); err != nil {
+		t.Fatalf("failed to recover pruning: %v", err)
+	}
+	if err := checkState(db, target.Root()); err != nil {
+		t.Fatalf("target state corrupted: %v", err)
+	}
+	if marker := rawdb.ReadSnapshotPruneMarker(db); marker != (common.Hash{}) {
+		t.Errorf("prune marker not cleaned up: %x", marker)
+	}
+	if common.FileExist(name) {
+		t.Errorf("state bloom not cleaned up")
+	}
+	if root := rawdb.ReadSnapshotRoot(db); root != target.Root() {
+		t.Errorf("snapshot root mismatch: have %x, want %x", root, target.Root())
+	}
+}
@@ -18,11 +18,14 @@ package snapshot
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/ethdb/memorydb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -37,22 +40,63 @@ type trieKV struct {
 
 type (
 	// trieGeneratorFn is the interface of trie generation which can
-	// be implemented by different trie algorithm.
-	trieGeneratorFn func(in chan (trieKV), out chan (common.Hash))
+	// be implemented by different trie algorithm. If the database is
+	// non-nil, the generated trie nodes are written into it as well.
+	trieGeneratorFn func(db ethdb.KeyValueWriter, in chan (trieKV), out chan (common.Hash))
 
 	// leafCallbackFn is the callback invoked at the leaves of the trie,
 	// returns the subtrie root with the specified subtrie identifier.
-	leafCallbackFn func(hash common.Hash, stat *generateStats) common.Hash
+	leafCallbackFn func(db ethdb.KeyValueWriter, accountHash, codeHash common.Hash, stat *generateStats) (common.Hash, error)
 )
 
 // GenerateAccountTrieRoot takes an account iterator and reproduces the root hash.
 func GenerateAccountTrieRoot(it AccountIterator) (common.Hash, error) {
-	return generateTrieRoot(it, common.Hash{}, stdGenerate, nil, &generateStats{start: time.Now()}, true)
+	return generateTrieRoot(nil, it, common.Hash{}, stdGenerate, nil, &generateStats{start: time.Now()}, true)
 }
 
 // GenerateStorageTrieRoot takes a storage iterator and reproduces the root hash.
 func GenerateStorageTrieRoot(account common.Hash, it StorageIterator) (common.Hash, error) {
-	return generateTrieRoot(it, account, stdGenerate, nil, &generateStats{start: time.Now()}, true)
+	return generateTrieRoot(nil, it, account, stdGenerate, nil, &generateStats{start: time.Now()}, true)
+}
+
+// GenerateTrie takes the whole snapshot tree as the input, traverses all the
+// accounts as well as the corresponding storages and regenerates the whole state
+// (account trie + all storage tries + contract codes) into the destination.
+// The contract codes are read from the source database.
+func GenerateTrie(snaptree *Tree, root common.Hash, src ethdb.Database, dst ethdb.KeyValueWriter) error {
+	// Traverse all state by snapshot, re-generate the whole state trie
+	acctIt, err := snaptree.AccountIterator(root, common.Hash{})
+	if err != nil {
+		return err // The required snapshot might not exist.
+	}
+	defer acctIt.Release()
+
+	got, err := generateTrieRoot(dst, acctIt, common.Hash{}, stackTrieGenerate, func(dst ethdb.KeyValueWriter, accountHash, codeHash common.Hash, stat *generateStats) (common.Hash, error) {
+		// Migrate the code first, commit the contract code into the destination
+		if codeHash != emptyCode {
+			code := rawdb.ReadCode(src, codeHash)
+			if len(code) == 0 {
+				return common.Hash{}, errors.New("failed to read contract code")
+			}
+			rawdb.WriteCode(dst, codeHash, code)
+		}
+		// Then regenerate all storage trie nodes into the destination
+		storageIt, err := snaptree.StorageIterator(root, accountHash, common.Hash{})
+		if err != nil {
+			return common.Hash{}, err
+		}
+		defer storageIt.Release()
+
+		return generateTrieRoot(dst, storageIt, accountHash, stackTrieGenerate, nil, stat, false)
+	}, &generateStats{start: time.Now()}, true)
+
+	if err != nil {
+		return err
+	}
+	if got != root {
+		return fmt.Errorf("state root hash mismatch: got %x, want %x", got, root)
+	}
+	return nil
 }
 
 // VerifyState takes the whole snapshot tree as the input, traverses all the accounts
@@ -65,18 +109,14 @@ func VerifyState(snaptree *Tree, root common.Hash) error {
 	}
 	defer acctIt.Release()
 
-	got, err := generateTrieRoot(acctIt, common.Hash{}, stdGenerate, func(account common.Hash, stat *generateStats) common.Hash {
-		storageIt, err := snaptree.StorageIterator(root, account, common.Hash{})
+	got, err := generateTrieRoot(nil, acctIt, common.Hash{}, stdGenerate, func(db ethdb.KeyValueWriter, accountHash, codeHash common.Hash, stat *generateStats) (common.Hash, error) {
+		storageIt, err := snaptree.StorageIterator(root, accountHash, common.Hash{})
 		if err != nil {
-			return common.Hash{}
+			return common.Hash{}, err
 		}
 		defer storageIt.Release()
 
-		hash, err := generateTrieRoot(storageIt, account, stdGenerate, nil, stat, false)
-		if err != nil {
-			return common.Hash{}
-		}
-		return hash
+		return generateTrieRoot(nil, storageIt, accountHash, stdGenerate, nil, stat, false)
 	}, &generateStats{start: time.Now()}, true)
 
 	if err != nil {
@@ -150,7 +190,7 @@ func (stat *generateStats) reportDone() {
 // generateTrieRoot generates the trie hash based on the snapshot iterator.
 // It can be used for generating account trie, storage trie or even the
 // whole state which connects the accounts and the corresponding storages.
-func generateTrieRoot(it Iterator, account common.Hash, generatorFn trieGeneratorFn, leafCallback leafCallbackFn, stats *generateStats, report bool) (common.Hash, error) {
+func generateTrieRoot(db ethdb.KeyValueWriter, it Iterator, account common.Hash, generatorFn trieGeneratorFn, leafCallback leafCallbackFn, stats *generateStats, report bool) (common.Hash, error) {
 	var (
 		in      = make(chan trieKV)         // chan to pass leaves
 		out     = make(chan common.Hash, 1) // chan to collect result
@@ -161,7 +201,7 @@ func generateTrieRoot(it Iterator, account common.Hash, generatorFn trieGenerato
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		generatorFn(in, out)
+		generatorFn(db, in, out)
 	}()
 
 	// Spin up a go-routine for progress logging
@@ -223,7 +263,11 @@ func generateTrieRoot(it Iterator, account common.Hash, generatorFn trieGenerato
 				}
 				// Apply the leaf callback. Normally the callback is used to traverse
 				// the storage trie and re-generate the subtrie root.
-				subroot := leafCallback(it.Hash(), stats)
+				subroot, err := leafCallback(db, it.Hash(), common.BytesToHash(account.CodeHash), stats)
+				if err != nil {
+					stop(false)
+					return common.Hash{}, err
+				}
 				if !bytes.Equal(account.Root, subroot.Bytes()) {
 					stop(false)
 					return common.Hash{}, fmt.Errorf("invalid subroot(%x), want %x, got %x", it.Hash(), account.Root, subroot)
@@ -266,10 +310,25 @@ func generateTrieRoot(it Iterator, account common.Hash, generatorFn trieGenerato
 
 // stdGenerate is a very basic hexary trie builder which uses the same Trie
 // as the rest of geth, with no enhancements or optimizations
-func stdGenerate(in chan (trieKV), out chan (common.Hash)) {
+func stdGenerate(db ethdb.KeyValueWriter, in chan (trieKV), out chan (common.Hash)) {
 	t, _ := trie.New(common.Hash{}, trie.NewDatabase(memorydb.New()))
 	for leaf := range in {
 		t.TryUpdate(leaf.key[:], leaf.value)
 	}
 	out <- t.Hash()
 }
+
+// stackTrieGenerate is a trie builder which uses the stack trie, persisting all
+// the generated nodes into the given database (if any). The leaves must be fed
+// in ascending key order, which the snapshot iterators guarantee.
+func stackTrieGenerate(db ethdb.KeyValueWriter, in chan (trieKV), out chan (common.Hash)) {
+	t := trie.NewStackTrie(db)
+	for leaf := range in {
+		t.TryUpdate(leaf.key[:], leaf.value)
+	}
+	if db == nil {
+		out <- t.Hash()
+		return
+	}
+	out <- t.Commit(db)
+}
@@ -727,3 +727,67 @@ func TestMissingTrieNodes(t *testing.T) {
 		t.Fatalf("expected error, got root :%x", root)
 	}
 }
+
+func TestPrepareAccessList(t *testing.T) {
+	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
+
+	var (
+		sender  = common.HexToAddress("0xaa")
+		dest    = common.HexToAddress("0xbb")
+		precomp = common.HexToAddress("0x01")
+		other   = common.HexToAddress("0xcc")
+		slot    = common.HexToHash("0x01")
+	)
+	state.PrepareAccessList(sender, &dest, []common.Address{precomp}, types.AccessList{
+		{Address: other, StorageKeys: []common.Hash{slot}},
+	})
+	for _, addr := range []common.Address{sender, dest, precomp, other} {
+		if !state.AddressInAccessList(addr) {
+			t.Errorf("address %x missing from access list", addr)
+		}
+	}
+	if addrOk, slotOk := state.SlotInAccessList(other, slot); !addrOk || !slotOk {
+		t.Errorf("slot missing from access list: address %v, slot %v", addrOk, slotOk)
+	}
+	if _, slotOk := state.SlotInAccessList(dest, slot); slotOk {
+		t.Error("unexpected slot in access list")
+	}
+	// The copy must be independent, and a new preparation must reset the list
+	cpy := state.Copy()
+	state.PrepareAccessList(sender, nil, nil, nil)
+	if state.AddressInAccessList(other) {
+		t.Error("access list not reset by PrepareAccessList")
+	}
+	if !cpy.AddressInAccessList(other) {
+		t.Error("copied access list modified by original")
+	}
+}
+
+func TestStateDBAccessListRevert(t *testing.T) {
+	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
+
+	var (
+		addr  = common.HexToAddress("0xaa")
+		other = common.HexToAddress("0xbb")
+		slot  = common.HexToHash("0x01")
+	)
+	state.AddAddressToAccessList(addr)
+	snapshot := state.Snapshot()
+
+	state.AddSlotToAccessList(addr, slot)
+	state.AddSlotToAccessList(other, slot)
+	if addrOk, slotOk := state.SlotInAccessList(other, slot); !addrOk || !slotOk {
+		t.Fatalf("slot missing from access list: address %v, slot %v", addrOk, slotOk)
+	}
+	state.RevertToSnapshot(snapshot)
+
+	if !state.AddressInAccessList(addr) {
+		t.Error("address added before the snapshot was reverted")
+	}
+	if _, slotOk := state.SlotInAccessList(addr, slot); slotOk {
+		t.Error("slot added after the snapshot was not reverted")
+	}
+	if state.AddressInAccessList(other) {
+		t.Error("address added after the snapshot was not reverted")
+	}
+}
@@ -79,6 +79,20 @@ func pricedTransaction(nonce uint64, gaslimit uint64, gasprice *big.Int, key *ec
 	return tx
 }
 
+func dynamicFeeTx(nonce uint64, gaslimit uint64, gasFee *big.Int, tip *big.Int, key *ecdsa.PrivateKey) *types.Transaction {
+	tx, _ := types.SignNewTx(key, types.LatestSignerForChainID(params.TestChainConfig.ChainID), &types.DynamicFeeTx{
+		ChainID:   params.TestChainConfig.ChainID,
+		Nonce:     nonce,
+		GasTipCap: tip,
+		GasFeeCap: gasFee,
+		Gas:       gaslimit,
+		To:        &common.Address{},
+		Value:     big.NewInt(100),
+		Data:      nil,
+	})
+	return tx
+}
+
 func pricedDataTransaction(nonce uint64, gaslimit uint64, gasprice *big.Int, key *ecdsa.PrivateKey, bytes uint64) *types.Transaction {
 	data := make([]byte, bytes)
 	rand.Read(data)
@@ -1736,6 +1750,54 @@ func TestTransactionReplacement(t *testing.T) {
 	}
 }
 
+// Tests that dynamic fee transactions are only accepted after London and that
+// both the fee cap and the tip need to be bumped to replace one.
+func TestTransactionReplacementDynamicFee(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	key, _ := crypto.GenerateKey()
+	statedb.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	// Dynamic fee transactions must be rejected before London
+	config := *params.TestChainConfig
+	config.BerlinBlock = common.Big0
+	config.LondonBlock = big.NewInt(100)
+
+	pool := NewTxPool(testTxPoolConfig, &config, &testBlockChain{statedb, 1000000, new(event.Feed)})
+	if err := pool.AddRemote(dynamicFeeTx(0, 100000, big.NewInt(2), big.NewInt(1), key)); err != ErrTxTypeNotSupported {
+		t.Fatalf("pre-London dynamic fee transaction error mismatch: have %v, want %v", err, ErrTxTypeNotSupported)
+	}
+	pool.Stop()
+
+	config.LondonBlock = common.Big0
+
+	pool = NewTxPool(testTxPoolConfig, &config, &testBlockChain{statedb, 1000000, new(event.Feed)})
+	defer pool.Stop()
+
+	if err := pool.AddRemote(dynamicFeeTx(0, 100000, big.NewInt(1), big.NewInt(2), key)); err != ErrTipAboveFeeCap {
+		t.Fatalf("tip above fee cap error mismatch: have %v, want %v", err, ErrTipAboveFeeCap)
+	}
+	if err := pool.AddRemote(dynamicFeeTx(0, 100000, big.NewInt(100), big.NewInt(0), key)); err != ErrUnderpriced {
+		t.Fatalf("tip below minimum error mismatch: have %v, want %v", err, ErrUnderpriced)
+	}
+	if err := pool.addRemoteSync(dynamicFeeTx(0, 100000, big.NewInt(100), big.NewInt(100), key)); err != nil {
+		t.Fatalf("failed to add original dynamic fee transaction: %v", err)
+	}
+	if err := pool.AddRemote(dynamicFeeTx(0, 100000, big.NewInt(200), big.NewInt(100), key)); err != ErrReplaceUnderpriced {
+		t.Fatalf("fee cap only replacement error mismatch: have %v, want %v", err, ErrReplaceUnderpriced)
+	}
+	if err := pool.AddRemote(dynamicFeeTx(0, 100000, big.NewInt(109), big.NewInt(109), key)); err != ErrReplaceUnderpriced {
+		t.Fatalf("below threshold replacement error mismatch: have %v, want %v", err, ErrReplaceUnderpriced)
+	}
+	if err := pool.addRemoteSync(dynamicFeeTx(0, 100000, big.NewInt(110), big.NewInt(110), key)); err != nil {
+		t.Fatalf("failed to replace dynamic fee transaction: %v", err)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
 // Tests that local transactions are journaled to disk, but remote transactions
 // get discarded between restarts.
 func TestTransactionJournaling(t *testing.T)         { testTransactionJournaling(t, false) }
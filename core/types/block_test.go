@@ -69,6 +69,40 @@ func TestBlockEncoding(t *testing.T) {
 	}
 }
 
+// Tests that the EIP-1559 base fee is appended to the header encoding only if
+// it is set, keeping legacy header hashes intact.
+func TestHeaderBaseFeeEncoding(t *testing.T) {
+	legacy := &Header{
+		Difficulty: big.NewInt(131072),
+		Number:     big.NewInt(1),
+		GasLimit:   3141592,
+		Time:       1426516743,
+		Extra:      []byte("test"),
+	}
+	london := CopyHeader(legacy)
+	london.BaseFee = big.NewInt(1000000000)
+
+	if legacy.Hash() == london.Hash() {
+		t.Fatal("base fee not included in header hash")
+	}
+	for _, header := range []*Header{legacy, london} {
+		enc, err := rlp.EncodeToBytes(header)
+		if err != nil {
+			t.Fatal("encode error: ", err)
+		}
+		var dec Header
+		if err := rlp.DecodeBytes(enc, &dec); err != nil {
+			t.Fatal("decode error: ", err)
+		}
+		if dec.Hash() != header.Hash() {
+			t.Errorf("hash mismatch: have %x, want %x", dec.Hash(), header.Hash())
+		}
+		if !reflect.DeepEqual(dec.BaseFee, header.BaseFee) {
+			t.Errorf("base fee mismatch: have %v, want %v", dec.BaseFee, header.BaseFee)
+		}
+	}
+}
+
 func TestUncleHash(t *testing.T) {
 	uncles := make([]*Header, 0)
 	h := CalcUncleHash(uncles)
@@ -73,6 +73,155 @@ func TestTransactionEncode(t *testing.T) {
 	}
 }
 
+func TestTransactionBinaryEncoding(t *testing.T) {
+	// Legacy transactions must keep their plain RLP list as canonical encoding.
+	blob, err := rightvrsTx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	enc, _ := rlp.EncodeToBytes(rightvrsTx)
+	if !bytes.Equal(blob, enc) {
+		t.Errorf("binary encoding mismatch: have %x, want %x", blob, enc)
+	}
+	var tx Transaction
+	if err := tx.UnmarshalBinary(blob); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if tx.Hash() != rightvrsTx.Hash() {
+		t.Errorf("hash mismatch: have %x, want %x", tx.Hash(), rightvrsTx.Hash())
+	}
+	// Envelopes with unknown or missing type bytes must be rejected.
+	if err := tx.UnmarshalBinary([]byte{0x7f, 0xc0}); err != ErrTxTypeNotSupported {
+		t.Errorf("unknown type: have error %v, want %v", err, ErrTxTypeNotSupported)
+	}
+	if err := tx.UnmarshalBinary(nil); err != errEmptyTypedTx {
+		t.Errorf("empty envelope: have error %v, want %v", err, errEmptyTypedTx)
+	}
+	if err := rlp.DecodeBytes([]byte{0x82, 0x7f, 0xc0}, &tx); err != ErrTxTypeNotSupported {
+		t.Errorf("unknown type in RLP: have error %v, want %v", err, ErrTxTypeNotSupported)
+	}
+}
+
+func TestAccessListTxEncoding(t *testing.T) {
+	key, addr := defaultTestKey()
+	signer := NewEIP2930Signer(big.NewInt(1))
+
+	to := common.HexToAddress("0x095e7baea6a6c7c4c2dfeb977efac326af552d87")
+	tx, err := SignNewTx(key, signer, &AccessListTx{
+		ChainID:  big.NewInt(1),
+		Nonce:    3,
+		To:       &to,
+		Gas:      25000,
+		GasPrice: big.NewInt(1),
+		Value:    big.NewInt(10),
+		Data:     common.FromHex("5544"),
+		AccessList: AccessList{
+			{Address: to, StorageKeys: []common.Hash{{0x01}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not sign transaction: %v", err)
+	}
+	if tx.Type() != AccessListTxType {
+		t.Fatalf("type mismatch: have %d, want %d", tx.Type(), AccessListTxType)
+	}
+	blob, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if blob[0] != AccessListTxType {
+		t.Fatalf("envelope type byte mismatch: have %#x, want %#x", blob[0], AccessListTxType)
+	}
+	var parsed Transaction
+	if err := parsed.UnmarshalBinary(blob); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if parsed.Hash() != tx.Hash() {
+		t.Errorf("hash mismatch: have %x, want %x", parsed.Hash(), tx.Hash())
+	}
+	if len(parsed.AccessList()) != 1 || parsed.AccessList().StorageKeys() != 1 {
+		t.Errorf("access list mismatch: have %v", parsed.AccessList())
+	}
+	from, err := Sender(signer, &parsed)
+	if err != nil {
+		t.Fatalf("could not recover sender: %v", err)
+	}
+	if from != addr {
+		t.Errorf("sender mismatch: have %x, want %x", from, addr)
+	}
+	// Access list transactions must not be accepted by pre-Berlin signers.
+	if _, err := Sender(NewEIP155Signer(big.NewInt(1)), &parsed); err != ErrTxTypeNotSupported {
+		t.Errorf("EIP155 signer: have error %v, want %v", err, ErrTxTypeNotSupported)
+	}
+}
+
+func TestDynamicFeeTxEncoding(t *testing.T) {
+	key, addr := defaultTestKey()
+	signer := NewLondonSigner(big.NewInt(1))
+
+	to := common.HexToAddress("0x095e7baea6a6c7c4c2dfeb977efac326af552d87")
+	tx, err := SignNewTx(key, signer, &DynamicFeeTx{
+		ChainID:   big.NewInt(1),
+		Nonce:     3,
+		To:        &to,
+		Gas:       25000,
+		GasTipCap: big.NewInt(2),
+		GasFeeCap: big.NewInt(10),
+		Value:     big.NewInt(10),
+		Data:      common.FromHex("5544"),
+	})
+	if err != nil {
+		t.Fatalf("could not sign transaction: %v", err)
+	}
+	blob, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if blob[0] != DynamicFeeTxType {
+		t.Fatalf("envelope type byte mismatch: have %#x, want %#x", blob[0], DynamicFeeTxType)
+	}
+	var parsed Transaction
+	if err := parsed.UnmarshalBinary(blob); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if parsed.Hash() != tx.Hash() {
+		t.Errorf("hash mismatch: have %x, want %x", parsed.Hash(), tx.Hash())
+	}
+	if parsed.GasTipCap().Cmp(big.NewInt(2)) != 0 || parsed.GasFeeCap().Cmp(big.NewInt(10)) != 0 {
+		t.Errorf("fee mismatch: have tip %v cap %v", parsed.GasTipCap(), parsed.GasFeeCap())
+	}
+	from, err := Sender(signer, &parsed)
+	if err != nil {
+		t.Fatalf("could not recover sender: %v", err)
+	}
+	if from != addr {
+		t.Errorf("sender mismatch: have %x, want %x", from, addr)
+	}
+	// Dynamic fee transactions must not be accepted by pre-London signers.
+	if _, err := Sender(NewEIP2930Signer(big.NewInt(1)), &parsed); err != ErrTxTypeNotSupported {
+		t.Errorf("EIP2930 signer: have error %v, want %v", err, ErrTxTypeNotSupported)
+	}
+	// The effective tip is capped by the fee cap once the base fee is deducted.
+	for _, tt := range []struct {
+		baseFee int64
+		tip     int64
+		err     error
+	}{
+		{0, 2, nil},
+		{7, 2, nil},
+		{9, 1, nil},
+		{11, -1, ErrGasFeeCapTooLow},
+	} {
+		tip, err := parsed.EffectiveGasTip(big.NewInt(tt.baseFee))
+		if err != tt.err {
+			t.Errorf("baseFee %d: error mismatch: have %v, want %v", tt.baseFee, err, tt.err)
+		}
+		if tip.Int64() != tt.tip {
+			t.Errorf("baseFee %d: tip mismatch: have %v, want %d", tt.baseFee, tip, tt.tip)
+		}
+	}
+}
+
 func decodeTx(data []byte) (*Transaction, error) {
 	var tx Transaction
 	t, err := &tx, rlp.Decode(bytes.NewReader(data), &tx)
@@ -140,7 +289,7 @@ func TestTransactionPriceNonceSort(t *testing.T) {
 		}
 	}
 	// Sort the transactions and cross check the nonce ordering
-	txset := NewTransactionsByPriceAndNonce(signer, groups)
+	txset := NewTransactionsByPriceAndNonce(signer, groups, nil)
 
 	txs := Transactions{}
 	for tx := txset.Peek(); tx != nil; tx = txset.Peek() {
@@ -171,6 +320,52 @@ func TestTransactionPriceNonceSort(t *testing.T) {
 	}
 }
 
+// Tests that dynamic fee transactions are sorted by their effective tip at the
+// given base fee, and that transactions unable to pay the base fee are skipped.
+func TestTransactionPriceNonceSort1559(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 5)
+	for i := 0; i < len(keys); i++ {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	signer := NewLondonSigner(common.Big1)
+	baseFee := big.NewInt(10)
+
+	// Fee caps grow with the account index while tips shrink, so the effective
+	// tip first grows (capped by fee cap - base fee) and then shrinks again.
+	groups := map[common.Address]Transactions{}
+	for i, key := range keys {
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		tx, _ := SignNewTx(key, signer, &DynamicFeeTx{
+			ChainID:   common.Big1,
+			Nonce:     0,
+			To:        &common.Address{},
+			Gas:       21000,
+			GasTipCap: big.NewInt(int64(10 - 2*i)),
+			GasFeeCap: big.NewInt(int64(9 + 3*i)),
+			Value:     common.Big0,
+		})
+		groups[addr] = append(groups[addr], tx)
+	}
+	txset := NewTransactionsByPriceAndNonce(signer, groups, baseFee)
+
+	txs := Transactions{}
+	for tx := txset.Peek(); tx != nil; tx = txset.Peek() {
+		txs = append(txs, tx)
+		txset.Shift()
+	}
+	// The first account can't pay the base fee and must be left out
+	if len(txs) != len(keys)-1 {
+		t.Fatalf("expected %d transactions, found %d", len(keys)-1, len(txs))
+	}
+	for i := 0; i+1 < len(txs); i++ {
+		tipi, _ := txs[i].EffectiveGasTip(baseFee)
+		tipn, _ := txs[i+1].EffectiveGasTip(baseFee)
+		if tipi.Cmp(tipn) < 0 {
+			t.Errorf("invalid tip ordering: tx #%d (T=%v) < tx #%d (T=%v)", i, tipi, i+1, tipn)
+		}
+	}
+}
+
 // Tests that if multiple transactions have the same price, the ones seen earlier
 // are prioritized to avoid network spam attacks aiming for a specific ordering.
 func TestTransactionTimeSort(t *testing.T) {
@@ -192,7 +387,7 @@ func TestTransactionTimeSort(t *testing.T) {
 		groups[addr] = append(groups[addr], tx)
 	}
 	// Sort the transactions and cross check the nonce ordering
-	txset := NewTransactionsByPriceAndNonce(signer, groups)
+	txset := NewTransactionsByPriceAndNonce(signer, groups, nil)
 
 	txs := Transactions{}
 	for tx := txset.Peek(); tx != nil; tx = txset.Peek() {
@@ -225,16 +420,41 @@ func TestTransactionJSON(t *testing.T) {
 	if err != nil {
 		t.Fatalf("could not generate key: %v", err)
 	}
-	signer := NewEIP155Signer(common.Big1)
+	signer := NewLondonSigner(common.Big1)
 
 	transactions := make([]*Transaction, 0, 50)
 	for i := uint64(0); i < 25; i++ {
 		var tx *Transaction
-		switch i % 2 {
+		switch i % 4 {
 		case 0:
 			tx = NewTransaction(i, common.Address{1}, common.Big0, 1, common.Big2, []byte("abcdef"))
 		case 1:
 			tx = NewContractCreation(i, common.Big0, 1, common.Big2, []byte("abcdef"))
+		case 2:
+			addr := common.Address{1}
+			tx = NewTx(&AccessListTx{
+				ChainID:    common.Big1,
+				Nonce:      i,
+				To:         &addr,
+				Value:      common.Big0,
+				Gas:        1,
+				GasPrice:   common.Big2,
+				Data:       []byte("abcdef"),
+				AccessList: AccessList{{Address: addr, StorageKeys: []common.Hash{{0x01}}}},
+			})
+		case 3:
+			addr := common.Address{1}
+			tx = NewTx(&DynamicFeeTx{
+				ChainID:    common.Big1,
+				Nonce:      i,
+				To:         &addr,
+				Value:      common.Big0,
+				Gas:        1,
+				GasTipCap:  common.Big1,
+				GasFeeCap:  common.Big2,
+				Data:       []byte("abcdef"),
+				AccessList: AccessList{{Address: addr, StorageKeys: []common.Hash{{0x01}}}},
+			})
 		}
 		transactions = append(transactions, tx)
 
@@ -97,6 +97,7 @@ type Context struct {
 	BlockNumber *big.Int       // Provides information for NUMBER
 	Time        *big.Int       // Provides information for TIME
 	Difficulty  *big.Int       // Provides information for DIFFICULTY
+	BaseFee     *big.Int       // Provides information for the EIP-1559 base fee
 }
 
 // EVM is the Ethereum Virtual Machine base object and provides
@@ -172,6 +173,26 @@ func NewEVM(ctx Context, statedb StateDB, chainConfig *params.ChainConfig, vmCon
 	return evm
 }
 
+// AccessListEnabled reports whether EIP-2929 state access accounting is in
+// effect, either through the Berlin fork or explicitly via Config.ExtraEips.
+func (evm *EVM) AccessListEnabled() bool {
+	if evm.chainRules.IsBerlin {
+		return true
+	}
+	for _, eip := range evm.vmConfig.ExtraEips {
+		if eip == 2929 {
+			return true
+		}
+	}
+	return false
+}
+
+// NoBaseFee reports whether the EIP-1559 base fee check should be skipped for
+// messages which do not specify any fee fields (e.g. eth_call).
+func (evm *EVM) NoBaseFee() bool {
+	return evm.vmConfig.NoBaseFee
+}
+
 // Cancel cancels any running EVM operation. This may be called concurrently and
 // it's safe to be called multiple times.
 func (evm *EVM) Cancel() {
@@ -416,6 +437,11 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	}
 	nonce := evm.StateDB.GetNonce(caller.Address())
 	evm.StateDB.SetNonce(caller.Address(), nonce+1)
+	// We add this to the access list _before_ taking a snapshot. Even if the creation fails,
+	// the access-list change should not be rolled back
+	if evm.AccessListEnabled() {
+		evm.StateDB.AddAddressToAccessList(address)
+	}
 
 	// Ensure there's no existing contract already at the designated address
 	contractHash := evm.StateDB.GetCodeHash(address)
@@ -113,6 +113,9 @@ func Execute(code, input []byte, cfg *Config) ([]byte, *state.StateDB, error) {
 		vmenv   = NewEnv(cfg)
 		sender  = vm.AccountRef(cfg.Origin)
 	)
+	if vmenv.AccessListEnabled() {
+		cfg.State.PrepareAccessList(cfg.Origin, &address, vm.ActivePrecompiles(vmenv.ChainConfig().Rules(vmenv.BlockNumber)), nil)
+	}
 	cfg.State.CreateAccount(address)
 	// set the receiver's (the executing contract) code for execution.
 	cfg.State.SetCode(address, code)
@@ -142,7 +145,9 @@ func Create(input []byte, cfg *Config) ([]byte, common.Address, uint64, error) {
 		vmenv  = NewEnv(cfg)
 		sender = vm.AccountRef(cfg.Origin)
 	)
-
+	if vmenv.AccessListEnabled() {
+		cfg.State.PrepareAccessList(cfg.Origin, nil, vm.ActivePrecompiles(vmenv.ChainConfig().Rules(vmenv.BlockNumber)), nil)
+	}
 	// Call the code with the given configuration.
 	code, address, leftOverGas, err := vmenv.Create(
 		sender,
@@ -164,6 +169,9 @@ func Call(address common.Address, input []byte, cfg *Config) ([]byte, uint64, er
 	vmenv := NewEnv(cfg)
 
 	sender := cfg.State.GetOrNewStateObject(cfg.Origin)
+	if vmenv.AccessListEnabled() {
+		cfg.State.PrepareAccessList(cfg.Origin, &address, vm.ActivePrecompiles(vmenv.ChainConfig().Rules(vmenv.BlockNumber)), nil)
+	}
 	// Call the code with the given configuration.
 	ret, leftOverGas, err := vmenv.Call(
 		sender,
@@ -722,3 +722,47 @@ func BenchmarkSimpleLoop(b *testing.B) {
 	//benchmarkNonModifyingCode(10000000, staticCallIdentity, "staticcall-identity-10M", b)
 	//benchmarkNonModifyingCode(10000000, loopingCode, "loop-10M", b)
 }
+
+// TestEip2929Gas checks that enabling EIP-2929 through the extra EIPs charges
+// cold and warm storage reads differently, and leaves the default rules as-is.
+func TestEip2929Gas(t *testing.T) {
+	code := []byte{
+		byte(vm.PUSH1), 0x01,
+		byte(vm.SLOAD), // cold slot
+		byte(vm.POP),
+		byte(vm.PUSH1), 0x01,
+		byte(vm.SLOAD), // warm slot
+		byte(vm.POP),
+		byte(vm.PUSH1), 0xff,
+		byte(vm.BALANCE), // cold account
+		byte(vm.POP),
+		byte(vm.ADDRESS),
+		byte(vm.BALANCE), // warm account (the callee is prepared)
+		byte(vm.POP),
+	}
+	for i, tt := range []struct {
+		eips []int
+		want uint64
+	}{
+		// 3+800+2 + 3+800+2 + 3+700+2 + 2+700+2
+		{nil, 3019},
+		// 3+2100+2 + 3+100+2 + 3+2600+2 + 2+100+2
+		{[]int{2929}, 4919},
+	} {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		address := common.HexToAddress("0x0a")
+		statedb.SetCode(address, code)
+
+		_, leftOver, err := Call(address, nil, &Config{
+			State:     statedb,
+			GasLimit:  100000,
+			EVMConfig: vm.Config{ExtraEips: tt.eips},
+		})
+		if err != nil {
+			t.Fatalf("test %d: call failed: %v", i, err)
+		}
+		if used := 100000 - leftOver; used != tt.want {
+			t.Errorf("test %d: gas used mismatch: have %d, want %d", i, used, tt.want)
+		}
+	}
+}
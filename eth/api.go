@@ -533,3 +533,93 @@ func (api *PrivateDebugAPI) getModifiedAccounts(startBlock, endBlock *types.Bloc
 	}
 	return dirty, nil
 }
+
+// maxAccountHistory is the maximum number of account changes returned by a
+// single account history query.
+const maxAccountHistory = 1000
+
+// AccountChange is the change of an account within a block, along with the
+// balance and nonce of the account at the end of the block.
+type AccountChange struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	BlockHash   common.Hash    `json:"blockHash"`
+	Balance     *hexutil.Big   `json:"balance"`
+	Nonce       hexutil.Uint64 `json:"nonce"`
+	Changes     []string       `json:"changes"`
+}
+
+// AccountHistory is a page of changes of an account within a block range. If the
+// page is full, next is the block to continue the query from.
+type AccountHistory struct {
+	Changes []*AccountChange `json:"changes"`
+	ToBlock hexutil.Uint64   `json:"toBlock"`
+	Next    *hexutil.Uint64  `json:"next,omitempty"`
+}
+
+// GetAccountHistory returns the blocks within the given range which changed the
+// balance, nonce, code or storage of an account, in ascending order. At most
+// limit changes are returned, with the range being capped at the last block of
+// the account history index.
+func (api *PrivateDebugAPI) GetAccountHistory(ctx context.Context, address common.Address, fromBlock rpc.BlockNumber, toBlock rpc.BlockNumber, limit *int) (*AccountHistory, error) {
+	if api.eth.accountHistoryIndexer == nil {
+		return nil, errors.New("account history indexing is disabled")
+	}
+	sections, last, _ := api.eth.accountHistoryIndexer.Sections()
+	if sections == 0 {
+		return nil, errors.New("account history is not indexed yet")
+	}
+
+	resolve := func(number rpc.BlockNumber) uint64 {
+		if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
+			return api.eth.blockchain.CurrentBlock().NumberU64()
+		}
+		return uint64(number)
+	}
+	from, to := resolve(fromBlock), resolve(toBlock)
+	if from > to {
+		return nil, fmt.Errorf("start block (%d) after end block (%d)", from, to)
+	}
+	if from > last {
+		return nil, fmt.Errorf("block #%d not indexed yet (indexed up to #%d)", from, last)
+	}
+	if to > last {
+		to = last
+	}
+	count := maxAccountHistory
+	if limit != nil && *limit > 0 && *limit < count {
+		count = *limit
+	}
+	history := &AccountHistory{
+		Changes: []*AccountChange{},
+		ToBlock: hexutil.Uint64(to),
+	}
+	for _, entry := range rawdb.ReadAccountHistory(api.eth.ChainDb(), address, from, to, count) {
+		change := &AccountChange{
+			BlockNumber: hexutil.Uint64(entry.Number),
+			BlockHash:   rawdb.ReadCanonicalHash(api.eth.ChainDb(), entry.Number),
+			Balance:     (*hexutil.Big)(entry.Balance),
+			Nonce:       hexutil.Uint64(entry.Nonce),
+			Changes:     []string{},
+		}
+		for _, field := range []struct {
+			flag uint8
+			name string
+		}{
+			{rawdb.AccountBalanceChanged, "balance"},
+			{rawdb.AccountNonceChanged, "nonce"},
+			{rawdb.AccountCodeChanged, "code"},
+			{rawdb.AccountStorageChanged, "storage"},
+		} {
+			if entry.Flags&field.flag != 0 {
+				change.Changes = append(change.Changes, field.name)
+			}
+		}
+		history.Changes = append(history.Changes, change)
+	}
+	if len(history.Changes) == count {
+		if next := uint64(history.Changes[count-1].BlockNumber) + 1; next <= to {
+			history.Next = (*hexutil.Uint64)(&next)
+		}
+	}
+	return history, nil
+}
@@ -0,0 +1,390 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// flatCallTracer is the name of the tracer producing the flattened call traces.
+	flatCallTracer = "flatCallTracer"
+
+	// maxTraceFilterBlocks is the maximum number of blocks a trace filter without
+	// address criteria may span, all of whose traces have to be retrieved.
+	maxTraceFilterBlocks = 10000
+
+	// maxTraceFilterReexec is the maximum number of blocks beyond the call trace
+	// index a trace filter may span, all of which have to be re-executed.
+	maxTraceFilterReexec = 1000
+)
+
+// PrivateTraceAPI is the collection of Ethereum full node APIs exposed over the
+// private trace endpoint, reporting the calls of transactions in the flattened
+// call trace format introduced by Parity.
+type PrivateTraceAPI struct {
+	eth   *Ethereum
+	debug *PrivateDebugAPI
+
+	maxBlocks uint64 // Maximum number of blocks spanned by an unfiltered trace filter
+	maxReexec uint64 // Maximum number of blocks re-executed by a trace filter
+}
+
+// NewPrivateTraceAPI creates a new API definition for the call trace methods of
+// the Ethereum service.
+func NewPrivateTraceAPI(eth *Ethereum) *PrivateTraceAPI {
+	return &PrivateTraceAPI{
+		eth:       eth,
+		debug:     NewPrivateDebugAPI(eth),
+		maxBlocks: maxTraceFilterBlocks,
+		maxReexec: maxTraceFilterReexec,
+	}
+}
+
+// flatTrace is a flattened call trace along with its position in the chain.
+type flatTrace struct {
+	*tracers.FlatCallFrame
+	BlockHash           common.Hash `json:"blockHash"`
+	BlockNumber         uint64      `json:"blockNumber"`
+	TransactionHash     common.Hash `json:"transactionHash"`
+	TransactionPosition uint64      `json:"transactionPosition"`
+}
+
+// TraceFilterArgs are the criteria of a trace filter. Traces match if sent from
+// any of the from addresses and sent to any of the to addresses, with an empty
+// address list matching everything.
+type TraceFilterArgs struct {
+	FromBlock   *rpc.BlockNumber `json:"fromBlock"`
+	ToBlock     *rpc.BlockNumber `json:"toBlock"`
+	FromAddress []common.Address `json:"fromAddress"`
+	ToAddress   []common.Address `json:"toAddress"`
+	After       *uint64          `json:"after"`
+	Count       *uint64          `json:"count"`
+}
+
+// Block returns the flattened call traces of all the transactions in a block.
+func (api *PrivateTraceAPI) Block(ctx context.Context, number rpc.BlockNumber) ([]*flatTrace, error) {
+	block, err := api.blockByNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	traces, err := api.blockCalls(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+	return flattenBlockCalls(block, traces, nil), nil
+}
+
+// Transaction returns the flattened call traces of a transaction.
+func (api *PrivateTraceAPI) Transaction(ctx context.Context, hash common.Hash) ([]*flatTrace, error) {
+	tx, blockHash, blockNumber, index := rawdb.ReadTransaction(api.eth.ChainDb(), hash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %#x not found", hash)
+	}
+	block := api.eth.blockchain.GetBlock(blockHash, blockNumber)
+	if block == nil {
+		return nil, fmt.Errorf("block %#x not found", blockHash)
+	}
+	traces := api.indexedCalls(block)
+	if traces == nil {
+		var frames []*tracers.FlatCallFrame
+		msg, vmctx, statedb, err := api.debug.computeTxEnv(block, int(index), defaultTraceReexec)
+		if err != nil {
+			return nil, err
+		}
+		tracer, timeout := flatCallTracer, callTraceTimeout.String()
+		res, err := api.debug.traceTx(ctx, msg, vmctx, statedb, &TraceConfig{Tracer: &tracer, Timeout: &timeout})
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(res.(json.RawMessage), &frames); err != nil {
+			return nil, err
+		}
+		traces = make([][]*tracers.FlatCallFrame, len(block.Transactions()))
+		traces[index] = frames
+	}
+	// Only report the calls of the requested transaction
+	for i := range traces {
+		if uint64(i) != index {
+			traces[i] = nil
+		}
+	}
+	return flattenBlockCalls(block, traces, nil), nil
+}
+
+// Filter returns the flattened call traces of a block range matching the given
+// sender and recipient addresses. Blocks covered by the call trace index are
+// looked up directly, any later ones are re-executed. Ranges re-executing more
+// than maxTraceFilterReexec blocks, or spanning more than maxTraceFilterBlocks
+// without address criteria, are rejected.
+func (api *PrivateTraceAPI) Filter(ctx context.Context, args TraceFilterArgs) ([]*flatTrace, error) {
+	from, err := api.blockByNumber(rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	to := from
+	if args.FromBlock != nil {
+		if from, err = api.blockByNumber(*args.FromBlock); err != nil {
+			return nil, err
+		}
+	}
+	if args.ToBlock != nil {
+		if to, err = api.blockByNumber(*args.ToBlock); err != nil {
+			return nil, err
+		}
+	}
+	if from.NumberU64() > to.NumberU64() {
+		return nil, errors.New("invalid block range")
+	}
+	// Reject ranges which would take too long to process
+	filtered := len(args.FromAddress) > 0 || len(args.ToAddress) > 0
+	if span := to.NumberU64() - from.NumberU64() + 1; !filtered && span > api.maxBlocks {
+		return nil, fmt.Errorf("block range of unfiltered traces too large: %d blocks, limit %d", span, api.maxBlocks)
+	}
+	indexed := api.indexedHead()
+	if to.NumberU64() >= indexed {
+		first := from.NumberU64()
+		if first < indexed {
+			first = indexed
+		}
+		if reexec := to.NumberU64() - first + 1; reexec > api.maxReexec {
+			return nil, fmt.Errorf("too many unindexed blocks to trace: %d blocks, limit %d", reexec, api.maxReexec)
+		}
+	}
+	var (
+		filter = newTraceFilter(args.FromAddress, args.ToAddress)
+		result = []*flatTrace{}
+		skip   uint64
+		limit  = ^uint64(0)
+	)
+	if args.After != nil {
+		skip = *args.After
+	}
+	if args.Count != nil {
+		limit = *args.Count
+	}
+	for _, number := range api.candidateBlocks(from.NumberU64(), to.NumberU64(), indexed, args.FromAddress, args.ToAddress) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		block := api.eth.blockchain.GetBlockByNumber(number)
+		if block == nil {
+			return nil, fmt.Errorf("block #%d not found", number)
+		}
+		traces, err := api.blockCalls(ctx, block)
+		if err != nil {
+			return nil, err
+		}
+		for _, trace := range flattenBlockCalls(block, traces, filter) {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if uint64(len(result)) >= limit {
+				return result, nil
+			}
+			result = append(result, trace)
+		}
+	}
+	return result, nil
+}
+
+// blockByNumber retrieves a canonical block, resolving the pending block to the
+// latest one since it cannot be traced.
+func (api *PrivateTraceAPI) blockByNumber(number rpc.BlockNumber) (*types.Block, error) {
+	var block *types.Block
+	switch number {
+	case rpc.PendingBlockNumber, rpc.LatestBlockNumber:
+		block = api.eth.blockchain.CurrentBlock()
+	default:
+		block = api.eth.blockchain.GetBlockByNumber(uint64(number))
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return block, nil
+}
+
+// candidateBlocks returns the numbers of the blocks within the given range which
+// may contain calls between the given addresses. Within the indexed part of the
+// chain, i.e. below the given block, the blocks are looked up in the call trace
+// index.
+func (api *PrivateTraceAPI) candidateBlocks(from, to, indexed uint64, fromAddrs, toAddrs []common.Address) []uint64 {
+	if len(fromAddrs) == 0 && len(toAddrs) == 0 || indexed <= from {
+		indexed = from
+	}
+	var numbers []uint64
+	if indexed > from {
+		// Use the smaller of the address lists, both have to match anyway
+		addrs := fromAddrs
+		if len(addrs) == 0 || (len(toAddrs) > 0 && len(toAddrs) < len(addrs)) {
+			addrs = toAddrs
+		}
+		end := to
+		if end >= indexed {
+			end = indexed - 1
+		}
+		seen := make(map[uint64]struct{})
+		for _, addr := range addrs {
+			for _, number := range rawdb.ReadCallTraceIndex(api.eth.ChainDb(), addr, from, end) {
+				if _, ok := seen[number]; !ok {
+					seen[number] = struct{}{}
+					numbers = append(numbers, number)
+				}
+			}
+		}
+		sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	}
+	for number := indexed; number <= to; number++ {
+		numbers = append(numbers, number)
+	}
+	return numbers
+}
+
+// indexedHead returns the number of the first block not covered by the call
+// trace index, or zero if indexing is disabled.
+func (api *PrivateTraceAPI) indexedHead() uint64 {
+	if api.eth.callTraceIndexer == nil {
+		return 0
+	}
+	sections, last, _ := api.eth.callTraceIndexer.Sections()
+	if sections == 0 {
+		return 0
+	}
+	return last + 1
+}
+
+// indexedCalls retrieves the flattened call traces of a block from the call
+// trace index, or nil if the block is not indexed.
+func (api *PrivateTraceAPI) indexedCalls(block *types.Block) [][]*tracers.FlatCallFrame {
+	if block.NumberU64() >= api.indexedHead() {
+		return nil
+	}
+	hash, blob := rawdb.ReadCallTraces(api.eth.ChainDb(), block.NumberU64())
+	if hash != block.Hash() {
+		return nil
+	}
+	var traces [][]*tracers.FlatCallFrame
+	if err := json.Unmarshal(blob, &traces); err != nil || len(traces) != len(block.Transactions()) {
+		return nil
+	}
+	return traces
+}
+
+// blockCalls retrieves the flattened call traces of a block, either from the call
+// trace index or by re-executing it.
+func (api *PrivateTraceAPI) blockCalls(ctx context.Context, block *types.Block) ([][]*tracers.FlatCallFrame, error) {
+	if traces := api.indexedCalls(block); traces != nil {
+		return traces, nil
+	}
+	return traceBlockCalls(ctx, api.debug, block, callTraceTimeout)
+}
+
+// traceBlockCalls re-executes a block, returning the flattened call traces of
+// each of its transactions.
+func traceBlockCalls(ctx context.Context, api *PrivateDebugAPI, block *types.Block, timeout time.Duration) ([][]*tracers.FlatCallFrame, error) {
+	traces := make([][]*tracers.FlatCallFrame, len(block.Transactions()))
+	if len(traces) == 0 {
+		return traces, nil
+	}
+	tracer, limit := flatCallTracer, timeout.String()
+	results, err := api.traceBlock(ctx, block, &TraceConfig{Tracer: &tracer, Timeout: &limit})
+	if err != nil {
+		return nil, err
+	}
+	for i, res := range results {
+		if res.Error != "" {
+			return nil, fmt.Errorf("tracing transaction %d of block #%d failed: %s", i, block.NumberU64(), res.Error)
+		}
+		if err := json.Unmarshal(res.Result.(json.RawMessage), &traces[i]); err != nil {
+			return nil, err
+		}
+	}
+	return traces, nil
+}
+
+// traceFilter matches flattened call traces by their sender and recipient.
+type traceFilter struct {
+	from map[common.Address]struct{}
+	to   map[common.Address]struct{}
+}
+
+// newTraceFilter creates a trace filter for the given senders and recipients.
+func newTraceFilter(from, to []common.Address) *traceFilter {
+	filter := &traceFilter{
+		from: make(map[common.Address]struct{}),
+		to:   make(map[common.Address]struct{}),
+	}
+	for _, addr := range from {
+		filter.from[addr] = struct{}{}
+	}
+	for _, addr := range to {
+		filter.to[addr] = struct{}{}
+	}
+	return filter
+}
+
+// matches returns whether the call trace is between the filtered addresses.
+func (f *traceFilter) matches(frame *tracers.FlatCallFrame) bool {
+	from, to := frame.Addresses()
+	return matchesAddress(f.from, from) && matchesAddress(f.to, to)
+}
+
+// matchesAddress returns whether the address is in the given set, with an empty
+// set matching any address.
+func matchesAddress(set map[common.Address]struct{}, addr *common.Address) bool {
+	if len(set) == 0 {
+		return true
+	}
+	if addr == nil {
+		return false
+	}
+	_, ok := set[*addr]
+	return ok
+}
+
+// flattenBlockCalls positions the call traces of a block's transactions in the
+// chain, dropping any not matching the optional filter.
+func flattenBlockCalls(block *types.Block, traces [][]*tracers.FlatCallFrame, filter *traceFilter) []*flatTrace {
+	result := []*flatTrace{}
+	for i, frames := range traces {
+		for _, frame := range frames {
+			if filter != nil && !filter.matches(frame) {
+				continue
+			}
+			result = append(result, &flatTrace{
+				FlatCallFrame:       frame,
+				BlockHash:           block.Hash(),
+				BlockNumber:         block.NumberU64(),
+				TransactionHash:     block.Transactions()[i].Hash(),
+				TransactionPosition: uint64(i),
+			})
+		}
+	}
+	return result
+}
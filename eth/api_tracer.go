@@ -58,10 +58,19 @@ const (
 type TraceConfig struct {
 	*vm.LogConfig
 	Tracer  *string
+	Tracers []string // Tracers to run in a single execution, results keyed by name or js#<index> for custom code
 	Timeout *string
 	Reexec  *uint64
 }
 
+// TraceCallConfig is the config for the traceCall API. On top of the tracing
+// options, it allows patching the state and block context the call runs in.
+type TraceCallConfig struct {
+	TraceConfig
+	StateOverrides *ethapi.StateOverride
+	BlockOverrides *ethapi.BlockOverrides
+}
+
 // StdTraceConfig holds extra parameters to standard-json trace functions.
 type StdTraceConfig struct {
 	*vm.LogConfig
@@ -205,7 +214,7 @@ func (api *PrivateDebugAPI) traceChain(ctx context.Context, start, end *types.Bl
 
 				// Trace all the transactions contained within
 				for i, tx := range task.block.Transactions() {
-					msg, _ := tx.AsMessage(signer)
+					msg, _ := tx.AsMessage(signer, task.block.BaseFee())
 					vmctx := core.NewEVMContext(msg, task.block.Header(), api.eth.blockchain, nil)
 
 					res, err := api.traceTx(ctx, msg, vmctx, task.statedb, config)
@@ -479,7 +488,7 @@ func (api *PrivateDebugAPI) traceBlock(ctx context.Context, block *types.Block,
 
 			// Fetch and execute the next transaction trace tasks
 			for task := range jobs {
-				msg, _ := txs[task.index].AsMessage(signer)
+				msg, _ := txs[task.index].AsMessage(signer, block.BaseFee())
 				vmctx := core.NewEVMContext(msg, block.Header(), api.eth.blockchain, nil)
 
 				res, err := api.traceTx(ctx, msg, vmctx, task.statedb, config)
@@ -494,11 +503,16 @@ func (api *PrivateDebugAPI) traceBlock(ctx context.Context, block *types.Block,
 	// Feed the transactions into the tracers and return
 	var failed error
 	for i, tx := range txs {
+		// Stop feeding transactions if the request was cancelled
+		if err := ctx.Err(); err != nil {
+			failed = err
+			break
+		}
 		// Send the trace task over for execution
 		jobs <- &txTraceTask{statedb: statedb.Copy(), index: i}
 
 		// Generate the next state snapshot fast without tracing
-		msg, _ := tx.AsMessage(signer)
+		msg, _ := tx.AsMessage(signer, block.BaseFee())
 		vmctx := core.NewEVMContext(msg, block.Header(), api.eth.blockchain, nil)
 
 		vmenv := vm.NewEVM(vmctx, statedb, api.eth.blockchain.Config(), vm.Config{})
@@ -567,7 +581,7 @@ func (api *PrivateDebugAPI) standardTraceBlockToFile(ctx context.Context, block
 	for i, tx := range block.Transactions() {
 		// Prepare the trasaction for un-traced execution
 		var (
-			msg, _ = tx.AsMessage(signer)
+			msg, _ = tx.AsMessage(signer, block.BaseFee())
 			vmctx  = core.NewEVMContext(msg, block.Header(), api.eth.blockchain, nil)
 
 			vmConf vm.Config
@@ -727,7 +741,9 @@ func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, hash common.Ha
 // TraceCall lets you trace a given eth_call. It collects the structured logs created during the execution of EVM
 // if the given transaction was added on top of the provided block and returns them as a JSON object.
 // You can provide -2 as a block number to trace on top of the pending block.
-func (api *PrivateDebugAPI) TraceCall(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, config *TraceConfig) (interface{}, error) {
+// The state and block context of the call may be patched via the overrides of
+// the trace config, e.g. to trace against contract upgrades before deployment.
+func (api *PrivateDebugAPI) TraceCall(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, config *TraceCallConfig) (interface{}, error) {
 	// First try to retrieve the state
 	statedb, header, err := api.eth.APIBackend.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
 	if err != nil {
@@ -750,25 +766,40 @@ func (api *PrivateDebugAPI) TraceCall(ctx context.Context, args ethapi.CallArgs,
 		if err != nil {
 			return nil, err
 		}
+		header = block.Header()
 	}
 
 	// Execute the trace
-	msg := args.ToMessage(api.eth.APIBackend.RPCGasCap())
+	msg, err := args.ToMessage(api.eth.APIBackend.RPCGasCap(), header.BaseFee)
+	if err != nil {
+		return nil, err
+	}
 	vmctx := core.NewEVMContext(msg, header, api.eth.blockchain, nil)
-	return api.traceTx(ctx, msg, vmctx, statedb, config)
+
+	var traceConfig *TraceConfig
+	if config != nil {
+		if err := config.StateOverrides.Apply(statedb); err != nil {
+			return nil, err
+		}
+		// Keep the overrides out of the changes reported by state tracers
+		statedb.Finalise(false)
+		config.BlockOverrides.Apply(&vmctx)
+		traceConfig = &config.TraceConfig
+	}
+	return api.traceTx(ctx, msg, vmctx, statedb, traceConfig)
 }
 
 // traceTx configures a new tracer according to the provided configuration, and
 // executes the given message in the provided environment. The return value will
 // be tracer dependent.
 func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, vmctx vm.Context, statedb *state.StateDB, config *TraceConfig) (interface{}, error) {
-	// Assemble the structured logger or the JavaScript tracer
+	// Assemble the structured logger or the requested tracer
 	var (
 		tracer vm.Tracer
 		err    error
 	)
 	switch {
-	case config != nil && config.Tracer != nil:
+	case config != nil && (config.Tracer != nil || len(config.Tracers) > 0):
 		// Define a meaningful timeout of a single transaction trace
 		timeout := defaultTraceTimeout
 		if config.Timeout != nil {
@@ -776,15 +807,23 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 				return nil, err
 			}
 		}
-		// Constuct the JavaScript tracer to execute with
-		if tracer, err = tracers.New(*config.Tracer); err != nil {
+		// Construct the native or JavaScript tracers to execute with
+		switch {
+		case config.Tracer != nil && len(config.Tracers) > 0:
+			return nil, errors.New("tracer and tracers are mutually exclusive")
+		case config.Tracer != nil:
+			tracer, err = tracers.NewTracer(*config.Tracer)
+		default:
+			tracer, err = tracers.NewMuxTracer(config.Tracers)
+		}
+		if err != nil {
 			return nil, err
 		}
 		// Handle timeouts and RPC cancellations
 		deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
 		go func() {
 			<-deadlineCtx.Done()
-			tracer.(*tracers.Tracer).Stop(errors.New("execution timeout"))
+			tracer.(tracers.TxTracer).Stop(errors.New("execution timeout"))
 		}()
 		defer cancel()
 
@@ -801,6 +840,11 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 	if err != nil {
 		return nil, fmt.Errorf("tracing failed: %v", err)
 	}
+	// Let the tracers interested in the final state inspect it, including the
+	// gas refunds and miner fees applied outside of the EVM
+	if tracer, ok := tracer.(tracers.StateTracer); ok {
+		tracer.CaptureTxEnd(statedb)
+	}
 	// Depending on the tracer type, format and return the output
 	switch tracer := tracer.(type) {
 	case *vm.StructLogger:
@@ -816,7 +860,7 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 			StructLogs:  ethapi.FormatLogs(tracer.StructLogs()),
 		}, nil
 
-	case *tracers.Tracer:
+	case tracers.TxTracer:
 		return tracer.GetResult()
 
 	default:
@@ -845,7 +889,7 @@ func (api *PrivateDebugAPI) computeTxEnv(block *types.Block, txIndex int, reexec
 
 	for idx, tx := range block.Transactions() {
 		// Assemble the transaction call message and return if the requested offset
-		msg, _ := tx.AsMessage(signer)
+		msg, _ := tx.AsMessage(signer, block.BaseFee())
 		context := core.NewEVMContext(msg, block.Header(), api.eth.blockchain, nil)
 		if idx == txIndex {
 			return msg, context, statedb, nil
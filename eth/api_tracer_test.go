@@ -0,0 +1,132 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// blockInfoCode returns the block number, timestamp, coinbase, storage slot 1
+// and balance of the contract as five words.
+var blockInfoCode = common.FromHex("0x436000524260205241604052600154606052303160805260a06000f3")
+
+// Tests that the state and block overrides of debug_traceCall are visible to
+// the traced execution.
+func TestTraceCallOverrides(t *testing.T) {
+	var (
+		contract = common.HexToAddress("0xc0de")
+		gspec    = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: core.GenesisAlloc{
+				testBank: {Balance: big.NewInt(params.Ether)},
+				contract: {Code: blockInfoCode, Balance: big.NewInt(7)},
+			},
+		}
+	)
+	eth, blocks := newTestEthereum(t, gspec, 2, nil)
+	head := blocks[len(blocks)-1]
+	api := NewPrivateDebugAPI(eth)
+
+	// word encodes a value as a returned word, expect assembles all five of them
+	word := func(v *big.Int) string {
+		return common.Bytes2Hex(common.LeftPadBytes(v.Bytes(), 32))
+	}
+	expect := func(number, time *big.Int, coinbase common.Address, slot common.Hash, balance *big.Int) string {
+		return word(number) + word(time) + word(new(big.Int).SetBytes(coinbase.Bytes())) + word(slot.Big()) + word(balance)
+	}
+	var (
+		newCode     = hexutil.Bytes(blockInfoCode)
+		newBalance  = (*hexutil.Big)(big.NewInt(1000))
+		newStorage  = map[common.Hash]common.Hash{common.HexToHash("0x01"): common.HexToHash("0xbeef")}
+		newNumber   = (*hexutil.Big)(big.NewInt(12345))
+		newTime     = hexutil.Uint64(987654)
+		newCoinbase = common.HexToAddress("0xc0ffee")
+		other       = common.HexToAddress("0xdeadbeef")
+	)
+	tests := []struct {
+		to     common.Address
+		config *TraceCallConfig
+		want   string
+	}{
+		// No overrides, the chain state and head block are used
+		{
+			to:   contract,
+			want: expect(head.Number(), new(big.Int).SetUint64(head.Time()), head.Coinbase(), common.Hash{}, big.NewInt(7)),
+		},
+		// Balance and storage overrides of an existing contract
+		{
+			to: contract,
+			config: &TraceCallConfig{StateOverrides: &ethapi.StateOverride{
+				contract: {Balance: &newBalance, State: &newStorage},
+			}},
+			want: expect(head.Number(), new(big.Int).SetUint64(head.Time()), head.Coinbase(), common.HexToHash("0xbeef"), big.NewInt(1000)),
+		},
+		// Code override of a plain account
+		{
+			to: other,
+			config: &TraceCallConfig{StateOverrides: &ethapi.StateOverride{
+				other: {Code: &newCode},
+			}},
+			want: expect(head.Number(), new(big.Int).SetUint64(head.Time()), head.Coinbase(), common.Hash{}, new(big.Int)),
+		},
+		// Block number, timestamp and coinbase overrides
+		{
+			to: contract,
+			config: &TraceCallConfig{BlockOverrides: &ethapi.BlockOverrides{
+				Number:   newNumber,
+				Time:     &newTime,
+				Coinbase: &newCoinbase,
+			}},
+			want: expect(big.NewInt(12345), big.NewInt(987654), newCoinbase, common.Hash{}, big.NewInt(7)),
+		},
+	}
+	for i, tt := range tests {
+		to := tt.to
+		args := ethapi.CallArgs{From: &testBank, To: &to}
+		res, err := api.TraceCall(context.Background(), args, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), tt.config)
+		if err != nil {
+			t.Fatalf("test %d: failed to trace call: %v", i, err)
+		}
+		result, ok := res.(*ethapi.ExecutionResult)
+		if !ok {
+			t.Fatalf("test %d: unexpected result type %T", i, res)
+		}
+		if result.Failed {
+			t.Fatalf("test %d: call failed", i)
+		}
+		if result.ReturnValue != tt.want {
+			t.Errorf("test %d: return value mismatch:\nhave %s\nwant %s", i, result.ReturnValue, tt.want)
+		}
+	}
+	// Overrides must not leak into the chain state
+	statedb, err := eth.blockchain.StateAt(head.Root())
+	if err != nil {
+		t.Fatalf("failed to open head state: %v", err)
+	}
+	if balance := statedb.GetBalance(contract); balance.Cmp(big.NewInt(7)) != 0 {
+		t.Errorf("balance override leaked into the state: %v", balance)
+	}
+}
@@ -34,11 +34,13 @@ import (
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/eth/filters"
 	"github.com/ethereum/go-ethereum/eth/gasprice"
+	"github.com/ethereum/go-ethereum/eth/protocols/snap"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
@@ -70,9 +72,11 @@ type Ethereum struct {
 	engine         consensus.Engine
 	accountManager *accounts.Manager
 
-	bloomRequests     chan chan *bloombits.Retrieval // Channel receiving bloom data retrieval requests
-	bloomIndexer      *core.ChainIndexer             // Bloom indexer operating during block imports
-	closeBloomHandler chan struct{}
+	bloomRequests         chan chan *bloombits.Retrieval // Channel receiving bloom data retrieval requests
+	bloomIndexer          *core.ChainIndexer             // Bloom indexer operating during block imports
+	callTraceIndexer      *core.ChainIndexer             // Call trace indexer operating during block imports (optional)
+	accountHistoryIndexer *core.ChainIndexer             // Account history indexer operating during block imports (optional)
+	closeBloomHandler     chan struct{}
 
 	APIBackend *EthAPIBackend
 
@@ -98,6 +102,12 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 	if !config.SyncMode.IsValid() {
 		return nil, fmt.Errorf("invalid sync mode %d", config.SyncMode)
 	}
+	if config.CallTraceIndex && !config.NoPruning {
+		return nil, errors.New("call trace indexing requires archive mode")
+	}
+	if config.AccountHistoryIndex && !config.NoPruning {
+		return nil, errors.New("account history indexing requires archive mode")
+	}
 	if config.Miner.GasPrice == nil || config.Miner.GasPrice.Cmp(common.Big0) <= 0 {
 		log.Warn("Sanitizing invalid miner gas price", "provided", config.Miner.GasPrice, "updated", DefaultConfig.Miner.GasPrice)
 		config.Miner.GasPrice = new(big.Int).Set(DefaultConfig.Miner.GasPrice)
@@ -124,6 +134,17 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 	}
 	log.Info("Initialised chain configuration", "config", chainConfig)
 
+	// The path state scheme can't be populated by the fast or snap syncers, which
+	// download trie nodes keyed by hash
+	if scheme := rawdb.ReadStateScheme(chainDb); scheme == rawdb.PathScheme && config.SyncMode != downloader.FullSync {
+		log.Warn("Switching to full sync for the path state scheme", "provided", config.SyncMode)
+		config.SyncMode = downloader.FullSync
+	}
+
+	if err := pruner.RecoverPruning(stack.ResolvePath(""), chainDb, stack.ResolvePath(config.TrieCleanCacheJournal)); err != nil {
+		log.Error("Failed to recover state", "error", err)
+	}
+
 	eth := &Ethereum{
 		config:            config,
 		chainDb:           chainDb,
@@ -154,6 +175,10 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 			rawdb.WriteDatabaseVersion(chainDb, core.BlockChainVersion)
 		}
 	}
+	var dirtyJournal string
+	if config.TrieDirtyCacheJournal != "" {
+		dirtyJournal = stack.ResolvePath(config.TrieDirtyCacheJournal)
+	}
 	var (
 		vmConfig = vm.Config{
 			EnablePreimageRecording: config.EnablePreimageRecording,
@@ -167,8 +192,10 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 			TrieCleanNoPrefetch: config.NoPrefetch,
 			TrieDirtyLimit:      config.TrieDirtyCache,
 			TrieDirtyDisabled:   config.NoPruning,
+			TrieDirtyJournal:    dirtyJournal,
 			TrieTimeLimit:       config.TrieTimeout,
 			SnapshotLimit:       config.SnapshotCache,
+			StateHistory:        config.StateHistory,
 		}
 	)
 	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, chainConfig, eth.engine, vmConfig, eth.shouldPreserve, &config.TxLookupLimit)
@@ -182,6 +209,14 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 		rawdb.WriteChainConfig(chainDb, genesisHash, chainConfig)
 	}
 	eth.bloomIndexer.Start(eth.blockchain)
+	if config.CallTraceIndex {
+		eth.callTraceIndexer = NewCallTraceIndexer(eth, callTraceSectionSize, callTraceConfirms)
+		eth.callTraceIndexer.Start(eth.blockchain)
+	}
+	if config.AccountHistoryIndex {
+		eth.accountHistoryIndexer = NewAccountHistoryIndexer(eth, accountHistorySectionSize, accountHistoryConfirms)
+		eth.accountHistoryIndexer.Start(eth.blockchain)
+	}
 
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = stack.ResolvePath(config.TxPool.Journal)
@@ -320,6 +355,10 @@ func (s *Ethereum) APIs() []rpc.API {
 			Namespace: "debug",
 			Version:   "1.0",
 			Service:   NewPrivateDebugAPI(s),
+		}, {
+			Namespace: "trace",
+			Version:   "1.0",
+			Service:   NewPrivateTraceAPI(s),
 		}, {
 			Namespace: "net",
 			Version:   "1.0",
@@ -505,6 +544,9 @@ func (s *Ethereum) Protocols() []p2p.Protocol {
 		protos[i].Attributes = []enr.Entry{s.currentEthEntry()}
 		protos[i].DialCandidates = s.dialCandidates
 	}
+	if s.config.SnapshotCache > 0 || s.config.SyncMode == downloader.SnapSync {
+		protos = append(protos, snap.MakeProtocols((*snapHandler)(s.protocolManager))...)
+	}
 	return protos
 }
 
@@ -537,6 +579,12 @@ func (s *Ethereum) Stop() error {
 
 	// Then stop everything else.
 	s.bloomIndexer.Close()
+	if s.callTraceIndexer != nil {
+		s.callTraceIndexer.Close()
+	}
+	if s.accountHistoryIndexer != nil {
+		s.accountHistoryIndexer.Close()
+	}
 	close(s.closeBloomHandler)
 	s.txPool.Stop()
 	s.miner.Stop()
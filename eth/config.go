@@ -67,8 +67,10 @@ var DefaultConfig = Config{
 	TrieCleanCacheJournal:   "triecache",
 	TrieCleanCacheRejournal: 60 * time.Minute,
 	TrieDirtyCache:          256,
+	TrieDirtyCacheJournal:   "triedirty",
 	TrieTimeout:             60 * time.Minute,
 	SnapshotCache:           102,
+	StateHistory:            90000,
 	Miner: miner.Config{
 		GasFloor: 8000000,
 		GasCeil:  8000000,
@@ -121,6 +123,10 @@ type Config struct {
 	NoPrefetch bool // Whether to disable prefetching and only load state on demand
 
 	TxLookupLimit uint64 `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
+	StateHistory  uint64 `toml:",omitempty"` // The number of recent states revertible in the path state scheme.
+
+	CallTraceIndex      bool `toml:",omitempty"` // Whether to index the call traces of the chain for trace filtering (requires archive mode)
+	AccountHistoryIndex bool `toml:",omitempty"` // Whether to index the blocks changing each account (requires archive mode)
 
 	// Whitelist of required block number -> hash values to accept
 	Whitelist map[uint64]common.Hash `toml:"-"`
@@ -147,6 +153,7 @@ type Config struct {
 	TrieCleanCacheJournal   string        `toml:",omitempty"` // Disk journal directory for trie cache to survive node restarts
 	TrieCleanCacheRejournal time.Duration `toml:",omitempty"` // Time interval to regenerate the journal for clean cache
 	TrieDirtyCache          int
+	TrieDirtyCacheJournal   string `toml:",omitempty"` // Disk journal for dirty trie nodes to survive crashes
 	TrieTimeout             time.Duration
 	SnapshotCache           int
 
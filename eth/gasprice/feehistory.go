@@ -0,0 +1,256 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// maxFeeHistory is the maximum number of blocks a fee history may span.
+	maxFeeHistory = 1024
+
+	// maxBlockFetchers is the maximum number of blocks whose fees are collected
+	// concurrently.
+	maxBlockFetchers = 4
+
+	// feeCacheSize is the number of block fee statistics cached by the oracle.
+	feeCacheSize = 2048
+)
+
+var (
+	errInvalidPercentile = errors.New("invalid reward percentile")
+	errRequestBeyondHead = errors.New("request beyond head block")
+)
+
+// BlockFees is the fee statistics of a single block.
+type BlockFees struct {
+	BaseFee      *big.Int   // Base fee of the block, zero before EIP-1559
+	NextBaseFee  *big.Int   // Base fee of the next block, zero before EIP-1559
+	GasUsedRatio float64    // Ratio of the gas used to the gas limit of the block
+	Rewards      []*big.Int // Effective tips at the requested percentiles, weighted by gas used
+}
+
+// txGasAndReward is the gas used and the effective tip paid by a transaction.
+type txGasAndReward struct {
+	gasUsed uint64
+	reward  *big.Int
+}
+
+// CollectBlockFees computes the fee statistics of a block. The rewards are the
+// effective tips at the given percentiles of the gas used in the block, with the
+// transactions sorted by their tips in ascending order. The receipts are only
+// needed if any percentiles are requested.
+func CollectBlockFees(config *params.ChainConfig, header *types.Header, txs types.Transactions, receipts types.Receipts, percentiles []float64) (*BlockFees, error) {
+	fees := &BlockFees{
+		BaseFee:     new(big.Int),
+		NextBaseFee: new(big.Int),
+	}
+	if header.BaseFee != nil {
+		fees.BaseFee.Set(header.BaseFee)
+	}
+	if config.IsLondon(new(big.Int).Add(header.Number, common.Big1)) {
+		fees.NextBaseFee = misc.CalcBaseFee(config, header)
+	}
+	if header.GasLimit > 0 {
+		fees.GasUsedRatio = float64(header.GasUsed) / float64(header.GasLimit)
+	}
+	if len(percentiles) == 0 {
+		return fees, nil
+	}
+	fees.Rewards = make([]*big.Int, len(percentiles))
+	if len(txs) == 0 {
+		for i := range fees.Rewards {
+			fees.Rewards[i] = new(big.Int)
+		}
+		return fees, nil
+	}
+	if len(receipts) != len(txs) {
+		return nil, fmt.Errorf("receipt count mismatch: have %d, want %d", len(receipts), len(txs))
+	}
+	sorted := make([]txGasAndReward, len(txs))
+	for i, tx := range txs {
+		reward, _ := tx.EffectiveGasTip(header.BaseFee)
+		sorted[i].reward = reward
+
+		// Don't rely on derived receipt fields, light clients don't have them
+		sorted[i].gasUsed = receipts[i].CumulativeGasUsed
+		if i > 0 {
+			sorted[i].gasUsed -= receipts[i-1].CumulativeGasUsed
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].reward.Cmp(sorted[j].reward) < 0 })
+
+	var (
+		txIndex int
+		sumGas  = sorted[0].gasUsed
+	)
+	for i, p := range percentiles {
+		threshold := uint64(float64(header.GasUsed) * p / 100)
+		for sumGas < threshold && txIndex < len(sorted)-1 {
+			txIndex++
+			sumGas += sorted[txIndex].gasUsed
+		}
+		fees.Rewards[i] = sorted[txIndex].reward
+	}
+	return fees, nil
+}
+
+// feeCacheKey identifies the fee statistics of a block for a set of percentiles.
+type feeCacheKey struct {
+	hash        common.Hash
+	percentiles string
+}
+
+// blockFees retrieves the fee statistics of a canonical block, serving them from
+// the cache if they were computed before.
+func (gpo *Oracle) blockFees(ctx context.Context, number uint64, percentiles []float64) (*BlockFees, error) {
+	header, err := gpo.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+	if header == nil {
+		if err == nil {
+			err = fmt.Errorf("header #%d not found", number)
+		}
+		return nil, err
+	}
+	key := feeCacheKey{hash: header.Hash(), percentiles: fmt.Sprint(percentiles)}
+	if fees, ok := gpo.feeCache.Get(key); ok {
+		return fees.(*BlockFees), nil
+	}
+	var (
+		txs      types.Transactions
+		receipts types.Receipts
+	)
+	if len(percentiles) > 0 && header.GasUsed > 0 {
+		block, err := gpo.backend.BlockByNumber(ctx, rpc.BlockNumber(number))
+		if block == nil {
+			if err == nil {
+				err = fmt.Errorf("block #%d not found", number)
+			}
+			return nil, err
+		}
+		if receipts, err = gpo.backend.GetReceipts(ctx, block.Hash()); err != nil {
+			return nil, err
+		}
+		txs = block.Transactions()
+	}
+	fees, err := CollectBlockFees(gpo.backend.ChainConfig(), header, txs, receipts, percentiles)
+	if err != nil {
+		return nil, err
+	}
+	gpo.feeCache.Add(key, fees)
+	return fees, nil
+}
+
+// FeeHistory returns the fee statistics of a range of blocks ending at the given
+// one: the base fees, including the one of the block following the range, the
+// ratios of the gas used to the gas limits, and the effective tips at the given
+// percentiles of the gas used. The pending block is resolved to the latest one.
+//
+// The statistics of each block are cached, so repeated and overlapping requests
+// only have to retrieve the blocks not seen before.
+func (gpo *Oracle) FeeHistory(ctx context.Context, blockCount uint64, lastBlock rpc.BlockNumber, percentiles []float64) (*big.Int, [][]*big.Int, []*big.Int, []float64, error) {
+	if blockCount < 1 {
+		return common.Big0, nil, nil, nil, nil
+	}
+	if blockCount > maxFeeHistory {
+		blockCount = maxFeeHistory
+	}
+	for i, p := range percentiles {
+		if p < 0 || p > 100 || (i > 0 && p < percentiles[i-1]) {
+			return common.Big0, nil, nil, nil, fmt.Errorf("%w: %f", errInvalidPercentile, p)
+		}
+	}
+	head, err := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if head == nil {
+		return common.Big0, nil, nil, nil, err
+	}
+	last := head.Number.Uint64()
+	if lastBlock >= 0 {
+		if uint64(lastBlock) > last {
+			return common.Big0, nil, nil, nil, fmt.Errorf("%w: requested %d, head %d", errRequestBeyondHead, lastBlock, last)
+		}
+		last = uint64(lastBlock)
+	}
+	if blockCount > last+1 {
+		blockCount = last + 1
+	}
+	oldest := last + 1 - blockCount
+	blocks := int(blockCount)
+
+	// Collect the statistics of the blocks concurrently
+	var (
+		fees = make([]*BlockFees, blocks)
+		errs = make([]error, blocks)
+		next = make(chan int, blocks)
+		wg   sync.WaitGroup
+	)
+	for i := 0; i < blocks; i++ {
+		next <- i
+	}
+	close(next)
+
+	fetchers := maxBlockFetchers
+	if fetchers > blocks {
+		fetchers = blocks
+	}
+	for i := 0; i < fetchers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if ctx.Err() != nil {
+					errs[i] = ctx.Err()
+					continue
+				}
+				fees[i], errs[i] = gpo.blockFees(ctx, oldest+uint64(i), percentiles)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var (
+		reward       [][]*big.Int
+		baseFee      = make([]*big.Int, blocks+1)
+		gasUsedRatio = make([]float64, blocks)
+	)
+	if len(percentiles) > 0 {
+		reward = make([][]*big.Int, blocks)
+	}
+	for i := range fees {
+		if errs[i] != nil {
+			return common.Big0, nil, nil, nil, errs[i]
+		}
+		baseFee[i], gasUsedRatio[i] = fees[i].BaseFee, fees[i].GasUsedRatio
+		if reward != nil {
+			reward[i] = fees[i].Rewards
+		}
+	}
+	baseFee[blocks] = fees[blocks-1].NextBaseFee
+
+	return new(big.Int).SetUint64(oldest), reward, baseFee, gasUsedRatio, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestFeeHistory(t *testing.T) {
+	var cases = []struct {
+		count       uint64
+		last        rpc.BlockNumber
+		percentiles []float64
+		expFirst    uint64
+		expCount    int
+		expErr      error
+	}{
+		{count: 0, last: 10, expFirst: 0, expCount: 0},
+		{count: 4, last: 10, expFirst: 7, expCount: 4},
+		{count: 4, last: 10, percentiles: []float64{0, 50, 100}, expFirst: 7, expCount: 4},
+		{count: 4, last: rpc.LatestBlockNumber, percentiles: []float64{10}, expFirst: 29, expCount: 4},
+		{count: 4, last: rpc.PendingBlockNumber, expFirst: 29, expCount: 4},
+		{count: 40, last: 2, expFirst: 0, expCount: 3},
+		{count: math.MaxUint64, last: 10, expFirst: 0, expCount: 11},
+		{count: 4, last: 33, expErr: errRequestBeyondHead},
+		{count: 4, last: 10, percentiles: []float64{50, 10}, expErr: errInvalidPercentile},
+		{count: 4, last: 10, percentiles: []float64{101}, expErr: errInvalidPercentile},
+	}
+	backend := newTestBackend(t)
+	oracle := NewOracle(backend, Config{Blocks: 3, Percentile: 60, Default: big.NewInt(params.GWei)})
+
+	for i, c := range cases {
+		first, reward, baseFee, ratio, err := oracle.FeeHistory(context.Background(), c.count, c.last, c.percentiles)
+		if c.expErr != nil {
+			if !errors.Is(err, c.expErr) {
+				t.Errorf("test %d: error mismatch: have %v, want %v", i, err, c.expErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d: failed to retrieve fee history: %v", i, err)
+		}
+		if first.Uint64() != c.expFirst {
+			t.Errorf("test %d: first block mismatch: have %d, want %d", i, first, c.expFirst)
+		}
+		if len(ratio) != c.expCount {
+			t.Errorf("test %d: gas used ratio count mismatch: have %d, want %d", i, len(ratio), c.expCount)
+		}
+		if c.expCount > 0 && len(baseFee) != c.expCount+1 {
+			t.Errorf("test %d: base fee count mismatch: have %d, want %d", i, len(baseFee), c.expCount+1)
+		}
+		if len(c.percentiles) == 0 && reward != nil {
+			t.Errorf("test %d: rewards returned without percentiles", i)
+		}
+		for j := range reward {
+			// Every block holds a single transaction, paying its number in gwei
+			want := new(big.Int).Mul(new(big.Int).SetUint64(c.expFirst+uint64(j)), big.NewInt(params.GWei))
+			if c.expFirst+uint64(j) == 0 {
+				want = new(big.Int)
+			}
+			if len(reward[j]) != len(c.percentiles) {
+				t.Fatalf("test %d: reward count mismatch in block %d: have %d, want %d", i, j, len(reward[j]), len(c.percentiles))
+			}
+			for k := range reward[j] {
+				if reward[j][k].Cmp(want) != 0 {
+					t.Errorf("test %d: reward mismatch in block %d: have %v, want %v", i, j, reward[j][k], want)
+				}
+			}
+		}
+		for j := range ratio {
+			if c.expFirst+uint64(j) > 0 && ratio[j] == 0 {
+				t.Errorf("test %d: gas used ratio of block %d is zero", i, j)
+			}
+		}
+	}
+	// Repeated requests should be served from the cache
+	cached := oracle.feeCache.Len()
+	if _, _, _, _, err := oracle.FeeHistory(context.Background(), 4, 10, []float64{0, 50, 100}); err != nil {
+		t.Fatalf("failed to retrieve fee history: %v", err)
+	}
+	if oracle.feeCache.Len() != cached {
+		t.Errorf("fee statistics recomputed: cache size %d, want %d", oracle.feeCache.Len(), cached)
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
+	lru "github.com/hashicorp/golang-lru"
 )
 
 const sampleNumber = 3 // Number of transactions sampled in a block
@@ -44,6 +45,7 @@ type Config struct {
 type OracleBackend interface {
 	HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error)
 	BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error)
+	GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error)
 	ChainConfig() *params.ChainConfig
 }
 
@@ -56,6 +58,7 @@ type Oracle struct {
 	maxPrice  *big.Int
 	cacheLock sync.RWMutex
 	fetchLock sync.Mutex
+	feeCache  *lru.Cache // Fee statistics of recently requested blocks
 
 	checkBlocks int
 	percentile  int
@@ -83,18 +86,39 @@ func NewOracle(backend OracleBackend, params Config) *Oracle {
 		maxPrice = DefaultMaxPrice
 		log.Warn("Sanitizing invalid gasprice oracle price cap", "provided", params.MaxPrice, "updated", maxPrice)
 	}
+	feeCache, _ := lru.New(feeCacheSize)
 	return &Oracle{
 		backend:     backend,
 		lastPrice:   params.Default,
 		maxPrice:    maxPrice,
+		feeCache:    feeCache,
 		checkBlocks: blocks,
 		percentile:  percent,
 	}
 }
 
-// SuggestPrice returns a gasprice so that newly created transaction can
-// have a very high chance to be included in the following blocks.
+// SuggestPrice returns a gasprice so that newly created legacy transaction can
+// have a very high chance to be included in the following blocks. After EIP-1559
+// activation it is the suggested tip on top of the base fee of the head block.
 func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
+	tip, err := gpo.SuggestTipCap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	head, _ := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if head != nil && head.BaseFee != nil {
+		tip = new(big.Int).Add(tip, head.BaseFee)
+	}
+	return tip, nil
+}
+
+// SuggestTipCap returns a tip cap so that newly created transaction can have a
+// very high chance to be included in the following blocks.
+//
+// Note, for legacy transactions and the legacy eth_gasPrice RPC call, it will be
+// necessary to add the basefee to the returned number to fall back to the legacy
+// behavior.
+func (gpo *Oracle) SuggestTipCap(ctx context.Context) (*big.Int, error) {
 	head, _ := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
 	headHash := head.Hash()
 
@@ -173,16 +197,36 @@ type getBlockPricesResult struct {
 	err    error
 }
 
-type transactionsByGasPrice []*types.Transaction
+type txSorter struct {
+	txs     []*types.Transaction
+	baseFee *big.Int
+}
+
+func newSorter(txs []*types.Transaction, baseFee *big.Int) *txSorter {
+	return &txSorter{
+		txs:     txs,
+		baseFee: baseFee,
+	}
+}
 
-func (t transactionsByGasPrice) Len() int           { return len(t) }
-func (t transactionsByGasPrice) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
-func (t transactionsByGasPrice) Less(i, j int) bool { return t[i].GasPriceCmp(t[j]) < 0 }
+func (s *txSorter) Len() int { return len(s.txs) }
+func (s *txSorter) Swap(i, j int) {
+	s.txs[i], s.txs[j] = s.txs[j], s.txs[i]
+}
+func (s *txSorter) Less(i, j int) bool {
+	// It's okay to discard the error because a tx would never be
+	// accepted into a block with an invalid effective tip.
+	tip1, _ := s.txs[i].EffectiveGasTip(s.baseFee)
+	tip2, _ := s.txs[j].EffectiveGasTip(s.baseFee)
+	return tip1.Cmp(tip2) < 0
+}
 
-// getBlockPrices calculates the lowest transaction gas price in a given block
-// and sends it to the result channel. If the block is empty or all transactions
-// are sent by the miner itself(it doesn't make any sense to include this kind of
-// transaction prices for sampling), nil gasprice is returned.
+// getBlockPrices calculates the lowest transaction tips in a given block and
+// sends them to the result channel. The tip is the effective gas tip, i.e. the
+// part of the gas price which goes to the miner after EIP-1559 and the whole
+// gas price before. If the block is empty or all transactions are sent by the
+// miner itself(it doesn't make any sense to include this kind of transaction
+// prices for sampling), nil gasprice is returned.
 func (gpo *Oracle) getBlockPrices(ctx context.Context, signer types.Signer, blockNum uint64, limit int, result chan getBlockPricesResult, quit chan struct{}) {
 	block, err := gpo.backend.BlockByNumber(ctx, rpc.BlockNumber(blockNum))
 	if block == nil {
@@ -195,13 +239,14 @@ func (gpo *Oracle) getBlockPrices(ctx context.Context, signer types.Signer, bloc
 	blockTxs := block.Transactions()
 	txs := make([]*types.Transaction, len(blockTxs))
 	copy(txs, blockTxs)
-	sort.Sort(transactionsByGasPrice(txs))
+	sort.Sort(newSorter(txs, block.BaseFee()))
 
 	var prices []*big.Int
 	for _, tx := range txs {
 		sender, err := types.Sender(signer, tx)
 		if err == nil && sender != block.Coinbase() {
-			prices = append(prices, tx.GasPrice())
+			tip, _ := tx.EffectiveGasTip(block.BaseFee())
+			prices = append(prices, tip)
 			if len(prices) >= limit {
 				break
 			}
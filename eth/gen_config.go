@@ -24,6 +24,9 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		NoPruning               bool
 		NoPrefetch              bool
 		TxLookupLimit           uint64                 `toml:",omitempty"`
+		StateHistory            uint64                 `toml:",omitempty"`
+		CallTraceIndex          bool                   `toml:",omitempty"`
+		AccountHistoryIndex     bool                   `toml:",omitempty"`
 		Whitelist               map[uint64]common.Hash `toml:"-"`
 		LightServ               int                    `toml:",omitempty"`
 		LightIngress            int                    `toml:",omitempty"`
@@ -41,6 +44,7 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		TrieCleanCacheJournal   string        `toml:",omitempty"`
 		TrieCleanCacheRejournal time.Duration `toml:",omitempty"`
 		TrieDirtyCache          int
+		TrieDirtyCacheJournal   string `toml:",omitempty"`
 		TrieTimeout             time.Duration
 		SnapshotCache           int
 		Miner                   miner.Config
@@ -64,6 +68,9 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.NoPruning = c.NoPruning
 	enc.NoPrefetch = c.NoPrefetch
 	enc.TxLookupLimit = c.TxLookupLimit
+	enc.StateHistory = c.StateHistory
+	enc.CallTraceIndex = c.CallTraceIndex
+	enc.AccountHistoryIndex = c.AccountHistoryIndex
 	enc.Whitelist = c.Whitelist
 	enc.LightServ = c.LightServ
 	enc.LightIngress = c.LightIngress
@@ -81,6 +88,7 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.TrieCleanCacheJournal = c.TrieCleanCacheJournal
 	enc.TrieCleanCacheRejournal = c.TrieCleanCacheRejournal
 	enc.TrieDirtyCache = c.TrieDirtyCache
+	enc.TrieDirtyCacheJournal = c.TrieDirtyCacheJournal
 	enc.TrieTimeout = c.TrieTimeout
 	enc.SnapshotCache = c.SnapshotCache
 	enc.Miner = c.Miner
@@ -108,6 +116,9 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		NoPruning               *bool
 		NoPrefetch              *bool
 		TxLookupLimit           *uint64                `toml:",omitempty"`
+		StateHistory            *uint64                `toml:",omitempty"`
+		CallTraceIndex          *bool                  `toml:",omitempty"`
+		AccountHistoryIndex     *bool                  `toml:",omitempty"`
 		Whitelist               map[uint64]common.Hash `toml:"-"`
 		LightServ               *int                   `toml:",omitempty"`
 		LightIngress            *int                   `toml:",omitempty"`
@@ -125,6 +136,7 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		TrieCleanCacheJournal   *string        `toml:",omitempty"`
 		TrieCleanCacheRejournal *time.Duration `toml:",omitempty"`
 		TrieDirtyCache          *int
+		TrieDirtyCacheJournal   *string `toml:",omitempty"`
 		TrieTimeout             *time.Duration
 		SnapshotCache           *int
 		Miner                   *miner.Config
@@ -165,6 +177,15 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.TxLookupLimit != nil {
 		c.TxLookupLimit = *dec.TxLookupLimit
 	}
+	if dec.StateHistory != nil {
+		c.StateHistory = *dec.StateHistory
+	}
+	if dec.CallTraceIndex != nil {
+		c.CallTraceIndex = *dec.CallTraceIndex
+	}
+	if dec.AccountHistoryIndex != nil {
+		c.AccountHistoryIndex = *dec.AccountHistoryIndex
+	}
 	if dec.Whitelist != nil {
 		c.Whitelist = dec.Whitelist
 	}
@@ -216,6 +237,9 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.TrieDirtyCache != nil {
 		c.TrieDirtyCache = *dec.TrieDirtyCache
 	}
+	if dec.TrieDirtyCacheJournal != nil {
+		c.TrieDirtyCacheJournal = *dec.TrieDirtyCacheJournal
+	}
 	if dec.TrieTimeout != nil {
 		c.TrieTimeout = *dec.TrieTimeout
 	}
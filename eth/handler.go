@@ -65,6 +65,7 @@ type ProtocolManager struct {
 	forkFilter forkid.Filter // Fork ID filter, constant across the lifetime of the node
 
 	fastSync  uint32 // Flag whether fast sync is enabled (gets disabled if we already have blocks)
+	snapSync  uint32 // Flag whether fast sync should operate on top of the snap protocol
 	acceptTxs uint32 // Flag whether we're considered synchronised (enables transaction processing)
 
 	checkpointNumber uint64      // Block number for the sync progress validator to cross reference
@@ -137,6 +138,9 @@ func NewProtocolManager(config *params.ChainConfig, checkpoint *params.TrustedCh
 		} else {
 			// If fast sync was requested and our database is empty, grant it
 			manager.fastSync = uint32(1)
+			if mode == downloader.SnapSync {
+				manager.snapSync = uint32(1)
+			}
 		}
 	}
 
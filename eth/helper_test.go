@@ -88,6 +88,33 @@ func newTestProtocolManagerMust(t *testing.T, mode downloader.SyncMode, blocks i
 	return pm, db
 }
 
+// newTestEthereum creates an archive Ethereum service for testing the APIs, with
+// the given genesis and number of generated blocks already imported. Only the
+// chain, the database and the API backend are set up.
+func newTestEthereum(t *testing.T, gspec *core.Genesis, blocks int, generator func(int, *core.BlockGen)) (*Ethereum, []*types.Block) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(db)
+		config  = &core.CacheConfig{TrieCleanLimit: 256, TrieDirtyDisabled: true}
+	)
+	blockchain, err := core.NewBlockChain(db, config, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create blockchain: %v", err)
+	}
+	chain, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, blocks, generator)
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("Failed to insert chain: %v", err)
+	}
+	eth := &Ethereum{
+		config:     &Config{RPCGasCap: 25000000},
+		blockchain: blockchain,
+		chainDb:    db,
+		engine:     blockchain.Engine(),
+	}
+	eth.APIBackend = &EthAPIBackend{eth: eth}
+	return eth, append([]*types.Block{genesis}, chain...)
+}
+
 // testTxPool is a fake, helper transaction pool for testing purposes
 type testTxPool struct {
 	txFeed event.Feed
@@ -0,0 +1,288 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+const (
+	// accountHistorySectionSize is the number of blocks the account history
+	// indexer processes and commits in one go.
+	accountHistorySectionSize = 256
+
+	// accountHistoryConfirms is the number of confirmations a block needs before
+	// its account changes are indexed.
+	accountHistoryConfirms = 128
+
+	// accountHistoryThrottling is the time to wait between processing two
+	// consecutive index sections, to avoid starving the node of resources while
+	// catching up.
+	accountHistoryThrottling = 100 * time.Millisecond
+)
+
+// AccountHistoryIndexer implements a core.ChainIndexer, recording for every
+// account the blocks of the canonical chain which changed its balance, nonce,
+// code or storage, along with its balance and nonce after those blocks.
+type AccountHistoryIndexer struct {
+	api   *PrivateDebugAPI // debug API to regenerate historical states with
+	db    ethdb.Database   // database instance to write index data into
+	size  uint64           // section size to record account changes for
+	batch ethdb.Batch      // batch collecting the index data of the section
+}
+
+// NewAccountHistoryIndexer returns a chain indexer that records the account
+// changes of the canonical chain.
+func NewAccountHistoryIndexer(eth *Ethereum, size, confirms uint64) *core.ChainIndexer {
+	backend := &AccountHistoryIndexer{
+		api:  NewPrivateDebugAPI(eth),
+		db:   eth.ChainDb(),
+		size: size,
+	}
+	table := rawdb.NewTable(eth.ChainDb(), string(rawdb.AccountHistoryPrefix))
+
+	return core.NewChainIndexer(eth.ChainDb(), table, backend, size, confirms, accountHistoryThrottling, "accounthistory")
+}
+
+// Reset implements core.ChainIndexerBackend, starting a new account history
+// section. Any data left over from an earlier, reorged or interrupted run of the
+// section is unwound first.
+func (h *AccountHistoryIndexer) Reset(ctx context.Context, section uint64, lastSectionHead common.Hash) error {
+	h.batch = h.db.NewBatch()
+
+	for number := section * h.size; number < (section+1)*h.size; number++ {
+		hash, addrs := rawdb.ReadAccountChanges(h.db, number)
+		if hash == (common.Hash{}) {
+			continue
+		}
+		for _, addr := range addrs {
+			rawdb.DeleteAccountHistory(h.batch, addr, number)
+		}
+		rawdb.DeleteAccountChanges(h.batch, number)
+	}
+	return h.flush(0)
+}
+
+// Process implements core.ChainIndexerBackend, re-executing a block and adding
+// the accounts it changed into the index.
+func (h *AccountHistoryIndexer) Process(ctx context.Context, header *types.Header) error {
+	chain := h.api.eth.blockchain
+
+	block := chain.GetBlock(header.Hash(), header.Number.Uint64())
+	if block == nil {
+		return fmt.Errorf("block #%d [%x…] not found", header.Number, header.Hash().Bytes()[:4])
+	}
+	var entries map[common.Address]*rawdb.AccountHistoryEntry
+	if block.NumberU64() == 0 {
+		statedb, err := chain.StateAt(block.Root())
+		if err != nil {
+			return err
+		}
+		entries = genesisAccountChanges(statedb)
+	} else {
+		parent := chain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+		if parent == nil {
+			return fmt.Errorf("parent %#x not found", block.ParentHash())
+		}
+		statedb, err := h.api.computeStateDB(parent, defaultTraceReexec)
+		if err != nil {
+			return err
+		}
+		if entries, err = blockAccountChanges(h.api.eth, block, statedb); err != nil {
+			return err
+		}
+	}
+	addrs := make([]common.Address, 0, len(entries))
+	for addr, entry := range entries {
+		rawdb.WriteAccountHistory(h.batch, addr, entry)
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+	rawdb.WriteAccountChanges(h.batch, block.NumberU64(), block.Hash(), addrs)
+
+	return h.flush(ethdb.IdealBatchSize)
+}
+
+// Commit implements core.ChainIndexerBackend, writing out the remaining index
+// data of the section.
+func (h *AccountHistoryIndexer) Commit() error {
+	return h.flush(0)
+}
+
+// Prune returns an empty error since we don't support pruning here.
+func (h *AccountHistoryIndexer) Prune(threshold uint64) error {
+	return nil
+}
+
+// flush writes out the collected index data if it exceeds the given size.
+func (h *AccountHistoryIndexer) flush(limit int) error {
+	if h.batch.ValueSize() <= limit {
+		return nil
+	}
+	if err := h.batch.Write(); err != nil {
+		return err
+	}
+	h.batch.Reset()
+	return nil
+}
+
+// genesisAccountChanges returns the accounts allocated in the genesis state as
+// changed by the genesis block.
+func genesisAccountChanges(statedb *state.StateDB) map[common.Address]*rawdb.AccountHistoryEntry {
+	entries := make(map[common.Address]*rawdb.AccountHistoryEntry)
+
+	dump := statedb.RawDump(false, false, true)
+	for addr, account := range dump.Accounts {
+		entry := &rawdb.AccountHistoryEntry{Number: 0, Nonce: account.Nonce}
+		entry.Balance, _ = new(big.Int).SetString(account.Balance, 10)
+		if entry.Balance == nil {
+			entry.Balance = new(big.Int)
+		}
+		if entry.Balance.Sign() != 0 {
+			entry.Flags |= rawdb.AccountBalanceChanged
+		}
+		if entry.Nonce != 0 {
+			entry.Flags |= rawdb.AccountNonceChanged
+		}
+		if len(account.Code) != 0 {
+			entry.Flags |= rawdb.AccountCodeChanged
+		}
+		if len(account.Storage) != 0 {
+			entry.Flags |= rawdb.AccountStorageChanged
+		}
+		entries[addr] = entry
+	}
+	return entries
+}
+
+// blockAccountChanges applies a block on top of its parent state, returning the
+// accounts it changed. Besides the transactions, the consensus rewards and the
+// irregular state change of the DAO hard-fork are taken into account.
+func blockAccountChanges(eth *Ethereum, block *types.Block, statedb *state.StateDB) (map[common.Address]*rawdb.AccountHistoryEntry, error) {
+	var (
+		config = eth.blockchain.Config()
+		signer = types.MakeSigner(config, block.Number())
+		header = block.Header()
+		gp     = new(core.GasPool).AddGas(block.GasLimit())
+		flags  = make(map[common.Address]uint8)
+	)
+	collect := func() {
+		for addr, diff := range statedb.Diff() {
+			if f := accountDiffFlags(diff); f != 0 {
+				flags[addr] |= f
+			}
+		}
+		statedb.Finalise(config.IsEIP158(block.Number()))
+	}
+	if config.DAOForkSupport && config.DAOForkBlock != nil && config.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(statedb)
+		collect()
+	}
+	for i, tx := range block.Transactions() {
+		msg, err := tx.AsMessage(signer, block.BaseFee())
+		if err != nil {
+			return nil, err
+		}
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+
+		vmctx := core.NewEVMContext(msg, header, eth.blockchain, nil)
+		vmenv := vm.NewEVM(vmctx, statedb, config, vm.Config{})
+		if _, err := core.ApplyMessage(vmenv, msg, gp); err != nil {
+			return nil, fmt.Errorf("transaction %#x failed: %v", tx.Hash(), err)
+		}
+		collect()
+	}
+	// The consensus engine finalises the state itself, so detect the rewards by
+	// comparing the balances of the beneficiaries instead.
+	rewarded := map[common.Address]*big.Int{header.Coinbase: nil}
+	for _, uncle := range block.Uncles() {
+		rewarded[uncle.Coinbase] = nil
+	}
+	for addr := range rewarded {
+		rewarded[addr] = statedb.GetBalance(addr)
+	}
+	eth.engine.Finalize(eth.blockchain, types.CopyHeader(header), statedb, block.Transactions(), block.Uncles())
+	for addr, balance := range rewarded {
+		if statedb.GetBalance(addr).Cmp(balance) != 0 {
+			flags[addr] |= rawdb.AccountBalanceChanged
+		}
+	}
+	// Record the state of all changed accounts at the end of the block
+	entries := make(map[common.Address]*rawdb.AccountHistoryEntry, len(flags))
+	for addr, f := range flags {
+		entries[addr] = &rawdb.AccountHistoryEntry{
+			Number:  block.NumberU64(),
+			Flags:   f,
+			Balance: statedb.GetBalance(addr),
+			Nonce:   statedb.GetNonce(addr),
+		}
+	}
+	return entries, nil
+}
+
+// accountDiffFlags returns the account history flags of the fields changed by
+// an account diff. Destroyed contracts are regarded as having their storage
+// changed, as it is wiped even if not touched.
+func accountDiffFlags(diff *state.AccountDiff) uint8 {
+	empty := &state.AccountState{Balance: new(big.Int)}
+
+	pre, post := diff.Pre, diff.Post
+	if pre == nil {
+		pre = empty
+	}
+	if post == nil {
+		post = empty
+	}
+	var flags uint8
+	if pre.Balance.Cmp(post.Balance) != 0 {
+		flags |= rawdb.AccountBalanceChanged
+	}
+	if pre.Nonce != post.Nonce {
+		flags |= rawdb.AccountNonceChanged
+	}
+	if !bytes.Equal(pre.Code, post.Code) {
+		flags |= rawdb.AccountCodeChanged
+	}
+	for key, value := range pre.Storage {
+		if post.Storage[key] != value {
+			flags |= rawdb.AccountStorageChanged
+		}
+	}
+	for key, value := range post.Storage {
+		if pre.Storage[key] != value {
+			flags |= rawdb.AccountStorageChanged
+		}
+	}
+	if diff.Post == nil && len(pre.Code) != 0 {
+		flags |= rawdb.AccountStorageChanged
+	}
+	return flags
+}
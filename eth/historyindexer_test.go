@@ -0,0 +1,173 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that the account history index records the changes made by transactions,
+// self-destructs, block and uncle rewards and the DAO hard-fork, and that account
+// history queries are paginated across index sections.
+func TestAccountHistory(t *testing.T) {
+	var (
+		storer    = common.HexToAddress("0x5707e") // Stores the block number in slot 0
+		destroyer = common.HexToAddress("0xdead")  // Self-destructs to the caller
+		miner     = common.HexToAddress("0x3333")
+		uncle     = common.HexToAddress("0x4444")
+		drained   = params.DAODrainList()[0]
+	)
+	gspec := &core.Genesis{
+		Config: &params.ChainConfig{
+			ChainID:        big.NewInt(1),
+			HomesteadBlock: big.NewInt(0),
+			DAOForkBlock:   big.NewInt(4),
+			DAOForkSupport: true,
+			Ethash:         new(params.EthashConfig),
+		},
+		Alloc: core.GenesisAlloc{
+			testBank:  {Balance: big.NewInt(params.Ether)},
+			storer:    {Code: common.FromHex("0x4360005500"), Balance: new(big.Int)},
+			destroyer: {Code: common.FromHex("0x33ff"), Balance: big.NewInt(50)},
+			drained:   {Balance: big.NewInt(1000)},
+		},
+	}
+	signer := types.HomesteadSigner{}
+	call := func(b *core.BlockGen, to common.Address) {
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(testBank), to, new(big.Int), 100000, big.NewInt(1), nil), signer, testBankKey)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		b.AddTx(tx)
+	}
+	eth, _ := newTestEthereum(t, gspec, 11, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(miner)
+
+		switch number := b.Number().Uint64(); number {
+		case 2:
+			call(b, destroyer)
+		case 3:
+			// Include the first block as an uncle, mined by someone else
+			header := b.PrevBlock(1).Header()
+			header.Coinbase = uncle
+			header.Extra = []byte("uncle")
+			b.AddUncle(header)
+		case 4:
+			// The DAO hard-fork moves the drained balances without transactions
+		default:
+			call(b, storer)
+		}
+	})
+	indexer := NewAccountHistoryIndexer(eth, 4, 0)
+	indexer.Start(eth.blockchain)
+	defer indexer.Close()
+	eth.accountHistoryIndexer = indexer
+
+	waitSections(t, indexer, 3, eth.blockchain.GetCanonicalHash(11))
+
+	api := NewPrivateDebugAPI(eth)
+	history := func(addr common.Address, from, to rpc.BlockNumber, limit int) *AccountHistory {
+		t.Helper()
+
+		res, err := api.GetAccountHistory(context.Background(), addr, from, to, &limit)
+		if err != nil {
+			t.Fatalf("failed to retrieve history of %x: %v", addr, err)
+		}
+		return res
+	}
+	// Check the flags of the individual kinds of changes
+	tests := []struct {
+		addr    common.Address
+		number  uint64
+		changes []string
+		balance *big.Int
+	}{
+		{storer, 0, []string{"code"}, new(big.Int)},
+		{storer, 1, []string{"storage"}, new(big.Int)},
+		{destroyer, 0, []string{"balance", "code"}, big.NewInt(50)},
+		{destroyer, 2, []string{"balance", "code", "storage"}, new(big.Int)},
+		{uncle, 3, []string{"balance"}, nil},
+		{drained, 0, []string{"balance"}, big.NewInt(1000)},
+		{drained, 4, []string{"balance"}, new(big.Int)},
+		{params.DAORefundContract, 4, []string{"balance"}, big.NewInt(1000)},
+		{miner, 4, []string{"balance"}, nil},
+	}
+	for i, tt := range tests {
+		res := history(tt.addr, 0, rpc.LatestBlockNumber, 0)
+
+		var change *AccountChange
+		for _, c := range res.Changes {
+			if uint64(c.BlockNumber) == tt.number {
+				change = c
+			}
+		}
+		if change == nil {
+			t.Errorf("test %d: no change of %x in block #%d", i, tt.addr, tt.number)
+			continue
+		}
+		if !reflect.DeepEqual(change.Changes, tt.changes) {
+			t.Errorf("test %d: change mismatch of %x in block #%d: have %v, want %v", i, tt.addr, tt.number, change.Changes, tt.changes)
+		}
+		if tt.balance != nil && (*big.Int)(change.Balance).Cmp(tt.balance) != 0 {
+			t.Errorf("test %d: balance mismatch of %x in block #%d: have %v, want %v", i, tt.addr, tt.number, change.Balance, tt.balance)
+		}
+		if change.BlockHash != eth.blockchain.GetCanonicalHash(tt.number) {
+			t.Errorf("test %d: block hash mismatch: have %x", i, change.BlockHash)
+		}
+	}
+	// The self-destructed contract must not be changed by later blocks
+	if res := history(destroyer, 3, rpc.LatestBlockNumber, 0); len(res.Changes) != 0 {
+		t.Errorf("destroyed contract changed after its destruction: %v", res.Changes)
+	}
+	// Page through the changes of the storer, spanning all three sections
+	var (
+		pages [][]uint64
+		from  = rpc.BlockNumber(0)
+	)
+	for {
+		res := history(storer, from, rpc.LatestBlockNumber, 3)
+		if res.ToBlock != 11 {
+			t.Fatalf("end block mismatch: have %d, want 11", res.ToBlock)
+		}
+		var page []uint64
+		for _, c := range res.Changes {
+			page = append(page, uint64(c.BlockNumber))
+		}
+		pages = append(pages, page)
+		if res.Next == nil {
+			break
+		}
+		from = rpc.BlockNumber(*res.Next)
+	}
+	if want := [][]uint64{{0, 1, 5}, {6, 7, 8}, {9, 10, 11}}; !reflect.DeepEqual(pages, want) {
+		t.Errorf("pagination mismatch: have %v, want %v", pages, want)
+	}
+	// Queries beyond the indexed range must be rejected
+	limit := 0
+	if _, err := api.GetAccountHistory(context.Background(), storer, 12, 20, &limit); err == nil {
+		t.Errorf("unindexed range accepted")
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/light"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	testKey, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr     = crypto.PubkeyToAddress(testKey.PublicKey)
+	testCode     = []byte{0x43, 0x43, 0x55, 0x00} // NUMBER NUMBER SSTORE STOP
+	testContract = common.HexToAddress("0xc0de")
+)
+
+// newTestChain creates a chain with a genesis state containing a number of
+// plain accounts and a single contract with the given amount of storage slots.
+// If blocks are requested too, each of them funds a new account and writes a
+// new slot into the contract's storage, all sent from a prefunded test key.
+func newTestChain(t *testing.T, accounts int, slots int, blocks int) *core.BlockChain {
+	alloc := make(core.GenesisAlloc)
+	for i := 0; i < accounts; i++ {
+		alloc[common.BigToAddress(big.NewInt(int64(i+1)))] = core.GenesisAccount{Balance: big.NewInt(int64(i + 1))}
+	}
+	storage := make(map[common.Hash]common.Hash)
+	for i := 0; i < slots; i++ {
+		storage[common.BigToHash(big.NewInt(int64(i+1)))] = common.BigToHash(big.NewInt(int64(i + 1)))
+	}
+	alloc[testContract] = core.GenesisAccount{Balance: big.NewInt(1), Code: testCode, Storage: storage}
+	if blocks > 0 {
+		alloc[testAddr] = core.GenesisAccount{Balance: big.NewInt(params.Ether)}
+	}
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		genesis = &core.Genesis{Config: params.TestChainConfig, Alloc: alloc}
+		gendb   = rawdb.NewMemoryDatabase()
+	)
+	genesis.MustCommit(db)
+
+	chain, err := core.NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create test chain: %v", err)
+	}
+	if blocks == 0 {
+		return chain
+	}
+	signer := types.LatestSigner(params.TestChainConfig)
+	chainBlocks, _ := core.GenerateChain(params.TestChainConfig, genesis.MustCommit(gendb), ethash.NewFaker(), gendb, blocks, func(i int, block *core.BlockGen) {
+		recipient := common.BigToAddress(big.NewInt(int64(accounts + i + 1)))
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testAddr), recipient, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, testKey)
+		block.AddTx(tx)
+		tx, _ = types.SignTx(types.NewTransaction(block.TxNonce(testAddr), testContract, big.NewInt(0), 100000, big.NewInt(1), nil), signer, testKey)
+		block.AddTx(tx)
+	})
+	if _, err := chain.InsertChain(chainBlocks); err != nil {
+		t.Fatalf("failed to insert test chain: %v", err)
+	}
+	return chain
+}
+
+// proofDB converts a list of proof nodes into a database to verify with.
+func proofDB(proof [][]byte) ethdb.KeyValueReader {
+	nodes := light.NewNodeSet()
+	for _, node := range proof {
+		nodes.Put(crypto.Keccak256(node), node)
+	}
+	return nodes
+}
+
+// Tests that account ranges are served from the snapshot along with valid
+// Merkle edge proofs, both for complete and for byte capped requests.
+func TestServiceGetAccountRange(t *testing.T) {
+	chain := newTestChain(t, 100, 0, 0)
+	defer chain.Stop()
+
+	root := chain.CurrentBlock().Root()
+	tests := []struct {
+		bytes uint64
+		full  bool
+	}{
+		{softResponseLimit, true},
+		{1, false},
+		{1000, false},
+	}
+	for i, tt := range tests {
+		req := &GetAccountRangePacket{Root: root, Limit: maxHash, Bytes: tt.bytes}
+		accounts, proof := ServiceGetAccountRangeQuery(chain, req)
+		if len(accounts) == 0 {
+			t.Fatalf("test %d: no accounts served", i)
+		}
+		if full := len(accounts) == 101; full != tt.full {
+			t.Errorf("test %d: completeness mismatch: have %v (%d accounts), want %v", i, full, len(accounts), tt.full)
+		}
+		hashes, values, err := (&AccountRangePacket{Accounts: accounts}).Unpack()
+		if err != nil {
+			t.Fatalf("test %d: failed to unpack accounts: %v", i, err)
+		}
+		keys := make([][]byte, len(hashes))
+		for j, hash := range hashes {
+			keys[j] = common.CopyBytes(hash[:])
+		}
+		err, cont := trie.VerifyRangeProof(root, make([]byte, common.HashLength), keys[len(keys)-1], keys, values, proofDB(proof))
+		if err != nil {
+			t.Fatalf("test %d: invalid range proof: %v", i, err)
+		}
+		if cont == tt.full {
+			t.Errorf("test %d: continuation flag mismatch: have %v, want %v", i, cont, !tt.full)
+		}
+	}
+	// Requests for unknown state roots should be answered empty
+	accounts, proof := ServiceGetAccountRangeQuery(chain, &GetAccountRangePacket{Root: common.Hash{0x01}, Limit: maxHash, Bytes: softResponseLimit})
+	if len(accounts) != 0 || len(proof) != 0 {
+		t.Errorf("unknown root served: %d accounts, %d proofs", len(accounts), len(proof))
+	}
+}
+
+// Tests that storage ranges are served from the snapshot, with proofs only
+// attached if the range was capped.
+func TestServiceGetStorageRanges(t *testing.T) {
+	chain := newTestChain(t, 1, 200, 0)
+	defer chain.Stop()
+
+	var (
+		root    = chain.CurrentBlock().Root()
+		account = crypto.Keccak256Hash(testContract[:])
+	)
+	// Retrieve the entire storage, no proofs are expected
+	slots, proof := ServiceGetStorageRangesQuery(chain, &GetStorageRangesPacket{Root: root, Accounts: []common.Hash{account}, Bytes: softResponseLimit})
+	if len(slots) != 1 || len(slots[0]) != 200 {
+		t.Fatalf("storage range mismatch: have %d ranges, want 1 with 200 slots", len(slots))
+	}
+	if len(proof) != 0 {
+		t.Errorf("unexpected proofs for complete range: %d", len(proof))
+	}
+	// Retrieve a capped storage range, which must be proven
+	slots, proof = ServiceGetStorageRangesQuery(chain, &GetStorageRangesPacket{Root: root, Accounts: []common.Hash{account}, Bytes: 100})
+	if len(slots) != 1 || len(slots[0]) == 0 || len(slots[0]) == 200 {
+		t.Fatalf("capped storage range mismatch: %d ranges", len(slots))
+	}
+	if len(proof) == 0 {
+		t.Fatalf("missing proofs for capped range")
+	}
+	hashes, values := (&StorageRangesPacket{Slots: slots}).Unpack()
+	keys := make([][]byte, len(hashes[0]))
+	for i, hash := range hashes[0] {
+		keys[i] = common.CopyBytes(hash[:])
+	}
+	state, _ := chain.State()
+	storageRoot := state.StorageTrie(testContract).Hash()
+	if err, _ := trie.VerifyRangeProof(storageRoot, make([]byte, common.HashLength), keys[len(keys)-1], keys, values[0], proofDB(proof)); err != nil {
+		t.Fatalf("invalid storage range proof: %v", err)
+	}
+}
+
+// Tests that bytecodes are served by hash, skipping unknown ones.
+func TestServiceGetByteCodes(t *testing.T) {
+	chain := newTestChain(t, 1, 0, 0)
+	defer chain.Stop()
+
+	codes := ServiceGetByteCodesQuery(chain, &GetByteCodesPacket{
+		Hashes: []common.Hash{crypto.Keccak256Hash(testCode), {0x01}, emptyCode},
+		Bytes:  softResponseLimit,
+	})
+	if len(codes) != 2 {
+		t.Fatalf("code count mismatch: have %d, want 2", len(codes))
+	}
+	if !bytes.Equal(codes[0], testCode) {
+		t.Errorf("code mismatch: have %x, want %x", codes[0], testCode)
+	}
+	if len(codes[1]) != 0 {
+		t.Errorf("empty code mismatch: have %x", codes[1])
+	}
+}
+
+// Tests that account and storage trie nodes are served by path.
+func TestServiceGetTrieNodes(t *testing.T) {
+	chain := newTestChain(t, 10, 10, 0)
+	defer chain.Stop()
+
+	var (
+		root    = chain.CurrentBlock().Root()
+		account = crypto.Keccak256Hash(testContract[:])
+	)
+	nodes, err := ServiceGetTrieNodesQuery(chain, &GetTrieNodesPacket{
+		Root:  root,
+		Paths: []TrieNodePathSet{{nil}, {account[:], nil}},
+		Bytes: softResponseLimit,
+	})
+	if err != nil {
+		t.Fatalf("failed to serve trie nodes: %v", err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("node count mismatch: have %d, want 2", len(nodes))
+	}
+	if hash := crypto.Keccak256Hash(nodes[0]); hash != root {
+		t.Errorf("account root mismatch: have %x, want %x", hash, root)
+	}
+	state, _ := chain.State()
+	if have, want := crypto.Keccak256Hash(nodes[1]), state.StorageTrie(testContract).Hash(); have != want {
+		t.Errorf("storage root mismatch: have %x, want %x", have, want)
+	}
+	// Empty path sets are invalid and should be rejected
+	if _, err := ServiceGetTrieNodesQuery(chain, &GetTrieNodesPacket{Root: root, Paths: []TrieNodePathSet{{}}, Bytes: softResponseLimit}); err == nil {
+		t.Errorf("empty path set accepted")
+	}
+}
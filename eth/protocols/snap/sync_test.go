@@ -0,0 +1,349 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// testPeer is a snap sync data source serving requests straight from a local
+// chain, delivering the responses asynchronously into a syncer.
+type testPeer struct {
+	id     string
+	chain  *core.BlockChain
+	syncer *Syncer
+	logger log.Logger
+
+	bytes    uint64 // Response size cap to force chunking, 0 = requested size
+	requests uint32 // Number of account range requests served (atomic)
+
+	lock sync.Mutex
+	errs []error // Errors returned by the syncer on delivery
+}
+
+func newTestPeer(id string, chain *core.BlockChain, syncer *Syncer, bytes uint64) *testPeer {
+	return &testPeer{
+		id:     id,
+		chain:  chain,
+		syncer: syncer,
+		logger: log.New("id", id),
+		bytes:  bytes,
+	}
+}
+
+func (p *testPeer) ID() string      { return p.id }
+func (p *testPeer) Log() log.Logger { return p.logger }
+
+func (p *testPeer) limit(bytes uint64) uint64 {
+	if p.bytes > 0 && p.bytes < bytes {
+		return p.bytes
+	}
+	return bytes
+}
+
+func (p *testPeer) fail(err error) {
+	if err != nil {
+		p.lock.Lock()
+		p.errs = append(p.errs, err)
+		p.lock.Unlock()
+	}
+}
+
+func (p *testPeer) errors() []error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.errs
+}
+
+func (p *testPeer) RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error {
+	atomic.AddUint32(&p.requests, 1)
+	go func() {
+		req := &GetAccountRangePacket{ID: id, Root: root, Origin: origin, Limit: limit, Bytes: p.limit(bytes)}
+		accounts, proof := ServiceGetAccountRangeQuery(p.chain, req)
+
+		hashes, blobs, err := (&AccountRangePacket{Accounts: accounts}).Unpack()
+		if err != nil {
+			p.fail(err)
+			return
+		}
+		p.fail(p.syncer.OnAccounts(p, id, hashes, blobs, proof))
+	}()
+	return nil
+}
+
+func (p *testPeer) RequestStorageRanges(id uint64, root common.Hash, accounts []common.Hash, origin, limit []byte, bytes uint64) error {
+	go func() {
+		req := &GetStorageRangesPacket{ID: id, Root: root, Accounts: accounts, Origin: origin, Limit: limit, Bytes: p.limit(bytes)}
+		slots, proof := ServiceGetStorageRangesQuery(p.chain, req)
+
+		hashes, blobs := (&StorageRangesPacket{Slots: slots}).Unpack()
+		p.fail(p.syncer.OnStorage(p, id, hashes, blobs, proof))
+	}()
+	return nil
+}
+
+func (p *testPeer) RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error {
+	go func() {
+		req := &GetByteCodesPacket{ID: id, Hashes: hashes, Bytes: p.limit(bytes)}
+		p.fail(p.syncer.OnByteCodes(p, id, ServiceGetByteCodesQuery(p.chain, req)))
+	}()
+	return nil
+}
+
+func (p *testPeer) RequestTrieNodes(id uint64, root common.Hash, paths []TrieNodePathSet, bytes uint64) error {
+	go func() {
+		req := &GetTrieNodesPacket{ID: id, Root: root, Paths: paths, Bytes: p.limit(bytes)}
+		nodes, err := ServiceGetTrieNodesQuery(p.chain, req)
+		if err != nil {
+			p.fail(err)
+			return
+		}
+		p.fail(p.syncer.OnTrieNodes(p, id, nodes))
+	}()
+	return nil
+}
+
+// runSync runs a sync cycle against the given root, failing the test if it
+// doesn't terminate in a reasonable time.
+func runSync(t *testing.T, syncer *Syncer, root common.Hash, cancel chan struct{}) error {
+	done := make(chan error, 1)
+	go func() { done <- syncer.Sync(root, cancel) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Minute):
+		t.Fatalf("sync of %x timed out", root)
+		return nil
+	}
+}
+
+// verifyState iterates the entire state trie of the given root, checking that
+// all account and storage trie nodes, as well as all bytecodes are present.
+func verifyState(t *testing.T, db ethdb.KeyValueStore, root common.Hash, accounts int) {
+	t.Helper()
+
+	triedb := trie.NewDatabase(db)
+	accTrie, err := trie.New(root, triedb)
+	if err != nil {
+		t.Fatalf("failed to open account trie: %v", err)
+	}
+	var (
+		count int
+		it    = trie.NewIterator(accTrie.NodeIterator(nil))
+	)
+	for it.Next() {
+		count++
+
+		var acc state.Account
+		if err := rlp.DecodeBytes(it.Value, &acc); err != nil {
+			t.Fatalf("failed to decode account %x: %v", it.Key, err)
+		}
+		if acc.Root != emptyRoot {
+			stTrie, err := trie.New(acc.Root, triedb)
+			if err != nil {
+				t.Fatalf("failed to open storage trie of %x: %v", it.Key, err)
+			}
+			stIt := trie.NewIterator(stTrie.NodeIterator(nil))
+			for stIt.Next() {
+			}
+			if stIt.Err != nil {
+				t.Fatalf("failed to iterate storage trie of %x: %v", it.Key, stIt.Err)
+			}
+		}
+		if hash := common.BytesToHash(acc.CodeHash); hash != emptyCode {
+			if code := rawdb.ReadCode(db, hash); len(code) == 0 {
+				t.Fatalf("missing code %x of account %x", hash, it.Key)
+			}
+		}
+	}
+	if it.Err != nil {
+		t.Fatalf("failed to iterate account trie: %v", it.Err)
+	}
+	if count != accounts {
+		t.Fatalf("account count mismatch: have %d, want %d", count, accounts)
+	}
+}
+
+// checkPeers fails the test if any of the peers' deliveries were rejected.
+func checkPeers(t *testing.T, peers ...*testPeer) {
+	t.Helper()
+	for _, peer := range peers {
+		if errs := peer.errors(); len(errs) > 0 {
+			t.Fatalf("peer %s deliveries rejected: %v", peer.id, errs)
+		}
+	}
+}
+
+// Tests that a state can be synced from scratch from a number of peers, both
+// with plentiful and with severely capped responses (forcing accounts ranges
+// and large contracts to be retrieved in chunks).
+func TestSync(t *testing.T) {
+	for _, bytes := range []uint64{0, 1000} {
+		t.Run(fmt.Sprintf("cap-%d", bytes), func(t *testing.T) {
+			source := newTestChain(t, 1000, 500, 0)
+			defer source.Stop()
+
+			var (
+				db     = rawdb.NewMemoryDatabase()
+				syncer = NewSyncer(db, nil)
+				peers  []*testPeer
+			)
+			for i := 0; i < 3; i++ {
+				peer := newTestPeer(fmt.Sprintf("peer-%d", i), source, syncer, bytes)
+				syncer.Register(peer)
+				peers = append(peers, peer)
+			}
+			root := source.CurrentBlock().Root()
+			if err := runSync(t, syncer, root, make(chan struct{})); err != nil {
+				t.Fatalf("sync failed: %v", err)
+			}
+			checkPeers(t, peers...)
+			verifyState(t, db, root, 1001)
+		})
+	}
+}
+
+// Tests that an interrupted sync persists its progress and resumes from where
+// it left off instead of starting from scratch.
+func TestSyncResume(t *testing.T) {
+	source := newTestChain(t, 1000, 500, 0)
+	defer source.Stop()
+
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		syncer = NewSyncer(db, nil)
+		peer   = newTestPeer("peer", source, syncer, 1000)
+		root   = source.CurrentBlock().Root()
+		cancel = make(chan struct{})
+	)
+	syncer.Register(peer)
+
+	// Interrupt the sync after a few account ranges were requested
+	go func() {
+		for atomic.LoadUint32(&peer.requests) < 10 {
+			time.Sleep(time.Millisecond)
+		}
+		close(cancel)
+	}()
+	if err := runSync(t, syncer, root, cancel); err != ErrCancelled {
+		t.Fatalf("interrupted sync result mismatch: have %v, want %v", err, ErrCancelled)
+	}
+	if rawdb.ReadSnapshotSyncStatus(db) == nil {
+		t.Fatalf("sync progress not persisted")
+	}
+	requests := atomic.LoadUint32(&peer.requests)
+
+	// Resume the sync with a fresh syncer and ensure it completes without
+	// retrieving everything again
+	syncer = NewSyncer(db, nil)
+	peer = newTestPeer("peer", source, syncer, 1000)
+	syncer.Register(peer)
+
+	if err := runSync(t, syncer, root, make(chan struct{})); err != nil {
+		t.Fatalf("resumed sync failed: %v", err)
+	}
+	checkPeers(t, peer)
+	verifyState(t, db, root, 1001)
+
+	// Run a full sync from scratch to compare the number of requests
+	fresh := NewSyncer(rawdb.NewMemoryDatabase(), nil)
+	full := newTestPeer("peer", source, fresh, 1000)
+	fresh.Register(full)
+
+	if err := runSync(t, fresh, root, make(chan struct{})); err != nil {
+		t.Fatalf("fresh sync failed: %v", err)
+	}
+	if resumed, total := atomic.LoadUint32(&peer.requests), atomic.LoadUint32(&full.requests); requests+resumed > total+accountConcurrency {
+		t.Errorf("resumed sync refetched too much: %d+%d requests, full sync %d", requests, resumed, total)
+	}
+}
+
+// Tests that if the sync target moves mid-sync, the accounts and storage slots
+// retrieved for the old state root are healed into the new one.
+func TestSyncPivotMove(t *testing.T) {
+	source := newTestChain(t, 1000, 500, 5)
+	defer source.Stop()
+
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		syncer  = NewSyncer(db, nil)
+		peer    = newTestPeer("peer", source, syncer, 1000)
+		oldRoot = source.GetBlockByNumber(0).Root()
+		newRoot = source.CurrentBlock().Root()
+		cancel  = make(chan struct{})
+	)
+	syncer.Register(peer)
+
+	// Sync part of the genesis state, then move the pivot to the chain head
+	go func() {
+		for atomic.LoadUint32(&peer.requests) < 20 {
+			time.Sleep(time.Millisecond)
+		}
+		close(cancel)
+	}()
+	if err := runSync(t, syncer, oldRoot, cancel); err != ErrCancelled {
+		t.Fatalf("interrupted sync result mismatch: have %v, want %v", err, ErrCancelled)
+	}
+	if err := runSync(t, syncer, newRoot, make(chan struct{})); err != nil {
+		t.Fatalf("pivot sync failed: %v", err)
+	}
+	checkPeers(t, peer)
+	if syncer.trienodeHealSynced == 0 {
+		t.Errorf("state was not healed after pivot move")
+	}
+	verifyState(t, db, newRoot, 1000+2+5+1) // genesis accounts, test key, new recipients, coinbase
+}
+
+// Tests that peers not having the requested state are not used for syncing,
+// but the sync still completes from the ones that do.
+func TestSyncStatelessPeer(t *testing.T) {
+	source := newTestChain(t, 100, 100, 0)
+	defer source.Stop()
+
+	empty := newTestChain(t, 0, 0, 0)
+	defer empty.Stop()
+
+	var (
+		db        = rawdb.NewMemoryDatabase()
+		syncer    = NewSyncer(db, nil)
+		stateless = newTestPeer("stateless", empty, syncer, 0)
+		full      = newTestPeer("full", source, syncer, 0)
+		root      = source.CurrentBlock().Root()
+	)
+	syncer.Register(stateless)
+	syncer.Register(full)
+
+	if err := runSync(t, syncer, root, make(chan struct{})); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	checkPeers(t, stateless, full)
+	verifyState(t, db, root, 101)
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+const (
+	// callTraceSectionSize is the number of blocks the call trace indexer
+	// processes and commits in one go.
+	callTraceSectionSize = 256
+
+	// callTraceConfirms is the number of confirmations a block needs before its
+	// call traces are indexed.
+	callTraceConfirms = 128
+
+	// callTraceThrottling is the time to wait between processing two consecutive
+	// index sections, to avoid starving the node of resources while catching up.
+	callTraceThrottling = 100 * time.Millisecond
+
+	// callTraceTimeout is the amount of time a single transaction may be traced
+	// for by the indexer. It is generous, since a failure stalls the indexer.
+	callTraceTimeout = time.Minute
+)
+
+// CallTraceIndexer implements a core.ChainIndexer, storing the flattened call
+// traces of the canonical chain along with an index from the addresses involved
+// to the blocks containing them, permitting trace filtering without re-execution.
+type CallTraceIndexer struct {
+	api     *PrivateDebugAPI // tracing API to generate the call traces with
+	db      ethdb.Database   // database instance to write index data into
+	size    uint64           // section size to generate call traces for
+	section uint64           // section number being processed currently
+	batch   ethdb.Batch      // batch collecting the index data of the section
+}
+
+// NewCallTraceIndexer returns a chain indexer that generates the call traces of
+// the canonical chain for fast trace filtering.
+func NewCallTraceIndexer(eth *Ethereum, size, confirms uint64) *core.ChainIndexer {
+	backend := &CallTraceIndexer{
+		api:  NewPrivateDebugAPI(eth),
+		db:   eth.ChainDb(),
+		size: size,
+	}
+	table := rawdb.NewTable(eth.ChainDb(), string(rawdb.CallTraceIndexPrefix))
+
+	return core.NewChainIndexer(eth.ChainDb(), table, backend, size, confirms, callTraceThrottling, "calltraces")
+}
+
+// Reset implements core.ChainIndexerBackend, starting a new call trace section.
+// Any data left over from an earlier, reorged or interrupted run of the section
+// is unwound first.
+func (c *CallTraceIndexer) Reset(ctx context.Context, section uint64, lastSectionHead common.Hash) error {
+	c.section, c.batch = section, c.db.NewBatch()
+
+	for number := section * c.size; number < (section+1)*c.size; number++ {
+		_, blob := rawdb.ReadCallTraces(c.db, number)
+		if blob == nil {
+			continue
+		}
+		var traces [][]*tracers.FlatCallFrame
+		if err := json.Unmarshal(blob, &traces); err != nil {
+			return fmt.Errorf("corrupt call traces of block %d: %v", number, err)
+		}
+		for addr := range callTraceAddresses(traces) {
+			rawdb.DeleteCallTraceIndex(c.batch, addr, number)
+		}
+		rawdb.DeleteCallTraces(c.batch, number)
+	}
+	return c.flush(0)
+}
+
+// Process implements core.ChainIndexerBackend, tracing the calls of a block and
+// adding them to the index.
+func (c *CallTraceIndexer) Process(ctx context.Context, header *types.Header) error {
+	block := c.api.eth.blockchain.GetBlock(header.Hash(), header.Number.Uint64())
+	if block == nil {
+		return fmt.Errorf("block #%d [%x…] not found", header.Number, header.Hash().Bytes()[:4])
+	}
+	traces, err := traceBlockCalls(ctx, c.api, block, callTraceTimeout)
+	if err != nil {
+		return err
+	}
+	blob, err := json.Marshal(traces)
+	if err != nil {
+		return err
+	}
+	rawdb.WriteCallTraces(c.batch, block.NumberU64(), block.Hash(), blob)
+	for addr := range callTraceAddresses(traces) {
+		rawdb.WriteCallTraceIndex(c.batch, addr, block.NumberU64())
+	}
+	return c.flush(ethdb.IdealBatchSize)
+}
+
+// Commit implements core.ChainIndexerBackend, writing out the remaining index
+// data of the section.
+func (c *CallTraceIndexer) Commit() error {
+	return c.flush(0)
+}
+
+// Prune returns an empty error since we don't support pruning here.
+func (c *CallTraceIndexer) Prune(threshold uint64) error {
+	return nil
+}
+
+// flush writes out the collected index data if it exceeds the given size.
+func (c *CallTraceIndexer) flush(limit int) error {
+	if c.batch.ValueSize() <= limit {
+		return nil
+	}
+	if err := c.batch.Write(); err != nil {
+		return err
+	}
+	c.batch.Reset()
+	return nil
+}
+
+// callTraceAddresses returns the set of senders and recipients of a block's
+// flattened call traces.
+func callTraceAddresses(traces [][]*tracers.FlatCallFrame) map[common.Address]struct{} {
+	addrs := make(map[common.Address]struct{})
+	for _, frames := range traces {
+		for _, frame := range frames {
+			from, to := frame.Addresses()
+			if from != nil {
+				addrs[*from] = struct{}{}
+			}
+			if to != nil {
+				addrs[*to] = struct{}{}
+			}
+		}
+	}
+	return addrs
+}
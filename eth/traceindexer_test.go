@@ -0,0 +1,195 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// transferGenerator returns a chain generator sending a transfer from the test
+// bank to a distinct recipient in every block, derived from the given base.
+func transferGenerator(t *testing.T, config *params.ChainConfig, base int64) func(int, *core.BlockGen) {
+	signer := types.LatestSigner(config)
+	return func(i int, b *core.BlockGen) {
+		to := common.BigToAddress(big.NewInt(base + b.Number().Int64()))
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(testBank), to, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, testBankKey)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		b.AddTx(tx)
+	}
+}
+
+// waitSections waits until the chain indexer has processed the given number of
+// sections, the last of them ending in the given block.
+func waitSections(t *testing.T, indexer *core.ChainIndexer, sections uint64, head common.Hash) {
+	t.Helper()
+
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		if have, _, _ := indexer.Sections(); have >= sections && indexer.SectionHead(sections-1) == head {
+			return
+		}
+	}
+	have, _, _ := indexer.Sections()
+	t.Fatalf("indexer stuck at %d sections, want %d ending in %x", have, sections, head)
+}
+
+// Tests that the call trace index follows reorganisations, dropping the traces
+// and address index entries of blocks no longer canonical, and that filtering
+// yields the same traces within and beyond the indexed range.
+func TestCallTraceIndexerReorg(t *testing.T) {
+	const (
+		oldBase = 0xaa00 // Recipients of the original chain
+		newBase = 0xbb00 // Recipients of the reorged chain
+	)
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{testBank: {Balance: big.NewInt(params.Ether)}},
+	}
+	eth, blocks := newTestEthereum(t, gspec, 8, transferGenerator(t, gspec.Config, oldBase))
+
+	indexer := NewCallTraceIndexer(eth, 4, 0)
+	indexer.Start(eth.blockchain)
+	defer indexer.Close()
+	eth.callTraceIndexer = indexer
+
+	waitSections(t, indexer, 2, blocks[7].Hash())
+
+	// Replace everything after block #1 with a longer fork
+	fork, _ := core.GenerateChain(gspec.Config, blocks[1], ethash.NewFaker(), eth.chainDb, 11, transferGenerator(t, gspec.Config, newBase))
+	if _, err := eth.blockchain.InsertChain(fork); err != nil {
+		t.Fatalf("failed to insert fork: %v", err)
+	}
+	waitSections(t, indexer, 3, fork[len(fork)-2].Hash())
+	if head := indexer.SectionHead(0); head != fork[1].Hash() {
+		t.Fatalf("first section not reindexed: head %x, want %x", head, fork[1].Hash())
+	}
+	// The traces of all indexed blocks must be the canonical ones
+	db := eth.chainDb
+	for number := uint64(0); number < 12; number++ {
+		if hash, _ := rawdb.ReadCallTraces(db, number); hash != rawdb.ReadCanonicalHash(db, number) {
+			t.Errorf("block #%d: stale traces of %x", number, hash)
+		}
+	}
+	// Only the recipients of the canonical blocks may be indexed
+	for number := int64(1); number < 12; number++ {
+		var oldWant, newWant []uint64
+		if number < 2 {
+			oldWant = []uint64{uint64(number)}
+		} else {
+			newWant = []uint64{uint64(number)}
+		}
+		if have := rawdb.ReadCallTraceIndex(db, common.BigToAddress(big.NewInt(oldBase+number)), 0, 100); !reflect.DeepEqual(have, oldWant) {
+			t.Errorf("old recipient of block #%d: index mismatch: have %v, want %v", number, have, oldWant)
+		}
+		if have := rawdb.ReadCallTraceIndex(db, common.BigToAddress(big.NewInt(newBase+number)), 0, 100); !reflect.DeepEqual(have, newWant) {
+			t.Errorf("new recipient of block #%d: index mismatch: have %v, want %v", number, have, newWant)
+		}
+	}
+	// Filter across the indexed and unindexed range of the chain
+	var (
+		api     = NewPrivateTraceAPI(eth)
+		from    = rpc.BlockNumber(1)
+		to      = rpc.BlockNumber(12)
+		indexed = common.BigToAddress(big.NewInt(newBase + 5))
+		latest  = common.BigToAddress(big.NewInt(newBase + 12))
+		stale   = common.BigToAddress(big.NewInt(oldBase + 5))
+		after   = uint64(2)
+		count   = uint64(3)
+	)
+	tests := []struct {
+		args TraceFilterArgs
+		want []uint64
+	}{
+		{TraceFilterArgs{FromBlock: &from, ToBlock: &to, FromAddress: []common.Address{testBank}}, []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}},
+		{TraceFilterArgs{FromBlock: &from, ToBlock: &to, ToAddress: []common.Address{indexed, latest}}, []uint64{5, 12}},
+		{TraceFilterArgs{FromBlock: &from, ToBlock: &to, FromAddress: []common.Address{testBank}, ToAddress: []common.Address{latest}}, []uint64{12}},
+		{TraceFilterArgs{FromBlock: &from, ToBlock: &to, ToAddress: []common.Address{stale}}, nil},
+		{TraceFilterArgs{FromBlock: &from, ToBlock: &to, FromAddress: []common.Address{indexed}}, nil},
+		{TraceFilterArgs{FromBlock: &from, ToBlock: &to, FromAddress: []common.Address{testBank}, After: &after, Count: &count}, []uint64{3, 4, 5}},
+	}
+	filter := func(args TraceFilterArgs) []*flatTrace {
+		traces, err := api.Filter(context.Background(), args)
+		if err != nil {
+			t.Fatalf("failed to filter traces: %v", err)
+		}
+		return traces
+	}
+	for i, tt := range tests {
+		traces := filter(tt.args)
+
+		var have []uint64
+		for _, trace := range traces {
+			have = append(have, trace.BlockNumber)
+			if trace.BlockHash != rawdb.ReadCanonicalHash(db, trace.BlockNumber) {
+				t.Errorf("test %d: trace of non-canonical block %x", i, trace.BlockHash)
+			}
+		}
+		if !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("test %d: block mismatch: have %v, want %v", i, have, tt.want)
+		}
+		// Re-executing all blocks must yield the same traces
+		eth.callTraceIndexer = nil
+		if plain := filter(tt.args); !reflect.DeepEqual(plain, traces) {
+			t.Errorf("test %d: indexed and re-executed traces differ", i)
+		}
+		eth.callTraceIndexer = indexer
+	}
+	// Ranges which would take too long to process must be rejected
+	api.maxBlocks, api.maxReexec = 4, 1
+
+	limits := []struct {
+		args TraceFilterArgs
+		fail bool
+	}{
+		{TraceFilterArgs{FromBlock: &from, ToBlock: &to, ToAddress: []common.Address{latest}}, false},
+		{TraceFilterArgs{FromBlock: &from, ToBlock: &to}, true},
+		{TraceFilterArgs{FromBlock: &to, ToBlock: &to}, false},
+	}
+	for i, tt := range limits {
+		if _, err := api.Filter(context.Background(), tt.args); (err != nil) != tt.fail {
+			t.Errorf("limit test %d: error mismatch: have %v, want failure %v", i, err, tt.fail)
+		}
+	}
+	eth.callTraceIndexer = nil
+	if _, err := api.Filter(context.Background(), limits[0].args); err == nil {
+		t.Errorf("unindexed range exceeding the re-execution limit accepted")
+	}
+	eth.callTraceIndexer = indexer
+
+	// Cancelled requests must not re-execute blocks
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := api.Filter(ctx, limits[2].args); err != context.Canceled {
+		t.Errorf("cancelled filter error mismatch: have %v, want %v", err, context.Canceled)
+	}
+	if _, err := traceBlockCalls(ctx, api.debug, eth.blockchain.GetBlockByNumber(12), callTraceTimeout); err != context.Canceled {
+		t.Errorf("cancelled re-execution error mismatch: have %v, want %v", err, context.Canceled)
+	}
+}
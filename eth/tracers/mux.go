@@ -0,0 +1,162 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// muxTracer fans out all the tracing callbacks to a set of tracers, allowing
+// them to collect their results from a single execution.
+type muxTracer struct {
+	keys    []string
+	tracers []TxTracer
+}
+
+// NewMuxTracer creates a tracer running all the given tracers at once. The
+// tracers are resolved by NewTracer and the result is an object containing the
+// result of each of them, keyed by the tracer name, or by js#<index> for custom
+// JavaScript code at the given position of the list.
+func NewMuxTracer(names []string) (TxTracer, error) {
+	if len(names) == 0 {
+		return nil, errors.New("no tracers to multiplex")
+	}
+	mux := &muxTracer{
+		keys:    make([]string, 0, len(names)),
+		tracers: make([]TxTracer, 0, len(names)),
+	}
+	seen := make(map[string]bool)
+	for i, name := range names {
+		key := muxTracerKey(name, i)
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate tracer %s", key)
+		}
+		seen[name] = true
+
+		tracer, err := NewTracer(name)
+		if err != nil {
+			return nil, fmt.Errorf("tracer %s: %v", key, err)
+		}
+		mux.keys = append(mux.keys, key)
+		mux.tracers = append(mux.tracers, tracer)
+	}
+	return mux, nil
+}
+
+// muxTracerKey returns the key the result of a multiplexed tracer is reported
+// under: the name of native and built-in JavaScript tracers, or js#<index> for
+// custom JavaScript code at the given position of the tracer list.
+func muxTracerKey(name string, index int) string {
+	if _, ok := native[name]; ok {
+		return name
+	}
+	if _, ok := tracer(name); ok {
+		return name
+	}
+	return fmt.Sprintf("js#%d", index)
+}
+
+// CaptureStart implements the Tracer interface to initialize the tracing operation.
+func (t *muxTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	var failure error
+	for _, tracer := range t.tracers {
+		if err := tracer.CaptureStart(from, to, create, input, gas, value); err != nil && failure == nil {
+			failure = err
+		}
+	}
+	return failure
+}
+
+// CaptureState implements the Tracer interface to trace a single step of VM execution.
+func (t *muxTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	var failure error
+	for _, tracer := range t.tracers {
+		if err := tracer.CaptureState(env, pc, op, gas, cost, memory, stack, rStack, rData, contract, depth, err); err != nil && failure == nil {
+			failure = err
+		}
+	}
+	return failure
+}
+
+// CaptureFault implements the Tracer interface to trace an execution fault
+// while running an opcode.
+func (t *muxTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, contract *vm.Contract, depth int, err error) error {
+	var failure error
+	for _, tracer := range t.tracers {
+		if err := tracer.CaptureFault(env, pc, op, gas, cost, memory, stack, rStack, contract, depth, err); err != nil && failure == nil {
+			failure = err
+		}
+	}
+	return failure
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *muxTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	var failure error
+	for _, tracer := range t.tracers {
+		if err := tracer.CaptureEnd(output, gasUsed, d, err); err != nil && failure == nil {
+			failure = err
+		}
+	}
+	return failure
+}
+
+// CaptureTxEnd implements StateTracer, forwarding the post transaction state to
+// the tracers interested in it.
+func (t *muxTracer) CaptureTxEnd(statedb *state.StateDB) {
+	for _, tracer := range t.tracers {
+		if tracer, ok := tracer.(StateTracer); ok {
+			tracer.CaptureTxEnd(statedb)
+		}
+	}
+}
+
+// GetResult returns the results of all the tracers by their keys. Every tracer
+// is finalized, even if an earlier one failed, so that they release their
+// resources.
+func (t *muxTracer) GetResult() (json.RawMessage, error) {
+	var (
+		results = make(map[string]json.RawMessage, len(t.tracers))
+		failure error
+	)
+	for i, tracer := range t.tracers {
+		res, err := tracer.GetResult()
+		if err != nil && failure == nil {
+			failure = fmt.Errorf("tracer %s: %v", t.keys[i], err)
+		}
+		results[t.keys[i]] = res
+	}
+	if failure != nil {
+		return nil, failure
+	}
+	return json.Marshal(results)
+}
+
+// Stop terminates execution of all the tracers at the first opportune moment.
+func (t *muxTracer) Stop(err error) {
+	for _, tracer := range t.tracers {
+		tracer.Stop(err)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Tests that the mux tracer produces the same results as running each of its
+// tracers separately.
+func TestMuxTracer(t *testing.T) {
+	blob, err := ioutil.ReadFile(filepath.Join("testdata", "call_tracer_deep_calls.json"))
+	if err != nil {
+		t.Fatalf("failed to read testcase: %v", err)
+	}
+	test := new(callTracerTest)
+	if err := json.Unmarshal(blob, test); err != nil {
+		t.Fatalf("failed to parse testcase: %v", err)
+	}
+	// The custom tracer is JavaScript code, ensure it's multiplexed too
+	names := []string{"prestateTracer", "4byteTracer", "opcountTracer", "{count: 0, step: function() { this.count++ }, fault: function() {}, result: function() { return this.count }}"}
+
+	mux, err := NewMuxTracer(names)
+	if err != nil {
+		t.Fatalf("failed to create mux tracer: %v", err)
+	}
+	var have map[string]interface{}
+	if err := json.Unmarshal(runTracerTest(t, test, mux), &have); err != nil {
+		t.Fatalf("failed to unmarshal mux result: %v", err)
+	}
+	if len(have) != len(names) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(have), len(names))
+	}
+	for i, name := range names {
+		key := name
+		if i == len(names)-1 {
+			key = "js#3"
+		}
+		if muxTracerKey(name, i) != key {
+			t.Errorf("tracer %d: key mismatch: have %q, want %q", i, muxTracerKey(name, i), key)
+		}
+		tracer, err := NewTracer(name)
+		if err != nil {
+			t.Fatalf("failed to create tracer %q: %v", name, err)
+		}
+		var want interface{}
+		if err := json.Unmarshal(runTracerTest(t, test, tracer), &want); err != nil {
+			t.Fatalf("failed to unmarshal %q result: %v", name, err)
+		}
+		if !reflect.DeepEqual(have[key], want) {
+			t.Errorf("tracer %s: result mismatch: have %v, want %v", key, have[key], want)
+		}
+	}
+}
+
+// Tests that invalid tracer sets are rejected.
+func TestMuxTracerInvalid(t *testing.T) {
+	if _, err := NewMuxTracer(nil); err == nil {
+		t.Errorf("empty tracer set accepted")
+	}
+	if _, err := NewMuxTracer([]string{"callTracer", "callTracer"}); err == nil {
+		t.Errorf("duplicate tracers accepted")
+	}
+	if _, err := NewMuxTracer([]string{"callTracer", "{invalid"}); err == nil {
+		t.Errorf("invalid tracer accepted")
+	}
+}
+
+// Tests that interrupting the mux tracer interrupts all its tracers.
+func TestMuxTracerStop(t *testing.T) {
+	mux, err := NewMuxTracer([]string{"callTracer", "4byteTracer"})
+	if err != nil {
+		t.Fatalf("failed to create mux tracer: %v", err)
+	}
+	mux.Stop(errors.New("stopped"))
+	if _, err := mux.GetResult(); err == nil {
+		t.Fatalf("interrupted mux tracer returned result")
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// TxTracer is a transaction tracer which can be interrupted and which assembles
+// its findings into a JSON result. It's implemented both by the JavaScript
+// tracers and by the native Go ones.
+type TxTracer interface {
+	vm.Tracer
+
+	// GetResult returns the JSON encoded result of the trace, or the error which
+	// interrupted it.
+	GetResult() (json.RawMessage, error)
+
+	// Stop terminates the tracing at the first opportune moment.
+	Stop(err error)
+}
+
+// native contains the Go implementations of the built-in tracers by name.
+var native = make(map[string]func() TxTracer)
+
+// RegisterNative makes a Go tracer available under the given name. Native
+// tracers take precedence over the JavaScript ones with the same name.
+func RegisterNative(name string, ctor func() TxTracer) {
+	native[name] = ctor
+}
+
+// NewTracer creates a tracer from the given name or JavaScript code. Names of
+// native tracers resolve to their Go implementation, anything else is handed to
+// the JavaScript engine.
+func NewTracer(code string) (TxTracer, error) {
+	if ctor, ok := native[code]; ok {
+		return ctor(), nil
+	}
+	return New(code)
+}
+
+func init() {
+	RegisterNative("callTracer", newCallTracer)
+	RegisterNative("prestateTracer", newPrestateTracer)
+	RegisterNative("4byteTracer", newFourByteTracer)
+	RegisterNative("noopTracer", newNoopTracer)
+	RegisterNative("opcountTracer", newOpcountTracer)
+	RegisterNative("unigramTracer", newUnigramTracer)
+	RegisterNative("bigramTracer", newBigramTracer)
+	RegisterNative("trigramTracer", newTrigramTracer)
+	RegisterNative("stateDiffTracer", newStateDiffTracer)
+	RegisterNative("flatCallTracer", newFlatCallTracer)
+}
+
+// interruptible implements the interruption handling shared by the native
+// tracers.
+type interruptible struct {
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *interruptible) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
+
+// stopped returns whether the tracer was interrupted.
+func (t *interruptible) stopped() bool {
+	return atomic.LoadUint32(&t.interrupt) > 0
+}
+
+// result encodes the tracing result into JSON, unless the tracer was interrupted.
+func (t *interruptible) result(res interface{}) (json.RawMessage, error) {
+	if t.stopped() {
+		return nil, t.reason
+	}
+	return json.Marshal(res)
+}
+
+// The helpers below give the native tracers the same lenient view over the
+// EVM internals as the JavaScript tracers have, so that they produce the same
+// output even for failing operations.
+
+// peek returns the nth-from-the-top element of the stack, or zero if the stack
+// is not deep enough.
+func peek(stack *vm.Stack, n int) *big.Int {
+	return (&stackWrapper{stack: stack}).peek(n)
+}
+
+// peekAddress interprets the nth-from-the-top element of the stack as an address.
+func peekAddress(stack *vm.Stack, n int) common.Address {
+	return common.BigToAddress(peek(stack, n))
+}
+
+// peekInt interprets the nth-from-the-top element of the stack as a memory
+// offset or size.
+func peekInt(stack *vm.Stack, n int) int64 {
+	return peek(stack, n).Int64()
+}
+
+// memorySlice returns the requested range of memory, or nil if out of bounds.
+func memorySlice(memory *vm.Memory, begin, end int64) []byte {
+	return (&memoryWrapper{memory: memory}).slice(begin, end)
+}
+
+// encodeAddress returns the lowercase hex encoding of an address.
+func encodeAddress(addr common.Address) string {
+	return hexutil.Encode(addr[:])
+}
+
+// encodeInt returns the hex encoding of a signed number the same way the
+// JavaScript big integer library does.
+func encodeInt(n int64) string {
+	if n < 0 {
+		return "0x-" + strconv.FormatInt(-n, 16)
+	}
+	return "0x" + strconv.FormatInt(n, 16)
+}
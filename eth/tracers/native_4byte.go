@@ -0,0 +1,101 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// fourByteTracer is the native implementation of the 4byteTracer, which counts
+// the 4byte method identifiers and call data sizes of all the calls made by a
+// transaction.
+type fourByteTracer struct {
+	interruptible
+
+	ids   map[string]int // Number of calls made by 4byte identifier and data size
+	input []byte         // Call data of the outer transaction
+}
+
+// newFourByteTracer creates a native 4byte tracer.
+func newFourByteTracer() TxTracer {
+	return &fourByteTracer{ids: make(map[string]int)}
+}
+
+// store saves the given identifier and data size.
+func (t *fourByteTracer) store(id []byte, size int64) {
+	t.ids[hexutil.Encode(id)+"-"+strconv.FormatInt(size, 10)]++
+}
+
+// CaptureStart implements the Tracer interface to initialize the tracing operation.
+func (t *fourByteTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.input = common.CopyBytes(input)
+	return nil
+}
+
+// CaptureState implements the Tracer interface to trace a single step of VM execution.
+func (t *fourByteTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	if t.stopped() {
+		return nil
+	}
+	// Skip any opcodes that are not internal calls, locating the input args
+	var memin int
+	switch op {
+	case vm.CALL, vm.CALLCODE:
+		memin = 3 // gas, addr, val, memin, meminsz, memout, memoutsz
+	case vm.DELEGATECALL, vm.STATICCALL:
+		memin = 2 // gas, addr, memin, meminsz, memout, memoutsz
+	default:
+		return nil
+	}
+	// Skip any pre-compile invocations, those are just fancy opcodes
+	if _, ok := vm.PrecompiledContractsIstanbul[peekAddress(stack, 1)]; ok {
+		return nil
+	}
+	// Gather internal call details
+	if size := peekInt(stack, memin+1); size >= 4 {
+		offset := peekInt(stack, memin)
+		t.store(memorySlice(memory, offset, offset+4), size-4)
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface to trace an execution fault
+// while running an opcode.
+func (t *fourByteTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *fourByteTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+
+// GetResult returns the number of calls by 4byte identifier and data size,
+// including the outer transaction.
+func (t *fourByteTracer) GetResult() (json.RawMessage, error) {
+	if len(t.input) >= 4 {
+		t.store(t.input[:4], int64(len(t.input)-4))
+	}
+	return t.result(t.ids)
+}
@@ -0,0 +1,281 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// callFrame is a single call of the call tree assembled by the call tracer. The
+// exported fields are laid out in the same order as the JavaScript tracer emits
+// them, the unexported ones track the call while it's in progress.
+type callFrame struct {
+	Type    string       `json:"type"`
+	From    string       `json:"from"`
+	To      string       `json:"to,omitempty"`
+	Value   string       `json:"value,omitempty"`
+	Gas     string       `json:"gas,omitempty"`
+	GasUsed string       `json:"gasUsed,omitempty"`
+	Input   string       `json:"input,omitempty"`
+	Output  string       `json:"output,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Time    string       `json:"time,omitempty"`
+	Calls   []*callFrame `json:"calls,omitempty"`
+
+	gasIn   uint64 // Gas available before the call opcode
+	gasCost uint64 // Cost of the call opcode
+	gas     uint64 // Gas available within the call, if known
+	hasGas  bool   // Whether the gas available within the call is known
+	outOff  int64  // Memory offset of the call output
+	outLen  int64  // Length of the call output
+}
+
+// callTracer is the native implementation of the callTracer, which assembles
+// the tree of internal calls made by a transaction.
+type callTracer struct {
+	interruptible
+
+	callstack []*callFrame // Current recursive call stack of the execution
+	descended bool         // Whether we've just descended into an inner call
+
+	// Context of the outer transaction gathered throughout execution
+	create  bool
+	from    common.Address
+	to      common.Address
+	input   []byte
+	gas     uint64
+	value   *big.Int
+	gasUsed uint64
+	output  []byte
+	time    time.Duration
+	err     error
+}
+
+// newCallTracer creates a native call tracer.
+func newCallTracer() TxTracer {
+	return &callTracer{callstack: []*callFrame{{}}, value: new(big.Int)}
+}
+
+// CaptureStart implements the Tracer interface to initialize the tracing operation.
+func (t *callTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.create, t.from, t.to, t.input, t.gas, t.value = create, from, to, common.CopyBytes(input), gas, value
+	return nil
+}
+
+// CaptureState implements the Tracer interface to trace a single step of VM execution.
+func (t *callTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	if t.stopped() {
+		return nil
+	}
+	// Capture any errors immediately
+	if err != nil {
+		t.fault(err)
+		return nil
+	}
+	// We only care about system opcodes, faster if we pre-check once
+	syscall := op&0xf0 == 0xf0
+
+	switch {
+	case syscall && (op == vm.CREATE || op == vm.CREATE2):
+		// If a new contract is being created, add to the call stack
+		inOff := peekInt(stack, 1)
+		inEnd := inOff + peekInt(stack, 2)
+
+		t.callstack = append(t.callstack, &callFrame{
+			Type:    op.String(),
+			From:    encodeAddress(contract.Address()),
+			Input:   hexutil.Encode(memorySlice(memory, inOff, inEnd)),
+			Value:   hexutil.EncodeBig(peek(stack, 0)),
+			gasIn:   gas,
+			gasCost: cost,
+		})
+		t.descended = true
+		return nil
+
+	case syscall && op == vm.SELFDESTRUCT:
+		// If a contract is being self destructed, gather that as a subcall too
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, &callFrame{
+			Type:  op.String(),
+			From:  encodeAddress(contract.Address()),
+			To:    encodeAddress(peekAddress(stack, 0)),
+			Value: hexutil.EncodeBig(env.StateDB.GetBalance(contract.Address())),
+		})
+		return nil
+
+	case syscall && (op == vm.CALL || op == vm.CALLCODE || op == vm.DELEGATECALL || op == vm.STATICCALL):
+		// If a new method invocation is being done, add to the call stack. Skip
+		// any pre-compile invocations, those are just fancy opcodes.
+		to := peekAddress(stack, 1)
+		if _, ok := vm.PrecompiledContractsIstanbul[to]; ok {
+			return nil
+		}
+		off := 1
+		if op == vm.DELEGATECALL || op == vm.STATICCALL {
+			off = 0
+		}
+		inOff := peekInt(stack, 2+off)
+		inEnd := inOff + peekInt(stack, 3+off)
+
+		call := &callFrame{
+			Type:    op.String(),
+			From:    encodeAddress(contract.Address()),
+			To:      encodeAddress(to),
+			Input:   hexutil.Encode(memorySlice(memory, inOff, inEnd)),
+			gasIn:   gas,
+			gasCost: cost,
+			outOff:  peekInt(stack, 4+off),
+			outLen:  peekInt(stack, 5+off),
+		}
+		if op != vm.DELEGATECALL && op != vm.STATICCALL {
+			call.Value = hexutil.EncodeBig(peek(stack, 2))
+		}
+		t.callstack = append(t.callstack, call)
+		t.descended = true
+		return nil
+	}
+	// If we've just descended into an inner call, retrieve it's true allowance. We
+	// need to extract if from within the call as there may be funky gas dynamics
+	// with regard to requested and actually given gas (2300 stipend, 63/64 rule).
+	if t.descended {
+		if depth >= len(t.callstack) {
+			call := t.callstack[len(t.callstack)-1]
+			call.gas, call.hasGas = gas, true
+		}
+		t.descended = false
+	}
+	// If an existing call is returning, pop off the call stack
+	if syscall && op == vm.REVERT {
+		t.callstack[len(t.callstack)-1].Error = "execution reverted"
+		return nil
+	}
+	if depth == len(t.callstack)-1 {
+		// Pop off the last call and get the execution results
+		call := t.callstack[len(t.callstack)-1]
+		t.callstack = t.callstack[:len(t.callstack)-1]
+
+		ret := peek(stack, 0)
+		if call.Type == vm.CREATE.String() || call.Type == vm.CREATE2.String() {
+			// If the call was a CREATE, retrieve the contract address and output code
+			call.GasUsed = encodeInt(int64(call.gasIn) - int64(call.gasCost) - int64(gas))
+
+			if ret.Sign() != 0 {
+				addr := common.BigToAddress(ret)
+				call.To = encodeAddress(addr)
+				call.Output = hexutil.Encode(env.StateDB.GetCode(addr))
+			} else if call.Error == "" {
+				call.Error = "internal failure"
+			}
+		} else {
+			// If the call was a contract call, retrieve the gas usage and output
+			if call.hasGas {
+				call.GasUsed = encodeInt(int64(call.gasIn) - int64(call.gasCost) + int64(call.gas) - int64(gas))
+			}
+			if ret.Sign() != 0 {
+				call.Output = hexutil.Encode(memorySlice(memory, call.outOff, call.outOff+call.outLen))
+			} else if call.Error == "" {
+				call.Error = "internal failure"
+			}
+		}
+		if call.hasGas {
+			call.Gas = hexutil.EncodeUint64(call.gas)
+		}
+		// Inject the call into the previous one
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, call)
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface to trace an execution fault
+// while running an opcode.
+func (t *callTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, contract *vm.Contract, depth int, err error) error {
+	if !t.stopped() {
+		t.fault(err)
+	}
+	return nil
+}
+
+// fault handles a failed execution, flattening the failed call into its parent.
+func (t *callTracer) fault(err error) {
+	// If the topmost call already reverted, don't handle the additional fault again
+	if t.callstack[len(t.callstack)-1].Error != "" {
+		return
+	}
+	// Pop off the just failed call, consuming all available gas
+	call := t.callstack[len(t.callstack)-1]
+	t.callstack = t.callstack[:len(t.callstack)-1]
+
+	call.Error = err.Error()
+	if call.hasGas {
+		call.Gas = hexutil.EncodeUint64(call.gas)
+		call.GasUsed = call.Gas
+	}
+	// Flatten the failed call into its parent
+	if len(t.callstack) > 0 {
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, call)
+		return
+	}
+	// Last call failed too, leave it in the stack
+	t.callstack = append(t.callstack, call)
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *callTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	t.output, t.gasUsed, t.time, t.err = common.CopyBytes(output), gasUsed, d, err
+	return nil
+}
+
+// GetResult returns the call tree of the transaction.
+func (t *callTracer) GetResult() (json.RawMessage, error) {
+	return t.result(t.frame())
+}
+
+// frame assembles the outer call of the transaction along with its call tree.
+func (t *callTracer) frame() *callFrame {
+	result := &callFrame{
+		Type:    "CALL",
+		From:    encodeAddress(t.from),
+		To:      encodeAddress(t.to),
+		Value:   hexutil.EncodeBig(t.value),
+		Gas:     hexutil.EncodeUint64(t.gas),
+		GasUsed: hexutil.EncodeUint64(t.gasUsed),
+		Input:   hexutil.Encode(t.input),
+		Output:  hexutil.Encode(t.output),
+		Time:    t.time.String(),
+		Calls:   t.callstack[0].Calls,
+	}
+	if t.create {
+		result.Type = "CREATE"
+	}
+	if t.callstack[0].Error != "" {
+		result.Error = t.callstack[0].Error
+	} else if t.err != nil {
+		result.Error = t.err.Error()
+	}
+	if result.Error != "" && (result.Error != "execution reverted" || result.Output == "0x") {
+		result.Output = ""
+	}
+	return result
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// FlatCallAction is the action of a flattened call trace. Calls set the call
+// type, sender, recipient, gas, input and value; creations the sender, gas,
+// init code and value; self-destructs the destroyed and refunded addresses
+// along with the refunded balance.
+type FlatCallAction struct {
+	Address       *common.Address `json:"address,omitempty"`
+	Balance       *hexutil.Big    `json:"balance,omitempty"`
+	CallType      string          `json:"callType,omitempty"`
+	From          *common.Address `json:"from,omitempty"`
+	Gas           *hexutil.Uint64 `json:"gas,omitempty"`
+	Init          *hexutil.Bytes  `json:"init,omitempty"`
+	Input         *hexutil.Bytes  `json:"input,omitempty"`
+	RefundAddress *common.Address `json:"refundAddress,omitempty"`
+	To            *common.Address `json:"to,omitempty"`
+	Value         *hexutil.Big    `json:"value,omitempty"`
+}
+
+// FlatCallResult is the outcome of a successful flattened call trace. Calls set
+// the gas used and output; creations the gas used, contract address and code.
+type FlatCallResult struct {
+	Address *common.Address `json:"address,omitempty"`
+	Code    *hexutil.Bytes  `json:"code,omitempty"`
+	GasUsed hexutil.Uint64  `json:"gasUsed"`
+	Output  *hexutil.Bytes  `json:"output,omitempty"`
+}
+
+// FlatCallFrame is a single call of a transaction in the flattened call trace
+// format introduced by Parity, positioned in the call tree by its trace address.
+type FlatCallFrame struct {
+	Action       FlatCallAction  `json:"action"`
+	Error        string          `json:"error,omitempty"`
+	Result       *FlatCallResult `json:"result,omitempty"`
+	Subtraces    int             `json:"subtraces"`
+	TraceAddress []int           `json:"traceAddress"`
+	Type         string          `json:"type"`
+}
+
+// Addresses returns the accounts involved in the call as its sender and its
+// recipient, which are the fields flattened traces are filtered by.
+func (f *FlatCallFrame) Addresses() (from *common.Address, to *common.Address) {
+	switch f.Type {
+	case "create":
+		if f.Result != nil {
+			return f.Action.From, f.Result.Address
+		}
+		return f.Action.From, nil
+	case "suicide":
+		return f.Action.Address, f.Action.RefundAddress
+	default:
+		return f.Action.From, f.Action.To
+	}
+}
+
+// flatCallTracer is a call tracer reporting the call tree of a transaction as a
+// flat list of calls in the Parity trace format.
+type flatCallTracer struct {
+	*callTracer
+}
+
+// newFlatCallTracer creates a native flat call tracer.
+func newFlatCallTracer() TxTracer {
+	return &flatCallTracer{callTracer: newCallTracer().(*callTracer)}
+}
+
+// GetResult returns the flattened calls of the transaction.
+func (t *flatCallTracer) GetResult() (json.RawMessage, error) {
+	return t.result(flattenCall(t.frame(), []int{}, nil))
+}
+
+// flattenCall appends the given call and all its inner calls in depth first
+// order to the flat trace list.
+func flattenCall(call *callFrame, traceAddress []int, frames []*FlatCallFrame) []*FlatCallFrame {
+	frame := &FlatCallFrame{
+		Error:        flatCallError(call.Error),
+		Subtraces:    len(call.Calls),
+		TraceAddress: traceAddress,
+	}
+	switch call.Type {
+	case "CREATE", "CREATE2":
+		frame.Type = "create"
+		frame.Action = FlatCallAction{
+			From:  decodeAddress(call.From),
+			Gas:   decodeUint64(call.Gas),
+			Init:  decodeBytes(call.Input),
+			Value: decodeBig(call.Value),
+		}
+		if frame.Error == "" {
+			frame.Result = &FlatCallResult{
+				Address: decodeAddress(call.To),
+				Code:    decodeBytes(call.Output),
+				GasUsed: *decodeUint64(call.GasUsed),
+			}
+		}
+	case "SELFDESTRUCT":
+		frame.Type = "suicide"
+		frame.Action = FlatCallAction{
+			Address:       decodeAddress(call.From),
+			Balance:       decodeBig(call.Value),
+			RefundAddress: decodeAddress(call.To),
+		}
+	default:
+		frame.Type = "call"
+		frame.Action = FlatCallAction{
+			CallType: strings.ToLower(call.Type),
+			From:     decodeAddress(call.From),
+			Gas:      decodeUint64(call.Gas),
+			Input:    decodeBytes(call.Input),
+			To:       decodeAddress(call.To),
+			Value:    decodeBig(call.Value),
+		}
+		if frame.Error == "" {
+			frame.Result = &FlatCallResult{
+				GasUsed: *decodeUint64(call.GasUsed),
+				Output:  decodeBytes(call.Output),
+			}
+		}
+	}
+	frames = append(frames, frame)
+	for i, inner := range call.Calls {
+		frames = flattenCall(inner, append(append([]int{}, traceAddress...), i), frames)
+	}
+	return frames
+}
+
+// flatCallError converts the common EVM errors into the wording used by flat
+// call traces, leaving any other error untouched.
+func flatCallError(err string) string {
+	switch {
+	case err == "execution reverted":
+		return "Reverted"
+	case err == "out of gas":
+		return "Out of gas"
+	case err == "invalid jump destination":
+		return "Bad jump destination"
+	case strings.HasPrefix(err, "stack underflow"):
+		return "Stack underflow"
+	case strings.HasPrefix(err, "invalid opcode"):
+		return "Bad instruction"
+	default:
+		return err
+	}
+}
+
+// decodeAddress converts a hex encoded address of the call tracer.
+func decodeAddress(s string) *common.Address {
+	addr := common.HexToAddress(s)
+	return &addr
+}
+
+// decodeUint64 converts a hex encoded quantity of the call tracer, treating any
+// missing or negative value as zero.
+func decodeUint64(s string) *hexutil.Uint64 {
+	n, _ := hexutil.DecodeUint64(s)
+	return (*hexutil.Uint64)(&n)
+}
+
+// decodeBig converts a hex encoded value of the call tracer, treating a missing
+// value as zero.
+func decodeBig(s string) *hexutil.Big {
+	n, err := hexutil.DecodeBig(s)
+	if err != nil {
+		return new(hexutil.Big)
+	}
+	return (*hexutil.Big)(n)
+}
+
+// decodeBytes converts a hex encoded blob of the call tracer.
+func decodeBytes(s string) *hexutil.Bytes {
+	b, _ := hexutil.Decode(s)
+	return (*hexutil.Bytes)(&b)
+}
@@ -0,0 +1,171 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// opTracer is the base of the native tracers which only look at the opcodes
+// executed, calling back into the given function for each of them.
+type opTracer struct {
+	interruptible
+	step func(op vm.OpCode, depth int)
+}
+
+// CaptureStart implements the Tracer interface to initialize the tracing operation.
+func (t *opTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureState implements the Tracer interface to trace a single step of VM execution.
+func (t *opTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	if t.step != nil && !t.stopped() {
+		t.step(op, depth)
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface to trace an execution fault
+// while running an opcode.
+func (t *opTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *opTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+
+// noopTracer is the native implementation of the noopTracer, which does nothing.
+type noopTracer struct {
+	opTracer
+}
+
+// newNoopTracer creates a native noop tracer.
+func newNoopTracer() TxTracer {
+	return new(noopTracer)
+}
+
+// GetResult returns an empty object.
+func (t *noopTracer) GetResult() (json.RawMessage, error) {
+	return t.result(struct{}{})
+}
+
+// opcountTracer is the native implementation of the opcountTracer, which counts
+// the number of EVM instructions executed.
+type opcountTracer struct {
+	opTracer
+	count int
+}
+
+// newOpcountTracer creates a native opcount tracer.
+func newOpcountTracer() TxTracer {
+	t := new(opcountTracer)
+	t.step = func(op vm.OpCode, depth int) { t.count++ }
+	return t
+}
+
+// GetResult returns the number of instructions executed.
+func (t *opcountTracer) GetResult() (json.RawMessage, error) {
+	return t.result(t.count)
+}
+
+// unigramTracer is the native implementation of the unigramTracer, which counts
+// the number of times each opcode is executed.
+type unigramTracer struct {
+	opTracer
+	hist map[string]int
+}
+
+// newUnigramTracer creates a native unigram tracer.
+func newUnigramTracer() TxTracer {
+	t := &unigramTracer{hist: make(map[string]int)}
+	t.step = func(op vm.OpCode, depth int) { t.hist[op.String()]++ }
+	return t
+}
+
+// GetResult returns the opcode counters, or null if nothing was executed.
+func (t *unigramTracer) GetResult() (json.RawMessage, error) {
+	if len(t.hist) == 0 {
+		return t.result(nil)
+	}
+	return t.result(t.hist)
+}
+
+// bigramTracer is the native implementation of the bigramTracer, which counts
+// the number of times each pair of consecutive opcodes is executed within the
+// same call.
+type bigramTracer struct {
+	opTracer
+
+	hist      map[string]int
+	lastOp    string
+	lastDepth int
+}
+
+// newBigramTracer creates a native bigram tracer.
+func newBigramTracer() TxTracer {
+	t := &bigramTracer{hist: make(map[string]int)}
+	t.step = func(op vm.OpCode, depth int) {
+		if depth == t.lastDepth {
+			t.hist[t.lastOp+"-"+op.String()]++
+		}
+		t.lastOp, t.lastDepth = op.String(), depth
+	}
+	return t
+}
+
+// GetResult returns the opcode bigram counters.
+func (t *bigramTracer) GetResult() (json.RawMessage, error) {
+	return t.result(t.hist)
+}
+
+// trigramTracer is the native implementation of the trigramTracer, which counts
+// the number of times each triplet of consecutive opcodes is executed within
+// the same call.
+type trigramTracer struct {
+	opTracer
+
+	hist      map[string]int
+	lastOps   [2]string
+	lastDepth int
+}
+
+// newTrigramTracer creates a native trigram tracer.
+func newTrigramTracer() TxTracer {
+	t := &trigramTracer{hist: make(map[string]int)}
+	t.step = func(op vm.OpCode, depth int) {
+		if depth != t.lastDepth {
+			t.lastOps, t.lastDepth = [2]string{}, depth
+			return
+		}
+		t.hist[t.lastOps[0]+"-"+t.lastOps[1]+"-"+op.String()]++
+		t.lastOps[0], t.lastOps[1] = t.lastOps[1], op.String()
+	}
+	return t
+}
+
+// GetResult returns the opcode trigram counters.
+func (t *trigramTracer) GetResult() (json.RawMessage, error) {
+	return t.result(t.hist)
+}
@@ -0,0 +1,172 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// prestateAccount is the state of an account before the traced transaction.
+type prestateAccount struct {
+	Balance *big.Int          `json:"-"`
+	Nonce   int64             `json:"nonce"`
+	Code    string            `json:"code"`
+	Storage map[string]string `json:"storage"`
+}
+
+// MarshalJSON encodes the account the same way the JavaScript tracer does.
+func (acc *prestateAccount) MarshalJSON() ([]byte, error) {
+	type account prestateAccount
+	return json.Marshal(&struct {
+		Balance string `json:"balance"`
+		*account
+	}{
+		Balance: hexutil.EncodeBig(acc.Balance),
+		account: (*account)(acc),
+	})
+}
+
+// prestateTracer is the native implementation of the prestateTracer, which
+// gathers all the state accessed by a transaction, as it was before execution.
+type prestateTracer struct {
+	interruptible
+
+	prestate map[common.Address]*prestateAccount
+	db       vm.StateDB
+
+	create bool
+	from   common.Address
+	to     common.Address
+	value  *big.Int
+}
+
+// newPrestateTracer creates a native prestate tracer.
+func newPrestateTracer() TxTracer {
+	return &prestateTracer{prestate: make(map[common.Address]*prestateAccount)}
+}
+
+// lookupAccount injects the specified account into the prestate.
+func (t *prestateTracer) lookupAccount(addr common.Address) {
+	if _, ok := t.prestate[addr]; ok {
+		return
+	}
+	t.prestate[addr] = &prestateAccount{
+		Balance: new(big.Int).Set(t.db.GetBalance(addr)),
+		Nonce:   int64(t.db.GetNonce(addr)),
+		Code:    hexutil.Encode(t.db.GetCode(addr)),
+		Storage: make(map[string]string),
+	}
+}
+
+// lookupStorage injects the specified storage entry of the given account into
+// the prestate.
+func (t *prestateTracer) lookupStorage(addr common.Address, key common.Hash) {
+	idx := hexutil.Encode(key[:])
+	if _, ok := t.prestate[addr].Storage[idx]; ok {
+		return
+	}
+	value := t.db.GetState(addr, key)
+	t.prestate[addr].Storage[idx] = hexutil.Encode(value[:])
+}
+
+// CaptureStart implements the Tracer interface to initialize the tracing operation.
+func (t *prestateTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.create, t.from, t.to, t.value = create, from, to, value
+	return nil
+}
+
+// CaptureState implements the Tracer interface to trace a single step of VM execution.
+func (t *prestateTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	if t.stopped() {
+		return nil
+	}
+	// Add the current account if we just started tracing. The balance will be
+	// wrong here, since it includes the value sent along, fixed up in the result.
+	if t.db == nil {
+		t.db = env.StateDB
+		t.lookupAccount(contract.Address())
+	}
+	// Whenever new state is accessed, add it to the prestate
+	switch op {
+	case vm.EXTCODECOPY, vm.EXTCODESIZE, vm.BALANCE:
+		t.lookupAccount(peekAddress(stack, 0))
+
+	case vm.CREATE:
+		from := contract.Address()
+		t.lookupAccount(crypto.CreateAddress(from, t.db.GetNonce(from)))
+
+	case vm.CREATE2:
+		// stack: salt, size, offset, endowment
+		from := contract.Address()
+		offset := peekInt(stack, 1)
+		code := memorySlice(memory, offset, offset+peekInt(stack, 2))
+		t.lookupAccount(crypto.CreateAddress2(from, common.BigToHash(peek(stack, 3)), crypto.Keccak256(code)))
+
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		t.lookupAccount(peekAddress(stack, 1))
+
+	case vm.SSTORE, vm.SLOAD:
+		t.lookupStorage(contract.Address(), common.BigToHash(peek(stack, 0)))
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface to trace an execution fault
+// while running an opcode.
+func (t *prestateTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *prestateTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+
+// GetResult returns the prestate accessed by the transaction.
+func (t *prestateTracer) GetResult() (json.RawMessage, error) {
+	// Transactions not executing any code have nothing to report
+	if t.db == nil {
+		return t.result(struct{}{})
+	}
+	// At this point, we need to deduct the 'value' from the outer transaction,
+	// and move it back to the origin
+	t.lookupAccount(t.from)
+
+	from, to := t.prestate[t.from], t.prestate[t.to]
+	to.Balance = new(big.Int).Sub(to.Balance, t.value)
+	from.Balance = new(big.Int).Add(from.Balance, t.value)
+
+	// Decrement the caller's nonce, and remove empty create targets. We can
+	// blindly delete the contract prestate, as any existing state would have
+	// caused the transaction to be rejected as invalid in the first place.
+	from.Nonce--
+	if t.create {
+		delete(t.prestate, t.to)
+	}
+	result := make(map[string]*prestateAccount, len(t.prestate))
+	for addr, acc := range t.prestate {
+		result[encodeAddress(addr)] = acc
+	}
+	return t.result(result)
+}
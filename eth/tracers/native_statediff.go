@@ -0,0 +1,161 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+)
+
+// errStateNotCaptured is returned by the state diff tracer if it was not given
+// the state after the transaction was applied.
+var errStateNotCaptured = errors.New("transaction state not captured")
+
+// StateTracer is implemented by tracers which need to inspect the state once a
+// transaction was fully applied, including the gas payments made outside of the
+// EVM. The state must have been finalised before the transaction was applied.
+type StateTracer interface {
+	CaptureTxEnd(statedb *state.StateDB)
+}
+
+// diffValue is a change of a single value in the Parity state diff format: "="
+// if unchanged, or an object keyed by "+" for born values, "-" for died ones,
+// and "*" for modified ones.
+type diffValue struct {
+	born, died interface{}
+	from, to   interface{}
+	changed    bool
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v *diffValue) MarshalJSON() ([]byte, error) {
+	switch {
+	case v.born != nil:
+		return json.Marshal(map[string]interface{}{"+": v.born})
+	case v.died != nil:
+		return json.Marshal(map[string]interface{}{"-": v.died})
+	case v.changed:
+		return json.Marshal(map[string]interface{}{"*": map[string]interface{}{"from": v.from, "to": v.to}})
+	default:
+		return json.Marshal("=")
+	}
+}
+
+// accountDiff is the change of an account in the Parity state diff format.
+type accountDiff struct {
+	Balance *diffValue            `json:"balance"`
+	Code    *diffValue            `json:"code"`
+	Nonce   *diffValue            `json:"nonce"`
+	Storage map[string]*diffValue `json:"storage"`
+}
+
+// stateDiffTracer reports the accounts changed by a transaction, with their
+// values before and after, in the Parity state diff format.
+type stateDiffTracer struct {
+	opTracer
+	diff map[common.Address]*state.AccountDiff
+}
+
+// newStateDiffTracer creates a native state diff tracer.
+func newStateDiffTracer() TxTracer {
+	return new(stateDiffTracer)
+}
+
+// CaptureTxEnd implements StateTracer, collecting the changes of the transaction.
+func (t *stateDiffTracer) CaptureTxEnd(statedb *state.StateDB) {
+	if !t.stopped() {
+		t.diff = statedb.Diff()
+	}
+}
+
+// GetResult returns the changes made by the transaction.
+func (t *stateDiffTracer) GetResult() (json.RawMessage, error) {
+	if t.diff == nil && !t.stopped() {
+		return nil, errStateNotCaptured
+	}
+	result := make(map[string]*accountDiff)
+	for addr, diff := range t.diff {
+		var (
+			account = &accountDiff{Storage: make(map[string]*diffValue)}
+			changed bool
+		)
+		switch {
+		case diff.Pre == nil:
+			account.Balance = &diffValue{born: (*hexutil.Big)(diff.Post.Balance)}
+			account.Code = &diffValue{born: hexutil.Bytes(diff.Post.Code)}
+			account.Nonce = &diffValue{born: hexutil.Uint64(diff.Post.Nonce)}
+			for key, value := range diff.Post.Storage {
+				if value != (common.Hash{}) {
+					account.Storage[encodeHash(key)] = &diffValue{born: value}
+				}
+			}
+			changed = true
+
+		case diff.Post == nil:
+			account.Balance = &diffValue{died: (*hexutil.Big)(diff.Pre.Balance)}
+			account.Code = &diffValue{died: hexutil.Bytes(diff.Pre.Code)}
+			account.Nonce = &diffValue{died: hexutil.Uint64(diff.Pre.Nonce)}
+			for key, value := range diff.Pre.Storage {
+				if value != (common.Hash{}) {
+					account.Storage[encodeHash(key)] = &diffValue{died: value}
+				}
+			}
+			changed = true
+
+		default:
+			account.Balance = &diffValue{
+				from:    (*hexutil.Big)(diff.Pre.Balance),
+				to:      (*hexutil.Big)(diff.Post.Balance),
+				changed: diff.Pre.Balance.Cmp(diff.Post.Balance) != 0,
+			}
+			account.Code = &diffValue{
+				from:    hexutil.Bytes(diff.Pre.Code),
+				to:      hexutil.Bytes(diff.Post.Code),
+				changed: !bytes.Equal(diff.Pre.Code, diff.Post.Code),
+			}
+			account.Nonce = &diffValue{
+				from:    hexutil.Uint64(diff.Pre.Nonce),
+				to:      hexutil.Uint64(diff.Post.Nonce),
+				changed: diff.Pre.Nonce != diff.Post.Nonce,
+			}
+			changed = account.Balance.changed || account.Code.changed || account.Nonce.changed
+
+			for key, pre := range diff.Pre.Storage {
+				post := diff.Post.Storage[key]
+				if pre == post {
+					continue
+				}
+				account.Storage[encodeHash(key)] = &diffValue{from: pre, to: post, changed: true}
+				changed = true
+			}
+		}
+		if changed {
+			result[encodeAddress(addr)] = account
+		}
+	}
+	return t.result(result)
+}
+
+// encodeHash returns the lowercase hex encoding of a hash.
+func encodeHash(hash common.Hash) string {
+	return hexutil.Encode(hash[:])
+}
@@ -0,0 +1,266 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+// runTracerTest executes the transaction of a tracer test case with the given
+// tracer attached and returns the tracing result.
+func runTracerTest(t *testing.T, test *callTracerTest, tracer TxTracer) json.RawMessage {
+	t.Helper()
+
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
+		t.Fatalf("failed to parse testcase input: %v", err)
+	}
+	signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
+	origin, _ := signer.Sender(tx)
+
+	context := vm.Context{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Origin:      origin,
+		Coinbase:    test.Context.Miner,
+		BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
+		Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
+		Difficulty:  (*big.Int)(test.Context.Difficulty),
+		GasLimit:    uint64(test.Context.GasLimit),
+		GasPrice:    tx.GasPrice(),
+	}
+	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), test.Genesis.Alloc, false)
+	evm := vm.NewEVM(context, statedb, test.Genesis.Config, vm.Config{Debug: true, Tracer: tracer})
+
+	msg, err := tx.AsMessage(signer, nil)
+	if err != nil {
+		t.Fatalf("failed to prepare transaction for tracing: %v", err)
+	}
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	if _, err = st.TransitionDb(); err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	if tracer, ok := tracer.(StateTracer); ok {
+		tracer.CaptureTxEnd(statedb)
+	}
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	return res
+}
+
+// Tests that the native tracers produce the same results as their JavaScript
+// counterparts on all the transactions in the tracer test harness.
+func TestNativeTracers(t *testing.T) {
+	files, err := ioutil.ReadDir("testdata")
+	if err != nil {
+		t.Fatalf("failed to retrieve tracer test suite: %v", err)
+	}
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "call_tracer_") {
+			continue
+		}
+		blob, err := ioutil.ReadFile(filepath.Join("testdata", file.Name()))
+		if err != nil {
+			t.Fatalf("failed to read testcase: %v", err)
+		}
+		test := new(callTracerTest)
+		if err := json.Unmarshal(blob, test); err != nil {
+			t.Fatalf("failed to parse testcase: %v", err)
+		}
+		for name, ctor := range native {
+			if _, ok := all[name]; !ok {
+				continue // Native only tracer, nothing to compare against
+			}
+			js, err := New(name)
+			if err != nil {
+				t.Fatalf("failed to create JavaScript %s: %v", name, err)
+			}
+			var want, have interface{}
+			if err := json.Unmarshal(runTracerTest(t, test, js), &want); err != nil {
+				t.Fatalf("%s/%s: failed to unmarshal JavaScript result: %v", file.Name(), name, err)
+			}
+			if err := json.Unmarshal(runTracerTest(t, test, ctor()), &have); err != nil {
+				t.Fatalf("%s/%s: failed to unmarshal native result: %v", file.Name(), name, err)
+			}
+			// Execution times naturally differ, drop them from the call traces
+			if name == "callTracer" {
+				delete(want.(map[string]interface{}), "time")
+				delete(have.(map[string]interface{}), "time")
+			}
+			if !reflect.DeepEqual(have, want) {
+				haveJSON, _ := json.Marshal(have)
+				wantJSON, _ := json.Marshal(want)
+				t.Errorf("%s/%s: result mismatch:\nhave %s\nwant %s", file.Name(), name, haveJSON, wantJSON)
+			}
+		}
+	}
+}
+
+// Tests that names of native tracers resolve to them, and anything else to the
+// JavaScript engine.
+func TestNewTracer(t *testing.T) {
+	tracer, err := NewTracer("callTracer")
+	if err != nil {
+		t.Fatalf("failed to create call tracer: %v", err)
+	}
+	if _, ok := tracer.(*callTracer); !ok {
+		t.Errorf("call tracer type mismatch: have %T, want %T", tracer, new(callTracer))
+	}
+	tracer, err = NewTracer("evmdisTracer")
+	if err != nil {
+		t.Fatalf("failed to create evmdis tracer: %v", err)
+	}
+	if _, ok := tracer.(*Tracer); !ok {
+		t.Errorf("evmdis tracer type mismatch: have %T, want %T", tracer, new(Tracer))
+	}
+	if _, err := NewTracer("{step: function() {}, fault: function() {}, result: function() { return 1 }}"); err != nil {
+		t.Fatalf("failed to create custom tracer: %v", err)
+	}
+}
+
+// Tests that interrupted native tracers report the interruption.
+func TestNativeTracerStop(t *testing.T) {
+	for name, ctor := range native {
+		tracer := ctor()
+		tracer.Stop(errors.New("stopped"))
+		if _, err := tracer.GetResult(); err == nil || err.Error() != "stopped" {
+			t.Errorf("%s: error mismatch: have %v, want %v", name, err, "stopped")
+		}
+	}
+}
+
+// Tests that the state diff tracer reports the original values of the accounts
+// touched by a transaction, along with the gas payments made outside of the EVM.
+func TestStateDiffTracer(t *testing.T) {
+	blob, err := ioutil.ReadFile(filepath.Join("testdata", "call_tracer_deep_calls.json"))
+	if err != nil {
+		t.Fatalf("failed to read testcase: %v", err)
+	}
+	test := new(callTracerTest)
+	if err := json.Unmarshal(blob, test); err != nil {
+		t.Fatalf("failed to parse testcase: %v", err)
+	}
+	var diff map[common.Address]map[string]interface{}
+	if err := json.Unmarshal(runTracerTest(t, test, newStateDiffTracer()), &diff); err != nil {
+		t.Fatalf("failed to unmarshal state diff: %v", err)
+	}
+	for addr, account := range diff {
+		alloc, ok := test.Genesis.Alloc[addr]
+		if !ok {
+			if _, ok := account["balance"].(map[string]interface{})["+"]; !ok {
+				t.Errorf("account %x: new account not born: %v", addr, account["balance"])
+			}
+			continue
+		}
+		change, ok := account["balance"].(map[string]interface{})
+		if !ok {
+			continue // unchanged balance
+		}
+		modified, ok := change["*"].(map[string]interface{})
+		if !ok {
+			t.Errorf("account %x: balance not modified: %v", addr, change)
+			continue
+		}
+		if have, _ := hexutil.DecodeBig(modified["from"].(string)); have.Cmp(alloc.Balance) != 0 {
+			t.Errorf("account %x: original balance mismatch: have %v, want %v", addr, have, alloc.Balance)
+		}
+	}
+	// The sender pays for gas and the miner collects it, both outside the EVM
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
+		t.Fatalf("failed to parse testcase input: %v", err)
+	}
+	signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
+	origin, _ := signer.Sender(tx)
+
+	nonce, ok := diff[origin]["nonce"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("sender nonce not modified: %v", diff[origin]["nonce"])
+	}
+	if want := hexutil.EncodeUint64(test.Genesis.Alloc[origin].Nonce + 1); nonce["*"].(map[string]interface{})["to"] != want {
+		t.Errorf("sender nonce mismatch: have %v, want %v", nonce["*"], want)
+	}
+	for _, addr := range []common.Address{origin, test.Context.Miner} {
+		if _, ok := diff[addr]["balance"].(map[string]interface{}); !ok {
+			t.Errorf("account %x: balance change missing", addr)
+		}
+	}
+}
+
+// Tests that the flat call tracer reports the same calls as the call tracer, in
+// depth first order and positioned by their trace addresses.
+func TestFlatCallTracer(t *testing.T) {
+	blob, err := ioutil.ReadFile(filepath.Join("testdata", "call_tracer_deep_calls.json"))
+	if err != nil {
+		t.Fatalf("failed to read testcase: %v", err)
+	}
+	test := new(callTracerTest)
+	if err := json.Unmarshal(blob, test); err != nil {
+		t.Fatalf("failed to parse testcase: %v", err)
+	}
+	var frames []*FlatCallFrame
+	if err := json.Unmarshal(runTracerTest(t, test, newFlatCallTracer()), &frames); err != nil {
+		t.Fatalf("failed to unmarshal flat call trace: %v", err)
+	}
+	// Walk the expected call tree along with the flattened calls
+	var (
+		index int
+		walk  func(call *callTrace, traceAddress []int)
+	)
+	walk = func(call *callTrace, traceAddress []int) {
+		if index >= len(frames) {
+			t.Fatalf("flat trace too short: %d frames", len(frames))
+		}
+		frame := frames[index]
+		index++
+
+		if !reflect.DeepEqual(frame.TraceAddress, traceAddress) {
+			t.Errorf("frame %d: trace address mismatch: have %v, want %v", index-1, frame.TraceAddress, traceAddress)
+		}
+		if frame.Subtraces != len(call.Calls) {
+			t.Errorf("frame %d: subtrace count mismatch: have %d, want %d", index-1, frame.Subtraces, len(call.Calls))
+		}
+		if from, _ := frame.Addresses(); from == nil || *from != call.From {
+			t.Errorf("frame %d: sender mismatch: have %v, want %x", index-1, from, call.From)
+		}
+		for i := range call.Calls {
+			walk(&call.Calls[i], append(append([]int{}, traceAddress...), i))
+		}
+	}
+	walk(test.Result, []int{})
+	if index != len(frames) {
+		t.Errorf("flat trace length mismatch: have %d, want %d", len(frames), index)
+	}
+}
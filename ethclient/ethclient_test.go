@@ -17,6 +17,7 @@
 package ethclient
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -27,14 +28,18 @@ import (
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
 )
 
 // Verify that Client implements the ethereum interfaces.
@@ -368,3 +373,312 @@ func TestBlockNumber(t *testing.T) {
 		t.Fatalf("BlockNumber returned wrong number: %d", blockNumber)
 	}
 }
+
+func TestFeeHistory(t *testing.T) {
+	backend, chain := newTestBackend(t)
+	client, _ := backend.Attach()
+	defer backend.Close()
+	defer client.Close()
+	ec := NewClient(client)
+
+	history, err := ec.FeeHistory(context.Background(), 2, nil, []float64{0, 100})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if history.OldestBlock.Uint64() != 0 {
+		t.Fatalf("FeeHistory returned wrong oldest block: %d", history.OldestBlock)
+	}
+	if len(history.Reward) != 2 || len(history.Reward[0]) != 2 || len(history.GasUsedRatio) != 2 || len(history.BaseFee) != 3 {
+		t.Fatalf("FeeHistory returned wrong sizes: %d rewards, %d ratios, %d base fees", len(history.Reward), len(history.GasUsedRatio), len(history.BaseFee))
+	}
+	for i, block := range chain {
+		want := block.BaseFee()
+		if want == nil {
+			want = new(big.Int)
+		}
+		if history.BaseFee[i].Cmp(want) != 0 {
+			t.Errorf("block %d: base fee mismatch: have %v, want %v", i, history.BaseFee[i], want)
+		}
+	}
+}
+
+func TestFeeHistoryLongRange(t *testing.T) {
+	backend, chain := newTestBackend(t)
+	client, _ := backend.Attach()
+	defer backend.Close()
+	defer client.Close()
+
+	// Block counts overflowing an int must be capped instead of yielding nothing
+	var history struct {
+		OldestBlock  *hexutil.Big `json:"oldestBlock"`
+		GasUsedRatio []float64    `json:"gasUsedRatio"`
+	}
+	if err := client.CallContext(context.Background(), &history, "eth_feeHistory", "0xffffffffffffffff", "latest", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if history.OldestBlock.ToInt().Uint64() != 0 || len(history.GasUsedRatio) != len(chain) {
+		t.Fatalf("FeeHistory returned wrong range: oldest block %v, %d blocks, want 0 and %d", history.OldestBlock, len(history.GasUsedRatio), len(chain))
+	}
+}
+
+// bundleTestCode logs the caller and forwards the call value to the coinbase,
+// or reverts with Error("nope") if called with any data.
+var bundleTestCode = common.FromHex("0x36601857" + // JUMPI(revert, CALLDATASIZE)
+	"3360006000a1" + // LOG1(0, 0, CALLER)
+	"600060006000600034415af15000" + // CALL(GAS, COINBASE, CALLVALUE, 0, 0, 0, 0), STOP
+	"5b6308c379a060e01b600052" + "6020600452" + "6004602452" + "636e6f706560e01b604452" + // revert: Error("nope")
+	"60646000fd")
+
+// blockInfoCode returns the block number and the coinbase as two words.
+var blockInfoCode = common.FromHex("0x436000524160205260406000f3")
+
+func TestCallBundle(t *testing.T) {
+	backend, _ := newTestBackend(t)
+	client, _ := backend.Attach()
+	defer backend.Close()
+	defer client.Close()
+
+	var (
+		contract = common.HexToAddress("0xc0de")
+		info     = common.HexToAddress("0x1f0")
+		caller   = common.HexToAddress("0xca11e4")
+		coinbase = common.HexToAddress("0xc014ba5e")
+		code     = hexutil.Bytes(bundleTestCode)
+		infoCode = hexutil.Bytes(blockInfoCode)
+		funds    = (*hexutil.Big)(big.NewInt(1000000))
+	)
+	signer := types.LatestSignerForChainID(params.AllEthashProtocolChanges.ChainID)
+	tx, err := types.SignTx(types.NewTransaction(0, contract, big.NewInt(1000), 100000, big.NewInt(1), nil), signer, testKey)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	blob, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to encode transaction: %v", err)
+	}
+	bundle := []interface{}{
+		hexutil.Bytes(blob),
+		map[string]interface{}{"from": caller, "to": contract, "value": (*hexutil.Big)(big.NewInt(500))},
+		map[string]interface{}{"from": caller, "to": contract, "data": "0x01"},
+		map[string]interface{}{"from": caller, "to": info},
+	}
+	overrides := map[common.Address]interface{}{
+		contract: map[string]interface{}{"code": code},
+		info:     map[string]interface{}{"code": infoCode},
+		caller:   map[string]interface{}{"balance": funds},
+	}
+	blockOverrides := map[string]interface{}{
+		"number":   (*hexutil.Big)(big.NewInt(1234)),
+		"coinbase": coinbase,
+	}
+	var results []*ethapi.BundleResult
+	if err := client.CallContext(context.Background(), &results, "eth_callBundle", bundle, "latest", overrides, blockOverrides); err != nil {
+		t.Fatalf("failed to call bundle: %v", err)
+	}
+	if len(results) != len(bundle) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(results), len(bundle))
+	}
+	// The signed transaction is filed under its hash and pays for its gas
+	if res := results[0]; res.Error != "" {
+		t.Errorf("signed tx failed: %v", res.Error)
+	} else {
+		if res.TxHash == nil || *res.TxHash != tx.Hash() {
+			t.Errorf("signed tx hash mismatch: have %v, want %x", res.TxHash, tx.Hash())
+		}
+		if len(res.Logs) != 1 || res.Logs[0].Topics[0] != common.BytesToHash(testAddr.Bytes()) || res.Logs[0].TxHash != tx.Hash() {
+			t.Errorf("signed tx logs mismatch: %v", res.Logs)
+		}
+		if want := big.NewInt(int64(res.GasUsed) + 1000); res.CoinbasePayment.ToInt().Cmp(want) != 0 {
+			t.Errorf("signed tx coinbase payment mismatch: have %v, want %v", res.CoinbasePayment, want)
+		}
+	}
+	// Unsigned calls have no hash and pay the coinbase only explicitly
+	if res := results[1]; res.Error != "" {
+		t.Errorf("call failed: %v", res.Error)
+	} else {
+		if res.TxHash != nil {
+			t.Errorf("call has hash %x", *res.TxHash)
+		}
+		if len(res.Logs) != 1 || res.Logs[0].Topics[0] != common.BytesToHash(caller.Bytes()) || res.Logs[0].TxHash != (common.Hash{}) {
+			t.Errorf("call logs mismatch: %v", res.Logs)
+		}
+		if res.CoinbasePayment.ToInt().Cmp(big.NewInt(500)) != 0 {
+			t.Errorf("call coinbase payment mismatch: have %v, want 500", res.CoinbasePayment)
+		}
+	}
+	// Reverted calls report the reason and drop their logs
+	if res := results[2]; res.Error != "execution reverted" || res.RevertReason != "nope" {
+		t.Errorf("revert mismatch: have error %q reason %q", res.Error, res.RevertReason)
+	} else if len(res.Logs) != 0 || res.CoinbasePayment.ToInt().Sign() != 0 {
+		t.Errorf("reverted call has side effects: logs %v, payment %v", res.Logs, res.CoinbasePayment)
+	}
+	// The block overrides are visible to the EVM
+	want := append(common.LeftPadBytes(big.NewInt(1234).Bytes(), 32), common.LeftPadBytes(coinbase.Bytes(), 32)...)
+	if res := results[3]; !bytes.Equal(res.ReturnData, want) {
+		t.Errorf("block context mismatch: have %x, want %x", res.ReturnData, want)
+	}
+	// A transaction that can't be included rejects the entire bundle
+	if err := client.CallContext(context.Background(), &results, "eth_callBundle", []interface{}{hexutil.Bytes(blob), hexutil.Bytes(blob)}, "latest"); err == nil {
+		t.Errorf("bundle with a nonce reuse accepted")
+	}
+}
+
+// parentHashCode returns the hash of the parent block.
+var parentHashCode = common.FromHex("0x600143034060005260206000f3")
+
+// simulatedBlock is the part of a block simulated by eth_simulate the tests
+// check.
+type simulatedBlock struct {
+	Number       hexutil.Uint64         `json:"number"`
+	Hash         common.Hash            `json:"hash"`
+	ParentHash   common.Hash            `json:"parentHash"`
+	Time         hexutil.Uint64         `json:"timestamp"`
+	TxRoot       common.Hash            `json:"transactionsRoot"`
+	Transactions []common.Hash          `json:"transactions"`
+	Calls        []*ethapi.BundleResult `json:"calls"`
+	Receipts     []struct {
+		TransactionHash   common.Hash    `json:"transactionHash"`
+		TransactionIndex  hexutil.Uint64 `json:"transactionIndex"`
+		BlockHash         common.Hash    `json:"blockHash"`
+		BlockNumber       hexutil.Uint64 `json:"blockNumber"`
+		From              common.Address `json:"from"`
+		Status            hexutil.Uint64 `json:"status"`
+		GasUsed           hexutil.Uint64 `json:"gasUsed"`
+		CumulativeGasUsed hexutil.Uint64 `json:"cumulativeGasUsed"`
+		Logs              []*types.Log   `json:"logs"`
+	} `json:"receipts"`
+}
+
+// hashList is a list of transaction hashes a trie root can be derived from.
+type hashList []common.Hash
+
+func (l hashList) Len() int { return len(l) }
+
+func (l hashList) GetRlp(i int) []byte {
+	enc, _ := rlp.EncodeToBytes(l[i])
+	return enc
+}
+
+func TestSimulate(t *testing.T) {
+	backend, chain := newTestBackend(t)
+	client, _ := backend.Attach()
+	defer backend.Close()
+	defer client.Close()
+
+	var (
+		contract = common.HexToAddress("0xc0de")
+		hasher   = common.HexToAddress("0x4a54")
+		alice    = common.HexToAddress("0xa11ce")
+		bob      = common.HexToAddress("0xb0b")
+		gas      = hexutil.Uint64(100000)
+		head     = chain[len(chain)-1]
+	)
+	blocks := []interface{}{
+		// Identical calls of two senders, which only differ in their sender
+		map[string]interface{}{
+			"stateOverrides": map[common.Address]interface{}{
+				contract: map[string]interface{}{"code": hexutil.Bytes(bundleTestCode)},
+				hasher:   map[string]interface{}{"code": hexutil.Bytes(parentHashCode)},
+			},
+			"calls": []interface{}{
+				map[string]interface{}{"from": alice, "to": contract, "gas": gas},
+				map[string]interface{}{"from": bob, "to": contract, "gas": gas},
+			},
+		},
+		// A block skipping two numbers, which need to be filled within its timestamp
+		map[string]interface{}{
+			"blockOverrides": map[string]interface{}{
+				"number":    (*hexutil.Big)(new(big.Int).Add(head.Number(), big.NewInt(4))),
+				"timestamp": hexutil.Uint64(head.Time() + 12 + 13),
+			},
+			"calls": []interface{}{
+				map[string]interface{}{"from": alice, "to": hasher},
+				map[string]interface{}{"from": alice, "to": contract},
+			},
+		},
+	}
+	var results []*simulatedBlock
+	if err := client.CallContext(context.Background(), &results, "eth_simulate", blocks, "latest"); err != nil {
+		t.Fatalf("failed to simulate: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("block count mismatch: have %d, want 4", len(results))
+	}
+	// The blocks must form a contiguous chain on top of the head, gaps included
+	parent := head.Hash()
+	for i, block := range results {
+		if want := head.NumberU64() + uint64(i) + 1; uint64(block.Number) != want {
+			t.Errorf("block %d: number mismatch: have %d, want %d", i, block.Number, want)
+		}
+		if block.ParentHash != parent {
+			t.Errorf("block %d: parent mismatch: have %x, want %x", i, block.ParentHash, parent)
+		}
+		parent = block.Hash
+	}
+	for i, block := range results[1:3] {
+		if len(block.Transactions) != 0 || len(block.Receipts) != 0 || len(block.Calls) != 0 {
+			t.Errorf("filler block %d not empty", block.Number)
+		}
+		if want := results[0].Time + hexutil.Uint64(4*(i+1)); block.Time != want {
+			t.Errorf("filler block %d: timestamp mismatch: have %d, want %d", block.Number, block.Time, want)
+		}
+	}
+	// The transaction roots must commit to the returned transaction hashes
+	for _, block := range results {
+		if want := types.DeriveSha(hashList(block.Transactions), trie.NewStackTrie(nil)); block.TxRoot != want {
+			t.Errorf("block %d: transaction root mismatch: have %x, want %x", block.Number, block.TxRoot, want)
+		}
+	}
+	// Check the receipts and logs of the first and the last block
+	for _, block := range []*simulatedBlock{results[0], results[3]} {
+		if len(block.Receipts) != 2 || len(block.Transactions) != 2 {
+			t.Fatalf("block %d: receipt count mismatch: have %d receipts, %d txs", block.Number, len(block.Receipts), len(block.Transactions))
+		}
+		var cumulative uint64
+		for j, receipt := range block.Receipts {
+			cumulative += uint64(receipt.GasUsed)
+			if receipt.TransactionHash != block.Transactions[j] {
+				t.Errorf("block %d receipt %d: hash mismatch: have %x, block has %x", block.Number, j, receipt.TransactionHash, block.Transactions[j])
+			}
+			if receipt.BlockHash != block.Hash || receipt.BlockNumber != block.Number || receipt.TransactionIndex != hexutil.Uint64(j) {
+				t.Errorf("block %d receipt %d: position mismatch: block %x #%d, index %d", block.Number, j, receipt.BlockHash, receipt.BlockNumber, receipt.TransactionIndex)
+			}
+			if receipt.Status != 1 || uint64(receipt.CumulativeGasUsed) != cumulative {
+				t.Errorf("block %d receipt %d: status %d, cumulative gas %d, want 1, %d", block.Number, j, receipt.Status, receipt.CumulativeGasUsed, cumulative)
+			}
+		}
+	}
+	first := results[0]
+	if first.Receipts[0].TransactionHash == first.Receipts[1].TransactionHash {
+		t.Errorf("calls of different senders share hash %x", first.Receipts[0].TransactionHash)
+	}
+	for j, sender := range []common.Address{alice, bob} {
+		receipt := first.Receipts[j]
+		if receipt.From != sender {
+			t.Errorf("receipt %d: sender mismatch: have %x, want %x", j, receipt.From, sender)
+		}
+		if len(receipt.Logs) != 1 {
+			t.Fatalf("receipt %d: log count mismatch: have %d, want 1", j, len(receipt.Logs))
+		}
+		log := receipt.Logs[0]
+		if log.Topics[0] != common.BytesToHash(sender.Bytes()) || log.TxHash != receipt.TransactionHash || log.TxIndex != uint(j) || log.Index != uint(j) {
+			t.Errorf("receipt %d: log mismatch: %+v", j, log)
+		}
+		if log.BlockHash != first.Hash || log.BlockNumber != uint64(first.Number) {
+			t.Errorf("receipt %d: log block mismatch: %x #%d", j, log.BlockHash, log.BlockNumber)
+		}
+	}
+	// BLOCKHASH resolves the preceding phantom block, log indices restart
+	last := results[3]
+	if want := results[2].Hash; !bytes.Equal(last.Calls[0].ReturnData, want.Bytes()) {
+		t.Errorf("parent hash mismatch: have %x, want %x", last.Calls[0].ReturnData, want)
+	}
+	if logs := last.Receipts[1].Logs; len(logs) != 1 || logs[0].Index != 0 || logs[0].BlockNumber != uint64(last.Number) {
+		t.Errorf("last block logs mismatch: %v", logs)
+	}
+	// Timestamps leaving no room for the filler blocks must be rejected
+	blocks[1].(map[string]interface{})["blockOverrides"].(map[string]interface{})["timestamp"] = hexutil.Uint64(head.Time() + 12 + 2)
+	if err := client.CallContext(context.Background(), &results, "eth_simulate", blocks, "latest"); err == nil {
+		t.Errorf("simulation without room for filler blocks accepted")
+	}
+}
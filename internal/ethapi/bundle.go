@@ -0,0 +1,204 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// BundleTx is a transaction of a simulated bundle, either a signed transaction
+// in its binary encoding, or the arguments of an unsigned message call.
+type BundleTx struct {
+	Signed *types.Transaction
+	Call   *CallArgs
+}
+
+// UnmarshalJSON decodes a bundle transaction from either a hex string holding a
+// signed transaction, or an object holding call arguments.
+func (tx *BundleTx) UnmarshalJSON(input []byte) error {
+	if len(input) > 0 && input[0] == '"' {
+		var blob hexutil.Bytes
+		if err := json.Unmarshal(input, &blob); err != nil {
+			return err
+		}
+		tx.Signed = new(types.Transaction)
+		return tx.Signed.UnmarshalBinary(blob)
+	}
+	tx.Call = new(CallArgs)
+	return json.Unmarshal(input, tx.Call)
+}
+
+// toMessage converts the bundle transaction into a message to execute.
+func (tx *BundleTx) toMessage(signer types.Signer, baseFee *big.Int, globalGasCap uint64) (types.Message, error) {
+	switch {
+	case tx.Signed != nil:
+		return tx.Signed.AsMessage(signer, baseFee)
+	case tx.Call != nil:
+		return tx.Call.ToMessage(globalGasCap, baseFee)
+	default:
+		return types.Message{}, errors.New("missing transaction")
+	}
+}
+
+// BundleResult is the outcome of a single transaction of a simulated bundle.
+type BundleResult struct {
+	TxHash          *common.Hash   `json:"txHash,omitempty"`
+	GasUsed         hexutil.Uint64 `json:"gasUsed"`
+	ReturnData      hexutil.Bytes  `json:"returnData"`
+	Error           string         `json:"error,omitempty"`
+	RevertReason    string         `json:"revertReason,omitempty"`
+	Logs            []*types.Log   `json:"logs"`
+	CoinbasePayment *hexutil.Big   `json:"coinbasePayment"`
+}
+
+// newBundleResult assembles the outcome of an executed bundle transaction.
+func newBundleResult(result *core.ExecutionResult, logs []*types.Log, coinbasePayment *big.Int) *BundleResult {
+	res := &BundleResult{
+		GasUsed:         hexutil.Uint64(result.UsedGas),
+		ReturnData:      result.ReturnData,
+		Logs:            logs,
+		CoinbasePayment: (*hexutil.Big)(coinbasePayment),
+	}
+	if res.Logs == nil {
+		res.Logs = []*types.Log{}
+	}
+	if result.Err != nil {
+		res.Error = result.Err.Error()
+		if reason, err := abi.UnpackRevert(result.Revert()); err == nil {
+			res.RevertReason = reason
+		}
+	}
+	return res
+}
+
+// DoCallBundle executes an ordered list of transactions sequentially on top of
+// the state of the given block, each one seeing the changes of the ones before.
+// If any transaction cannot be included at all (e.g. nonce or fee issues), the
+// entire bundle is rejected.
+func DoCallBundle(ctx context.Context, b Backend, txs []BundleTx, blockNrOrHash rpc.BlockNumberOrHash, overrides *StateOverride, blockOverrides *BlockOverrides, timeout time.Duration, globalGasCap uint64) ([]*BundleResult, error) {
+	defer func(start time.Time) { log.Debug("Executing EVM call bundle finished", "runtime", time.Since(start)) }(time.Now())
+
+	if len(txs) == 0 {
+		return nil, errors.New("empty bundle")
+	}
+	state, header, err := b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	if err := overrides.Apply(state); err != nil {
+		return nil, err
+	}
+	// Setup context so it may be cancelled when the bundle has completed
+	// or the allowed execution time elapsed.
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	var (
+		signer  = types.MakeSigner(b.ChainConfig(), header.Number)
+		gp      = new(core.GasPool).AddGas(math.MaxUint64)
+		results = make([]*BundleResult, 0, len(txs))
+	)
+	for i, tx := range txs {
+		// Assemble the message and the hash its logs are filed under. Calls don't
+		// have a hash, so they use a placeholder which is cleared from the logs.
+		msg, err := tx.toMessage(signer, header.BaseFee, globalGasCap)
+		if err != nil {
+			return nil, fmt.Errorf("tx %d: %v", i, err)
+		}
+		txHash := common.BigToHash(big.NewInt(int64(i + 1)))
+		if tx.Signed != nil {
+			txHash = tx.Signed.Hash()
+		}
+		// Calls may not specify fees, signed transactions pay as they would on chain
+		vmConfig := vm.Config{NoBaseFee: tx.Call != nil}
+		evm, vmError, err := b.GetEVM(ctx, msg, state, header, &vmConfig)
+		if err != nil {
+			return nil, err
+		}
+		if blockOverrides != nil {
+			// Recreate the EVM to run with the rules of the overridden block
+			blockCtx := evm.Context
+			blockOverrides.Apply(&blockCtx)
+			evm = vm.NewEVM(blockCtx, state, b.ChainConfig(), vmConfig)
+		}
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				evm.Cancel()
+			case <-done:
+			}
+		}()
+		state.Prepare(txHash, header.Hash(), i)
+		coinbase := new(big.Int).Set(state.GetBalance(evm.Coinbase))
+
+		result, err := core.ApplyMessage(evm, msg, gp)
+		close(done)
+
+		if err := vmError(); err != nil {
+			return nil, err
+		}
+		if evm.Cancelled() {
+			return nil, fmt.Errorf("execution aborted (timeout = %v)", timeout)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tx %d: %w (supplied gas %d)", i, err, msg.Gas())
+		}
+		state.Finalise(evm.ChainConfig().IsEIP158(evm.BlockNumber))
+
+		res := newBundleResult(result, state.GetLogs(txHash), new(big.Int).Sub(state.GetBalance(evm.Coinbase), coinbase))
+		if tx.Signed != nil {
+			res.TxHash = &txHash
+		} else {
+			for _, entry := range res.Logs {
+				entry.TxHash = common.Hash{}
+			}
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// CallBundle executes an ordered list of transactions, signed or given as call
+// arguments, one after the other on top of the state of the given block. Unlike
+// separate calls, every transaction sees the changes made by the previous ones.
+//
+// Additionally, the caller can override account fields and block context fields
+// for the entire bundle. Nothing is persisted to the state or the blockchain.
+func (s *PublicBlockChainAPI) CallBundle(ctx context.Context, txs []BundleTx, blockNrOrHash rpc.BlockNumberOrHash, overrides *StateOverride, blockOverrides *BlockOverrides) ([]*BundleResult, error) {
+	return DoCallBundle(ctx, s.b, txs, blockNrOrHash, overrides, blockOverrides, 5*time.Second, s.b.RPCGasCap())
+}
@@ -0,0 +1,381 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	// maxSimulateBlocks is the maximum number of blocks that can be simulated
+	// in a single request, also the range BLOCKHASH can reach back.
+	maxSimulateBlocks = 256
+
+	// simulateBlockTime is the default number of seconds between two simulated
+	// blocks if no explicit timestamp is requested.
+	simulateBlockTime = 12
+)
+
+// SimBlock is a phantom block to simulate on top of the previous one, with its
+// transactions and the overrides of its header fields and starting state.
+type SimBlock struct {
+	BlockOverrides *BlockOverrides `json:"blockOverrides"`
+	StateOverrides *StateOverride  `json:"stateOverrides"`
+	Calls          []BundleTx      `json:"calls"`
+}
+
+// simChain is the chain context of simulated blocks, resolving the headers of
+// the phantom blocks before falling back to the local chain.
+type simChain struct {
+	ctx     context.Context
+	b       Backend
+	headers map[common.Hash]*types.Header
+}
+
+// Engine retrieves the chain's consensus engine.
+func (c *simChain) Engine() consensus.Engine {
+	return c.b.Engine()
+}
+
+// GetHeader retrieves a simulated or local header by its hash.
+func (c *simChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header, ok := c.headers[hash]; ok {
+		return header
+	}
+	header, _ := c.b.HeaderByHash(c.ctx, hash)
+	return header
+}
+
+// simTxHashes is the list of hashes the transactions of a simulated block are
+// filed under, from which the transaction root of the block is derived.
+type simTxHashes []common.Hash
+
+// Len returns the number of transactions.
+func (h simTxHashes) Len() int { return len(h) }
+
+// GetRlp returns the RLP encoding of the hash of one transaction.
+func (h simTxHashes) GetRlp(i int) []byte {
+	enc, _ := rlp.EncodeToBytes(h[i])
+	return enc
+}
+
+// makeSimHeader assembles the header of a simulated block on top of the given
+// parent, defaulting any field not overridden to a plausible successor value.
+func makeSimHeader(config *params.ChainConfig, parent *types.Header, overrides *BlockOverrides) (*types.Header, error) {
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		UncleHash:  types.EmptyUncleHash,
+		Coinbase:   parent.Coinbase,
+		Difficulty: new(big.Int).Set(parent.Difficulty),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		GasLimit:   parent.GasLimit,
+		Time:       parent.Time + simulateBlockTime,
+	}
+	if overrides != nil {
+		if overrides.Number != nil {
+			if overrides.Number.ToInt().Cmp(parent.Number) <= 0 {
+				return nil, fmt.Errorf("block number %v not above parent %v", overrides.Number.ToInt(), parent.Number)
+			}
+			header.Number = new(big.Int).Set(overrides.Number.ToInt())
+		}
+		if overrides.Time != nil {
+			if uint64(*overrides.Time) <= parent.Time {
+				return nil, fmt.Errorf("block timestamp %d not above parent %d", uint64(*overrides.Time), parent.Time)
+			}
+			header.Time = uint64(*overrides.Time)
+		}
+		if overrides.Coinbase != nil {
+			header.Coinbase = *overrides.Coinbase
+		}
+		if overrides.Difficulty != nil {
+			header.Difficulty = new(big.Int).Set(overrides.Difficulty.ToInt())
+		}
+		if overrides.GasLimit != nil {
+			header.GasLimit = uint64(*overrides.GasLimit)
+		}
+	}
+	if config.IsLondon(header.Number) {
+		header.BaseFee = misc.CalcBaseFee(config, parent)
+	}
+	return header, nil
+}
+
+// DoSimulate executes a sequence of phantom blocks on top of the state of the
+// given block. Every block starts from the state left by the previous one, and
+// BLOCKHASH resolves the hashes of the earlier phantom blocks. Gaps between the
+// requested block numbers are filled with empty blocks, spaced out within the
+// requested timestamps. No block rewards are applied and nothing is persisted.
+//
+// The transaction root of a simulated block commits to the hashes its transactions
+// are filed under, which for unsigned calls differ from the transaction hashes.
+func DoSimulate(ctx context.Context, b Backend, blocks []SimBlock, blockNrOrHash rpc.BlockNumberOrHash, timeout time.Duration, globalGasCap uint64) ([]map[string]interface{}, error) {
+	defer func(start time.Time) { log.Debug("Simulating blocks finished", "runtime", time.Since(start)) }(time.Now())
+
+	if len(blocks) == 0 {
+		return nil, errors.New("no blocks to simulate")
+	}
+	if len(blocks) > maxSimulateBlocks {
+		return nil, fmt.Errorf("too many blocks to simulate: %d > %d", len(blocks), maxSimulateBlocks)
+	}
+	statedb, parent, err := b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	// Setup context so it may be cancelled when the simulation has completed
+	// or the allowed execution time elapsed.
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	var (
+		config  = b.ChainConfig()
+		chain   = &simChain{ctx: ctx, b: b, headers: make(map[common.Hash]*types.Header)}
+		results = make([]map[string]interface{}, 0, len(blocks))
+	)
+	// seal finalizes a simulated block and makes it the parent of the next one
+	seal := func(header *types.Header, txs []*types.Transaction, receipts []*types.Receipt, senders []common.Address, calls []*BundleResult) error {
+		header.Root = statedb.IntermediateRoot(config.IsEIP158(header.Number))
+		sim := types.NewBlock(header, txs, nil, receipts, trie.NewStackTrie(nil))
+
+		hashes := make([]common.Hash, len(receipts))
+		for j, receipt := range receipts {
+			hashes[j] = receipt.TxHash
+		}
+		sealed := sim.Header()
+		sealed.TxHash = types.DeriveSha(simTxHashes(hashes), trie.NewStackTrie(nil))
+		sim = sim.WithSeal(sealed)
+
+		hash := sim.Hash()
+		fields, err := RPCMarshalBlock(sim, true, false)
+		if err != nil {
+			return err
+		}
+		// The block hash is only known now, fill it into the receipts and logs
+		// along with the block number. The state is shared across the simulated
+		// blocks, so the log indices need to be restarted for every block too.
+		var (
+			marshalled = make([]map[string]interface{}, len(receipts))
+			logIndex   uint
+		)
+		for j, receipt := range receipts {
+			receipt.BlockHash = hash
+			for _, entry := range receipt.Logs {
+				entry.BlockHash = hash
+				entry.BlockNumber = sim.NumberU64()
+				entry.Index = logIndex
+				logIndex++
+			}
+			marshalled[j] = marshalReceipt(receipt, hash, sim.NumberU64(), senders[j], txs[j], uint64(j))
+			marshalled[j]["transactionHash"] = receipt.TxHash
+		}
+		fields["transactions"] = hashes
+		fields["receipts"] = marshalled
+		fields["calls"] = calls
+		results = append(results, fields)
+
+		chain.headers[hash] = sim.Header()
+		parent = sim.Header()
+		return nil
+	}
+	for i, block := range blocks {
+		// Fill any gap in the requested block numbers with empty blocks, keeping
+		// the chain contiguous for BLOCKHASH
+		if overrides := block.BlockOverrides; overrides != nil && overrides.Number != nil {
+			gaps := new(big.Int).Sub(overrides.Number.ToInt(), parent.Number)
+			gaps.Sub(gaps, common.Big1)
+
+			if gaps.Sign() > 0 {
+				if !gaps.IsUint64() || gaps.Uint64() >= uint64(maxSimulateBlocks-len(results)) {
+					return nil, fmt.Errorf("too many blocks to simulate: > %d", maxSimulateBlocks)
+				}
+				// Space the filler blocks out so that the requested timestamp
+				// still follows them
+				step := uint64(simulateBlockTime)
+				if overrides.Time != nil {
+					if uint64(*overrides.Time) <= parent.Time+gaps.Uint64() {
+						return nil, fmt.Errorf("block %d: timestamp %d leaves no room for %d blocks after parent %d", i, uint64(*overrides.Time), gaps, parent.Time)
+					}
+					if window := (uint64(*overrides.Time) - parent.Time) / (gaps.Uint64() + 1); window < step {
+						step = window
+					}
+				}
+				for j := uint64(0); j < gaps.Uint64(); j++ {
+					header, _ := makeSimHeader(config, parent, nil)
+					header.Time = parent.Time + step
+					if err := seal(header, nil, nil, nil, []*BundleResult{}); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+		if len(results) >= maxSimulateBlocks {
+			return nil, fmt.Errorf("too many blocks to simulate: > %d", maxSimulateBlocks)
+		}
+		header, err := makeSimHeader(config, parent, block.BlockOverrides)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %v", i, err)
+		}
+		if err := block.StateOverrides.Apply(statedb); err != nil {
+			return nil, fmt.Errorf("block %d: %v", i, err)
+		}
+		txs, receipts, senders, calls, err := simulateBlock(ctx, chain, statedb, header, block.Calls, globalGasCap)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %v", i, err)
+		}
+		if err := seal(header, txs, receipts, senders, calls); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// simCallHash derives the hash an unsigned call is filed under in a simulated
+// block. The unsigned transaction doesn't commit to its sender, so its own hash
+// could collide with the same call made by another account.
+func simCallHash(tx *types.Transaction, from common.Address, number *big.Int, index int) common.Hash {
+	return crypto.Keccak256Hash(tx.Hash().Bytes(), from.Bytes(), common.BigToHash(number).Bytes(), common.BigToHash(big.NewInt(int64(index))).Bytes())
+}
+
+// simulateBlock executes the transactions of a simulated block, returning the
+// transactions to include in the block along with their receipts, senders and
+// execution results. Calls are included as unsigned legacy transactions, filed
+// under a hash derived from their sender and position.
+func simulateBlock(ctx context.Context, chain *simChain, statedb *state.StateDB, header *types.Header, calls []BundleTx, globalGasCap uint64) ([]*types.Transaction, []*types.Receipt, []common.Address, []*BundleResult, error) {
+	var (
+		config   = chain.b.ChainConfig()
+		signer   = types.MakeSigner(config, header.Number)
+		gp       = new(core.GasPool).AddGas(header.GasLimit)
+		txs      = make([]*types.Transaction, 0, len(calls))
+		receipts = make([]*types.Receipt, 0, len(calls))
+		senders  = make([]common.Address, 0, len(calls))
+		results  = make([]*BundleResult, 0, len(calls))
+	)
+	for i, call := range calls {
+		// Calls without an explicit gas allowance may use up the rest of the block
+		if call.Call != nil && call.Call.Gas == nil {
+			args := *call.Call
+			gas := hexutil.Uint64(gp.Gas())
+			args.Gas = &gas
+			call.Call = &args
+		}
+		msg, err := call.toMessage(signer, header.BaseFee, globalGasCap)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("tx %d: %v", i, err)
+		}
+		nonce := statedb.GetNonce(msg.From())
+
+		tx := call.Signed
+		if tx == nil {
+			tx = types.NewTx(&types.LegacyTx{
+				Nonce:    nonce,
+				GasPrice: msg.GasPrice(),
+				Gas:      msg.Gas(),
+				To:       msg.To(),
+				Value:    msg.Value(),
+				Data:     msg.Data(),
+			})
+		}
+		txHash := tx.Hash()
+		if call.Signed == nil {
+			txHash = simCallHash(tx, msg.From(), header.Number, i)
+		}
+		// Calls may not specify fees, signed transactions pay as they would on chain
+		vmConfig := vm.Config{NoBaseFee: call.Call != nil}
+		evm := vm.NewEVM(core.NewEVMContext(msg, header, chain, &header.Coinbase), statedb, config, vmConfig)
+
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				evm.Cancel()
+			case <-done:
+			}
+		}()
+		statedb.Prepare(txHash, common.Hash{}, i)
+		coinbase := new(big.Int).Set(statedb.GetBalance(header.Coinbase))
+
+		result, err := core.ApplyMessage(evm, msg, gp)
+		close(done)
+
+		if err := statedb.Error(); err != nil {
+			return nil, nil, nil, nil, err
+		}
+		if evm.Cancelled() {
+			return nil, nil, nil, nil, errors.New("execution aborted (timeout)")
+		}
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("tx %d: %w (supplied gas %d)", i, err, msg.Gas())
+		}
+		var root []byte
+		if config.IsByzantium(header.Number) {
+			statedb.Finalise(true)
+		} else {
+			root = statedb.IntermediateRoot(config.IsEIP158(header.Number)).Bytes()
+		}
+		header.GasUsed += result.UsedGas
+
+		receipt := types.NewReceipt(root, result.Failed(), header.GasUsed)
+		receipt.Type = tx.Type()
+		receipt.TxHash = txHash
+		receipt.GasUsed = result.UsedGas
+		if msg.To() == nil {
+			receipt.ContractAddress = crypto.CreateAddress(msg.From(), nonce)
+		}
+		receipt.Logs = statedb.GetLogs(txHash)
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		receipt.BlockNumber = header.Number
+		receipt.TransactionIndex = uint(i)
+
+		txs = append(txs, tx)
+		receipts = append(receipts, receipt)
+		senders = append(senders, msg.From())
+		results = append(results, newBundleResult(result, receipt.Logs, new(big.Int).Sub(statedb.GetBalance(header.Coinbase), coinbase)))
+	}
+	return txs, receipts, senders, results, nil
+}
+
+// Simulate executes a sequence of phantom blocks on top of the given block, each
+// with its own transactions, header fields and state overrides. The state left
+// by a block is the starting state of the next one, which allows fast-forwarding
+// time dependent contracts without mining. For each block the header, the hashes
+// of its transactions, their receipts and their call results are returned.
+func (s *PublicBlockChainAPI) Simulate(ctx context.Context, blocks []SimBlock, blockNrOrHash rpc.BlockNumberOrHash) ([]map[string]interface{}, error) {
+	return DoSimulate(ctx, s.b, blocks, blockNrOrHash, 5*time.Second, s.b.RPCGasCap())
+}
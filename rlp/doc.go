@@ -102,7 +102,8 @@ Signed integers, floating point numbers, maps, channels and functions cannot be
 
 Struct Tags
 
-Package rlp honours certain struct tags: "-", "tail", "nil", "nilList" and "nilString".
+Package rlp honours certain struct tags: "-", "tail", "nil", "nilList", "nilString" and
+"optional".
 
 The "-" tag ignores fields.
 
@@ -126,5 +127,15 @@ an empty RLP list.
 The choice of null value can be made explicit with the "nilList" and "nilString" struct
 tags. Using these tags encodes/decodes a Go nil pointer value as the kind of empty
 RLP value defined by the tag.
+
+The "optional" tag allows a field to be missing from the input list. If this tag is set on
+a field, all subsequent public fields must also be declared optional. When encoding, zero
+valued optional fields at the end of the struct are omitted from the output list. When
+decoding, missing optional fields are set to their zero value.
+
+    type StructWithOptionalField struct {
+        Required uint64
+        Optional *big.Int `rlp:"optional"`
+    }
 */
 package rlp
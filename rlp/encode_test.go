@@ -263,6 +263,20 @@ var encTests = []encTest{
 	{val: &tailRaw{A: 1, Tail: []RawValue{}}, output: "C101"},
 	{val: &tailRaw{A: 1, Tail: nil}, output: "C101"},
 	{val: &hasIgnoredField{A: 1, B: 2, C: 3}, output: "C20103"},
+
+	// optional fields
+	{val: &optionalFields{A: 1, B: 0, C: 0}, output: "C101"},
+	{val: &optionalFields{A: 1, B: 2, C: 0}, output: "C20102"},
+	{val: &optionalFields{A: 1, B: 2, C: 3}, output: "C3010203"},
+	{val: &optionalFields{A: 1, B: 0, C: 3}, output: "C3018003"},
+	{val: &optionalAndTailField{A: 1}, output: "C101"},
+	{val: &optionalAndTailField{A: 1, B: 2}, output: "C20102"},
+	{val: &optionalAndTailField{A: 1, Tail: []uint{5, 6}}, output: "C401800506"},
+	{val: &optionalBigIntField{A: 1}, output: "C101"},
+	{val: &optionalPtrField{A: 1}, output: "C101"},
+	{val: &optionalPtrField{A: 1, B: &[3]byte{1, 2, 3}}, output: "C50183010203"},
+	{val: &nonOptionalPtrField{A: 1}, output: "C20180"}, // encodes without optional field
+	{val: &nonOptionalPtrField{A: 1, B: &[3]byte{1, 2, 3}}, output: "C50183010203"},
 	{val: &intField{X: 3}, error: "rlp: type int is not RLP-serializable (struct field rlp.intField.X)"},
 
 	// nil
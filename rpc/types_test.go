@@ -122,3 +122,35 @@ func TestBlockNumberOrHash_UnmarshalJSON(t *testing.T) {
 		}
 	}
 }
+
+func TestDecimalOrHexJSONUnmarshal(t *testing.T) {
+	tests := []struct {
+		input    string
+		mustFail bool
+		expected DecimalOrHex
+	}{
+		0: {`0`, false, 0},
+		1: {`12`, false, 12},
+		2: {`"12"`, false, 12},
+		3: {`"0x12"`, false, 18},
+		4: {`"0x"`, true, 0},
+		5: {`-1`, true, 0},
+		6: {`1.5`, true, 0},
+		7: {`"ff"`, true, 0},
+	}
+	for i, test := range tests {
+		var num DecimalOrHex
+		err := json.Unmarshal([]byte(test.input), &num)
+		if test.mustFail && err == nil {
+			t.Errorf("Test %d should fail", i)
+			continue
+		}
+		if !test.mustFail && err != nil {
+			t.Errorf("Test %d should pass but got err: %v", i, err)
+			continue
+		}
+		if num != test.expected {
+			t.Errorf("Test %d got unexpected value, want %d, got %d", i, test.expected, num)
+		}
+	}
+}
@@ -64,10 +64,20 @@ func (cd decodedCallData) String() string {
 }
 
 // verifySelector checks whether the ABI encoded data blob matches the requested
-// function signature.
+// function signature. Besides bare signatures like transfer(address,uint256),
+// human-readable declarations like function transfer(address to, uint256 amount)
+// are accepted too.
 func verifySelector(selector string, calldata []byte) (*decodedCallData, error) {
 	// Parse the selector into an ABI JSON spec
-	abidata, err := parseSelector(selector)
+	var (
+		abidata []byte
+		err     error
+	)
+	if strings.ContainsAny(selector, " \t") {
+		abidata, err = abi.HumanReadableToJSON([]string{selector})
+	} else {
+		abidata, err = parseSelector(selector)
+	}
 	if err != nil {
 		return nil, err
 	}
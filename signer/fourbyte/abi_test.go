@@ -172,3 +172,28 @@ func TestMaliciousABIStrings(t *testing.T) {
 		}
 	}
 }
+
+// Tests that human-readable declarations are accepted as method selectors.
+func TestHumanReadableSelectors(t *testing.T) {
+	data := common.Hex2Bytes("a9059cbb" +
+		"000000000000000000000000000000000000000000000000000000000000dead" +
+		"0000000000000000000000000000000000000000000000000000000000000012")
+
+	for i, selector := range []string{
+		"transfer(address,uint256)",
+		"function transfer(address to, uint256 amount)",
+		"function transfer(address to, uint256 amount) external returns (bool)",
+	} {
+		info, err := verifySelector(selector, data)
+		if err != nil {
+			t.Errorf("test %d: failed to verify selector %q: %v", i, selector, err)
+			continue
+		}
+		if info.signature != "transfer(address,uint256)" {
+			t.Errorf("test %d: signature mismatch: have %q", i, info.signature)
+		}
+	}
+	if _, err := verifySelector("function transfer(address to, uint128 amount)", data); err == nil {
+		t.Errorf("mismatching declaration accepted")
+	}
+}
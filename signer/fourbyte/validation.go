@@ -99,7 +99,7 @@ func (db *Database) ValidateCallData(selector *string, data []byte, messages *co
 			messages.Warn(fmt.Sprintf("Transaction contains data, but provided ABI signature could not be matched: %v", err))
 		} else {
 			messages.Info(fmt.Sprintf("Transaction invokes the following method: %q", info.String()))
-			db.AddSelector(*selector, data[:4])
+			db.AddSelector(info.signature, data[:4])
 		}
 		return
 	}
@@ -35,6 +35,7 @@ type leaf struct {
 	size int         // size of the rlp data (estimate)
 	hash common.Hash // hash of rlp data
 	node node        // the node to commit
+	path []byte      // hex path of the node, only tracked in the path scheme
 }
 
 // committer is a type used for the trie Commit operation. A committer has some
@@ -49,6 +50,7 @@ type committer struct {
 
 	onleaf LeafCallback
 	leafCh chan *leaf
+	owner  common.Hash // Account owning the committed trie in the path scheme
 }
 
 // committers live in a global sync.Pool
@@ -69,6 +71,7 @@ func newCommitter() *committer {
 func returnCommitterToPool(h *committer) {
 	h.onleaf = nil
 	h.leafCh = nil
+	h.owner = common.Hash{}
 	committerPool.Put(h)
 }
 
@@ -77,15 +80,17 @@ func (c *committer) Commit(n node, db *Database) (hashNode, error) {
 	if db == nil {
 		return nil, errors.New("no db provided")
 	}
-	h, err := c.commit(n, db)
+	h, err := c.commit(nil, n, db)
 	if err != nil {
 		return nil, err
 	}
 	return h.(hashNode), nil
 }
 
-// commit collapses a node down into a hash node and inserts it into the database
-func (c *committer) commit(n node, db *Database) (node, error) {
+// commit collapses a node down into a hash node and inserts it into the database.
+// The path of the node is only tracked (and the result only valid) if the
+// database uses the path scheme.
+func (c *committer) commit(path []byte, n node, db *Database) (node, error) {
 	// if this path is clean, use available cached data
 	hash, dirty := n.cache()
 	if hash != nil && !dirty {
@@ -100,7 +105,7 @@ func (c *committer) commit(n node, db *Database) (node, error) {
 		// If the child is fullnode, recursively commit.
 		// Otherwise it can only be hashNode or valueNode.
 		if _, ok := cn.Val.(*fullNode); ok {
-			childV, err := c.commit(cn.Val, db)
+			childV, err := c.commit(childPath(db, path, cn.Key...), cn.Val, db)
 			if err != nil {
 				return nil, err
 			}
@@ -108,20 +113,20 @@ func (c *committer) commit(n node, db *Database) (node, error) {
 		}
 		// The key needs to be copied, since we're delivering it to database
 		collapsed.Key = hexToCompact(cn.Key)
-		hashedNode := c.store(collapsed, db)
+		hashedNode := c.store(path, collapsed, db)
 		if hn, ok := hashedNode.(hashNode); ok {
 			return hn, nil
 		}
 		return collapsed, nil
 	case *fullNode:
-		hashedKids, err := c.commitChildren(cn, db)
+		hashedKids, err := c.commitChildren(path, cn, db)
 		if err != nil {
 			return nil, err
 		}
 		collapsed := cn.copy()
 		collapsed.Children = hashedKids
 
-		hashedNode := c.store(collapsed, db)
+		hashedNode := c.store(path, collapsed, db)
 		if hn, ok := hashedNode.(hashNode); ok {
 			return hn, nil
 		}
@@ -135,7 +140,7 @@ func (c *committer) commit(n node, db *Database) (node, error) {
 }
 
 // commitChildren commits the children of the given fullnode
-func (c *committer) commitChildren(n *fullNode, db *Database) ([17]node, error) {
+func (c *committer) commitChildren(path []byte, n *fullNode, db *Database) ([17]node, error) {
 	var children [17]node
 	for i := 0; i < 16; i++ {
 		child := n.Children[i]
@@ -152,7 +157,7 @@ func (c *committer) commitChildren(n *fullNode, db *Database) ([17]node, error)
 		// Commit the child recursively and store the "hashed" value.
 		// Note the returned node can be some embedded nodes, so it's
 		// possible the type is not hashnode.
-		hashed, err := c.commit(child, db)
+		hashed, err := c.commit(childPath(db, path, byte(i)), child, db)
 		if err != nil {
 			return children, err
 		}
@@ -168,7 +173,7 @@ func (c *committer) commitChildren(n *fullNode, db *Database) ([17]node, error)
 // store hashes the node n and if we have a storage layer specified, it writes
 // the key/value pair to it and tracks any node->child references as well as any
 // node->external trie references.
-func (c *committer) store(n node, db *Database) node {
+func (c *committer) store(path []byte, n node, db *Database) node {
 	// Larger nodes are replaced by their hash and stored in the database.
 	var (
 		hash, _ = n.cache()
@@ -179,6 +184,14 @@ func (c *committer) store(n node, db *Database) node {
 		// In theory we should apply the leafCall here if it's not nil(embedded
 		// node usually contains value). But small value(less than 32bytes) is
 		// not our target.
+		//
+		// In the path scheme, any node previously stored at this path is stale
+		// now that it's embedded in the parent, so mark it deleted.
+		if db != nil && db.path != nil {
+			db.lock.Lock()
+			db.deletePath(c.owner, path)
+			db.lock.Unlock()
+		}
 		return n
 	} else {
 		// We have the hash already, estimate the RLP encoding-size of the node.
@@ -192,12 +205,13 @@ func (c *committer) store(n node, db *Database) node {
 			size: size,
 			hash: common.BytesToHash(hash),
 			node: n,
+			path: path,
 		}
 	} else if db != nil {
 		// No leaf-callback used, but there's still a database. Do serial
 		// insertion
 		db.lock.Lock()
-		db.insert(common.BytesToHash(hash), size, n)
+		c.insert(db, path, common.BytesToHash(hash), size, n)
 		db.lock.Unlock()
 	}
 	return hash
@@ -213,7 +227,7 @@ func (c *committer) commitLoop(db *Database) {
 		)
 		// We are pooling the trie nodes into an intermediate memory cache
 		db.lock.Lock()
-		db.insert(hash, size, n)
+		c.insert(db, item.path, hash, size, n)
 		db.lock.Unlock()
 
 		if c.onleaf != nil {
@@ -233,6 +247,27 @@ func (c *committer) commitLoop(db *Database) {
 	}
 }
 
+// insert pools a collapsed node into the database, either by hash or by path
+// depending on the scheme used.
+//
+// Note, this method assumes that the database's lock is held!
+func (c *committer) insert(db *Database, path []byte, hash common.Hash, size int, n node) {
+	if db.path != nil {
+		db.insertPath(c.owner, path, hash, n)
+		return
+	}
+	db.insert(hash, size, n)
+}
+
+// childPath returns the path of a child node, or nil if the database doesn't
+// use the path scheme, avoiding the allocations in the hash scheme.
+func childPath(db *Database, path []byte, key ...byte) []byte {
+	if db == nil || db.path == nil {
+		return nil
+	}
+	return concat(path, key...)
+}
+
 func (c *committer) makeHashNode(data []byte) hashNode {
 	n := make(hashNode, c.sha.Size())
 	c.sha.Reset()
@@ -88,6 +88,9 @@ type Database struct {
 	childrenSize  common.StorageSize // Storage size of the external children tracking
 	preimagesSize common.StorageSize // Storage size of the preimages cache
 
+	journal *dirtyJournal // Write-ahead journal of dirty cache mutations (nil = disabled)
+	path    *pathDatabase // State layers of the path scheme (nil = hash scheme)
+
 	lock sync.RWMutex
 }
 
@@ -291,7 +294,7 @@ func NewDatabaseWithCache(diskdb ethdb.KeyValueStore, cache int, journal string)
 			cleans = fastcache.LoadFromFileOrNew(journal, cache*1024*1024)
 		}
 	}
-	return &Database{
+	db := &Database{
 		diskdb: diskdb,
 		cleans: cleans,
 		dirties: map[common.Hash]*cachedNode{{}: {
@@ -299,6 +302,10 @@ func NewDatabaseWithCache(diskdb ethdb.KeyValueStore, cache int, journal string)
 		}},
 		preimages: make(map[common.Hash][]byte),
 	}
+	if rawdb.ReadStateScheme(diskdb) == rawdb.PathScheme {
+		db.path = newPathDatabase(diskdb)
+	}
+	return db
 }
 
 // DiskDB retrieves the persistent storage backing the trie database.
@@ -337,6 +344,10 @@ func (db *Database) insert(hash common.Hash, size int, node node) {
 		db.dirties[db.newest].flushNext, db.newest = hash, hash
 	}
 	db.dirtiesSize += common.StorageSize(common.HashLength + entry.size)
+
+	if db.journal != nil {
+		db.appendJournal(&journalEntry{Op: journalInsert, Hash: hash, Blob: entry.rlp(), Size: entry.size})
+	}
 }
 
 // insertPreimage writes a new trie node pre-image to the memory database if it's
@@ -488,6 +499,7 @@ func (db *Database) reference(child common.Hash, parent common.Hash) {
 	if db.dirties[parent].children[child] == 1 {
 		db.childrenSize += common.HashLength + 2 // uint16 counter
 	}
+	db.appendJournal(&journalEntry{Op: journalReference, Hash: child, Parent: parent})
 }
 
 // Dereference removes an existing reference from a root node.
@@ -502,6 +514,7 @@ func (db *Database) Dereference(root common.Hash) {
 
 	nodes, storage, start := len(db.dirties), db.dirtiesSize, time.Now()
 	db.dereference(root, common.Hash{})
+	db.appendJournal(&journalEntry{Op: journalDereference, Hash: root})
 
 	db.gcnodes += uint64(nodes - len(db.dirties))
 	db.gcsize += storage - db.dirtiesSize
@@ -634,6 +647,7 @@ func (db *Database) Cap(limit common.StorageSize) error {
 	}
 	for db.oldest != oldest {
 		node := db.dirties[db.oldest]
+		db.appendJournal(&journalEntry{Op: journalFlush, Hash: db.oldest})
 		delete(db.dirties, db.oldest)
 		db.oldest = node.flushNext
 
@@ -688,6 +702,24 @@ func (db *Database) Commit(node common.Hash, report bool, callback func(common.H
 	}
 	batch.Reset()
 
+	// In the path scheme, persist all the in-memory layers up to the requested
+	// state instead
+	if db.path != nil {
+		db.lock.Lock()
+		defer db.lock.Unlock()
+
+		db.preimages, db.preimagesSize = make(map[common.Hash][]byte), 0
+		if err := db.flatten(node, 0); err != nil {
+			log.Error("Failed to persist state layers", "err", err)
+			return err
+		}
+		logger := log.Info
+		if !report {
+			logger = log.Debug
+		}
+		logger("Persisted state layers from memory database", "root", node, "id", db.path.stateID, "time", time.Since(start))
+		return nil
+	}
 	// Move the trie itself into the batch, flushing if enough data is accumulated
 	nodes, storage := len(db.dirties), db.dirtiesSize
 
@@ -794,6 +826,7 @@ func (c *cleaner) Put(key []byte, rlp []byte) error {
 		c.db.dirties[node.flushNext].flushPrev = node.flushPrev
 	}
 	// Remove the node from the dirty cache
+	c.db.appendJournal(&journalEntry{Op: journalFlush, Hash: hash})
 	delete(c.db.dirties, hash)
 	c.db.dirtiesSize -= common.StorageSize(common.HashLength + int(node.size))
 	if node.children != nil {
@@ -822,6 +855,9 @@ func (db *Database) Size() (common.StorageSize, common.StorageSize) {
 	// counted.
 	var metadataSize = common.StorageSize((len(db.dirties) - 1) * cachedNodeSize)
 	var metarootRefs = common.StorageSize(len(db.dirties[common.Hash{}].children) * (common.HashLength + 2))
+	if db.path != nil {
+		return db.path.size, db.preimagesSize
+	}
 	return db.dirtiesSize + db.childrenSize + metadataSize - metarootRefs, db.preimagesSize
 }
 
@@ -0,0 +1,466 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// journalVersion is the version of the dirty node journal format. Journals with
+// a different version are discarded on load.
+const journalVersion uint64 = 0
+
+// journalCompactMinimum is the minimum number of bytes that need to be appended
+// to the dirty node journal before it's considered for compaction.
+const journalCompactMinimum = 64 * 1024 * 1024
+
+// journalCompactRatio is the multiple of the live dirty cache size the journal
+// needs to grow to before it's compacted down into a dump of the live nodes.
+const journalCompactRatio = 4
+
+// journalBufferSize is the size of the in-memory buffer accumulating journal
+// entries in between explicit syncs.
+const journalBufferSize = 1024 * 1024
+
+// Operations that are recorded in the dirty node journal.
+const (
+	journalInsert      uint8 = iota // Dirty node inserted into the cache
+	journalReference                // Reference added between two cached nodes
+	journalDereference              // Reference removed from a root, collecting garbage
+	journalFlush                    // Node persisted to disk and dropped from the cache
+	journalNode                     // Full cached node dumped during compaction
+)
+
+// journalChild is an external reference of a cached node, as stored in the
+// dirty node journal.
+type journalChild struct {
+	Hash common.Hash
+	Refs uint16
+}
+
+// journalEntry is a single mutation of the dirty node cache. Depending on the
+// operation, only a subset of the fields is filled in.
+type journalEntry struct {
+	Op       uint8
+	Hash     common.Hash
+	Parent   common.Hash
+	Blob     []byte
+	Size     uint16
+	Parents  uint32
+	Children []journalChild
+}
+
+// dirtyJournal is a write-ahead log of all the mutations done on the dirty node
+// cache of a trie database, allowing it to be reconstructed after a crash.
+type dirtyJournal struct {
+	path    string        // Filesystem path of the journal
+	file    *os.File      // Journal file opened for appending
+	writer  *bufio.Writer // Buffered writer accumulating entries until synced
+	written uint64        // Number of bytes written since the last compaction
+}
+
+// OpenJournal loads the dirty node journal from the given path (if any), replays
+// it into the dirty cache and starts journalling all subsequent mutations. The
+// number of dirty nodes recovered is returned.
+//
+// The method must be called on a freshly created database, before any trie is
+// committed into it.
+func (db *Database) OpenJournal(path string) (int, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.path != nil {
+		return 0, errors.New("dirty journal unsupported in the path scheme")
+	}
+	if db.journal != nil {
+		return 0, errors.New("dirty journal already open")
+	}
+	if len(db.dirties) > 1 {
+		return 0, errors.New("dirty cache not empty")
+	}
+	if file, err := os.Open(path); err == nil {
+		start := time.Now()
+		entries, err := db.replayJournal(bufio.NewReader(file))
+		file.Close()
+
+		switch {
+		case err == errJournalVersion:
+			log.Warn("Discarding incompatible dirty trie journal", "path", path)
+		case err != nil:
+			log.Warn("Dirty trie journal truncated", "path", path, "entries", entries, "err", err)
+		}
+		if entries > 0 {
+			log.Info("Recovered dirty trie nodes from journal", "nodes", len(db.dirties)-1, "size", db.dirtiesSize, "entries", entries, "elapsed", common.PrettyDuration(time.Since(start)))
+		}
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+	if err := db.compactJournal(path); err != nil {
+		return 0, err
+	}
+	return len(db.dirties) - 1, nil
+}
+
+// SyncJournal flushes all the buffered journal entries to disk, compacting the
+// journal if it grew too large compared to the live dirty cache.
+func (db *Database) SyncJournal() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.journal == nil {
+		return nil
+	}
+	if err := db.journal.writer.Flush(); err != nil {
+		db.dropJournal(err)
+		return err
+	}
+	if err := db.journal.file.Sync(); err != nil {
+		db.dropJournal(err)
+		return err
+	}
+	if db.journal.written > journalCompactMinimum && db.journal.written > journalCompactRatio*uint64(db.dirtiesSize) {
+		if err := db.compactJournal(db.journal.path); err != nil {
+			db.dropJournal(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// CloseJournal stops journalling the dirty cache mutations. If discard is set,
+// the journal is also deleted, which should only be done after all the state
+// needed on restart has been committed to disk.
+func (db *Database) CloseJournal(discard bool) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.journal == nil {
+		return nil
+	}
+	journal := db.journal
+	db.journal = nil
+
+	err := journal.writer.Flush()
+	if cerr := journal.file.Close(); err == nil {
+		err = cerr
+	}
+	if discard {
+		if rerr := os.Remove(journal.path); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// Roots returns the tries held alive by references from the meta-root, along
+// with the number of references to each of them.
+func (db *Database) Roots() map[common.Hash]uint16 {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	roots := make(map[common.Hash]uint16, len(db.dirties[common.Hash{}].children))
+	for root, refs := range db.dirties[common.Hash{}].children {
+		roots[root] = refs
+	}
+	return roots
+}
+
+// appendJournal appends a mutation to the dirty node journal, if enabled.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) appendJournal(entry *journalEntry) {
+	if db.journal == nil {
+		return
+	}
+	blob, err := rlp.EncodeToBytes(entry)
+	if err != nil {
+		panic(err) // Can't happen, all fields are encodable
+	}
+	if _, err := db.journal.writer.Write(blob); err != nil {
+		db.dropJournal(err)
+		return
+	}
+	db.journal.written += uint64(len(blob))
+}
+
+// dropJournal disables journalling after a write failure. The journal is deleted
+// as it would not reflect the dirty cache any more.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) dropJournal(err error) {
+	log.Error("Failed to write dirty trie journal, disabling", "path", db.journal.path, "err", err)
+
+	db.journal.file.Close()
+	os.Remove(db.journal.path)
+	db.journal = nil
+}
+
+// compactJournal atomically replaces the journal at the given path with a dump
+// of the current dirty cache and reopens it for appending new mutations.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) compactJournal(path string) error {
+	start := time.Now()
+
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriterSize(file, journalBufferSize)
+	written, err := db.dumpJournal(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if db.journal != nil {
+		db.journal.file.Close()
+	}
+	db.journal = &dirtyJournal{
+		path:    path,
+		file:    file,
+		writer:  bufio.NewWriterSize(file, journalBufferSize),
+		written: written,
+	}
+	log.Debug("Compacted dirty trie journal", "nodes", len(db.dirties)-1, "size", common.StorageSize(written), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// dumpJournal writes a journal header followed by the entire dirty cache into
+// the given writer, in flush-list order. The number of bytes written is returned.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) dumpJournal(w io.Writer) (uint64, error) {
+	var written uint64
+
+	dump := func(val interface{}) error {
+		blob, err := rlp.EncodeToBytes(val)
+		if err != nil {
+			return err
+		}
+		n, err := w.Write(blob)
+		written += uint64(n)
+		return err
+	}
+	if err := dump(journalVersion); err != nil {
+		return written, err
+	}
+	// Dump the meta-root first, followed by all the nodes in flush-list order
+	if err := dump(&journalEntry{Op: journalNode, Children: journalChildren(db.dirties[common.Hash{}])}); err != nil {
+		return written, err
+	}
+	for hash := db.oldest; hash != (common.Hash{}); {
+		node := db.dirties[hash]
+		entry := &journalEntry{
+			Op:       journalNode,
+			Hash:     hash,
+			Blob:     node.rlp(),
+			Size:     node.size,
+			Parents:  node.parents,
+			Children: journalChildren(node),
+		}
+		if err := dump(entry); err != nil {
+			return written, err
+		}
+		hash = node.flushNext
+	}
+	return written, nil
+}
+
+// errJournalVersion is returned if the journal being replayed was written by an
+// incompatible version.
+var errJournalVersion = errors.New("dirty journal version mismatch")
+
+// replayJournal reads the dirty node journal from the given reader and applies
+// all the recorded mutations to the dirty cache. The number of entries applied
+// is returned. A partially written entry at the end of the journal is reported
+// as an error, but all the preceding entries remain applied.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) replayJournal(r io.Reader) (int, error) {
+	stream := rlp.NewStream(r, 0)
+
+	version, err := stream.Uint()
+	if err != nil {
+		return 0, err
+	}
+	if version != journalVersion {
+		return 0, errJournalVersion
+	}
+	for entries := 0; ; entries++ {
+		var entry journalEntry
+		if err := stream.Decode(&entry); err != nil {
+			if err == io.EOF {
+				return entries, nil
+			}
+			return entries, err
+		}
+		if err := db.replayEntry(&entry); err != nil {
+			return entries, err
+		}
+	}
+}
+
+// replayEntry applies a single journalled mutation to the dirty cache.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) replayEntry(entry *journalEntry) error {
+	switch entry.Op {
+	case journalInsert:
+		n, err := decodeNode(entry.Hash[:], entry.Blob)
+		if err != nil {
+			return err
+		}
+		db.insert(entry.Hash, int(entry.Size), collapseDecoded(n))
+
+	case journalReference:
+		if _, ok := db.dirties[entry.Parent]; !ok {
+			return fmt.Errorf("reference from unknown parent %x", entry.Parent)
+		}
+		db.reference(entry.Hash, entry.Parent)
+
+	case journalDereference:
+		db.dereference(entry.Hash, common.Hash{})
+
+	case journalFlush:
+		db.uncache(entry.Hash)
+
+	case journalNode:
+		if entry.Hash == (common.Hash{}) {
+			meta := db.dirties[common.Hash{}]
+			for _, child := range entry.Children {
+				meta.children[child.Hash] = child.Refs
+			}
+			db.childrenSize += common.StorageSize(len(entry.Children) * (common.HashLength + 2))
+			return nil
+		}
+		if _, ok := db.dirties[entry.Hash]; ok {
+			return fmt.Errorf("duplicate node %x", entry.Hash)
+		}
+		n, err := decodeNode(entry.Hash[:], entry.Blob)
+		if err != nil {
+			return err
+		}
+		node := &cachedNode{
+			node:      simplifyNode(collapseDecoded(n)),
+			size:      entry.Size,
+			parents:   entry.Parents,
+			flushPrev: db.newest,
+		}
+		if len(entry.Children) > 0 {
+			node.children = make(map[common.Hash]uint16, len(entry.Children))
+			for _, child := range entry.Children {
+				node.children[child.Hash] = child.Refs
+			}
+			db.childrenSize += common.StorageSize(cachedNodeChildrenSize + len(entry.Children)*(common.HashLength+2))
+		}
+		db.dirties[entry.Hash] = node
+
+		if db.oldest == (common.Hash{}) {
+			db.oldest, db.newest = entry.Hash, entry.Hash
+		} else {
+			db.dirties[db.newest].flushNext, db.newest = entry.Hash, entry.Hash
+		}
+		db.dirtiesSize += common.StorageSize(common.HashLength + entry.Size)
+
+	default:
+		return fmt.Errorf("unknown journal operation %d", entry.Op)
+	}
+	return nil
+}
+
+// uncache removes an already persisted node from the dirty cache, without
+// touching the reference counts of its children.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) uncache(hash common.Hash) {
+	node, ok := db.dirties[hash]
+	if !ok {
+		return
+	}
+	switch hash {
+	case db.oldest:
+		db.oldest = node.flushNext
+		db.dirties[node.flushNext].flushPrev = common.Hash{}
+	case db.newest:
+		db.newest = node.flushPrev
+		db.dirties[node.flushPrev].flushNext = common.Hash{}
+	default:
+		db.dirties[node.flushPrev].flushNext = node.flushNext
+		db.dirties[node.flushNext].flushPrev = node.flushPrev
+	}
+	delete(db.dirties, hash)
+	db.dirtiesSize -= common.StorageSize(common.HashLength + int(node.size))
+	if node.children != nil {
+		db.childrenSize -= common.StorageSize(cachedNodeChildrenSize + len(node.children)*(common.HashLength+2))
+	}
+}
+
+// journalChildren converts the external references of a cached node into their
+// journal representation.
+func journalChildren(node *cachedNode) []journalChild {
+	if len(node.children) == 0 {
+		return nil
+	}
+	children := make([]journalChild, 0, len(node.children))
+	for hash, refs := range node.children {
+		children = append(children, journalChild{Hash: hash, Refs: refs})
+	}
+	return children
+}
+
+// collapseDecoded converts the keys of a decoded trie node back into compact
+// form, so that simplifying it results in the same node the committer caches.
+func collapseDecoded(n node) node {
+	switch n := n.(type) {
+	case *shortNode:
+		return &shortNode{Key: hexToCompact(n.Key), Val: collapseDecoded(n.Val)}
+
+	case *fullNode:
+		collapsed := new(fullNode)
+		for i, child := range n.Children {
+			if child != nil {
+				collapsed.Children[i] = collapseDecoded(child)
+			}
+		}
+		return collapsed
+
+	default:
+		return n
+	}
+}
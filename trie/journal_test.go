@@ -0,0 +1,227 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+// dirtyState is a flattened view of a dirty node cache, used to compare the
+// caches of two databases.
+type dirtyState struct {
+	order []common.Hash
+	nodes map[common.Hash]string
+	roots map[common.Hash]uint16
+}
+
+func collectDirtyState(db *Database) *dirtyState {
+	state := &dirtyState{
+		nodes: make(map[common.Hash]string),
+		roots: db.Roots(),
+	}
+	for hash := db.oldest; hash != (common.Hash{}); hash = db.dirties[hash].flushNext {
+		node := db.dirties[hash]
+		state.order = append(state.order, hash)
+		state.nodes[hash] = fmt.Sprintf("%x/%d/%d/%v", node.rlp(), node.size, node.parents, node.children)
+	}
+	return state
+}
+
+func checkDirtyState(t *testing.T, have, want *dirtyState) {
+	t.Helper()
+
+	if len(have.order) != len(want.order) {
+		t.Fatalf("dirty node count mismatch: have %d, want %d", len(have.order), len(want.order))
+	}
+	for i := range have.order {
+		if have.order[i] != want.order[i] {
+			t.Fatalf("flush-list item %d mismatch: have %x, want %x", i, have.order[i], want.order[i])
+		}
+		if have.nodes[have.order[i]] != want.nodes[want.order[i]] {
+			t.Fatalf("dirty node %x mismatch: have %s, want %s", have.order[i], have.nodes[have.order[i]], want.nodes[want.order[i]])
+		}
+	}
+	if len(have.roots) != len(want.roots) {
+		t.Fatalf("root count mismatch: have %d, want %d", len(have.roots), len(want.roots))
+	}
+	for root, refs := range want.roots {
+		if have.roots[root] != refs {
+			t.Fatalf("root %x reference mismatch: have %d, want %d", root, have.roots[root], refs)
+		}
+	}
+}
+
+// fillJournalledDatabase commits a sequence of tries into the database, mixing
+// in all the dirty cache mutations that need to be journalled.
+func fillJournalledDatabase(t *testing.T, db *Database) []common.Hash {
+	var (
+		roots []common.Hash
+		root  common.Hash
+	)
+	for i := 0; i < 10; i++ {
+		trie, _ := NewSecure(root, db)
+		for j := 0; j < 100; j++ {
+			trie.Update(randBytes(32), randBytes(20))
+		}
+		// Reinsert a shared value to have duplicate nodes across tries
+		trie.Update([]byte("shared"), []byte("value"))
+
+		var err error
+		if root, err = trie.Commit(nil); err != nil {
+			t.Fatalf("failed to commit trie %d: %v", i, err)
+		}
+		db.Reference(root, common.Hash{})
+		roots = append(roots, root)
+
+		switch i {
+		case 3:
+			nodes, _ := db.Size()
+			if err := db.Cap(nodes / 2); err != nil {
+				t.Fatalf("failed to cap database: %v", err)
+			}
+		case 5:
+			db.Dereference(roots[0])
+		case 7:
+			if err := db.Commit(roots[2], false, nil); err != nil {
+				t.Fatalf("failed to commit root: %v", err)
+			}
+		}
+	}
+	return roots
+}
+
+// Tests that the dirty node journal can reconstruct the exact dirty cache after
+// an unclean shutdown, and that the state is readable from the recovered cache.
+func TestDirtyJournalReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dirtyjournal-")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "triedirty")
+
+	diskdb := memorydb.New()
+	db := NewDatabase(diskdb)
+	if n, err := db.OpenJournal(path); err != nil || n != 0 {
+		t.Fatalf("failed to open empty journal: %d, %v", n, err)
+	}
+	roots := fillJournalledDatabase(t, db)
+	if err := db.SyncJournal(); err != nil {
+		t.Fatalf("failed to sync journal: %v", err)
+	}
+	want := collectDirtyState(db)
+
+	// Simulate a crash by loading the journal into a fresh database
+	recovered := NewDatabase(diskdb)
+	n, err := recovered.OpenJournal(path)
+	if err != nil {
+		t.Fatalf("failed to replay journal: %v", err)
+	}
+	if n != len(want.order) {
+		t.Fatalf("recovered node count mismatch: have %d, want %d", n, len(want.order))
+	}
+	checkDirtyState(t, collectDirtyState(recovered), want)
+
+	// Ensure the latest state is fully available from the recovered database
+	trie, err := NewSecure(roots[len(roots)-1], recovered)
+	if err != nil {
+		t.Fatalf("failed to open recovered trie: %v", err)
+	}
+	if !bytes.Equal(trie.Get([]byte("shared")), []byte("value")) {
+		t.Fatalf("recovered trie missing shared value")
+	}
+	it := trie.NodeIterator(nil)
+	for it.Next(true) {
+	}
+	if it.Error() != nil {
+		t.Fatalf("recovered trie incomplete: %v", it.Error())
+	}
+	// Opening the journal compacts it, ensure the compacted version also replays
+	if err := recovered.CloseJournal(false); err != nil {
+		t.Fatalf("failed to close journal: %v", err)
+	}
+	compacted := NewDatabase(diskdb)
+	if _, err := compacted.OpenJournal(path); err != nil {
+		t.Fatalf("failed to replay compacted journal: %v", err)
+	}
+	checkDirtyState(t, collectDirtyState(compacted), want)
+
+	// Dereference everything and ensure a discarded journal is deleted
+	for _, root := range roots[1:] {
+		compacted.Dereference(root)
+	}
+	if size, _ := compacted.Size(); size != 0 {
+		t.Fatalf("dangling nodes after full dereference: %v", size)
+	}
+	if err := compacted.CloseJournal(true); err != nil {
+		t.Fatalf("failed to discard journal: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("journal not deleted: %v", err)
+	}
+}
+
+// Tests that a journal with a partially written tail is still replayed up to
+// the last complete entry.
+func TestDirtyJournalTruncated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dirtyjournal-")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "triedirty")
+
+	diskdb := memorydb.New()
+	db := NewDatabase(diskdb)
+	if _, err := db.OpenJournal(path); err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	roots := fillJournalledDatabase(t, db)
+	if err := db.SyncJournal(); err != nil {
+		t.Fatalf("failed to sync journal: %v", err)
+	}
+	// Chop off the tail of the last entry, which references the last root
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read journal: %v", err)
+	}
+	if err := ioutil.WriteFile(path, blob[:len(blob)-1], 0644); err != nil {
+		t.Fatalf("failed to truncate journal: %v", err)
+	}
+	recovered := NewDatabase(diskdb)
+	if _, err := recovered.OpenJournal(path); err != nil {
+		t.Fatalf("failed to replay truncated journal: %v", err)
+	}
+	have := recovered.Roots()
+	if _, ok := have[roots[len(roots)-1]]; ok {
+		t.Fatalf("torn reference replayed")
+	}
+	if _, ok := have[roots[len(roots)-2]]; !ok {
+		t.Fatalf("complete reference missing")
+	}
+	if _, err := NewSecure(roots[len(roots)-1], recovered); err != nil {
+		t.Fatalf("inserted trie nodes lost: %v", err)
+	}
+}
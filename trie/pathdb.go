@@ -0,0 +1,538 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// defaultStateHistory is the number of reverse diffs retained by default in the
+// path scheme, limiting how far back the persisted state can be reverted.
+const defaultStateHistory = 90000
+
+// errStateUnrecoverable is returned if the persisted state cannot be reverted
+// to the requested root.
+var errStateUnrecoverable = errors.New("state unrecoverable")
+
+// pathNode is a trie node tracked by its owner and path in the path scheme.
+type pathNode struct {
+	hash common.Hash // Hash of the node, empty if the node was deleted
+	blob []byte      // Encoded trie node, nil if the node was deleted
+}
+
+// pathNodeSet is a set of trie node changes, grouped by the owning account (the
+// zero hash for the account trie) and keyed by the hex path within the trie.
+type pathNodeSet map[common.Hash]map[string]*pathNode
+
+// pathLayer is the set of trie node changes introduced by a single state
+// transition, stacked on top of the state it was derived from.
+type pathLayer struct {
+	root       common.Hash
+	parentRoot common.Hash
+	parent     *pathLayer // Parent layer, nil if the parent state is the persisted one
+
+	nodes pathNodeSet              // Trie nodes changed by the state transition
+	wipes map[common.Hash]struct{} // Storage tries deleted by the state transition
+	size  common.StorageSize       // Approximate memory used by the layer
+}
+
+// indexedNode is a trie node blob tracked by one or more in-memory layers.
+type indexedNode struct {
+	blob []byte
+	refs int
+}
+
+// pathDatabase is the state tracker of the path scheme. It keeps one persisted
+// state on disk with trie nodes keyed by owner and path, a tree of in-memory
+// layers on top of it holding the recent state transitions and an index of all
+// the in-memory nodes, allowing them to be looked up by owner, path and hash.
+type pathDatabase struct {
+	diskRoot common.Hash // Root of the persisted state
+	stateID  uint64      // Id of the persisted state, incremented on every flush
+	history  uint64      // Number of reverse diffs to retain for reverting the state
+
+	layers  map[common.Hash]*pathLayer              // In-memory state layers keyed by root
+	index   map[string]map[common.Hash]*indexedNode // In-memory nodes keyed by owner+path and hash
+	pending pathNodeSet                             // Committed nodes not yet sealed into a layer
+	size    common.StorageSize                      // Approximate memory used by the layers
+}
+
+// reverseDiff is the set of trie nodes overwritten when a state layer is flushed
+// to disk, allowing the persisted state to be reverted to its parent.
+type reverseDiff struct {
+	Parent common.Hash       // Root of the state reverted to
+	Root   common.Hash       // Root of the state reverted from
+	Nodes  []reverseDiffNode // Original trie nodes, in the order they were overwritten
+}
+
+// reverseDiffNode is a single trie node overwritten in the persisted state.
+type reverseDiffNode struct {
+	Owner common.Hash
+	Path  []byte
+	Blob  []byte // Original node, empty if it didn't exist
+}
+
+// newPathDatabase loads the state tracker of the path scheme from disk.
+func newPathDatabase(diskdb ethdb.KeyValueStore) *pathDatabase {
+	root := emptyRoot
+	if blob := rawdb.ReadAccountTrieNode(diskdb, nil); len(blob) > 0 {
+		root = crypto.Keccak256Hash(blob)
+	}
+	return &pathDatabase{
+		diskRoot: root,
+		stateID:  rawdb.ReadPersistentStateID(diskdb),
+		history:  defaultStateHistory,
+		layers:   make(map[common.Hash]*pathLayer),
+		index:    make(map[string]map[common.Hash]*indexedNode),
+		pending:  make(pathNodeSet),
+	}
+}
+
+// indexKey returns the key of a trie node in the in-memory node index.
+func indexKey(owner common.Hash, path []byte) string {
+	return string(owner.Bytes()) + string(path)
+}
+
+// addLayer inserts a new layer into the tree and indexes its nodes.
+func (p *pathDatabase) addLayer(layer *pathLayer) {
+	for owner, nodes := range layer.nodes {
+		for path, n := range nodes {
+			if n.blob == nil {
+				continue
+			}
+			key := indexKey(owner, []byte(path))
+			if p.index[key] == nil {
+				p.index[key] = make(map[common.Hash]*indexedNode)
+			}
+			if entry := p.index[key][n.hash]; entry != nil {
+				entry.refs++
+			} else {
+				p.index[key][n.hash] = &indexedNode{blob: n.blob, refs: 1}
+			}
+		}
+	}
+	p.layers[layer.root] = layer
+	p.size += layer.size
+}
+
+// removeLayer drops a layer from the tree and unindexes its nodes.
+func (p *pathDatabase) removeLayer(layer *pathLayer) {
+	for owner, nodes := range layer.nodes {
+		for path, n := range nodes {
+			if n.blob == nil {
+				continue
+			}
+			key := indexKey(owner, []byte(path))
+			if entry := p.index[key][n.hash]; entry != nil {
+				if entry.refs--; entry.refs == 0 {
+					delete(p.index[key], n.hash)
+					if len(p.index[key]) == 0 {
+						delete(p.index, key)
+					}
+				}
+			}
+		}
+	}
+	delete(p.layers, layer.root)
+	p.size -= layer.size
+}
+
+// reset drops all the in-memory layers and pending nodes.
+func (p *pathDatabase) reset() {
+	p.layers = make(map[common.Hash]*pathLayer)
+	p.index = make(map[string]map[common.Hash]*indexedNode)
+	p.pending = make(pathNodeSet)
+	p.size = 0
+}
+
+// Scheme returns the scheme the trie nodes are stored with on disk.
+func (db *Database) Scheme() string {
+	if db.path != nil {
+		return rawdb.PathScheme
+	}
+	return rawdb.HashScheme
+}
+
+// SetStateHistory sets the number of reverse diffs retained in the path scheme,
+// limiting how far back the persisted state can be reverted. Zero disables the
+// reverse diffs altogether.
+func (db *Database) SetStateHistory(history uint64) {
+	if db.path == nil {
+		return
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.path.history = history
+}
+
+// pathBlob retrieves the encoded trie node with the given owner, path and hash
+// in the path scheme, or nil if the node is unavailable.
+func (db *Database) pathBlob(owner common.Hash, path []byte, hash common.Hash) []byte {
+	// Retrieve the node from the clean cache if available
+	if db.cleans != nil {
+		if enc := db.cleans.Get(nil, hash[:]); enc != nil {
+			memcacheCleanHitMeter.Mark(1)
+			memcacheCleanReadMeter.Mark(int64(len(enc)))
+			return enc
+		}
+	}
+	// Retrieve the node from the pending set or any of the in-memory layers
+	db.lock.RLock()
+	if n := db.path.pending[owner][string(path)]; n != nil && n.hash == hash {
+		db.lock.RUnlock()
+		return n.blob
+	}
+	entry := db.path.index[indexKey(owner, path)][hash]
+	db.lock.RUnlock()
+
+	if entry != nil {
+		memcacheDirtyHitMeter.Mark(1)
+		memcacheDirtyReadMeter.Mark(int64(len(entry.blob)))
+		return entry.blob
+	}
+	memcacheDirtyMissMeter.Mark(1)
+
+	// Content unavailable in memory, attempt to retrieve from disk. The node at
+	// the path might belong to a different version of the state, so verify it.
+	var enc []byte
+	if owner == (common.Hash{}) {
+		enc = rawdb.ReadAccountTrieNode(db.diskdb, path)
+	} else {
+		enc = rawdb.ReadStorageTrieNode(db.diskdb, owner, path)
+	}
+	if len(enc) == 0 || crypto.Keccak256Hash(enc) != hash {
+		return nil
+	}
+	if db.cleans != nil {
+		db.cleans.Set(hash[:], enc)
+		memcacheCleanMissMeter.Mark(1)
+		memcacheCleanWriteMeter.Mark(int64(len(enc)))
+	}
+	return enc
+}
+
+// insertPath inserts a collapsed trie node into the pending node set of the path
+// scheme.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) insertPath(owner common.Hash, path []byte, hash common.Hash, n node) {
+	blob, err := rlp.EncodeToBytes(n)
+	if err != nil {
+		panic(err) // Can't happen, collapsed nodes are always encodable
+	}
+	if db.path.pending[owner] == nil {
+		db.path.pending[owner] = make(map[string]*pathNode)
+	}
+	db.path.pending[owner][string(path)] = &pathNode{hash: hash, blob: blob}
+}
+
+// deletePath marks the trie node with the given owner and path as deleted in the
+// pending node set of the path scheme.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) deletePath(owner common.Hash, path []byte) {
+	if db.path.pending[owner] == nil {
+		db.path.pending[owner] = make(map[string]*pathNode)
+	}
+	db.path.pending[owner][string(path)] = new(pathNode)
+}
+
+// Update seals all the trie nodes committed since the last update into a new
+// in-memory state layer with the given root, on top of its parent state. The
+// storage tries of the wiped accounts are deleted entirely. It's a noop in the
+// hash scheme.
+func (db *Database) Update(root, parent common.Hash, wipes map[common.Hash]struct{}) error {
+	if db.path == nil {
+		return nil
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	nodes := db.path.pending
+	db.path.pending = make(pathNodeSet)
+
+	if parent == (common.Hash{}) {
+		parent = emptyRoot
+	}
+	// Skip transitions which don't change the state or are already known
+	if root == parent || root == db.path.diskRoot {
+		return nil
+	}
+	if _, ok := db.path.layers[root]; ok {
+		return nil
+	}
+	var parentLayer *pathLayer
+	if parent != db.path.diskRoot {
+		if parentLayer = db.path.layers[parent]; parentLayer == nil {
+			return fmt.Errorf("parent state %x unavailable", parent)
+		}
+	}
+	layer := &pathLayer{
+		root:       root,
+		parentRoot: parent,
+		parent:     parentLayer,
+		nodes:      nodes,
+		wipes:      wipes,
+	}
+	for _, subset := range nodes {
+		for path, n := range subset {
+			layer.size += common.StorageSize(common.HashLength + len(path) + len(n.blob))
+		}
+	}
+	db.path.addLayer(layer)
+	return nil
+}
+
+// Flatten persists all the in-memory layers below the given state, keeping the
+// requested number of layers in memory. Layers not built on top of the newly
+// persisted state are discarded. It's a noop in the hash scheme.
+func (db *Database) Flatten(root common.Hash, layers int) error {
+	if db.path == nil {
+		return nil
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.flatten(root, layers)
+}
+
+// flatten is the private locked version of Flatten.
+func (db *Database) flatten(root common.Hash, layers int) error {
+	layer := db.path.layers[root]
+	if layer == nil {
+		if root == db.path.diskRoot {
+			return nil
+		}
+		return fmt.Errorf("state %x unavailable", root)
+	}
+	var chain []*pathLayer
+	for l := layer; l != nil; l = l.parent {
+		chain = append(chain, l)
+	}
+	if len(chain) <= layers {
+		return nil
+	}
+	start := time.Now()
+	for i := len(chain) - 1; i >= layers; i-- {
+		if err := db.persistLayer(chain[i]); err != nil {
+			return err
+		}
+		// Layers built on the flushed one now sit directly on disk
+		for _, l := range db.path.layers {
+			if l.parent == chain[i] {
+				l.parent = nil
+			}
+		}
+		db.path.removeLayer(chain[i])
+	}
+	// Discard all the layers not built on top of the new persisted state
+	alive := make(map[*pathLayer]bool)
+
+	var check func(l *pathLayer) bool
+	check = func(l *pathLayer) bool {
+		if res, ok := alive[l]; ok {
+			return res
+		}
+		var res bool
+		if l.parent == nil {
+			res = l.parentRoot == db.path.diskRoot
+		} else {
+			res = check(l.parent)
+		}
+		alive[l] = res
+		return res
+	}
+	for _, l := range db.path.layers {
+		if !check(l) {
+			db.path.removeLayer(l)
+		}
+	}
+	log.Debug("Persisted state layers", "count", len(chain)-layers, "root", db.path.diskRoot, "id", db.path.stateID, "layers", len(db.path.layers), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// persistLayer writes the trie node changes of a layer sitting directly on top
+// of the persisted state to disk, along with the reverse diff needed to undo it.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) persistLayer(layer *pathLayer) error {
+	var (
+		batch = db.diskdb.NewBatch()
+		diff  = &reverseDiff{Parent: db.path.diskRoot, Root: layer.root}
+	)
+	// Delete the storage tries of any wiped accounts first
+	for owner := range layer.wipes {
+		it := rawdb.IterateStorageTrieNodes(db.diskdb, owner)
+		for it.Next() {
+			path := common.CopyBytes(it.Key()[len(rawdb.TrieNodeStoragePrefix)+common.HashLength:])
+			diff.Nodes = append(diff.Nodes, reverseDiffNode{Owner: owner, Path: path, Blob: common.CopyBytes(it.Value())})
+			rawdb.DeleteStorageTrieNode(batch, owner, path)
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return err
+		}
+	}
+	// Overwrite all the changed trie nodes, tracking the original ones
+	for owner, nodes := range layer.nodes {
+		for path, n := range nodes {
+			if owner == (common.Hash{}) {
+				diff.Nodes = append(diff.Nodes, reverseDiffNode{Path: []byte(path), Blob: rawdb.ReadAccountTrieNode(db.diskdb, []byte(path))})
+				if n.blob == nil {
+					rawdb.DeleteAccountTrieNode(batch, []byte(path))
+				} else {
+					rawdb.WriteAccountTrieNode(batch, []byte(path), n.blob)
+				}
+			} else {
+				diff.Nodes = append(diff.Nodes, reverseDiffNode{Owner: owner, Path: []byte(path), Blob: rawdb.ReadStorageTrieNode(db.diskdb, owner, []byte(path))})
+				if n.blob == nil {
+					rawdb.DeleteStorageTrieNode(batch, owner, []byte(path))
+				} else {
+					rawdb.WriteStorageTrieNode(batch, owner, []byte(path), n.blob)
+				}
+			}
+		}
+	}
+	// Store the reverse diff and prune the ones beyond the retention limit
+	id := db.path.stateID + 1
+	if db.path.history > 0 {
+		enc, err := rlp.EncodeToBytes(diff)
+		if err != nil {
+			return err
+		}
+		rawdb.WriteReverseDiff(batch, id, enc)
+		rawdb.WriteStateID(batch, layer.root, id)
+
+		// The initial state was never flushed by a layer, track it explicitly
+		if db.path.stateID == 0 {
+			rawdb.WriteStateID(batch, diff.Parent, 0)
+		}
+	}
+	if id > db.path.history {
+		db.pruneReverseDiff(batch, id-db.path.history)
+	}
+	rawdb.WritePersistentStateID(batch, id)
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	db.path.diskRoot, db.path.stateID = layer.root, id
+	return nil
+}
+
+// pruneReverseDiff deletes the reverse diff with the given id, along with the id
+// mapping of the state it would revert to, which becomes unrecoverable.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) pruneReverseDiff(batch ethdb.KeyValueWriter, id uint64) {
+	blob := rawdb.ReadReverseDiff(db.diskdb, id)
+	if len(blob) == 0 {
+		return
+	}
+	var diff reverseDiff
+	if err := rlp.DecodeBytes(blob, &diff); err == nil {
+		if prev := rawdb.ReadStateID(db.diskdb, diff.Parent); prev != nil && *prev == id-1 {
+			rawdb.DeleteStateID(batch, diff.Parent)
+		}
+	}
+	rawdb.DeleteReverseDiff(batch, id)
+}
+
+// Recoverable returns whether the persisted state can be reverted to the state
+// with the given root. It's always false in the hash scheme.
+func (db *Database) Recoverable(root common.Hash) bool {
+	if db.path == nil {
+		return false
+	}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.recoverable(root)
+}
+
+// recoverable is the private locked version of Recoverable.
+func (db *Database) recoverable(root common.Hash) bool {
+	if root == db.path.diskRoot {
+		return true
+	}
+	id := rawdb.ReadStateID(db.diskdb, root)
+	if id == nil || *id >= db.path.stateID || db.path.stateID-*id > db.path.history {
+		return false
+	}
+	return len(rawdb.ReadReverseDiff(db.diskdb, *id+1)) > 0
+}
+
+// Recover reverts the persisted state to the one with the given root by applying
+// the reverse diffs, discarding all the in-memory layers.
+func (db *Database) Recover(root common.Hash) error {
+	if db.path == nil {
+		return errStateUnrecoverable
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.recoverable(root) {
+		return errStateUnrecoverable
+	}
+	db.path.reset()
+
+	start, reverted := time.Now(), 0
+	for db.path.diskRoot != root {
+		var diff reverseDiff
+		if err := rlp.DecodeBytes(rawdb.ReadReverseDiff(db.diskdb, db.path.stateID), &diff); err != nil {
+			return err
+		}
+		if diff.Root != db.path.diskRoot {
+			return fmt.Errorf("reverse diff %d root mismatch: have %x, want %x", db.path.stateID, diff.Root, db.path.diskRoot)
+		}
+		batch := db.diskdb.NewBatch()
+		for i := len(diff.Nodes) - 1; i >= 0; i-- {
+			n := diff.Nodes[i]
+			switch {
+			case n.Owner == (common.Hash{}) && len(n.Blob) == 0:
+				rawdb.DeleteAccountTrieNode(batch, n.Path)
+			case n.Owner == (common.Hash{}):
+				rawdb.WriteAccountTrieNode(batch, n.Path, n.Blob)
+			case len(n.Blob) == 0:
+				rawdb.DeleteStorageTrieNode(batch, n.Owner, n.Path)
+			default:
+				rawdb.WriteStorageTrieNode(batch, n.Owner, n.Path, n.Blob)
+			}
+		}
+		if id := rawdb.ReadStateID(db.diskdb, diff.Root); id != nil && *id == db.path.stateID {
+			rawdb.DeleteStateID(batch, diff.Root)
+		}
+		rawdb.DeleteReverseDiff(batch, db.path.stateID)
+		rawdb.WritePersistentStateID(batch, db.path.stateID-1)
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		db.path.diskRoot, db.path.stateID = diff.Parent, db.path.stateID-1
+		reverted++
+	}
+	log.Info("Reverted persisted state", "root", root, "id", db.path.stateID, "diffs", reverted, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
@@ -0,0 +1,259 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+// newPathTestDatabase creates an empty trie database using the path scheme.
+func newPathTestDatabase() (ethdb.KeyValueStore, *Database) {
+	diskdb := memorydb.New()
+	rawdb.WriteStateScheme(diskdb, rawdb.PathScheme)
+	return diskdb, NewDatabase(diskdb)
+}
+
+// commitPathState applies a set of changes on top of a state and seals the
+// result into a new state layer.
+func commitPathState(t *testing.T, db *Database, parent common.Hash, content map[string]string, changes map[string]string) common.Hash {
+	t.Helper()
+
+	tr, err := New(parent, db)
+	if err != nil {
+		t.Fatalf("failed to open parent state %x: %v", parent, err)
+	}
+	for key, val := range changes {
+		if val == "" {
+			if err := tr.TryDelete([]byte(key)); err != nil {
+				t.Fatalf("failed to delete %x: %v", key, err)
+			}
+			delete(content, key)
+		} else {
+			if err := tr.TryUpdate([]byte(key), []byte(val)); err != nil {
+				t.Fatalf("failed to update %x: %v", key, err)
+			}
+			content[key] = val
+		}
+	}
+	root, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	if err := db.Update(root, parent, nil); err != nil {
+		t.Fatalf("failed to update state layers: %v", err)
+	}
+	return root
+}
+
+// checkPathState ensures a state is fully readable and matches the expected
+// content.
+func checkPathState(t *testing.T, db *Database, root common.Hash, content map[string]string) {
+	t.Helper()
+
+	tr, err := New(root, db)
+	if err != nil {
+		t.Fatalf("failed to open state %x: %v", root, err)
+	}
+	count := 0
+	it := NewIterator(tr.NodeIterator(nil))
+	for it.Next() {
+		if want := content[string(it.Key)]; want != string(it.Value) {
+			t.Fatalf("state %x: value mismatch for %q: have %q, want %q", root, it.Key, it.Value, want)
+		}
+		count++
+	}
+	if it.Err != nil {
+		t.Fatalf("state %x: iteration failed: %v", root, it.Err)
+	}
+	if count != len(content) {
+		t.Fatalf("state %x: item count mismatch: have %d, want %d", root, count, len(content))
+	}
+}
+
+// randomPathChanges generates a set of random changes on top of the given
+// content, deleting some of the existing items.
+func randomPathChanges(content map[string]string, inserts, deletes int) map[string]string {
+	changes := make(map[string]string)
+	for i := 0; i < inserts; i++ {
+		changes[string(randBytes(8))] = string(randBytes(32))
+	}
+	for key := range content {
+		if deletes == 0 {
+			break
+		}
+		changes[key] = ""
+		deletes--
+	}
+	return changes
+}
+
+func copyPathContent(content map[string]string) map[string]string {
+	cpy := make(map[string]string, len(content))
+	for key, val := range content {
+		cpy[key] = val
+	}
+	return cpy
+}
+
+// Tests that state layers are readable both from memory and after being
+// persisted, and that persisted states can be reverted via reverse diffs.
+func TestPathDatabaseLayers(t *testing.T) {
+	diskdb, db := newPathTestDatabase()
+	if db.Scheme() != rawdb.PathScheme {
+		t.Fatalf("scheme mismatch: have %s, want %s", db.Scheme(), rawdb.PathScheme)
+	}
+	var (
+		roots    = []common.Hash{emptyRoot}
+		contents = []map[string]string{{}}
+		content  = make(map[string]string)
+	)
+	for i := 0; i < 8; i++ {
+		root := commitPathState(t, db, roots[len(roots)-1], content, randomPathChanges(content, 200, 50))
+		roots = append(roots, root)
+		contents = append(contents, copyPathContent(content))
+	}
+	// All the states should be readable from memory
+	for i, root := range roots {
+		checkPathState(t, db, root, contents[i])
+	}
+	// Persist the bottom half of the layers, the rest needs to remain readable
+	if err := db.Flatten(roots[len(roots)-1], 4); err != nil {
+		t.Fatalf("failed to flatten layers: %v", err)
+	}
+	if id := rawdb.ReadPersistentStateID(diskdb); id != 4 {
+		t.Fatalf("persistent state id mismatch: have %d, want 4", id)
+	}
+	for i := 4; i < len(roots); i++ {
+		checkPathState(t, db, roots[i], contents[i])
+	}
+	if _, err := New(roots[3], db); err == nil {
+		t.Fatalf("overwritten state %x still readable", roots[3])
+	}
+	// Persist everything and ensure the state survives a restart
+	if err := db.Commit(roots[len(roots)-1], false, nil); err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	db = NewDatabase(diskdb)
+	checkPathState(t, db, roots[len(roots)-1], contents[len(contents)-1])
+
+	// Revert the persisted state step by step
+	for i := len(roots) - 2; i >= 0; i-- {
+		if !db.Recoverable(roots[i]) {
+			t.Fatalf("state %d not recoverable", i)
+		}
+		if err := db.Recover(roots[i]); err != nil {
+			t.Fatalf("failed to recover state %d: %v", i, err)
+		}
+		checkPathState(t, db, roots[i], contents[i])
+		if db.Recoverable(roots[i+1]) {
+			t.Fatalf("reverted state %d still recoverable", i+1)
+		}
+	}
+	// Reverting to the empty state should leave no trie nodes behind
+	it := diskdb.NewIterator(rawdb.TrieNodeAccountPrefix, nil)
+	defer it.Release()
+	if it.Next() {
+		t.Fatalf("dangling trie node after full revert: %x", it.Key())
+	}
+}
+
+// Tests that nodes removed from the trie are deleted from disk, keeping only the
+// nodes of the latest state persisted.
+func TestPathDatabaseDeletion(t *testing.T) {
+	diskdb, db := newPathTestDatabase()
+
+	var (
+		root    = emptyRoot
+		content = make(map[string]string)
+	)
+	for i := 0; i < 10; i++ {
+		root = commitPathState(t, db, root, content, randomPathChanges(content, 100, 80))
+		if err := db.Commit(root, false, nil); err != nil {
+			t.Fatalf("failed to commit state: %v", err)
+		}
+	}
+	checkPathState(t, db, root, content)
+
+	// Count the nodes stored separately in the latest state
+	tr, _ := New(root, db)
+	live := make(map[string]common.Hash)
+	for it := tr.NodeIterator(nil); it.Next(true); {
+		if it.Hash() != (common.Hash{}) {
+			live[string(it.Path())] = it.Hash()
+		}
+	}
+	if it := tr.NodeIterator(nil); it.Error() != nil {
+		t.Fatalf("failed to iterate state: %v", it.Error())
+	}
+	// Ensure the disk contains exactly the live nodes
+	it := diskdb.NewIterator(rawdb.TrieNodeAccountPrefix, nil)
+	defer it.Release()
+
+	stored := 0
+	for it.Next() {
+		path := it.Key()[len(rawdb.TrieNodeAccountPrefix):]
+		hash, ok := live[string(path)]
+		if !ok {
+			t.Fatalf("stale trie node on disk at path %x", path)
+		}
+		if !bytes.Equal(crypto.Keccak256(it.Value()), hash[:]) {
+			t.Fatalf("trie node mismatch at path %x", path)
+		}
+		stored++
+	}
+	if stored != len(live) {
+		t.Fatalf("stored node count mismatch: have %d, want %d", stored, len(live))
+	}
+}
+
+// Tests that the reverse diffs beyond the configured history are pruned.
+func TestPathDatabaseHistory(t *testing.T) {
+	diskdb, db := newPathTestDatabase()
+	db.SetStateHistory(3)
+
+	var (
+		roots   = []common.Hash{emptyRoot}
+		content = make(map[string]string)
+	)
+	for i := 0; i < 6; i++ {
+		root := commitPathState(t, db, roots[len(roots)-1], content, randomPathChanges(content, 50, 10))
+		if err := db.Commit(root, false, nil); err != nil {
+			t.Fatalf("failed to commit state: %v", err)
+		}
+		roots = append(roots, root)
+	}
+	for i := uint64(1); i <= 6; i++ {
+		if have, want := len(rawdb.ReadReverseDiff(diskdb, i)) > 0, i > 3; have != want {
+			t.Errorf("reverse diff %d presence mismatch: have %v, want %v", i, have, want)
+		}
+	}
+	for i, root := range roots {
+		if have, want := db.Recoverable(root), i >= 3; have != want {
+			t.Errorf("state %d recoverability mismatch: have %v, want %v", i, have, want)
+		}
+	}
+	if err := db.Recover(roots[2]); err != errStateUnrecoverable {
+		t.Fatalf("pruned state recovery error mismatch: have %v, want %v", err, errStateUnrecoverable)
+	}
+}
@@ -52,10 +52,16 @@ type SecureTrie struct {
 // A new cache generation is created by each call to Commit.
 // cachelimit sets the number of past cache generations to keep.
 func NewSecure(root common.Hash, db *Database) (*SecureTrie, error) {
+	return NewSecureWithOwner(common.Hash{}, root, db)
+}
+
+// NewSecureWithOwner creates a secure trie owned by the account with the given
+// hash. See NewWithOwner for the meaning of the owner.
+func NewSecureWithOwner(owner common.Hash, root common.Hash, db *Database) (*SecureTrie, error) {
 	if db == nil {
 		panic("trie.NewSecure called without a database")
 	}
-	trie, err := New(root, db)
+	trie, err := NewWithOwner(owner, root, db)
 	if err != nil {
 		return nil, err
 	}
@@ -168,6 +174,12 @@ func (t *SecureTrie) Hash() common.Hash {
 // Copy returns a copy of SecureTrie.
 func (t *SecureTrie) Copy() *SecureTrie {
 	cpy := *t
+	if t.trie.deleted != nil {
+		cpy.trie.deleted = make(map[string]struct{}, len(t.trie.deleted))
+		for path := range t.trie.deleted {
+			cpy.trie.deleted[path] = struct{}{}
+		}
+	}
 	return &cpy
 }
 
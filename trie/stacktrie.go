@@ -32,7 +32,7 @@ var stPool = sync.Pool{
 	},
 }
 
-func stackTrieFromPool(db ethdb.KeyValueStore) *StackTrie {
+func stackTrieFromPool(db ethdb.KeyValueWriter) *StackTrie {
 	st := stPool.Get().(*StackTrie)
 	st.db = db
 	return st
@@ -53,18 +53,18 @@ type StackTrie struct {
 	keyOffset int            // offset of the key chunk inside a full key
 	children  [16]*StackTrie // list of children (for fullnodes and exts)
 
-	db ethdb.KeyValueStore // Pointer to the commit db, can be nil
+	db ethdb.KeyValueWriter // Pointer to the commit db, can be nil
 }
 
 // NewStackTrie allocates and initializes an empty trie.
-func NewStackTrie(db ethdb.KeyValueStore) *StackTrie {
+func NewStackTrie(db ethdb.KeyValueWriter) *StackTrie {
 	return &StackTrie{
 		nodeType: emptyNode,
 		db:       db,
 	}
 }
 
-func newLeaf(ko int, key, val []byte, db ethdb.KeyValueStore) *StackTrie {
+func newLeaf(ko int, key, val []byte, db ethdb.KeyValueWriter) *StackTrie {
 	st := stackTrieFromPool(db)
 	st.nodeType = leafNode
 	st.keyOffset = ko
@@ -73,7 +73,7 @@ func newLeaf(ko int, key, val []byte, db ethdb.KeyValueStore) *StackTrie {
 	return st
 }
 
-func newExt(ko int, key []byte, child *StackTrie, db ethdb.KeyValueStore) *StackTrie {
+func newExt(ko int, key []byte, child *StackTrie, db ethdb.KeyValueWriter) *StackTrie {
 	st := stackTrieFromPool(db)
 	st.nodeType = extNode
 	st.keyOffset = ko
@@ -392,13 +392,26 @@ func (st *StackTrie) Hash() (h common.Hash) {
 }
 
 // Commit will commit the current node to database db
-func (st *StackTrie) Commit(db ethdb.KeyValueStore) common.Hash {
+func (st *StackTrie) Commit(db ethdb.KeyValueWriter) common.Hash {
 	oldDb := st.db
 	st.db = db
 	defer func() {
 		st.db = oldDb
 	}()
 	st.hash()
-	h := common.BytesToHash(st.val)
-	return h
+	if len(st.val) != 32 {
+		// If the root node is too small to be hashed on its own, it was not
+		// written out during hashing. Force hash it and persist it here.
+		h := newHasher(false)
+		defer returnHasherToPool(h)
+		ret := make([]byte, 32)
+		h.sha.Reset()
+		h.sha.Write(st.val)
+		h.sha.Read(ret)
+		if db != nil {
+			db.Put(ret, st.val)
+		}
+		return common.BytesToHash(ret)
+	}
+	return common.BytesToHash(st.val)
 }
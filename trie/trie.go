@@ -47,8 +47,14 @@ type LeafCallback func(path []byte, leaf []byte, parent common.Hash) error
 //
 // Trie is not safe for concurrent use.
 type Trie struct {
-	db   *Database
-	root node
+	db    *Database
+	root  node
+	owner common.Hash // Account owning the trie in the path scheme, zero for the account trie
+
+	// Keep track of the paths of the nodes removed from the trie since the last
+	// commit. It's only used by the path scheme to delete stale nodes from disk.
+	deleted map[string]struct{}
+
 	// Keep track of the number leafs which have been inserted since the last
 	// hashing operation. This number will not directly map to the number of
 	// actually unhashed nodes
@@ -67,11 +73,20 @@ func (t *Trie) newFlag() nodeFlag {
 // New will panic if db is nil and returns a MissingNodeError if root does
 // not exist in the database. Accessing the trie loads nodes from db on demand.
 func New(root common.Hash, db *Database) (*Trie, error) {
+	return NewWithOwner(common.Hash{}, root, db)
+}
+
+// NewWithOwner creates a trie with an existing root node from db, owned by the
+// account with the given hash. The owner is the zero hash for the account trie
+// and is only relevant for databases using the path scheme, where the nodes of
+// different storage tries live in separate namespaces.
+func NewWithOwner(owner common.Hash, root common.Hash, db *Database) (*Trie, error) {
 	if db == nil {
 		panic("trie.New called without a database")
 	}
 	trie := &Trie{
-		db: db,
+		db:    db,
+		owner: owner,
 	}
 	if root != (common.Hash{}) && root != emptyRoot {
 		rootnode, err := trie.resolveHash(root[:], nil)
@@ -365,6 +380,7 @@ func (t *Trie) delete(n node, prefix, key []byte) (bool, node, error) {
 			return false, n, nil // don't replace n on mismatch
 		}
 		if matchlen == len(key) {
+			t.trackDeletion(prefix)
 			return true, nil, nil // remove n entirely for whole matches
 		}
 		// The key is longer than n.Key. Remove the remaining suffix
@@ -383,6 +399,7 @@ func (t *Trie) delete(n node, prefix, key []byte) (bool, node, error) {
 			// always creates a new slice) instead of append to
 			// avoid modifying n.Key since it might be shared with
 			// other nodes.
+			t.trackDeletion(concat(prefix, n.Key...))
 			return true, &shortNode{concat(n.Key, child.Key...), child.Val, t.newFlag()}, nil
 		default:
 			return true, &shortNode{n.Key, child, t.newFlag()}, nil
@@ -425,11 +442,12 @@ func (t *Trie) delete(n node, prefix, key []byte) (bool, node, error) {
 				// shortNode{..., shortNode{...}}.  Since the entry
 				// might not be loaded yet, resolve it just for this
 				// check.
-				cnode, err := t.resolve(n.Children[pos], prefix)
+				cnode, err := t.resolve(n.Children[pos], concat(prefix, byte(pos)))
 				if err != nil {
 					return false, nil, err
 				}
 				if cnode, ok := cnode.(*shortNode); ok {
+					t.trackDeletion(concat(prefix, byte(pos)))
 					k := append([]byte{byte(pos)}, cnode.Key...)
 					return true, &shortNode{k, cnode.Val, t.newFlag()}, nil
 				}
@@ -482,12 +500,30 @@ func (t *Trie) resolve(n node, prefix []byte) (node, error) {
 
 func (t *Trie) resolveHash(n hashNode, prefix []byte) (node, error) {
 	hash := common.BytesToHash(n)
+	if t.db.path != nil {
+		if enc := t.db.pathBlob(t.owner, prefix, hash); enc != nil {
+			return mustDecodeNode(hash[:], enc), nil
+		}
+		return nil, &MissingNodeError{NodeHash: hash, Path: prefix}
+	}
 	if node := t.db.node(hash); node != nil {
 		return node, nil
 	}
 	return nil, &MissingNodeError{NodeHash: hash, Path: prefix}
 }
 
+// trackDeletion records the path of a node removed from the trie, so that its
+// stale copy can be deleted from disk on commit in the path scheme.
+func (t *Trie) trackDeletion(path []byte) {
+	if t.db == nil || t.db.path == nil {
+		return
+	}
+	if t.deleted == nil {
+		t.deleted = make(map[string]struct{})
+	}
+	t.deleted[string(path)] = struct{}{}
+}
+
 // Hash returns the root hash of the trie. It does not write to the
 // database and can be used even if the trie doesn't have one.
 func (t *Trie) Hash() common.Hash {
@@ -502,6 +538,16 @@ func (t *Trie) Commit(onleaf LeafCallback) (root common.Hash, err error) {
 	if t.db == nil {
 		panic("commit called on trie with nil database")
 	}
+	// Flush the paths of the removed nodes first, any nodes reinserted at the
+	// same paths will be overwritten by the committer afterwards.
+	if len(t.deleted) > 0 {
+		t.db.lock.Lock()
+		for path := range t.deleted {
+			t.db.deletePath(t.owner, []byte(path))
+		}
+		t.db.lock.Unlock()
+		t.deleted = nil
+	}
 	if t.root == nil {
 		return emptyRoot, nil
 	}
@@ -509,6 +555,7 @@ func (t *Trie) Commit(onleaf LeafCallback) (root common.Hash, err error) {
 	// in the following procedure that all nodes are hashed.
 	rootHash := t.Hash()
 	h := newCommitter()
+	h.owner = t.owner
 	defer returnCommitterToPool(h)
 
 	// Do a quick check if we really need to commit, before we spin
@@ -561,4 +608,5 @@ func (t *Trie) hashRoot(db *Database) (node, node, error) {
 func (t *Trie) Reset() {
 	t.root = nil
 	t.unhashed = 0
+	t.deleted = nil
 }